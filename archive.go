@@ -0,0 +1,172 @@
+package rpm
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+)
+
+/*
+Writes the decompressed payload of the package to w as a cpio archive, like
+rpm2cpio does.
+
+Packages with files of 4GB or more have a payload in rpm's "stripped" cpio
+format, which cpio cannot read; as with rpm2cpio, these are refused, and
+should be converted with WriteTar instead.
+*/
+func (p *Package) WriteCPIO(w io.Writer) error {
+	rc, err := p.DecompressedPayload()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	br := bufio.NewReader(rc)
+	if magic, err := br.Peek(len(cpioStrippedMagic)); err == nil && string(magic) == cpioStrippedMagic {
+		return fmt.Errorf("payload has files over 4GB, which cpio does not support")
+	}
+
+	_, err = io.Copy(w, br)
+	return err
+}
+
+/*
+Writes the contents of the package to w as a tar archive, optionally gzipped,
+like rpm2archive does. File modes, owners, modification times, symlinks, hard
+links and device nodes are preserved; members are named "./path".
+*/
+func (p *Package) WriteTar(w io.Writer, compress bool) error {
+	pr, err := p.Payload()
+	if err != nil {
+		return err
+	}
+	defer pr.Close()
+
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+
+	// The members of a set of hard links carry no content, except for the
+	// one written last; the others are held back until it has been
+	// written, and then added as links to it.
+	pending := make(map[[2]uint32][]*tar.Header)
+
+	for {
+		pf, err := pr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		hdr := tarHeader(pf)
+		if hdr.Typeflag == tar.TypeSymlink {
+			// The target of a symlink is its content.
+			target, err := io.ReadAll(io.LimitReader(pr, 4096))
+			if err != nil {
+				return err
+			}
+			if len(target) > 0 {
+				hdr.Linkname = string(target)
+			}
+		}
+
+		key, linked := hardLinkKey(pf)
+		if linked && pf.Size == 0 && hdr.Typeflag == tar.TypeReg {
+			pending[key] = append(pending[key], hdr)
+			continue
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := io.CopyN(tw, pr, hdr.Size); err != nil {
+				return err
+			}
+		}
+
+		if linked {
+			for _, link := range pending[key] {
+				link.Typeflag, link.Linkname, link.Size = tar.TypeLink, hdr.Name, 0
+				if err := tw.WriteHeader(link); err != nil {
+					return err
+				}
+			}
+			delete(pending, key)
+		}
+	}
+
+	// Links whose content never came are written as empty files.
+	for _, links := range pending {
+		for _, link := range links {
+			if err := tw.WriteHeader(link); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if zw != nil {
+		return zw.Close()
+	}
+	return nil
+}
+
+/*
+Returns the key identifying the set of hard links a file belongs to, and
+whether it belongs to one at all.
+*/
+func hardLinkKey(pf *PayloadFile) ([2]uint32, bool) {
+	if pf.CPIO.Index < 0 {
+		return [2]uint32{pf.CPIO.DevMajor<<20 | pf.CPIO.DevMinor, pf.CPIO.Inode}, pf.NLink > 1
+	}
+	// Stripped archives have nothing but the package header to go by.
+	return [2]uint32{pf.File.Device, pf.File.Inode}, pf.NLink > 1
+}
+
+func tarHeader(pf *PayloadFile) *tar.Header {
+	f := pf.File
+	hdr := &tar.Header{
+		Name:    "." + f.Name,
+		Mode:    int64(f.Mode & 07777),
+		Uid:     int(pf.CPIO.UID),
+		Gid:     int(pf.CPIO.GID),
+		Uname:   f.Owner,
+		Gname:   f.Group,
+		ModTime: f.ModTime,
+	}
+	if hdr.ModTime.IsZero() {
+		hdr.ModTime = time.Unix(0, 0)
+	}
+
+	major, minor := int64(pf.CPIO.RDevMajor), int64(pf.CPIO.RDevMinor)
+	if pf.CPIO.Index >= 0 {
+		major, minor = int64(f.Rdev>>8), int64(f.Rdev&0xff)
+	}
+
+	switch uint32(f.Mode) & modeTypeMask {
+	case modeDir:
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case modeSymlink:
+		hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, f.LinkTo
+	case modeChar:
+		hdr.Typeflag, hdr.Devmajor, hdr.Devminor = tar.TypeChar, major, minor
+	case modeBlock:
+		hdr.Typeflag, hdr.Devmajor, hdr.Devminor = tar.TypeBlock, major, minor
+	case modeFIFO:
+		hdr.Typeflag = tar.TypeFifo
+	default:
+		hdr.Typeflag, hdr.Size = tar.TypeReg, pf.Size
+	}
+	return hdr
+}
@@ -0,0 +1,79 @@
+package rpm
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+var testArchive = buildCPIO(
+	testMember{name: "./usr/bin", mode: 040755, ino: 1, nlink: 2},
+	testMember{name: "./usr/bin/go", mode: 0100755, ino: 2, nlink: 1, content: "#!/bin/sh\n"},
+	testMember{name: "./usr/bin/gofmt", mode: 0120777, ino: 3, nlink: 1, content: "go"},
+	testMember{name: "./usr/bin/a", mode: 0100644, ino: 4, nlink: 2},
+	testMember{name: "./usr/bin/b", mode: 0100644, ino: 4, nlink: 2, content: "ab\n"},
+)
+
+func TestWriteCPIO(t *testing.T) {
+	pkg, err := ReadPackage(bytes.NewReader(buildPackage(buildHeader(testInt32(SigTagSize, 0)), buildHeader(testFilesHeader...), compress(t, "gzip", testArchive))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := pkg.WriteCPIO(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), testArchive) {
+		t.Errorf("WriteCPIO did not reproduce the payload; got %q wanted %q", b.Bytes(), testArchive)
+	}
+
+	stripped := buildCPIO(testMember{index: 1})
+	pkg, err = ReadPackage(bytes.NewReader(buildPackage(buildHeader(testInt32(SigTagSize, 0)), buildHeader(testFilesHeader...), compress(t, "gzip", stripped))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pkg.WriteCPIO(ioutil.Discard); err == nil {
+		t.Errorf("expected an error converting a stripped payload to cpio")
+	}
+}
+
+func TestWriteTar(t *testing.T) {
+	hdr := append([]testEntry{
+		testString(TagPayloadCompressor, "xz"),
+		testStrings(TagFileUserName, TypeStringArray, "root", "root", "root", "root", "root"),
+		testStrings(TagFileGroupName, TypeStringArray, "root", "root", "root", "wheel", "wheel"),
+		testInt32(TagFileMTimes, 1354838400, 1354838400, 1354838400, 1354838400, 1354838400),
+	}, testFilesHeader...)
+	pkg, err := ReadPackage(bytes.NewReader(buildPackage(buildHeader(testInt32(SigTagSize, 0)), buildHeader(hdr...), compress(t, "xz", testArchive))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := pkg.WriteTar(&b, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	tr := tar.NewReader(&b)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(tr)
+		got = append(got, fmt.Sprintf("%c %s %o %s:%s %d %s %q", h.Typeflag, h.Name, h.Mode, h.Uname, h.Gname, h.ModTime.Unix(), h.Linkname, content))
+	}
+
+	expected := `[5 ./usr/bin/ 755 root:root 1354838400  "" 0 ./usr/bin/go 755 root:root 1354838400  "#!/bin/sh\n" 2 ./usr/bin/gofmt 777 root:root 1354838400 go "" 0 ./usr/bin/b 644 root:wheel 1354838400  "ab\n" 1 ./usr/bin/a 644 root:wheel 1354838400 ./usr/bin/b ""]`
+	t.Logf("expecting %q", expected)
+	if s := fmt.Sprint(got); s != expected {
+		t.Errorf("failed to convert package to tar; got %q wanted %q", s, expected)
+	}
+}
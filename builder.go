@@ -0,0 +1,897 @@
+package rpm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nesv/rpm/spec"
+	"github.com/ulikunitz/xz"
+)
+
+// The version of rpm written to the RPMVERSION tag of built packages; it is
+// the oldest version that understands everything a Builder writes.
+const builderRPMVersion = "4.14.0"
+
+// The size of the RESERVEDSPACE tag in the signature header of built
+// packages, which leaves room for signatures to be added in place.
+const reservedSpace = 4128
+
+// The PGP hash algorithm id of SHA256, used for file and payload digests.
+const digestAlgoSHA256 = 8
+
+/*
+The compressors a Builder can write payloads with, along with the value of
+the PAYLOADFLAGS tag (the compression level) for each.
+*/
+var compressors = map[string]struct {
+	flags string
+	new   func(io.Writer) (io.WriteCloser, error)
+}{
+	"gzip": {"9", func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, gzip.BestCompression)
+	}},
+	"xz": {"6", func(w io.Writer) (io.WriteCloser, error) {
+		return xz.NewWriter(w)
+	}},
+	"zstd": {"3", func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	}},
+}
+
+/*
+The scriptlets a Builder can add to a package, by the name of their spec file
+section, with their header tags and the sense flags of the dependency on
+their interpreter.
+*/
+var scriptletTags = map[string]struct {
+	script, prog Tag
+	flags        spec.DependencyFlags
+}{
+	"pre":          {TagPreIn, TagPreInProg, spec.DepScriptPre},
+	"post":         {TagPostIn, TagPostInProg, spec.DepScriptPost},
+	"preun":        {TagPreUn, TagPreUnProg, spec.DepScriptPreun},
+	"postun":       {TagPostUn, TagPostUnProg, spec.DepScriptPostun},
+	"pretrans":     {TagPreTrans, TagPreTransProg, spec.DepPreTrans},
+	"posttrans":    {TagPostTrans, TagPostTransProg, spec.DepPostTrans},
+	"verifyscript": {TagVerifyScript, TagVerifyScriptProg, spec.DepScriptVerify},
+}
+
+// The architecture numbers rpm writes to the lead.
+var leadArchNums = map[string]uint16{
+	"i386": 1, "i486": 1, "i586": 1, "i686": 1, "athlon": 1, "x86_64": 1,
+	"alpha": 2, "sparc": 3, "sparc64": 3, "mips": 4, "ppc": 5, "m68k": 6,
+	"ia64": 9, "mips64": 11, "armv7hl": 12, "armv7l": 12, "s390": 14,
+	"s390x": 15, "ppc64": 16, "ppc64le": 16, "aarch64": 19, "riscv64": 22,
+}
+
+/*
+A BuildFile is a file to be added to a package by a Builder.
+*/
+type BuildFile struct {
+	// Name is the absolute path of the file once installed.
+	Name string
+
+	// Mode holds the permissions and type of the file; a Mode without
+	// type bits is a regular file.
+	Mode    fs.FileMode
+	ModTime time.Time
+
+	// Owner and Group default to "root".
+	Owner string
+	Group string
+
+	Flags FileFlags
+
+	// NoVerify holds the RPMVERIFY_* bits of the checks "rpm -V" should
+	// skip for the file, as set with %verify(not ...).
+	NoVerify uint32
+
+	// LinkTo is the target of a symlink, and Rdev the device number of
+	// a device node.
+	LinkTo string
+	Rdev   uint16
+
+	Lang string
+	Caps string
+
+	// The content of a regular file is either held in Data, or read from
+	// the file at Path when the package is written.
+	Data []byte
+	Path string
+}
+
+/*
+A Builder writes binary RPM packages. The package metadata comes from a
+spec.Package, as obtained by evaluating a spec file, or filled in by hand.
+*/
+type Builder struct {
+	Package *spec.Package
+	Files   []BuildFile
+
+	// Scriptlets are keyed by the name of their section: "pre", "post",
+	// "preun", "postun", "pretrans", "posttrans" or "verifyscript".
+	Scriptlets map[string]spec.Scriptlet
+
+	// Changelog holds the changelog entries, newest first.
+	Changelog []spec.ChangelogEntry
+
+	// Compressor is the payload compression: "gzip" (the default), "xz"
+	// or "zstd".
+	Compressor string
+
+	// FileAttrs generate dependencies from the files of the package, as
+	// rpmbuild's file attributes do: what they find is added to the
+	// Provides and Requires of the Package, unless it has NoAutoProv or
+	// NoAutoReq set. Set it to DefaultFileAttrs for rpm's generators.
+	FileAttrs []FileAttr
+
+	// BuildTime defaults to the current time, and BuildHost to the name
+	// of the host.
+	BuildTime time.Time
+	BuildHost string
+
+	// SourceDateEpoch makes the package reproducible, as rpm's
+	// %source_date_epoch does: BuildTime then defaults to it, BuildHost
+	// to "reproducible", and file modification times later than it are
+	// clamped to it. It defaults to the time given by the
+	// SOURCE_DATE_EPOCH environment variable.
+	SourceDateEpoch time.Time
+
+	// SourceRPM is the name of the source package the package is built
+	// from, which defaults to "name-version-release.src.rpm".
+	SourceRPM string
+
+	// OS defaults to "linux".
+	OS string
+
+	// Set for source packages, whose files have no directory, and extra
+	// tags for the header.
+	source bool
+	extra  []Entry
+}
+
+/*
+Returns a Builder for the package described by pkg, with no files.
+*/
+func NewBuilder(pkg *spec.Package) *Builder {
+	return &Builder{Package: pkg, Scriptlets: make(map[string]spec.Scriptlet)}
+}
+
+/*
+Adds the files in the directory tree at dir to the package, installed under
+prefix (which would be "/" for a buildroot). Modes, modification times and
+symlinks are taken from the tree; files are owned by root. The content of
+regular files is read when the package is written.
+*/
+func (b *Builder) AddTree(dir, prefix string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." && path.Clean(prefix) == "/" {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f := BuildFile{
+			Name:    path.Join("/", prefix, filepath.ToSlash(rel)),
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+		}
+		switch {
+		case info.Mode().IsRegular():
+			f.Path = p
+		case info.Mode()&fs.ModeSymlink != 0:
+			if f.LinkTo, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		b.Files = append(b.Files, f)
+		return nil
+	})
+}
+
+// builtFile is a file of a package being written, with what is recorded
+// for it in the header.
+type builtFile struct {
+	*BuildFile
+	mode   uint32
+	size   int64
+	mtime  time.Time
+	digest string
+}
+
+/*
+Writes the package to w: the lead, a signature header holding the size and
+digests of the header and payload, the main header, and the payload, which is
+a cpio archive of the files.
+
+The payload is compressed in memory before anything is written, since the
+headers hold its digests.
+*/
+func (b *Builder) Write(w io.Writer) error {
+	pkg := b.Package
+	if pkg == nil || pkg.Name == "" || pkg.Version == "" || pkg.Release == "" {
+		return fmt.Errorf("package name, version and release are required")
+	}
+	compressor := b.Compressor
+	if compressor == "" {
+		compressor = "gzip"
+	}
+	compress, ok := compressors[compressor]
+	if !ok {
+		return fmt.Errorf("unsupported payload compressor %q", compressor)
+	}
+
+	epoch := b.SourceDateEpoch
+	if epoch.IsZero() {
+		var err error
+		if epoch, err = sourceDateEpoch(); err != nil {
+			return err
+		}
+	}
+	buildTime := b.BuildTime
+	switch {
+	case buildTime.IsZero() && !epoch.IsZero():
+		buildTime = epoch
+	case buildTime.IsZero():
+		buildTime = time.Now()
+	}
+	files, err := b.files(buildTime, epoch)
+	if err != nil {
+		return err
+	}
+
+	// Files of 4GB or more need the stripped cpio format.
+	large := false
+	for _, f := range files {
+		large = large || f.size > math.MaxUint32
+	}
+
+	var payload bytes.Buffer
+	zw, err := compress.new(&payload)
+	if err != nil {
+		return err
+	}
+	alt := sha256.New()
+	counter := &countingWriter{}
+	prefix := "."
+	if b.source {
+		prefix = ""
+	}
+	if err := writeArchive(io.MultiWriter(zw, alt, counter), files, prefix, large); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	h, err := b.header(files, large, buildTime, !epoch.IsZero())
+	if err != nil {
+		return err
+	}
+	h.Entries = append(h.Entries,
+		Entry{Tag: TagPayloadCompressor, Type: TypeString, Value: compressor},
+		Entry{Tag: TagPayloadFlags, Type: TypeString, Value: compress.flags},
+		Entry{Tag: TagPayloadDigest, Type: TypeStringArray, Value: []string{hexDigest(sha256.New(), payload.Bytes())}},
+		Entry{Tag: TagPayloadDigestAlt, Type: TypeStringArray, Value: []string{hex.EncodeToString(alt.Sum(nil))}},
+		Entry{Tag: TagPayloadDigestAlgo, Type: TypeInt32, Value: []uint32{digestAlgoSHA256}},
+	)
+	header, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	sig, err := signatureHeader(header, payload.Bytes(), counter.n)
+	if err != nil {
+		return err
+	}
+
+	lead := Lead{
+		Major:         3,
+		Type:          LeadBinary,
+		ArchNum:       leadArchNums[b.arch()],
+		Name:          pkg.Name + "-" + pkg.EVR(),
+		OSNum:         1,
+		SignatureType: 5,
+	}
+	if b.source {
+		lead.Type = LeadSource
+	}
+
+	var out bytes.Buffer
+	out.Write(lead.bytes())
+	out.Write(sig)
+	for out.Len()%8 != 0 {
+		out.WriteByte(0)
+	}
+	out.Write(header)
+	if _, err := w.Write(out.Bytes()); err != nil {
+		return err
+	}
+	_, err = w.Write(payload.Bytes())
+	return err
+}
+
+/*
+Returns the time given by the SOURCE_DATE_EPOCH environment variable, in
+seconds since the Unix epoch, or the zero time if it is not set.
+*/
+func sourceDateEpoch() (time.Time, error) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return time.Time{}, nil
+	}
+	secs, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || secs < 0 || secs > math.MaxUint32 {
+		return time.Time{}, fmt.Errorf("bad SOURCE_DATE_EPOCH %q", v)
+	}
+	return time.Unix(secs, 0).UTC(), nil
+}
+
+func (b *Builder) arch() string {
+	switch {
+	case b.Package.BuildArch != "":
+		return b.Package.BuildArch
+	case b.Package.Arch != "":
+		return b.Package.Arch
+	}
+	return "noarch"
+}
+
+/*
+Returns the files of the package in order of their names, after checking
+them, with their modes and sizes worked out. Files without a modification time
+are given buildTime, and later ones are clamped to epoch unless it is zero. The
+content of files on disk is not read yet.
+*/
+func (b *Builder) files(buildTime, epoch time.Time) ([]builtFile, error) {
+	files := make([]builtFile, len(b.Files))
+	for i := range b.Files {
+		files[i].BuildFile = &b.Files[i]
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	for i := range files {
+		f := &files[i]
+		if b.source && (f.Name == "" || strings.ContainsRune(f.Name, '/')) ||
+			!b.source && (!path.IsAbs(f.Name) || path.Clean(f.Name) != f.Name || f.Name == "/") {
+			return nil, fmt.Errorf("bad file name %q", f.Name)
+		}
+		if i > 0 && files[i-1].Name == f.Name {
+			return nil, fmt.Errorf("%s is listed twice", f.Name)
+		}
+
+		f.mode, f.mtime = unixMode(f.Mode), f.ModTime
+		if f.mtime.IsZero() {
+			f.mtime = buildTime
+		}
+		if !epoch.IsZero() && f.mtime.After(epoch) {
+			f.mtime = epoch
+		}
+		switch f.mode & modeTypeMask {
+		case modeRegular:
+			if f.Flags&FileGhost != 0 {
+				break
+			}
+			f.size = int64(len(f.Data))
+			if f.Path != "" {
+				info, err := os.Stat(f.Path)
+				if err != nil {
+					return nil, err
+				}
+				f.size = info.Size()
+			}
+		case modeSymlink:
+			if f.LinkTo == "" {
+				return nil, fmt.Errorf("symlink %s has no target", f.Name)
+			}
+			f.size = int64(len(f.LinkTo))
+		}
+	}
+	return files, nil
+}
+
+/*
+Writes the cpio archive of the files, with prefix added to their names,
+computing the digests of regular files along the way. Ghost files are left out
+of the archive, as rpm does.
+*/
+func writeArchive(w io.Writer, files []builtFile, prefix string, stripped bool) error {
+	c := newCPIOWriter(w)
+	for i := range files {
+		f := &files[i]
+		if f.Flags&FileGhost != 0 {
+			continue
+		}
+
+		h := &CPIOHeader{
+			Name:      prefix + f.Name,
+			Inode:     uint32(i + 1),
+			Mode:      f.mode,
+			NLink:     1,
+			ModTime:   f.mtime,
+			DevMinor:  1,
+			RDevMajor: uint32(f.Rdev >> 8),
+			RDevMinor: uint32(f.Rdev & 0xff),
+			Index:     -1,
+		}
+		if f.mode&modeTypeMask == modeDir {
+			h.NLink = 2
+		}
+		if f.mode&modeTypeMask == modeRegular || f.mode&modeTypeMask == modeSymlink {
+			h.Size = f.size
+		}
+		if stripped {
+			h.Index = i
+		}
+		if err := c.writeHeader(h); err != nil {
+			return err
+		}
+
+		switch f.mode & modeTypeMask {
+		case modeSymlink:
+			if _, err := io.WriteString(c, f.LinkTo); err != nil {
+				return err
+			}
+		case modeRegular:
+			digest := sha256.New()
+			if err := copyContent(io.MultiWriter(c, digest), f); err != nil {
+				return err
+			}
+			f.digest = hex.EncodeToString(digest.Sum(nil))
+		}
+	}
+	return c.close()
+}
+
+// copyContent copies the content of a regular file to w.
+func copyContent(w io.Writer, f *builtFile) error {
+	if f.Path == "" {
+		_, err := w.Write(f.Data)
+		return err
+	}
+
+	r, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if _, err := io.CopyN(w, r, f.size); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("%s changed while it was being read", f.Path)
+		}
+		return err
+	}
+	return nil
+}
+
+/*
+Returns the main header of the package, short of the payload tags. When
+reproducible is set, nothing about the build host is recorded, and with a zero
+buildTime, there is no BUILDTIME tag.
+*/
+func (b *Builder) header(files []builtFile, large bool, buildTime time.Time, reproducible bool) (*Header, error) {
+	pkg := b.Package
+	h := &Header{}
+	add := func(tag Tag, typ TagType, v interface{}) {
+		h.Entries = append(h.Entries, Entry{Tag: tag, Type: typ, Value: v})
+	}
+	addString := func(tag Tag, s string) {
+		if s != "" {
+			add(tag, TypeString, s)
+		}
+	}
+	i18n := func(tag Tag, s string) {
+		add(tag, TypeI18NString, []string{s})
+	}
+
+	host, srpm, osName := b.BuildHost, b.SourceRPM, b.OS
+	switch {
+	case host == "" && reproducible:
+		host = "reproducible"
+	case host == "":
+		host, _ = os.Hostname()
+	}
+	if srpm == "" {
+		srpm = fmt.Sprintf("%s-%s-%s.src.rpm", pkg.Name, pkg.Version, pkg.Release)
+	}
+	if osName == "" {
+		osName = "linux"
+	}
+	group := pkg.Group
+	if group == "" {
+		group = "Unspecified"
+	}
+
+	add(TagHeaderImmutable, TypeBin, nil)
+	add(TagHeaderI18NTable, TypeStringArray, []string{"C"})
+	addString(TagName, pkg.Name)
+	addString(TagVersion, pkg.Version)
+	addString(TagRelease, pkg.Release)
+	if pkg.Epoch != "" {
+		epoch, err := strconv.ParseUint(pkg.Epoch, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad epoch %q", pkg.Epoch)
+		}
+		add(TagEpoch, TypeInt32, []uint32{uint32(epoch)})
+	}
+	i18n(TagSummary, pkg.Summary)
+	i18n(TagDescription, pkg.Description)
+	if !buildTime.IsZero() {
+		add(TagBuildTime, TypeInt32, []uint32{uint32(buildTime.Unix())})
+	}
+	addString(TagBuildHost, host)
+	addString(TagLicense, pkg.License)
+	i18n(TagGroup, group)
+	addString(TagURL, pkg.URL)
+	addString(TagVendor, pkg.Vendor)
+	addString(TagPackager, pkg.Packager)
+	addString(TagDistribution, pkg.Distribution)
+	addString(TagOS, osName)
+	addString(TagArch, b.arch())
+	if b.source {
+		add(TagSourcePackage, TypeInt32, []uint32{1})
+	} else {
+		addString(TagSourceRPM, srpm)
+	}
+	addString(TagRPMVersion, builderRPMVersion)
+	addString(TagEncoding, "utf-8")
+	addString(TagPayloadFormat, "cpio")
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	if large {
+		add(TagLongSize, TypeInt64, []uint64{uint64(total)})
+	} else {
+		add(TagSize, TypeInt32, []uint32{uint32(total)})
+	}
+
+	autoProvides, autoRequires, err := b.generateDependencies(files)
+	if err != nil {
+		return nil, err
+	}
+
+	requires := addGenerated(append([]spec.Dependency(nil), pkg.Requires...), autoRequires)
+	rpmlib := func(name, version string) {
+		requires = append(requires, spec.Dependency{
+			Name:    "rpmlib(" + name + ")",
+			Flags:   spec.DepRPMLib | spec.DepLess | spec.DepEqual,
+			Version: version,
+		})
+	}
+
+	if err := b.addScriptlets(add, &requires, rpmlib); err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		b.addFiles(add, files, large, rpmlib)
+	}
+	switch b.Compressor {
+	case "xz":
+		rpmlib("PayloadIsXz", "5.2-1")
+	case "zstd":
+		rpmlib("PayloadIsZstd", "5.4.18-1")
+	}
+
+	provides := addGenerated(append([]spec.Dependency(nil), pkg.Provides...), autoProvides)
+	self := spec.Dependency{Name: pkg.Name, Flags: spec.DepEqual, Version: pkg.EVR()}
+	if !b.source && !containsDependency(provides, self) {
+		provides = append(provides, self)
+	}
+
+	for _, deps := range []struct {
+		name, flags, version Tag
+		deps                 []spec.Dependency
+	}{
+		{TagProvideName, TagProvideFlags, TagProvideVersion, provides},
+		{TagRequireName, TagRequireFlags, TagRequireVersion, requires},
+		{TagConflictName, TagConflictFlags, TagConflictVersion, pkg.Conflicts},
+		{TagObsoleteName, TagObsoleteFlags, TagObsoleteVersion, pkg.Obsoletes},
+		{TagRecommendName, TagRecommendFlags, TagRecommendVersion, pkg.Recommends},
+		{TagSuggestName, TagSuggestFlags, TagSuggestVersion, pkg.Suggests},
+		{TagSupplementName, TagSupplementFlags, TagSupplementVersion, pkg.Supplements},
+		{TagEnhanceName, TagEnhanceFlags, TagEnhanceVersion, pkg.Enhances},
+	} {
+		if len(deps.deps) == 0 {
+			continue
+		}
+		names := make([]string, len(deps.deps))
+		flags := make([]uint32, len(deps.deps))
+		versions := make([]string, len(deps.deps))
+		for i, d := range deps.deps {
+			names[i], flags[i], versions[i] = d.Name, uint32(d.Flags), d.Version
+		}
+		add(deps.name, TypeStringArray, names)
+		add(deps.flags, TypeInt32, flags)
+		add(deps.version, TypeStringArray, versions)
+	}
+
+	if len(b.Changelog) > 0 {
+		times := make([]uint32, len(b.Changelog))
+		names := make([]string, len(b.Changelog))
+		texts := make([]string, len(b.Changelog))
+		for i, c := range b.Changelog {
+			times[i], names[i], texts[i] = uint32(c.Time.Unix()), c.Name, c.Text
+		}
+		add(TagChangelogTime, TypeInt32, times)
+		add(TagChangelogName, TypeStringArray, names)
+		add(TagChangelogText, TypeStringArray, texts)
+	}
+	h.Entries = append(h.Entries, b.extra...)
+	return h, nil
+}
+
+/*
+Adds the scriptlets to the header, along with the dependencies on their
+interpreters.
+*/
+func (b *Builder) addScriptlets(add func(Tag, TagType, interface{}), requires *[]spec.Dependency, rpmlib func(name, version string)) error {
+	names := make([]string, 0, len(b.Scriptlets))
+	for name := range b.Scriptlets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lua := false
+	for _, name := range names {
+		tags, ok := scriptletTags[name]
+		if !ok {
+			return fmt.Errorf("unknown scriptlet %%%s", name)
+		}
+		s := b.Scriptlets[name]
+		prog := s.Interpreter()
+		if s.Body != "" {
+			add(tags.script, TypeString, s.Body)
+		}
+		add(tags.prog, TypeStringArray, prog)
+
+		switch {
+		case prog[0] == "<lua>":
+			lua = true
+		case strings.HasPrefix(prog[0], "/"):
+			*requires = append(*requires, spec.Dependency{Name: prog[0], Flags: spec.DepInterp | tags.flags})
+		}
+	}
+	if lua {
+		rpmlib("BuiltinLuaScripts", "4.2.2-1")
+	}
+	return nil
+}
+
+/*
+Adds the file tags to the header.
+*/
+func (b *Builder) addFiles(add func(Tag, TagType, interface{}), files []builtFile, large bool, rpmlib func(name, version string)) {
+	n := len(files)
+	var (
+		bases, dirs, digests, links   = make([]string, n), []string(nil), make([]string, n), make([]string, n)
+		owners, groups, langs, caps   = make([]string, n), make([]string, n), make([]string, n), make([]string, n)
+		dirIndexes, mtimes, flags     = make([]uint32, n), make([]uint32, n), make([]uint32, n)
+		verify, devices, inodes, size = make([]uint32, n), make([]uint32, n), make([]uint32, n), make([]uint32, n)
+		longSizes                     = make([]uint64, n)
+		modes, rdevs                  = make([]uint16, n), make([]uint16, n)
+		dirIndex                      = make(map[string]int)
+		hasCaps                       bool
+	)
+
+	for i, f := range files {
+		dir, base := path.Split(f.Name)
+		idx, ok := dirIndex[dir]
+		if !ok {
+			idx = len(dirs)
+			dirIndex[dir] = idx
+			dirs = append(dirs, dir)
+		}
+		bases[i], dirIndexes[i] = base, uint32(idx)
+
+		owners[i], groups[i] = f.Owner, f.Group
+		if owners[i] == "" {
+			owners[i] = "root"
+		}
+		if groups[i] == "" {
+			groups[i] = "root"
+		}
+		digests[i], links[i], langs[i], caps[i] = f.digest, f.LinkTo, f.Lang, f.Caps
+		hasCaps = hasCaps || f.Caps != ""
+
+		modes[i], rdevs[i] = uint16(f.mode), f.Rdev
+		mtimes[i], flags[i], verify[i] = uint32(f.mtime.Unix()), uint32(f.Flags), ^f.NoVerify
+		devices[i], inodes[i] = 1, uint32(i+1)
+		size[i], longSizes[i] = uint32(f.size), uint64(f.size)
+	}
+
+	if large {
+		add(TagLongFileSizes, TypeInt64, longSizes)
+		rpmlib("LargeFiles", "4.12.0-1")
+	} else {
+		add(TagFileSizes, TypeInt32, size)
+	}
+	add(TagFileModes, TypeInt16, modes)
+	add(TagFileRDevs, TypeInt16, rdevs)
+	add(TagFileMTimes, TypeInt32, mtimes)
+	add(TagFileDigests, TypeStringArray, digests)
+	add(TagFileLinkTos, TypeStringArray, links)
+	add(TagFileFlags, TypeInt32, flags)
+	add(TagFileUserName, TypeStringArray, owners)
+	add(TagFileGroupName, TypeStringArray, groups)
+	add(TagFileVerifyFlags, TypeInt32, verify)
+	add(TagFileDevices, TypeInt32, devices)
+	add(TagFileInodes, TypeInt32, inodes)
+	add(TagFileLangs, TypeStringArray, langs)
+	if hasCaps {
+		add(TagFileCaps, TypeStringArray, caps)
+		rpmlib("FileCaps", "4.6.1-1")
+	}
+	add(TagDirIndexes, TypeInt32, dirIndexes)
+	add(TagBaseNames, TypeStringArray, bases)
+	add(TagDirNames, TypeStringArray, dirs)
+	add(TagFileDigestAlgo, TypeInt32, []uint32{digestAlgoSHA256})
+
+	rpmlib("CompressedFileNames", "3.0.4-1")
+	rpmlib("FileDigests", "4.6.0-1")
+	if !b.source {
+		rpmlib("PayloadFilesHavePrefix", "4.0-1")
+	}
+}
+
+/*
+Returns the encoded signature header for a package with the given main header
+and compressed payload, whose uncompressed size is archiveSize.
+*/
+func signatureHeader(header, payload []byte, archiveSize int64) ([]byte, error) {
+	md5sum := md5.New()
+	md5sum.Write(header)
+	md5sum.Write(payload)
+
+	h := &Header{Entries: []Entry{
+		{Tag: TagHeaderSignatures, Type: TypeBin},
+		{Tag: SigTagSHA1, Type: TypeString, Value: hexDigest(sha1.New(), header)},
+		{Tag: SigTagSHA256, Type: TypeString, Value: hexDigest(sha256.New(), header)},
+		{Tag: SigTagMD5, Type: TypeBin, Value: md5sum.Sum(nil)},
+		{Tag: SigTagReservedSpace, Type: TypeBin, Value: make([]byte, reservedSpace)},
+	}}
+
+	size := int64(len(header) + len(payload))
+	if size > math.MaxUint32 || archiveSize > math.MaxUint32 {
+		h.Entries = append(h.Entries,
+			Entry{Tag: SigTagLongSize, Type: TypeInt64, Value: []uint64{uint64(size)}},
+			Entry{Tag: SigTagLongArchiveSize, Type: TypeInt64, Value: []uint64{uint64(archiveSize)}},
+		)
+	} else {
+		h.Entries = append(h.Entries,
+			Entry{Tag: SigTagSize, Type: TypeInt32, Value: []uint32{uint32(size)}},
+			Entry{Tag: SigTagPayloadSize, Type: TypeInt32, Value: []uint32{uint32(archiveSize)}},
+		)
+	}
+	return h.MarshalBinary()
+}
+
+func hexDigest(h hash.Hash, b []byte) string {
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+/*
+Runs the builder's file attributes on the files, and returns what they provide
+and require, flagged as found by dependency generators.
+*/
+func (b *Builder) generateDependencies(files []builtFile) (provides, requires []spec.Dependency, err error) {
+	pkg := b.Package
+	if len(b.FileAttrs) == 0 || (pkg.NoAutoProv && pkg.NoAutoReq) {
+		return nil, nil, nil
+	}
+	bfs := make([]BuildFile, len(files))
+	for i, f := range files {
+		bfs[i] = *f.BuildFile
+	}
+	provides, requires, err = GenerateDependencies(bfs, b.FileAttrs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if pkg.NoAutoProv {
+		provides = nil
+	}
+	if pkg.NoAutoReq {
+		requires = nil
+	}
+	for i := range provides {
+		provides[i].Flags |= spec.DepFindProvides
+	}
+	for i := range requires {
+		requires[i].Flags |= spec.DepFindRequires
+	}
+	return provides, requires, nil
+}
+
+// addGenerated adds the generated dependencies to deps, leaving out those
+// already there.
+func addGenerated(deps, generated []spec.Dependency) []spec.Dependency {
+	have := make(map[string]bool, len(deps))
+	for _, d := range deps {
+		have[d.String()] = true
+	}
+	for _, d := range generated {
+		if !have[d.String()] {
+			deps = append(deps, d)
+		}
+	}
+	return deps
+}
+
+func containsDependency(deps []spec.Dependency, d spec.Dependency) bool {
+	for _, dep := range deps {
+		if dep == d {
+			return true
+		}
+	}
+	return false
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	c.n += int64(len(b))
+	return len(b), nil
+}
+
+// unixMode converts an fs.FileMode to a unix st_mode.
+func unixMode(m fs.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	switch {
+	case m&fs.ModeSymlink != 0:
+		mode |= modeSymlink
+	case m&fs.ModeDir != 0:
+		mode |= modeDir
+	case m&fs.ModeCharDevice != 0:
+		mode |= modeChar
+	case m&fs.ModeDevice != 0:
+		mode |= modeBlock
+	case m&fs.ModeNamedPipe != 0:
+		mode |= modeFIFO
+	case m&fs.ModeSocket != 0:
+		mode |= modeSocket
+	default:
+		mode |= modeRegular
+	}
+	if m&fs.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if m&fs.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if m&fs.ModeSticky != 0 {
+		mode |= 01000
+	}
+	return mode
+}
@@ -0,0 +1,297 @@
+package rpm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nesv/rpm/spec"
+)
+
+func testBuilder() *Builder {
+	b := NewBuilder(&spec.Package{
+		Name:        "hello",
+		Epoch:       "1",
+		Version:     "2.0",
+		Release:     "3",
+		Summary:     "Says hello",
+		Description: "Prints a greeting.",
+		License:     "MIT",
+		Arch:        "x86_64",
+		Requires:    []spec.Dependency{{Name: "glibc", Flags: spec.DepGreater | spec.DepEqual, Version: "2.28"}},
+	})
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	b.Files = []BuildFile{
+		{Name: "/usr/bin/hello", Mode: 0755, ModTime: mtime, Data: []byte("#!/bin/sh\necho hello\n")},
+		{Name: "/usr/bin", Mode: fs.ModeDir | 0755, ModTime: mtime},
+		{Name: "/usr/bin/hi", Mode: fs.ModeSymlink | 0777, ModTime: mtime, LinkTo: "hello"},
+		{Name: "/etc/hello.conf", Mode: 0644, ModTime: mtime, Owner: "hello", Flags: FileConfig | FileNoReplace, Data: []byte("greeting=hello\n")},
+		{Name: "/var/log/hello.log", Mode: 0640, ModTime: mtime, Flags: FileGhost},
+	}
+	b.Scriptlets["post"] = spec.Scriptlet{Body: "echo installed"}
+	b.Scriptlets["postun"] = spec.Scriptlet{Program: []string{"/sbin/ldconfig"}}
+	b.Changelog = []spec.ChangelogEntry{{Time: mtime, Name: "Jane Doe <jane@example.com> - 1:2.0-3", Text: "- Initial package"}}
+	b.BuildTime, b.BuildHost = mtime, "build.example.com"
+	return b
+}
+
+func buildTestPackage(t *testing.T, b *Builder) *Package {
+	p, err := ReadPackage(bytes.NewReader(mustBytes(t, b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestBuilder(t *testing.T) {
+	for _, c := range []string{"gzip", "xz", "zstd"} {
+		b := testBuilder()
+		b.Compressor = c
+		pkg := mustBytes(t, b)
+		p, err := ReadPackage(bytes.NewReader(pkg))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := p.Header.NEVRA(), "hello-1:2.0-3.x86_64"; got != want {
+			t.Errorf("%s: wrong NEVRA; got %q wanted %q", c, got, want)
+		}
+		if got := p.PayloadCompressor(); got != c {
+			t.Errorf("wrong payload compressor; got %q wanted %q", got, c)
+		}
+		if p.Header.IsSource() || p.Lead.Name != "hello-1:2.0-3" {
+			t.Errorf("%s: bad lead or source package; got %+v", c, p.Lead)
+		}
+
+		r, err := p.VerifyDigests()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !r.OK() || len(r.Checks) != 6 || len(r.Files) != 2 {
+			t.Errorf("%s: digests do not verify; got %s", c, r)
+		}
+
+		got := readPayload(t, pkg)
+		expected := `[0 /etc/hello.conf -rw-r--r-- "greeting=hello\n" 1 /usr/bin drwxr-xr-x "" 2 /usr/bin/hello -rwxr-xr-x "#!/bin/sh\necho hello\n" 3 /usr/bin/hi Lrwxrwxrwx "hello"]`
+		t.Logf("expecting %q", expected)
+		if got != expected {
+			t.Errorf("%s: wrong payload; got %q wanted %q", c, got, expected)
+		}
+	}
+}
+
+// mustBytes writes the package of b, and returns it.
+func mustBytes(t *testing.T, b *Builder) []byte {
+	var out bytes.Buffer
+	if err := b.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestBuilderHeader(t *testing.T) {
+	p := buildTestPackage(t, testBuilder())
+	h := p.Header
+
+	files, err := h.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, fmt.Sprintf("%s %v %d %s:%s %x %q", f.Name, f.FileMode(), f.Size, f.Owner, f.Group, f.Flags, f.LinkTo))
+	}
+	expected := `[/etc/hello.conf -rw-r--r-- 15 hello:root 11 "" /usr/bin drwxr-xr-x 0 root:root 0 "" /usr/bin/hello -rwxr-xr-x 21 root:root 0 "" /usr/bin/hi Lrwxrwxrwx 5 root:root 0 "hello" /var/log/hello.log -rw-r----- 0 root:root 40 ""]`
+	t.Logf("expecting %q", expected)
+	if fmt.Sprint(got) != expected {
+		t.Errorf("wrong files; got %q wanted %q", fmt.Sprint(got), expected)
+	}
+
+	requires, err := h.Requires()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "[glibc >= 2.28 /bin/sh /sbin/ldconfig rpmlib(CompressedFileNames) <= 3.0.4-1 rpmlib(FileDigests) <= 4.6.0-1 rpmlib(PayloadFilesHavePrefix) <= 4.0-1]"
+	t.Logf("expecting %q", expected)
+	if got := fmt.Sprint(requires); got != expected {
+		t.Errorf("wrong requires; got %q wanted %q", got, expected)
+	}
+	if requires[1].Flags != spec.DepInterp|spec.DepScriptPost || requires[2].Flags != spec.DepInterp|spec.DepScriptPostun {
+		t.Errorf("wrong flags for the interpreters; got %#x and %#x", requires[1].Flags, requires[2].Flags)
+	}
+
+	provides, _ := h.Provides()
+	if got, want := fmt.Sprint(provides), "[hello = 1:2.0-3]"; got != want {
+		t.Errorf("wrong provides; got %q wanted %q", got, want)
+	}
+
+	tests := map[Tag]string{
+		TagSourceRPM:   "[hello-2.0-3.src.rpm]",
+		TagBuildHost:   "[build.example.com]",
+		TagPostIn:      "[echo installed]",
+		TagPostInProg:  "[/bin/sh]",
+		TagPostUnProg:  "[/sbin/ldconfig]",
+		TagGroup:       "[Unspecified]",
+		TagDirNames:    "[/etc/ /usr/ /usr/bin/ /var/log/]",
+		TagDescription: "[Prints a greeting.]",
+	}
+	for tag, want := range tests {
+		if got := fmt.Sprint(h.GetStrings(tag)); got != want {
+			t.Errorf("tag %v; got %s wanted %s", tag, got, want)
+		}
+	}
+	if _, ok := h.Entry(TagPostUn); ok {
+		t.Errorf("empty scriptlet body was written")
+	}
+
+	changelog, _ := h.Changelog()
+	if len(changelog) != 1 || changelog[0].Text != "- Initial package" {
+		t.Errorf("wrong changelog; got %v", changelog)
+	}
+	if space := p.Signature.GetBytes(SigTagReservedSpace); len(space) != reservedSpace {
+		t.Errorf("wrong reserved space; got %d bytes", len(space))
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	tests := map[string]func(b *Builder){
+		"no version":      func(b *Builder) { b.Package.Version = "" },
+		"bad compressor":  func(b *Builder) { b.Compressor = "bzip2" },
+		"relative name":   func(b *Builder) { b.Files[0].Name = "usr/bin/hello" },
+		"unclean name":    func(b *Builder) { b.Files[0].Name = "/usr/bin/../hello" },
+		"duplicate name":  func(b *Builder) { b.Files[1].Name = b.Files[0].Name },
+		"no link target":  func(b *Builder) { b.Files[2].LinkTo = "" },
+		"missing file":    func(b *Builder) { b.Files[0].Path = "/nonexistent" },
+		"bad epoch":       func(b *Builder) { b.Package.Epoch = "x" },
+		"unknown section": func(b *Builder) { b.Scriptlets["install"] = spec.Scriptlet{} },
+	}
+	for name, modify := range tests {
+		b := testBuilder()
+		modify(b)
+		if err := b.Write(&bytes.Buffer{}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestBuilderAddTree(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "usr/share/hello"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "usr/share/hello/README"), []byte("read me\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("README", filepath.Join(dir, "usr/share/hello/README.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	b := testBuilder()
+	b.Files = nil
+	if err := b.AddTree(dir, "/"); err != nil {
+		t.Fatal(err)
+	}
+	p := buildTestPackage(t, b)
+
+	files, err := p.Header.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, fmt.Sprintf("%s %v %q", f.Name, f.FileMode()&fs.ModeType, f.LinkTo))
+	}
+	expected := `[/usr d--------- "" /usr/share d--------- "" /usr/share/hello d--------- "" /usr/share/hello/README ---------- "" /usr/share/hello/README.txt L--------- "README"]`
+	t.Logf("expecting %q", expected)
+	if fmt.Sprint(got) != expected {
+		t.Errorf("wrong files; got %q wanted %q", fmt.Sprint(got), expected)
+	}
+
+	r, err := p.VerifyDigests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.OK() {
+		t.Errorf("digests do not verify; got %s", r)
+	}
+}
+
+func TestBuilderReproducible(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1714564800")
+	epoch := time.Unix(1714564800, 0)
+
+	// The same tree, written at different times.
+	build := func(c string, mtime time.Time) []byte {
+		dir := t.TempDir()
+		writeTree(t, dir, map[string]string{
+			"usr/bin/hello":      "#!/bin/sh\necho hello\n",
+			"usr/share/hello/a":  "a",
+			"usr/share/hello/b":  "->a",
+			"etc/hello.conf":     "greeting=hello\n",
+			"usr/share/hello/c/": "",
+		})
+		for _, name := range []string{"usr/bin/hello", "usr/share/hello/a", "etc/hello.conf"} {
+			if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		b := testBuilder()
+		b.Files, b.BuildTime, b.BuildHost, b.Compressor = nil, time.Time{}, "", c
+		if err := b.AddTree(dir, "/"); err != nil {
+			t.Fatal(err)
+		}
+		return mustBytes(t, b)
+	}
+
+	for _, c := range []string{"gzip", "xz", "zstd"} {
+		first := build(c, time.Now())
+		second := build(c, time.Now().Add(time.Hour))
+		if got, want := hexDigest(sha256.New(), second), hexDigest(sha256.New(), first); got != want {
+			t.Errorf("%s: builds differ; got %s wanted %s", c, got, want)
+		}
+
+		p, err := ReadPackage(bytes.NewReader(first))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Header.BuildTime(); !got.Equal(epoch) {
+			t.Errorf("%s: wrong build time; got %v wanted %v", c, got, epoch)
+		}
+		if got := fmt.Sprint(p.Header.GetStrings(TagBuildHost)); got != "[reproducible]" {
+			t.Errorf("%s: wrong build host; got %s", c, got)
+		}
+		for _, m := range p.Header.GetInts(TagFileMTimes) {
+			if m != epoch.Unix() {
+				t.Errorf("%s: file time was not clamped; got %d", c, m)
+			}
+		}
+	}
+
+	// Older files keep their time.
+	old := time.Unix(1000000000, 0)
+	b := testBuilder()
+	b.Files[0].ModTime = old
+	p := buildTestPackage(t, b)
+	if got := p.Header.GetInts(TagFileMTimes); fmt.Sprint(got) != "[1714564800 1714564800 1000000000 1714564800 1714564800]" {
+		t.Errorf("wrong file times; got %v", got)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "yesterday")
+	if err := testBuilder().Write(&bytes.Buffer{}); err == nil {
+		t.Errorf("expected an error for a bad SOURCE_DATE_EPOCH")
+	}
+}
+
+func TestUnixMode(t *testing.T) {
+	for _, m := range []uint32{0100644, 040755, 0120777, 020620, 060660, 010600, 0140755, 0104755, 043777} {
+		if got := unixMode(unixFileMode(m)); got != m {
+			t.Errorf("mode %o; got %o", m, got)
+		}
+	}
+}
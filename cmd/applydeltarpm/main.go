@@ -0,0 +1,125 @@
+/*
+Command applydeltarpm rebuilds a package from the package it replaces and a
+delta rpm, as deltarpm's applydeltarpm does with the -r option.
+
+Usage:
+
+	applydeltarpm -r old.rpm delta.drpm new.rpm
+	applydeltarpm -r old.rpm -payload delta.drpm payload.cpio
+	applydeltarpm -i delta.drpm
+
+The new package is only written if it matches the digest the delta holds.
+Payloads are compressed again with Go's compressors, which do not write the
+bytes rpm does, so the packages of distributions such as Fedora and RHEL are
+not reproduced and their deltas fail to apply. With -payload, the
+uncompressed payload of the new package is written instead, if it matches the
+payload digest of the new header; this works whatever the compression. With
+-i, what the delta holds is printed instead, as in:
+
+	version:    3
+	source:     hello-2.0-1
+	target:     hello-2.1-1.x86_64
+	compressor: xz
+	copies:     12 internal, 40 external
+
+The exit status is 0 on success, and 1 otherwise.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nesv/rpm"
+)
+
+func main() {
+	oldName := flag.String("r", "", "the old package")
+	info := flag.Bool("i", false, "print what the delta holds")
+	payload := flag.Bool("payload", false, "write the uncompressed payload rather than the package")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s -r old.rpm [-payload] delta.drpm new.rpm\n       %s -i delta.drpm\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var err error
+	switch {
+	case *info && flag.NArg() == 1:
+		err = printInfo(flag.Arg(0))
+	case !*info && *oldName != "" && flag.NArg() == 2:
+		err = apply(*oldName, flag.Arg(0), flag.Arg(1), *payload)
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "applydeltarpm: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func readDelta(name string) (*rpm.Delta, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d, err := rpm.ReadDelta(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return d, nil
+}
+
+func printInfo(name string) error {
+	d, err := readDelta(name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("version:    %d\n", d.Version)
+	fmt.Printf("source:     %s\n", d.SourceNEVR)
+	if d.Header != nil {
+		fmt.Printf("target:     %s\n", d.Header.NEVRA())
+	}
+	if d.RPMOnly {
+		fmt.Printf("rpm-only:   yes\n")
+	}
+	fmt.Printf("compressor: %s\n", d.TargetCompressor)
+	fmt.Printf("copies:     %d internal, %d external\n", len(d.IntCopies), len(d.ExtCopies))
+	return nil
+}
+
+func apply(oldName, deltaName, newName string, payload bool) error {
+	d, err := readDelta(deltaName)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(oldName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	old, err := rpm.ReadPackage(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", oldName, err)
+	}
+
+	out, err := os.Create(newName)
+	if err != nil {
+		return err
+	}
+	if payload {
+		err = d.ApplyPayload(old, out)
+	} else {
+		err = d.Apply(old, out)
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(newName)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,90 @@
+/*
+Command rpm2archive converts RPM packages to cpio or tar archives, like rpm's
+rpm2cpio and rpm2archive tools, without needing rpm installed.
+
+Usage:
+
+	rpm2archive [-format tgz|tar|cpio] [-o output] [package.rpm]
+
+The package is read from standard input if no file (or "-") is given, and the
+archive is written to standard output unless -o is given.
+*/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/nesv/rpm"
+)
+
+func main() {
+	format := flag.String("format", "tgz", "the archive format: tgz, tar or cpio")
+	output := flag.String("o", "-", "the file to write the archive to")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-format tgz|tar|cpio] [-o output] [package.rpm]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := convert(flag.Arg(0), *output, *format); err != nil {
+		fmt.Fprintf(os.Stderr, "rpm2archive: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func convert(input, output, format string) error {
+	var r io.ReaderAt
+	if input == "" || input == "-" {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	} else {
+		f, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	pkg, err := rpm.ReadPackage(r)
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if output != "-" {
+		if w, err = os.Create(output); err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case "tgz":
+		err = pkg.WriteTar(w, true)
+	case "tar":
+		err = pkg.WriteTar(w, false)
+	case "cpio":
+		err = pkg.WriteCPIO(w)
+	default:
+		err = fmt.Errorf("unknown archive format %q", format)
+	}
+
+	if w != os.Stdout {
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+/*
+Command rpmdiff compares two binary RPM packages, like rpmlint's rpmdiff tool,
+and reports the differences in their metadata, dependencies and files.
+
+Usage:
+
+	rpmdiff [-json] [-ignore SM5DNLVUGFT] old.rpm new.rpm
+
+Each difference is printed on a line of its own, as in:
+
+	removed     REQUIRES glibc >= 2.28
+	S.5........ /usr/bin/hello
+
+Changed files are shown with a letter for each check that failed: size, mode,
+digest, device number, number of hard links, symlink target, verify flags,
+user, group, file flags and modification time. The checks whose letters are
+given with -ignore are not made. With -json, the differences are printed as a
+JSON array instead.
+
+The exit status is 0 if the packages are the same, 1 if they differ, and 2 if
+they could not be compared.
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nesv/rpm"
+)
+
+func main() {
+	asJSON := flag.Bool("json", false, "print the differences as JSON")
+	ignore := flag.String("ignore", "", "the letters of the file checks to ignore, as in T for modification times")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-json] [-ignore SM5DNLVUGFT] old.rpm new.rpm\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	diffs, err := diff(flag.Arg(0), flag.Arg(1), rpm.DiffOptions{Ignore: *ignore})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rpmdiff: %v\n", err)
+		os.Exit(2)
+	}
+
+	if *asJSON {
+		if diffs == nil {
+			diffs = []rpm.Difference{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diffs); err != nil {
+			fmt.Fprintf(os.Stderr, "rpmdiff: %v\n", err)
+			os.Exit(2)
+		}
+	} else {
+		for _, d := range diffs {
+			fmt.Println(d)
+		}
+	}
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}
+
+func diff(oldName, newName string, opts rpm.DiffOptions) ([]rpm.Difference, error) {
+	old, err := readPackage(oldName)
+	if err != nil {
+		return nil, err
+	}
+	new, err := readPackage(newName)
+	if err != nil {
+		return nil, err
+	}
+	return rpm.Diff(old.Header, new.Header, opts)
+}
+
+func readPackage(name string) (*rpm.Package, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p, err := rpm.ReadPackage(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return p, nil
+}
@@ -0,0 +1,125 @@
+/*
+Command rpmverify checks the files of installed packages against the rpm
+database, like "rpm -V", without needing rpm installed.
+
+Usage:
+
+	rpmverify [-root DIR] [-json] [-v] [-ignore SM5DLUGTP] [-noconfig] [-noghost] [package...]
+
+The database and the files are read from the system whose root directory is
+given with -root (by default, the running system), such as an unpacked
+container image. Without package names, all installed packages are checked.
+
+Each file which fails verification is printed on a line of its own, as in:
+
+	S.5....T.  c /etc/foo
+	missing     /usr/bin/foo
+
+with a letter for each check that failed: size, mode, digest, device number,
+symlink target, user, group, modification time and capabilities, or a "?" for
+those which could not be made. The checks whose letters are given with -ignore
+are not made. With -v, files which pass are printed too; with -json, the
+results of all files are printed as JSON instead.
+
+The exit status is 0 if all files pass, 1 if any fails, and 2 on errors.
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nesv/rpm"
+	"github.com/nesv/rpm/rpmdb"
+)
+
+// The results of verifying a package, as printed with -json.
+type result struct {
+	Package string                 `json:"package"`
+	Files   []rpm.FileVerification `json:"files"`
+}
+
+func main() {
+	root := flag.String("root", "/", "the root directory of the system to verify")
+	asJSON := flag.Bool("json", false, "print the results as JSON")
+	verbose := flag.Bool("v", false, "print the files which pass too")
+	var opts rpm.VerifyOptions
+	flag.StringVar(&opts.Ignore, "ignore", "", "the letters of the checks to ignore, as in T for modification times")
+	flag.BoolVar(&opts.NoConfig, "noconfig", false, "skip %config files")
+	flag.BoolVar(&opts.NoGhost, "noghost", false, "skip %ghost files")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-root DIR] [-json] [-v] [-ignore SM5DLUGTP] [-noconfig] [-noghost] [package...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	pkgs, err := packages(*root, flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rpmverify: %v\n", err)
+		os.Exit(2)
+	}
+
+	results := []result{}
+	failed := false
+	for _, p := range pkgs {
+		files, err := p.VerifyFiles(*root, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rpmverify: %s: %v\n", p.NEVRA(), err)
+			os.Exit(2)
+		}
+		if files == nil {
+			files = []rpm.FileVerification{}
+		}
+		results = append(results, result{Package: p.NEVRA(), Files: files})
+
+		for _, f := range files {
+			if !f.OK() {
+				failed = true
+			}
+			if !*asJSON && (*verbose || !f.OK()) {
+				fmt.Println(f)
+			}
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			fmt.Fprintf(os.Stderr, "rpmverify: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// packages returns the installed packages with the given names, or all of
+// them if none are given.
+func packages(root string, names []string) ([]rpmdb.Package, error) {
+	db, err := rpmdb.Open(root)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if len(names) == 0 {
+		return db.Packages()
+	}
+	var pkgs []rpmdb.Package
+	for _, name := range names {
+		found, err := db.ByName(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("package %s is not installed", name)
+		}
+		pkgs = append(pkgs, found...)
+	}
+	return pkgs, nil
+}
@@ -0,0 +1,280 @@
+package rpm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+var ErrBadArchive = errors.New("malformed cpio archive")
+
+// The magic numbers of the cpio formats found in RPM payloads: "newc", "crc"
+// (newc with checksums), and the "stripped" format rpm uses for packages
+// with files of 4GB or more.
+const (
+	cpioNewcMagic     = "070701"
+	cpioCRCMagic      = "070702"
+	cpioStrippedMagic = "07070X"
+	cpioTrailer       = "TRAILER!!!"
+)
+
+// Limits on cpio headers read from untrusted input.
+const (
+	cpioHeaderSize         = 110
+	cpioStrippedHeaderSize = 14
+	cpioMaxNameSize        = 4096
+)
+
+/*
+A CPIOHeader is the header of a single member of a "newc" cpio archive. For
+members of a "stripped" archive only Index is set.
+*/
+type CPIOHeader struct {
+	Name      string
+	Inode     uint32
+	Mode      uint32
+	UID       uint32
+	GID       uint32
+	NLink     uint32
+	ModTime   time.Time
+	Size      int64
+	DevMajor  uint32
+	DevMinor  uint32
+	RDevMajor uint32
+	RDevMinor uint32
+	Checksum  uint32
+
+	// Index is the index of the file in the RPM header, for members of a
+	// stripped archive, and -1 otherwise.
+	Index int
+}
+
+/*
+A cpioReader reads the members of a cpio archive in sequence, keeping track of
+its position in order to skip the padding between members.
+*/
+type cpioReader struct {
+	r      io.Reader
+	pos    int64
+	remain int64 // unread content of the current member
+	pad    int64 // padding following the current member
+}
+
+func newCPIOReader(r io.Reader) *cpioReader {
+	return &cpioReader{r: r}
+}
+
+func (c *cpioReader) readFull(b []byte) error {
+	n, err := io.ReadFull(c.r, b)
+	c.pos += int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (c *cpioReader) skip(n int64) error {
+	m, err := io.CopyN(io.Discard, c.r, n)
+	c.pos += m
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (c *cpioReader) align() error {
+	return c.skip((4 - c.pos%4) % 4)
+}
+
+/*
+Advances to the next member of the archive, and returns its header. It returns
+io.EOF once the trailer has been read.
+
+The content of stripped members is not described by their header; the caller
+has to set it with setSize.
+*/
+func (c *cpioReader) next() (*CPIOHeader, error) {
+	if err := c.skip(c.remain + c.pad); err != nil {
+		return nil, err
+	}
+	c.remain, c.pad = 0, 0
+
+	var magic [6]byte
+	if err := c.readFull(magic[:]); err != nil {
+		return nil, err
+	}
+
+	switch string(magic[:]) {
+	case cpioStrippedMagic:
+		var idx [8]byte
+		if err := c.readFull(idx[:]); err != nil {
+			return nil, err
+		}
+		n, err := parseHex(idx[:])
+		if err != nil {
+			return nil, err
+		}
+		if err := c.align(); err != nil {
+			return nil, err
+		}
+		return &CPIOHeader{Index: int(n)}, nil
+
+	case cpioNewcMagic, cpioCRCMagic:
+	default:
+		return nil, fmt.Errorf("%v: bad magic %q", ErrBadArchive, magic[:])
+	}
+
+	var raw [cpioHeaderSize - 6]byte
+	if err := c.readFull(raw[:]); err != nil {
+		return nil, err
+	}
+	var fields [13]uint32
+	for i := range fields {
+		v, err := parseHex(raw[i*8 : i*8+8])
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = v
+	}
+
+	namesize := fields[11]
+	if namesize == 0 || namesize > cpioMaxNameSize {
+		return nil, fmt.Errorf("%v: bad name size %d", ErrBadArchive, namesize)
+	}
+	name := make([]byte, namesize)
+	if err := c.readFull(name); err != nil {
+		return nil, err
+	}
+	if name[namesize-1] != 0 {
+		return nil, fmt.Errorf("%v: unterminated name", ErrBadArchive)
+	}
+	if err := c.align(); err != nil {
+		return nil, err
+	}
+
+	h := &CPIOHeader{
+		Name:      string(bytes.TrimRight(name, "\x00")),
+		Inode:     fields[0],
+		Mode:      fields[1],
+		UID:       fields[2],
+		GID:       fields[3],
+		NLink:     fields[4],
+		ModTime:   time.Unix(int64(fields[5]), 0).UTC(),
+		Size:      int64(fields[6]),
+		DevMajor:  fields[7],
+		DevMinor:  fields[8],
+		RDevMajor: fields[9],
+		RDevMinor: fields[10],
+		Checksum:  fields[12],
+		Index:     -1,
+	}
+	if h.Name == cpioTrailer {
+		return nil, io.EOF
+	}
+	c.setSize(h.Size)
+	return h, nil
+}
+
+// setSize sets the size of the content of the current member.
+func (c *cpioReader) setSize(n int64) {
+	c.remain, c.pad = n, (4-(c.pos+n)%4)%4
+}
+
+// Read reads the content of the current member.
+func (c *cpioReader) Read(b []byte) (int, error) {
+	if c.remain <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > c.remain {
+		b = b[:c.remain]
+	}
+	n, err := c.r.Read(b)
+	c.pos += int64(n)
+	c.remain -= int64(n)
+	if err == io.EOF && c.remain > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func parseHex(b []byte) (uint32, error) {
+	v, err := strconv.ParseUint(string(b), 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%v: bad number %q", ErrBadArchive, b)
+	}
+	return uint32(v), nil
+}
+
+/*
+A cpioWriter writes a "newc" (or, for members with an Index, stripped) cpio
+archive, padding each member's content as it is finished.
+*/
+type cpioWriter struct {
+	w      io.Writer
+	pos    int64
+	remain int64 // unwritten content of the current member
+}
+
+func newCPIOWriter(w io.Writer) *cpioWriter {
+	return &cpioWriter{w: w}
+}
+
+func (c *cpioWriter) write(b []byte) error {
+	n, err := c.w.Write(b)
+	c.pos += int64(n)
+	return err
+}
+
+func (c *cpioWriter) align() error {
+	return c.write(make([]byte, (4-c.pos%4)%4))
+}
+
+/*
+Starts a new member of the archive, whose content of h.Size bytes has to be
+written next. The previous member must have been written in full.
+*/
+func (c *cpioWriter) writeHeader(h *CPIOHeader) error {
+	if c.remain != 0 {
+		return fmt.Errorf("cpio member is %d bytes short", c.remain)
+	}
+	if err := c.align(); err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	if h.Index >= 0 {
+		fmt.Fprintf(&b, "%s%08x", cpioStrippedMagic, h.Index)
+	} else {
+		if h.Size > math.MaxUint32 {
+			return fmt.Errorf("%s is too large for a cpio archive", h.Name)
+		}
+		fmt.Fprintf(&b, "%s%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%s\x00",
+			cpioNewcMagic, h.Inode, h.Mode, h.UID, h.GID, h.NLink, h.ModTime.Unix(), h.Size,
+			h.DevMajor, h.DevMinor, h.RDevMajor, h.RDevMinor, len(h.Name)+1, h.Checksum, h.Name)
+	}
+	if err := c.write(b.Bytes()); err != nil {
+		return err
+	}
+	c.remain = h.Size
+	return c.align()
+}
+
+// Write writes the content of the current member.
+func (c *cpioWriter) Write(b []byte) (int, error) {
+	if int64(len(b)) > c.remain {
+		return 0, fmt.Errorf("write beyond the size of the cpio member")
+	}
+	n, err := c.w.Write(b)
+	c.pos += int64(n)
+	c.remain -= int64(n)
+	return n, err
+}
+
+// close writes the trailer of the archive.
+func (c *cpioWriter) close() error {
+	return c.writeHeader(&CPIOHeader{Name: cpioTrailer, NLink: 1, ModTime: time.Unix(0, 0), Index: -1})
+}
@@ -0,0 +1,107 @@
+package rpm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// testMember is a member of an archive built by buildCPIO. Members with an
+// index are written in the stripped format.
+type testMember struct {
+	name    string
+	mode    uint32
+	ino     uint32
+	nlink   uint32
+	content string
+	index   int
+}
+
+func buildCPIO(members ...testMember) []byte {
+	var b bytes.Buffer
+	pad := func() {
+		for b.Len()%4 != 0 {
+			b.WriteByte(0)
+		}
+	}
+	newc := func(m testMember) {
+		fmt.Fprintf(&b, "%s%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+			cpioNewcMagic, m.ino, m.mode, 0, 0, m.nlink, 1354838400, len(m.content), 0, 0, 0, 0, len(m.name)+1, 0)
+		b.WriteString(m.name + "\x00")
+		pad()
+	}
+
+	for _, m := range members {
+		if m.index > 0 {
+			fmt.Fprintf(&b, "%s%08x", cpioStrippedMagic, m.index-1)
+			pad()
+		} else {
+			newc(m)
+		}
+		b.WriteString(m.content)
+		pad()
+	}
+	newc(testMember{name: cpioTrailer})
+	return b.Bytes()
+}
+
+func TestCPIOReader(t *testing.T) {
+	archive := buildCPIO(
+		testMember{name: "./usr/bin", mode: 040755, ino: 1, nlink: 2},
+		testMember{name: "./usr/bin/go", mode: 0100755, ino: 2, nlink: 1, content: "#!/bin/sh\n"},
+		testMember{name: "./usr/bin/gofmt", mode: 0120777, ino: 3, nlink: 1, content: "go"},
+	)
+
+	c := newCPIOReader(bytes.NewReader(archive))
+	var got []string
+	for {
+		h, err := c.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%s %o %d %q", h.Name, h.Mode, h.Size, content))
+	}
+
+	expected := `[./usr/bin 40755 0 "" ./usr/bin/go 100755 10 "#!/bin/sh\n" ./usr/bin/gofmt 120777 2 "go"]`
+	t.Logf("expecting %q", expected)
+	if s := fmt.Sprint(got); s != expected {
+		t.Errorf("failed to read cpio archive; got %q wanted %q", s, expected)
+	}
+}
+
+func TestCPIOReaderMalformed(t *testing.T) {
+	archive := buildCPIO(testMember{name: "./usr/bin/go", mode: 0100755, content: "#!/bin/sh\n"})
+
+	for n := 0; n < len(archive); n++ {
+		c := newCPIOReader(bytes.NewReader(archive[:n]))
+		var err error
+		for err == nil {
+			if _, err = c.next(); err == nil {
+				_, err = ioutil.ReadAll(c)
+			}
+		}
+		if err == io.EOF {
+			t.Errorf("no error reading an archive truncated to %d bytes", n)
+		}
+	}
+
+	for i := 0; i < len(archive); i++ {
+		b := append([]byte(nil), archive...)
+		b[i] = 'z'
+		c := newCPIOReader(bytes.NewReader(b))
+		for {
+			if _, err := c.next(); err != nil {
+				break
+			}
+			ioutil.ReadAll(c)
+		}
+	}
+}
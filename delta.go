@@ -0,0 +1,812 @@
+package rpm
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	ErrNotDelta       = errors.New("not a delta rpm")
+	ErrDeltaMismatch  = errors.New("delta rpm does not apply to the old package")
+	ErrDigestMismatch = errors.New("reconstructed package does not match the digest of the delta rpm")
+)
+
+/*
+A delta rpm, as written by deltarpm's makedeltarpm and served as prestodelta
+data by update repositories, turns an old package into a new one. Its data
+follows the lead, signature and header of the new package, whose payload
+format is changed to "drpm", and is compressed as a whole:
+
+	magic      "DLT1", "DLT2" or "DLT3"
+	source     length, name-[epoch:]version-release of the old package
+	sequence   length, MD5 of the old files it lists, and their numbers
+	target     MD5 of the header and payload of the new package
+	           (2+) size of the new package
+	           (2+) payload compression, length, compression parameters
+	           (3+) length of the header in the new data, and the
+	                offset adjustments of the external copies
+	lead       length, lead and signature of the new package
+	           offset of the payload format in the header's data store
+	copies     number of internal and external copies, then the
+	           internal copies, and the external copies
+	           length of the external data (64 bits from version 3)
+	add data   length, data
+	int data   length (64 bits from version 3), data
+
+Every number is big-endian, and 32 bits unless noted. The arrays of pairs
+are stored as all of the first members, then all of the second members.
+Deltas made with "makedeltarpm -u" (rpm-only deltas) start with the magic
+"drpm" instead of an rpm lead, and hold the header of the new package in its
+new data.
+*/
+
+// The magic numbers starting the data of a delta rpm, and rpm-only deltas.
+const (
+	deltaMagic        = "DLT"
+	deltaRPMOnlyMagic = "drpm"
+)
+
+// Limits on the counts and lengths read from a delta rpm.
+const (
+	deltaMaxString = 1 << 16
+	deltaMaxCopies = 1 << 24
+
+	// The sequence lists files of the old header, and the lead holds a
+	// signature header, neither of which can be larger than a header.
+	deltaMaxSequence = md5.Size + maxHeaderData
+	deltaMaxLead     = leadSize + 16 + 16*maxHeaderTags + maxHeaderData + 7
+)
+
+// The names of deltarpm's compression types, by number.
+var deltaCompressors = []string{"uncompressed", "gzip", "bzip2", "gzip.rsyncable", "lzma", "xz", "zstd"}
+
+/*
+A DeltaIntCopy copies data from the internal data of a delta, after making a
+number of external copies.
+*/
+type DeltaIntCopy struct {
+	ExtCopies uint32
+	Len       uint32
+}
+
+/*
+A DeltaExtCopy copies data from the external data a delta is applied to: the
+files of the old package. Offset is from the end of the previous copy.
+*/
+type DeltaExtCopy struct {
+	Offset int32
+	Len    uint32
+}
+
+/*
+A DeltaOffsetAdjust adds to the offset of the external copies, once a number
+of them have been made since the previous adjustment, for external data
+beyond the reach of their 32-bit offsets.
+*/
+type DeltaOffsetAdjust struct {
+	ExtCopies uint32
+	Adjust    int32
+}
+
+/*
+A Delta is a delta rpm, as read by ReadDelta.
+*/
+type Delta struct {
+	// Version is the version of the delta format, 1 to 3.
+	Version int
+
+	// RPMOnly is set for deltas made from packages alone, rather than
+	// from the files of an installed package.
+	RPMOnly bool
+
+	// Header is the header of the new package, with its payload format
+	// changed to "drpm". Rpm-only deltas have none.
+	Header *Header
+
+	// SourceNEVR is the name-[epoch:]version-release of the old package.
+	SourceNEVR string
+
+	// Sequence starts with an MD5 digest of the files of the old package
+	// the delta uses, followed by their numbers in the old header.
+	Sequence []byte
+
+	// TargetMD5 is the MD5 digest of the header and payload of the new
+	// package, and TargetSize its size.
+	TargetMD5  []byte
+	TargetSize uint32
+
+	// TargetCompressor is the compression of the new payload: one of
+	// "uncompressed", "gzip", "bzip2", "gzip.rsyncable", "lzma", "xz" and
+	// "zstd", at level TargetCompressionLevel, with the parameters deltarpm
+	// keeps to reproduce it.
+	TargetCompressor       string
+	TargetCompressionLevel int
+	TargetCompressionParam []byte
+
+	// TargetHeaderLen is the length of the header at the start of the new
+	// data, for rpm-only deltas.
+	TargetHeaderLen uint32
+
+	// TargetLead is the lead and signature header of the new package.
+	TargetLead []byte
+
+	// PayloadFormatOffset is the offset of the payload format in the
+	// data store of Header.
+	PayloadFormatOffset uint32
+
+	OffsetAdjusts []DeltaOffsetAdjust
+	IntCopies     []DeltaIntCopy
+	ExtCopies     []DeltaExtCopy
+
+	// ExtDataLen is the length of the external data the delta is applied
+	// to.
+	ExtDataLen int64
+
+	// AddData, if there is any, is added byte by byte to the data of the
+	// external copies. It is kept compressed, as in the delta.
+	AddData []byte
+
+	// IntData is the data of the internal copies.
+	IntData []byte
+}
+
+/*
+Reads the delta rpm in r. Both the deltas holding the header of the new
+package and rpm-only deltas are read, in versions 1 to 3 of the format.
+
+Reading a delta does not mean it can be applied: Apply only reproduces
+packages whose payloads Go's compressors write byte for byte, which excludes
+those of distributions, while ApplyPayload reconstructs the uncompressed
+payload of any delta that is not rpm-only.
+*/
+func ReadDelta(r io.ReaderAt) (*Delta, error) {
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	d := &Delta{}
+	var body io.Reader
+	if string(magic[:]) == deltaRPMOnlyMagic {
+		d.RPMOnly = true
+		body = io.NewSectionReader(r, 4, math.MaxInt64-4)
+	} else {
+		p, err := ReadPackage(r)
+		if err == ErrNotRPM {
+			return nil, ErrNotDelta
+		} else if err != nil {
+			return nil, err
+		}
+		if f := p.Header.GetString(TagPayloadFormat); f != "drpm" {
+			return nil, ErrNotDelta
+		}
+		d.Header = p.Header
+		body = p.RawPayload()
+	}
+
+	rc, err := autoDecompress(body)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if err := d.read(&deltaReader{r: bufio.NewReader(rc)}); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// autoDecompress decompresses r according to the magic it starts with, as
+// deltarpm does with the data of deltas and their add data.
+func autoDecompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(6)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	compressor := ""
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		compressor = "gzip"
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		compressor = "bzip2"
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0}):
+		compressor = "xz"
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		compressor = "zstd"
+	case bytes.HasPrefix(magic, []byte{0x5d, 0, 0}):
+		compressor = "lzma"
+	default:
+		return io.NopCloser(br), nil
+	}
+	rc, err := decompressors[compressor](br)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s data: %v", compressor, err)
+	}
+	return rc, nil
+}
+
+// A deltaReader reads the fields of the data of a delta, keeping the first
+// error.
+type deltaReader struct {
+	r   io.Reader
+	err error
+}
+
+func (dr *deltaReader) bytes(n int64) []byte {
+	if dr.err != nil {
+		return nil
+	}
+	// Read in chunks, so that a bad length cannot make us allocate more
+	// than there is data.
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, dr.r, n); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		dr.err = err
+		return nil
+	}
+	return buf.Bytes()
+}
+
+func (dr *deltaReader) uint32() uint32 {
+	b := dr.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (dr *deltaReader) uint64() uint64 {
+	b := dr.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// length reads a 32-bit length, and checks it is at most max.
+func (dr *deltaReader) length(what string, max int64) int64 {
+	n := int64(dr.uint32())
+	if n > max && dr.err == nil {
+		dr.err = fmt.Errorf("bad %s length %d", what, n)
+	}
+	return n
+}
+
+// pairs reads n pairs of numbers, stored as the first of each, then the
+// second of each.
+func (dr *deltaReader) pairs(n int64) [][2]uint32 {
+	p := make([][2]uint32, 0, min(n, 1<<16))
+	for i := int64(0); i < n && dr.err == nil; i++ {
+		p = append(p, [2]uint32{dr.uint32()})
+	}
+	for i := range p {
+		p[i][1] = dr.uint32()
+	}
+	return p
+}
+
+func (d *Delta) read(dr *deltaReader) error {
+	magic := dr.bytes(4)
+	if dr.err != nil {
+		return fmt.Errorf("reading delta: %v", dr.err)
+	}
+	if string(magic[:3]) != deltaMagic || magic[3] < '1' || magic[3] > '3' {
+		return ErrNotDelta
+	}
+	d.Version = int(magic[3] - '0')
+	if d.RPMOnly && d.Version < 3 {
+		return fmt.Errorf("rpm-only delta of version %d", d.Version)
+	}
+
+	d.SourceNEVR = string(bytes.TrimRight(dr.bytes(dr.length("source", deltaMaxString)), "\x00"))
+	d.Sequence = dr.bytes(dr.length("sequence", deltaMaxSequence))
+	if dr.err == nil && len(d.Sequence) < md5.Size {
+		return fmt.Errorf("bad sequence length %d", len(d.Sequence))
+	}
+	d.TargetMD5 = dr.bytes(md5.Size)
+
+	d.TargetCompressor, d.TargetCompressionLevel = "gzip", 9
+	if d.Version >= 2 {
+		d.TargetSize = dr.uint32()
+		comp := dr.uint32()
+		if int(comp&0xff) >= len(deltaCompressors) && dr.err == nil {
+			return fmt.Errorf("unsupported compression %#x", comp)
+		}
+		d.TargetCompressor, d.TargetCompressionLevel = deltaCompressors[comp&0xff], int(comp>>8&0xff)
+		d.TargetCompressionParam = dr.bytes(dr.length("compression parameter", deltaMaxString))
+	}
+	if d.Version >= 3 {
+		d.TargetHeaderLen = dr.uint32()
+		for _, p := range dr.pairs(dr.length("offset adjustment", deltaMaxCopies)) {
+			d.OffsetAdjusts = append(d.OffsetAdjusts, DeltaOffsetAdjust{p[0], int32(p[1])})
+		}
+	}
+	if d.RPMOnly && d.TargetHeaderLen == 0 && dr.err == nil {
+		return errors.New("rpm-only delta without a header length")
+	}
+
+	d.TargetLead = dr.bytes(dr.length("lead", deltaMaxLead))
+	if dr.err == nil && len(d.TargetLead) < leadSize {
+		return fmt.Errorf("bad lead length %d", len(d.TargetLead))
+	}
+	d.PayloadFormatOffset = dr.uint32()
+	nint, next := dr.length("internal copies", deltaMaxCopies), dr.length("external copies", deltaMaxCopies)
+	for _, p := range dr.pairs(nint) {
+		d.IntCopies = append(d.IntCopies, DeltaIntCopy{p[0], p[1]})
+	}
+	for _, p := range dr.pairs(next) {
+		d.ExtCopies = append(d.ExtCopies, DeltaExtCopy{int32(p[0]), p[1]})
+	}
+
+	if d.Version >= 3 {
+		d.ExtDataLen = int64(dr.uint64())
+	} else {
+		d.ExtDataLen = int64(dr.uint32())
+	}
+	// The add data is bounded by the payload size once decompressed, by
+	// newData.
+	d.AddData = dr.bytes(int64(dr.uint32()))
+	var intLen int64
+	if d.Version >= 3 {
+		intLen = int64(dr.uint64())
+	} else {
+		intLen = int64(dr.uint32())
+	}
+	if (intLen < 0 || d.ExtDataLen < 0) && dr.err == nil {
+		return errors.New("bad data length")
+	}
+	d.IntData = dr.bytes(intLen)
+	if dr.err != nil {
+		return fmt.Errorf("reading delta: %v", dr.err)
+	}
+	return nil
+}
+
+/*
+Returns the numbers of the files of the old package the delta uses, in the
+order their data is laid out in the external data.
+
+After its MD5 digest, the sequence is a list of numbers stored in nibbles,
+high nibble first: each nibble holds 3 bits of a number, most significant
+first, and has its 8 bit set if more follow. The numbers alternate between
+runs of consecutive files, starting with the first, and jumps from the file
+after a run to the first of the next: even jumps go forward by half their
+value, odd ones back by half of one more.
+*/
+func (d *Delta) SequenceFiles() ([]int, error) {
+	if len(d.Sequence) < md5.Size {
+		return nil, errors.New("sequence too short")
+	}
+	var files []int
+	pos, num, run := 0, 0, true
+	for _, b := range d.Sequence[md5.Size:] {
+		for _, nib := range []byte{b >> 4, b & 0x0f} {
+			if num > math.MaxInt32>>3 {
+				return nil, errors.New("bad sequence")
+			}
+			num = num<<3 | int(nib&7)
+			if nib&8 != 0 {
+				continue
+			}
+			if run {
+				if len(files)+num > len(d.Sequence)*2*8 {
+					return nil, errors.New("bad sequence")
+				}
+				for i := 0; i < num; i++ {
+					files = append(files, pos)
+					pos++
+				}
+			} else if num%2 == 0 {
+				pos += num / 2
+			} else {
+				pos -= (num + 1) / 2
+			}
+			if pos < 0 {
+				return nil, errors.New("bad sequence")
+			}
+			num, run = 0, !run
+		}
+	}
+	return files, nil
+}
+
+/*
+Returns the MD5 digest of the files of a header, as the sequence of a delta
+starts with: for each file, its name, its mode, and its size and digest, the
+target of a symlink or the device number of a device.
+*/
+func sequenceDigest(files []File, seq []int) ([]byte, error) {
+	h := md5.New()
+	var b [4]byte
+	for _, i := range seq {
+		if i >= len(files) {
+			return nil, fmt.Errorf("sequence lists file %d of %d", i, len(files))
+		}
+		f := files[i]
+		io.WriteString(h, f.Name+"\x00")
+		binary.BigEndian.PutUint32(b[:], uint32(f.Mode))
+		h.Write(b[:])
+		switch f.Mode & modeTypeMask {
+		case modeRegular:
+			digest, err := hex.DecodeString(f.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("%s: bad digest %q", f.Name, f.Digest)
+			}
+			binary.BigEndian.PutUint32(b[:], uint32(f.Size))
+			h.Write(b[:])
+			h.Write(digest)
+		case modeSymlink:
+			io.WriteString(h, f.LinkTo+"\x00")
+		case modeChar, modeBlock:
+			binary.BigEndian.PutUint32(b[:], uint32(f.Rdev))
+			h.Write(b[:])
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+/*
+Returns the external data of a delta made against a package: for each file
+of the sequence, a cpio header with nothing but its mode, size, device number
+and name, and its content, as deltarpm lays them out.
+*/
+func deltaExtData(old *Package, seq []int) ([]byte, error) {
+	files, err := old.Header.Files()
+	if err != nil {
+		return nil, err
+	}
+	needed := make(map[int]bool, len(seq))
+	for _, i := range seq {
+		needed[i] = true
+	}
+
+	// Hard links share their content, which the archive holds once.
+	content := make(map[int][]byte)
+	byInode := make(map[[2]uint32][]byte)
+	pr, err := old.Payload()
+	if err != nil {
+		return nil, err
+	}
+	defer pr.Close()
+	for {
+		pf, err := pr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if pf.Index < 0 || (!needed[pf.Index] && pf.NLink < 2) {
+			continue
+		}
+		b, err := io.ReadAll(pr)
+		if err != nil {
+			return nil, err
+		}
+		if pf.Size > 0 {
+			byInode[[2]uint32{pf.File.Device, pf.File.Inode}] = b
+		}
+		content[pf.Index] = b
+	}
+
+	var ext bytes.Buffer
+	cw := newCPIOWriter(&ext)
+	for _, i := range seq {
+		f := files[i]
+		var data []byte
+		switch f.Mode & modeTypeMask {
+		case modeRegular:
+			data = content[i]
+			if int64(len(data)) != f.Size {
+				data = byInode[[2]uint32{f.Device, f.Inode}]
+			}
+			if int64(len(data)) != f.Size {
+				return nil, fmt.Errorf("%s: content missing from the old package", f.Name)
+			}
+		case modeSymlink:
+			data = []byte(f.LinkTo)
+		}
+		name := f.Name
+		if len(name) > 0 && name[0] == '/' {
+			name = name[1:]
+		}
+		h := &CPIOHeader{
+			Name:      "./" + name,
+			Mode:      uint32(f.Mode),
+			NLink:     1,
+			Size:      int64(len(data)),
+			RDevMajor: uint32(f.Rdev) >> 8 & 0xff,
+			RDevMinor: uint32(f.Rdev) & 0xff,
+			ModTime:   time.Unix(0, 0),
+			Index:     -1,
+		}
+		if err := cw.writeHeader(h); err != nil {
+			return nil, err
+		}
+		if _, err := cw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := cw.align(); err != nil {
+			return nil, err
+		}
+	}
+	return ext.Bytes(), nil
+}
+
+/*
+Returns the size of the uncompressed payload of the new package, as its
+signature declares it.
+*/
+func (d *Delta) payloadSize() (int64, error) {
+	if len(d.TargetLead) <= leadSize {
+		return 0, errors.New("the new package has no signature")
+	}
+	sig, _, err := readHeader(bytes.NewReader(d.TargetLead), leadSize)
+	if err != nil {
+		return 0, fmt.Errorf("signature: %v", err)
+	}
+	size, ok := sig.GetInt(SigTagLongArchiveSize)
+	if !ok {
+		size, ok = sig.GetInt(SigTagPayloadSize)
+	}
+	if !ok || size < 0 {
+		return 0, errors.New("the new package does not declare the size of its payload")
+	}
+	return size, nil
+}
+
+/*
+Returns the uncompressed new data of the delta, made from its copies out of
+the internal data and the external data ext. The data, and the add data
+making it, must be of the given size, or an error is returned as soon as they
+go beyond it.
+*/
+func (d *Delta) newData(ext []byte, size int64) ([]byte, error) {
+	var add []byte
+	if len(d.AddData) > 0 {
+		rc, err := autoDecompress(bytes.NewReader(d.AddData))
+		if err != nil {
+			return nil, fmt.Errorf("add data: %v", err)
+		}
+		add, err = io.ReadAll(io.LimitReader(rc, size+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("add data: %v", err)
+		}
+		if int64(len(add)) > size {
+			return nil, errors.New("add data larger than the new payload")
+		}
+	}
+
+	var out bytes.Buffer
+	var extOff, intOff int64
+	next, adjusts, sinceAdjust := 0, d.OffsetAdjusts, uint32(0)
+	extCopy := func() error {
+		if next >= len(d.ExtCopies) {
+			return errors.New("not enough external copies")
+		}
+		if len(adjusts) > 0 && sinceAdjust == adjusts[0].ExtCopies {
+			extOff += int64(adjusts[0].Adjust)
+			adjusts, sinceAdjust = adjusts[1:], 0
+		}
+		c := d.ExtCopies[next]
+		next, sinceAdjust = next+1, sinceAdjust+1
+		extOff += int64(c.Offset)
+		end := extOff + int64(c.Len)
+		if extOff < 0 || end > int64(len(ext)) {
+			return fmt.Errorf("external copy of %d bytes at %d out of range", c.Len, extOff)
+		}
+		if int64(out.Len())+int64(c.Len) > size {
+			return errors.New("new data larger than the new payload")
+		}
+		b := ext[extOff:end]
+		if add != nil {
+			if int64(len(add)) < int64(c.Len) {
+				return errors.New("add data too short")
+			}
+			b = append([]byte(nil), b...)
+			for i := range b {
+				b[i] += add[i]
+			}
+			add = add[c.Len:]
+		}
+		out.Write(b)
+		extOff = end
+		return nil
+	}
+
+	for _, c := range d.IntCopies {
+		for i := uint32(0); i < c.ExtCopies; i++ {
+			if err := extCopy(); err != nil {
+				return nil, err
+			}
+		}
+		end := intOff + int64(c.Len)
+		if end > int64(len(d.IntData)) {
+			return nil, fmt.Errorf("internal copy of %d bytes at %d out of range", c.Len, intOff)
+		}
+		if int64(out.Len())+int64(c.Len) > size {
+			return nil, errors.New("new data larger than the new payload")
+		}
+		out.Write(d.IntData[intOff:end])
+		intOff = end
+	}
+	if next != len(d.ExtCopies) || intOff != int64(len(d.IntData)) || len(add) != 0 {
+		return nil, errors.New("delta data left over")
+	}
+	if int64(out.Len()) != size {
+		return nil, fmt.Errorf("new data of %d bytes for a payload of %d", out.Len(), size)
+	}
+	return out.Bytes(), nil
+}
+
+// compressPayload compresses the new payload as the delta says the new
+// package had it.
+func (d *Delta) compressPayload(data []byte) ([]byte, error) {
+	if len(d.TargetCompressionParam) > 0 {
+		return nil, fmt.Errorf("unsupported %s compression parameters", d.TargetCompressor)
+	}
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch d.TargetCompressor {
+	case "uncompressed":
+		return data, nil
+	case "gzip":
+		w, err = gzip.NewWriterLevel(&buf, d.TargetCompressionLevel)
+	case "xz":
+		w, err = xz.NewWriter(&buf)
+	case "zstd":
+		w, err = zstd.NewWriter(&buf, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(d.TargetCompressionLevel)))
+	default:
+		return nil, fmt.Errorf("unsupported payload compressor %q", d.TargetCompressor)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+Returns the uncompressed payload of the new package, made from the files of
+the old package and the delta.
+*/
+func (d *Delta) newPayload(old *Package) ([]byte, error) {
+	if d.RPMOnly || d.Header == nil {
+		return nil, errors.New("rpm-only deltas are not supported")
+	}
+	if old.Header.Name()+"-"+old.Header.EVR() != d.SourceNEVR {
+		return nil, ErrDeltaMismatch
+	}
+
+	seq, err := d.SequenceFiles()
+	if err != nil {
+		return nil, err
+	}
+	files, err := old.Header.Files()
+	if err != nil {
+		return nil, err
+	}
+	digest, err := sequenceDigest(files, seq)
+	if err != nil || !bytes.Equal(digest, d.Sequence[:md5.Size]) {
+		return nil, ErrDeltaMismatch
+	}
+	ext, err := deltaExtData(old, seq)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(ext)) != d.ExtDataLen {
+		return nil, ErrDeltaMismatch
+	}
+
+	size, err := d.payloadSize()
+	if err != nil {
+		return nil, err
+	}
+	return d.newData(ext, size)
+}
+
+/*
+Reconstructs the new package from the old package and the delta, as
+"applydeltarpm -r old.rpm" does, and writes it to w. The old package must be
+the one the delta was made from, and the reconstructed package must match the
+digest and size the delta holds, or nothing is written: ErrDeltaMismatch and
+ErrDigestMismatch tell these cases apart.
+
+The payload is compressed again with Go's compressors, which write other bytes
+than the ones rpm builds packages with, so the packages of distributions are
+not reproduced, and their deltas fail with ErrDigestMismatch; only payloads
+written by Builder, or left uncompressed, are. ApplyPayload reconstructs the
+uncompressed payload of any package instead. Rpm-only deltas are not
+supported.
+*/
+func (d *Delta) Apply(old *Package, w io.Writer) error {
+	data, err := d.newPayload(old)
+	if err != nil {
+		return err
+	}
+	payload, err := d.compressPayload(data)
+	if err != nil {
+		return err
+	}
+
+	// Put the payload format of the header back.
+	header := append([]byte(nil), d.Header.Bytes()...)
+	nindex, _, err := parseIntro(header)
+	if err != nil {
+		return err
+	}
+	off := 16 + 16*int64(nindex) + int64(d.PayloadFormatOffset)
+	if off+4 > int64(len(header)) || string(header[off:off+4]) != "drpm" {
+		return errors.New("bad payload format offset")
+	}
+	copy(header[off:], "cpio")
+
+	h := md5.New()
+	h.Write(header)
+	h.Write(payload)
+	if !bytes.Equal(h.Sum(nil), d.TargetMD5) {
+		return ErrDigestMismatch
+	}
+	if d.Version >= 2 && uint32(len(d.TargetLead)+len(header)+len(payload)) != d.TargetSize {
+		return ErrDigestMismatch
+	}
+
+	for _, b := range [][]byte{d.TargetLead, header, payload} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Reconstructs the uncompressed payload of the new package from the old package
+and the delta, and writes it to w. Unlike Apply, this does not depend on
+compressing the payload as the new package had it. The payload must match
+the payload digest (PAYLOADDIGESTALT) of the new header, or nothing is
+written, and ErrDigestMismatch is returned; headers without that digest are
+an error.
+*/
+func (d *Delta) ApplyPayload(old *Package, w io.Writer) error {
+	data, err := d.newPayload(old)
+	if err != nil {
+		return err
+	}
+
+	expected := d.Header.GetStrings(TagPayloadDigestAlt)
+	n, _ := d.Header.GetInt(TagPayloadDigestAlgo)
+	algo := hashAlgorithms[n]
+	if len(expected) == 0 || algo == 0 || !algo.Available() {
+		return errors.New("the new header has no usable payload digest")
+	}
+	h := algo.New()
+	h.Write(data)
+	if hex.EncodeToString(h.Sum(nil)) != expected[0] {
+		return ErrDigestMismatch
+	}
+	_, err = w.Write(data)
+	return err
+}
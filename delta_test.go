@@ -0,0 +1,474 @@
+package rpm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// deltaPackages builds the old and new packages of the delta tests.
+func deltaPackages(t *testing.T) (old *Package, newRPM []byte) {
+	b := testBuilder()
+	b.Package.Version = "1.0"
+	b.Files[0].Data = []byte("#!/bin/sh\necho hi\n")
+	old = buildTestPackage(t, b)
+	return old, mustBytes(t, testBuilder())
+}
+
+// deltaData holds what a test delta is made of.
+type deltaData struct {
+	seq       []int
+	intCopies []DeltaIntCopy
+	extCopies []DeltaExtCopy
+	add       []byte
+	intData   []byte
+}
+
+// makeDelta encodes a delta rpm of version 3 turning old into newRPM.
+func makeDelta(t *testing.T, old *Package, newRPM []byte, dd deltaData) []byte {
+	p, err := ReadPackage(bytes.NewReader(newRPM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := old.Header.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seqDigest, err := sequenceDigest(files, dd.seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext, err := deltaExtData(old, dd.seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := append([]byte(nil), p.Header.Bytes()...)
+	leadLen := len(newRPM) - len(header) - int(int64(len(newRPM))-p.PayloadOffset)
+	payload := newRPM[p.PayloadOffset:]
+	sum := md5.Sum(append(append([]byte(nil), header...), payload...))
+
+	// Find the payload format in the data store, and change it to "drpm".
+	nindex := int(binary.BigEndian.Uint32(header[8:]))
+	fmtOff := -1
+	for i := 0; i < nindex; i++ {
+		e := header[16+16*i:]
+		if Tag(binary.BigEndian.Uint32(e)) == TagPayloadFormat {
+			fmtOff = int(binary.BigEndian.Uint32(e[8:]))
+		}
+	}
+	if fmtOff < 0 {
+		t.Fatal("no payload format")
+	}
+	copy(header[16+16*nindex+fmtOff:], "drpm")
+
+	var body bytes.Buffer
+	u32 := func(n uint32) { binary.Write(&body, binary.BigEndian, n) }
+	nevr := old.Header.Name() + "-" + old.Header.EVR() + "\x00"
+	body.WriteString("DLT3")
+	u32(uint32(len(nevr)))
+	body.WriteString(nevr)
+	seq := append(seqDigest, encodeSequence(dd.seq)...)
+	u32(uint32(len(seq)))
+	body.Write(seq)
+	body.Write(sum[:])
+	u32(uint32(len(newRPM)))
+	u32(1 | 9<<8)
+	u32(0)
+	u32(0)
+	u32(0)
+	u32(uint32(leadLen))
+	body.Write(newRPM[:leadLen])
+	u32(uint32(fmtOff))
+	u32(uint32(len(dd.intCopies)))
+	u32(uint32(len(dd.extCopies)))
+	for _, c := range dd.intCopies {
+		u32(c.ExtCopies)
+	}
+	for _, c := range dd.intCopies {
+		u32(c.Len)
+	}
+	for _, c := range dd.extCopies {
+		u32(uint32(c.Offset))
+	}
+	for _, c := range dd.extCopies {
+		u32(c.Len)
+	}
+	binary.Write(&body, binary.BigEndian, uint64(len(ext)))
+	u32(uint32(len(dd.add)))
+	body.Write(dd.add)
+	binary.Write(&body, binary.BigEndian, uint64(len(dd.intData)))
+	body.Write(dd.intData)
+
+	drpm := bytes.NewBuffer(append(append([]byte(nil), newRPM[:leadLen]...), header...))
+	zw := gzip.NewWriter(drpm)
+	zw.Write(body.Bytes())
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return drpm.Bytes()
+}
+
+// encodeSequence encodes file numbers as the sequence of a delta does.
+func encodeSequence(files []int) []byte {
+	var nibbles []byte
+	number := func(n int) {
+		var groups []byte
+		for {
+			groups = append([]byte{byte(n & 7)}, groups...)
+			if n >>= 3; n == 0 {
+				break
+			}
+		}
+		for i, g := range groups {
+			if i < len(groups)-1 {
+				g |= 8
+			}
+			nibbles = append(nibbles, g)
+		}
+	}
+	pos := 0
+	for i := 0; i < len(files); {
+		// Runs and jumps alternate, starting with a run.
+		if i == 0 && files[0] != 0 {
+			number(0)
+		}
+		if i > 0 || files[0] != 0 {
+			if files[i] >= pos {
+				number(2 * (files[i] - pos))
+			} else {
+				number(2*(pos-files[i]) - 1)
+			}
+		}
+		run := 1
+		for i+run < len(files) && files[i+run] == files[i]+run {
+			run++
+		}
+		number(run)
+		pos, i = files[i]+run, i+run
+	}
+	if len(nibbles)%2 != 0 {
+		nibbles = append(nibbles, 0)
+	}
+	var b []byte
+	for i := 0; i < len(nibbles); i += 2 {
+		b = append(b, nibbles[i]<<4|nibbles[i+1])
+	}
+	return b
+}
+
+// payloadFiles returns the numbers of the files of a package with content
+// in its payload.
+func payloadFiles(t *testing.T, p *Package) []int {
+	files, err := p.Header.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seq []int
+	for i, f := range files {
+		if f.Mode&modeTypeMask != modeDir && f.Flags&FileGhost == 0 {
+			seq = append(seq, i)
+		}
+	}
+	return seq
+}
+
+func TestDeltaApply(t *testing.T) {
+	old, newRPM := deltaPackages(t)
+	p, err := ReadPackage(bytes.NewReader(newRPM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := p.DecompressedPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newData, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq := payloadFiles(t, old)
+	ext, err := deltaExtData(old, seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Copy what the external data has in common with the new data, and
+	// the rest from the internal data.
+	common := 0
+	for common < len(ext) && common < len(newData) && ext[common] == newData[common] {
+		common++
+	}
+	// Or add the difference to the whole of the external data.
+	n := min(len(ext), len(newData))
+	diff := make([]byte, n)
+	for i := range diff {
+		diff[i] = newData[i] - ext[i]
+	}
+	var add bytes.Buffer
+	zw := gzip.NewWriter(&add)
+	zw.Write(diff)
+	zw.Close()
+
+	tests := map[string]deltaData{
+		"copies": {
+			seq:       seq,
+			extCopies: []DeltaExtCopy{{0, uint32(common)}},
+			intCopies: []DeltaIntCopy{{1, uint32(len(newData) - common)}},
+			intData:   newData[common:],
+		},
+		"add data": {
+			seq:       seq,
+			extCopies: []DeltaExtCopy{{0, uint32(n)}},
+			intCopies: []DeltaIntCopy{{1, uint32(len(newData) - n)}},
+			add:       add.Bytes(),
+			intData:   newData[n:],
+		},
+	}
+	for name, dd := range tests {
+		drpm := makeDelta(t, old, newRPM, dd)
+		d, err := ReadDelta(bytes.NewReader(drpm))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if d.Version != 3 || d.SourceNEVR != "hello-1:1.0-3" || d.TargetCompressor != "gzip" || d.TargetCompressionLevel != 9 {
+			t.Errorf("%s: wrong delta; got version %d, source %q, compression %s %d", name, d.Version, d.SourceNEVR, d.TargetCompressor, d.TargetCompressionLevel)
+		}
+		if got, err := d.SequenceFiles(); err != nil || fmt.Sprint(got) != fmt.Sprint(seq) {
+			t.Errorf("%s: wrong sequence; got %v (%v) wanted %v", name, got, err, seq)
+		}
+
+		var out bytes.Buffer
+		if err := d.Apply(old, &out); err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !bytes.Equal(out.Bytes(), newRPM) {
+			t.Errorf("%s: reconstructed package differs", name)
+		}
+	}
+
+	dd := tests["copies"]
+	d, err := ReadDelta(bytes.NewReader(makeDelta(t, old, newRPM, dd)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := d.Apply(p, &out); err != ErrDeltaMismatch {
+		t.Errorf("applied to the wrong package; got %v wanted %v", err, ErrDeltaMismatch)
+	}
+	d.TargetMD5[0] ^= 1
+	if err := d.Apply(old, &out); err != ErrDigestMismatch {
+		t.Errorf("wrong digest; got %v wanted %v", err, ErrDigestMismatch)
+	}
+	if out.Len() != 0 {
+		t.Errorf("%d bytes written for failed reconstructions", out.Len())
+	}
+	d.TargetMD5[0] ^= 1
+
+	// The uncompressed payload is reconstructed whatever the compression.
+	out.Reset()
+	if err := d.ApplyPayload(old, &out); err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(out.Bytes(), newData) {
+		t.Errorf("reconstructed payload differs")
+	}
+	d.TargetCompressor = "bzip2"
+	out.Reset()
+	if err := d.ApplyPayload(old, &out); err != nil {
+		t.Errorf("bzip2: %v", err)
+	}
+	d.TargetCompressor = "gzip"
+	d.IntData[0] ^= 1
+	out.Reset()
+	if err := d.ApplyPayload(old, &out); err != ErrDigestMismatch || out.Len() != 0 {
+		t.Errorf("wrong payload; got %v wanted %v", err, ErrDigestMismatch)
+	}
+	d.IntData[0] ^= 1
+
+	d.Sequence[0] ^= 1
+	if err := d.Apply(old, &out); err != ErrDeltaMismatch {
+		t.Errorf("wrong sequence digest; got %v wanted %v", err, ErrDeltaMismatch)
+	}
+}
+
+func TestReadDeltaErrors(t *testing.T) {
+	old, newRPM := deltaPackages(t)
+	if _, err := ReadDelta(bytes.NewReader(newRPM)); err != ErrNotDelta {
+		t.Errorf("package read as a delta; got %v wanted %v", err, ErrNotDelta)
+	}
+	if _, err := ReadDelta(bytes.NewReader(bytes.Repeat([]byte("hello, world\n"), 20))); err != ErrNotDelta {
+		t.Errorf("text read as a delta; got %v wanted %v", err, ErrNotDelta)
+	}
+
+	drpm := makeDelta(t, old, newRPM, deltaData{seq: payloadFiles(t, old)})
+	p, err := ReadPackage(bytes.NewReader(drpm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int64{0, 10, 40} {
+		raw, _ := io.ReadAll(p.RawPayload())
+		zr, _ := gzip.NewReader(bytes.NewReader(raw))
+		body, _ := io.ReadAll(zr)
+
+		var short bytes.Buffer
+		short.Write(drpm[:p.PayloadOffset])
+		zw := gzip.NewWriter(&short)
+		zw.Write(body[:n])
+		zw.Close()
+		if _, err := ReadDelta(bytes.NewReader(short.Bytes())); err == nil {
+			t.Errorf("no error for a delta cut after %d bytes", n)
+		}
+	}
+
+	// A lead too long to hold a signature header.
+	raw, _ := io.ReadAll(p.RawPayload())
+	zr, _ := gzip.NewReader(bytes.NewReader(raw))
+	body, _ := io.ReadAll(zr)
+	i := bytes.Index(body, drpm[:4])
+	if i < 4 {
+		t.Fatal("no lead in the delta")
+	}
+	binary.BigEndian.PutUint32(body[i-4:], deltaMaxLead+1)
+	var long bytes.Buffer
+	long.Write(drpm[:p.PayloadOffset])
+	zw := gzip.NewWriter(&long)
+	zw.Write(body)
+	zw.Close()
+	if _, err := ReadDelta(bytes.NewReader(long.Bytes())); err == nil || !strings.Contains(err.Error(), "bad lead length") {
+		t.Errorf("wrong error for a lead of %d bytes; got %v", deltaMaxLead+1, err)
+	}
+}
+
+func TestDeltaSequenceFiles(t *testing.T) {
+	tests := []struct {
+		seq      []byte
+		expected string
+	}{
+		{[]byte{0x34, 0x27, 0x10}, "[0 1 2 5 6 3]"},
+		{[]byte{0x91}, "[0 1 2 3 4 5 6 7 8]"},
+		{[]byte{0x04, 0x20}, "[2 3]"},
+		{[]byte{}, "[]"},
+	}
+	for _, test := range tests {
+		d := &Delta{Sequence: append(make([]byte, md5.Size), test.seq...)}
+		files, err := d.SequenceFiles()
+		if err != nil {
+			t.Errorf("%x: %v", test.seq, err)
+			continue
+		}
+		t.Logf("expecting %s", test.expected)
+		if got := fmt.Sprint(files); got != test.expected {
+			t.Errorf("%x: wrong files; got %s wanted %s", test.seq, got, test.expected)
+		}
+		if got := encodeSequence(files); !bytes.Equal(got, test.seq) && len(test.seq) > 0 {
+			t.Errorf("%s: wrong encoding; got %x wanted %x", test.expected, got, test.seq)
+		}
+	}
+
+	d := &Delta{Sequence: append(make([]byte, md5.Size), 0x01, 0x30)}
+	if _, err := d.SequenceFiles(); err == nil {
+		t.Errorf("no error for a jump before the first file")
+	}
+}
+
+func TestDeltaNewData(t *testing.T) {
+	d := &Delta{
+		ExtCopies:     []DeltaExtCopy{{2, 3}, {-5, 2}, {4, 1}},
+		IntCopies:     []DeltaIntCopy{{1, 2}, {1, 0}, {1, 1}},
+		OffsetAdjusts: []DeltaOffsetAdjust{{2, 3}},
+		IntData:       []byte("XYZ"),
+	}
+	got, err := d.newData([]byte("abcdefghijklmnop"), 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "cdeXYabjZ"
+	t.Logf("expecting %q", expected)
+	if string(got) != expected {
+		t.Errorf("wrong data; got %q wanted %q", got, expected)
+	}
+
+	for _, size := range []int64{0, 8, 10} {
+		if _, err := d.newData([]byte("abcdefghijklmnop"), size); err == nil {
+			t.Errorf("no error for new data of 9 bytes with a payload of %d", size)
+		}
+	}
+
+	// Copying the same external data over and over stops at the size of
+	// the payload.
+	loop := &Delta{IntCopies: []DeltaIntCopy{{1 << 20, 0}}}
+	for i := 0; i < 1<<20; i++ {
+		loop.ExtCopies = append(loop.ExtCopies, DeltaExtCopy{-16, 16})
+	}
+	loop.ExtCopies[0].Offset = 0
+	if _, err := loop.newData([]byte("abcdefghijklmnop"), 1<<10); err == nil {
+		t.Errorf("no error for repeated copies beyond the payload")
+	}
+
+	d.ExtCopies[1].Offset = -6
+	if _, err := d.newData([]byte("abcdefghijklmnop"), 9); err == nil {
+		t.Errorf("no error for a copy before the external data")
+	}
+	d.ExtCopies[1].Offset = -5
+	d.IntData = []byte("XYZW")
+	if _, err := d.newData([]byte("abcdefghijklmnop"), 10); err == nil {
+		t.Errorf("no error for unused internal data")
+	}
+}
+
+// TestDeltaMakedeltarpm applies a delta made by deltarpm's makedeltarpm; see
+// testdata/delta/README for how the files it needs are made.
+func TestDeltaMakedeltarpm(t *testing.T) {
+	drpm, err := os.ReadFile("testdata/delta/hello-1.0-1_2.0-1.noarch.drpm")
+	if os.IsNotExist(err) {
+		t.Skip("no delta made by makedeltarpm in testdata/delta")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) *Package {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := ReadPackage(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return p
+	}
+	old, newPkg := read("testdata/delta/hello-1.0-1.noarch.rpm"), read("testdata/delta/hello-2.0-1.noarch.rpm")
+
+	d, err := ReadDelta(bytes.NewReader(drpm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := old.Header.Name() + "-" + old.Header.EVR()
+	t.Logf("expecting %q", expected)
+	if d.SourceNEVR != expected {
+		t.Errorf("wrong source; got %q wanted %q", d.SourceNEVR, expected)
+	}
+
+	rc, err := newPkg.DecompressedPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := d.ApplyPayload(old, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), payload) {
+		t.Errorf("reconstructed payload differs from that of the new package")
+	}
+}
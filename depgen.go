@@ -0,0 +1,497 @@
+package rpm
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nesv/rpm/spec"
+)
+
+/*
+A DependencyGenerator works out what a file provides and requires, like the
+dependency generators rpmbuild runs on the files it packages.
+*/
+type DependencyGenerator interface {
+	Dependencies(f *GeneratorFile) (provides, requires []spec.Dependency, err error)
+}
+
+/*
+A DependencyGeneratorFunc is a function used as a DependencyGenerator.
+*/
+type DependencyGeneratorFunc func(f *GeneratorFile) (provides, requires []spec.Dependency, err error)
+
+func (fn DependencyGeneratorFunc) Dependencies(f *GeneratorFile) ([]spec.Dependency, []spec.Dependency, error) {
+	return fn(f)
+}
+
+/*
+A GeneratorFile is a regular file of a package, as given to a
+DependencyGenerator.
+*/
+type GeneratorFile struct {
+	// Name is the absolute path of the file once installed.
+	Name string
+	Mode fs.FileMode
+	Size int64
+
+	// Magic describes the type of the file, as FileMagic does.
+	Magic string
+
+	// Content reads the content of the file.
+	Content io.ReaderAt
+}
+
+/*
+A FileAttr runs a DependencyGenerator on the files it matches, like the file
+attributes rpmbuild reads from its fileattrs directory. A file matches if its
+name matches Path or its magic matches Magic (both, with MagicAndPath), and
+neither ExcludePath nor ExcludeMagic match.
+*/
+type FileAttr struct {
+	Name string
+
+	Path         *regexp.Regexp
+	Magic        *regexp.Regexp
+	ExcludePath  *regexp.Regexp
+	ExcludeMagic *regexp.Regexp
+
+	// MagicAndPath and ExecutableOnly are rpm's magic_and_path and
+	// exeonly flags: the file must match both Path and Magic, or be
+	// executable by someone.
+	MagicAndPath   bool
+	ExecutableOnly bool
+
+	Generator DependencyGenerator
+}
+
+/*
+Reports whether the file attribute applies to the file.
+*/
+func (a *FileAttr) Matches(f *GeneratorFile) bool {
+	if a.ExecutableOnly && f.Mode&0111 == 0 {
+		return false
+	}
+	if (a.ExcludePath != nil && a.ExcludePath.MatchString(f.Name)) ||
+		(a.ExcludeMagic != nil && a.ExcludeMagic.MatchString(f.Magic)) {
+		return false
+	}
+	pathOK := a.Path != nil && a.Path.MatchString(f.Name)
+	magicOK := a.Magic != nil && a.Magic.MatchString(f.Magic)
+	if a.MagicAndPath {
+		return pathOK && magicOK
+	}
+	return pathOK || magicOK
+}
+
+/*
+The file attributes of rpm's elf, script and pkgconfig generators:
+
+  - ELF shared objects provide their SONAME and the symbol versions they
+    define, and executable ELF files require the libraries they were linked
+    against (DT_NEEDED) and the symbol versions they use, as in
+    "libc.so.6(GLIBC_2.34)(64bit)",
+  - executable scripts require the interpreter named on their "#!" line,
+  - pkg-config files provide "pkgconfig(name) = version", and require the
+    modules listed in their Requires and Requires.private fields, along with
+    /usr/bin/pkg-config.
+*/
+var DefaultFileAttrs = []FileAttr{
+	{
+		Name:        "elf",
+		Magic:       regexp.MustCompile(`^(setuid,? )?(setgid,? )?(sticky )?ELF (32|64)-bit.*$`),
+		ExcludePath: regexp.MustCompile(`^/lib/modules/.*\.ko?(\.[[:alnum:]]*)$`),
+		Generator:   DependencyGeneratorFunc(elfDependencies),
+	},
+	{
+		Name:           "script",
+		Magic:          regexp.MustCompile(`^.* script,? .*$`),
+		ExecutableOnly: true,
+		Generator:      DependencyGeneratorFunc(scriptDependencies),
+	},
+	{
+		Name:      "pkgconfig",
+		Path:      regexp.MustCompile(`^((/usr/lib(64)?|/usr/share)/pkgconfig/.*\.pc|/usr/bin/pkg-config)$`),
+		Generator: DependencyGeneratorFunc(pkgconfigDependencies),
+	},
+}
+
+/*
+Returns a description of the type of a file from the start of its content,
+in the words of file(1) and libmagic, which fileattrs match against: in
+example "ELF 64-bit LSB shared object", "a /usr/bin/python3 script, ASCII text
+executable", "ASCII text" or "data". Only the types rpm's own generators look
+for are told apart.
+*/
+func FileMagic(mode fs.FileMode, data []byte) string {
+	var prefix []string
+	for _, bit := range []struct {
+		mode fs.FileMode
+		name string
+	}{{fs.ModeSetuid, "setuid"}, {fs.ModeSetgid, "setgid"}, {fs.ModeSticky, "sticky"}} {
+		if mode&bit.mode != 0 {
+			prefix = append(prefix, bit.name)
+		}
+	}
+	magic := func(s string) string {
+		if len(prefix) == 0 {
+			return s
+		}
+		return strings.Join(prefix, ", ") + " " + s
+	}
+
+	switch {
+	case len(data) == 0:
+		return magic("empty")
+	case len(data) >= 20 && bytes.HasPrefix(data, []byte(elf.ELFMAG)):
+		class := map[byte]string{1: "32-bit", 2: "64-bit"}[data[elf.EI_CLASS]]
+		order := map[byte]string{1: "LSB", 2: "MSB"}[data[elf.EI_DATA]]
+		if class == "" || order == "" {
+			return magic("data")
+		}
+		typ := uint16(data[16]) | uint16(data[17])<<8
+		if order == "MSB" {
+			typ = uint16(data[16])<<8 | uint16(data[17])
+		}
+		kind := map[elf.Type]string{
+			elf.ET_REL:  "relocatable",
+			elf.ET_EXEC: "executable",
+			elf.ET_DYN:  "shared object",
+			elf.ET_CORE: "core file",
+		}[elf.Type(typ)]
+		if kind == "" {
+			kind = "unknown type"
+		}
+		return magic(fmt.Sprintf("ELF %s %s %s", class, order, kind))
+	}
+
+	text := "data"
+	if isText(data) {
+		text = "ASCII text"
+		if mode&0111 != 0 {
+			text += " executable"
+		}
+	}
+	if interp := shebang(data); interp != "" && text != "data" {
+		// Like file(1), name the program env runs.
+		if fields := strings.Fields(string(bytes.SplitN(data[2:], []byte("\n"), 2)[0])); path.Base(interp) == "env" && len(fields) > 1 {
+			interp += " " + fields[1]
+		}
+		return magic(fmt.Sprintf("a %s script, %s", interp, text))
+	}
+	return magic(text)
+}
+
+// isText reports whether data looks like text, without control characters
+// other than whitespace.
+func isText(data []byte) bool {
+	for _, c := range data {
+		if c == 0x7f || (c < 0x20 && !strings.ContainsRune("\t\n\r\f\v\x1b", rune(c))) {
+			return false
+		}
+	}
+	return true
+}
+
+// shebang returns the interpreter named on the "#!" line at the start of
+// data, if it is an absolute path, as rpm's script.req takes it.
+func shebang(data []byte) string {
+	if !bytes.HasPrefix(data, []byte("#!")) {
+		return ""
+	}
+	line := data[2:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return ""
+	}
+	return fields[0]
+}
+
+/*
+Runs the file attributes on the regular files of a package, and returns what
+they provide and require, in order and without duplicates. Files flagged
+%ghost, which have no content, are left out.
+*/
+func GenerateDependencies(files []BuildFile, attrs []FileAttr) (provides, requires []spec.Dependency, err error) {
+	for i := range files {
+		bf := &files[i]
+		if !bf.Mode.IsRegular() || bf.Flags&FileGhost != 0 {
+			continue
+		}
+		p, r, err := generateFileDependencies(bf, attrs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", bf.Name, err)
+		}
+		provides, requires = append(provides, p...), append(requires, r...)
+	}
+	return sortDependencies(provides), sortDependencies(requires), nil
+}
+
+func generateFileDependencies(bf *BuildFile, attrs []FileAttr) (provides, requires []spec.Dependency, err error) {
+	var content io.ReaderAt = bytes.NewReader(bf.Data)
+	size := int64(len(bf.Data))
+	if bf.Path != "" {
+		f, err := os.Open(bf.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return nil, nil, err
+		}
+		content, size = f, info.Size()
+	}
+
+	head := make([]byte, 1024)
+	n, err := content.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	f := &GeneratorFile{Name: bf.Name, Mode: bf.Mode, Size: size, Magic: FileMagic(bf.Mode, head[:n]), Content: content}
+
+	for i := range attrs {
+		a := &attrs[i]
+		if a.Generator == nil || !a.Matches(f) {
+			continue
+		}
+		p, r, err := a.Generator.Dependencies(f)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s generator: %v", a.Name, err)
+		}
+		provides, requires = append(provides, p...), append(requires, r...)
+	}
+	return provides, requires, nil
+}
+
+// sortDependencies sorts dependencies by name, then version, and removes
+// duplicates.
+func sortDependencies(deps []spec.Dependency) []spec.Dependency {
+	sort.SliceStable(deps, func(i, j int) bool {
+		if deps[i].Name != deps[j].Name {
+			return deps[i].Name < deps[j].Name
+		}
+		return deps[i].String() < deps[j].String()
+	})
+	var sorted []spec.Dependency
+	for i, d := range deps {
+		if i == 0 || d != deps[i-1] {
+			sorted = append(sorted, d)
+		}
+	}
+	return sorted
+}
+
+// elfDependencies works out the dependencies of an ELF file the way rpm's
+// elfdeps does. Files that only look like ELF, which elfdeps fails on and
+// rpmbuild then ignores, have no dependencies.
+func elfDependencies(f *GeneratorFile) (provides, requires []spec.Dependency, err error) {
+	provides, requires, err = readELFDependencies(f)
+	if err != nil {
+		return nil, nil, nil
+	}
+	return provides, requires, nil
+}
+
+func readELFDependencies(f *GeneratorFile) (provides, requires []spec.Dependency, err error) {
+	ef, err := elf.NewFile(f.Content)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer ef.Close()
+	if ef.Type != elf.ET_DYN && ef.Type != elf.ET_EXEC {
+		return nil, nil, nil
+	}
+
+	// 64-bit objects are marked, except on Alpha, where they are all
+	// 64-bit.
+	marker := ""
+	if ef.Class == elf.ELFCLASS64 && ef.Machine != elf.EM_ALPHA {
+		marker = "(64bit)"
+	}
+	dep := func(soname, version string) spec.Dependency {
+		if version != "" || marker != "" {
+			soname += "(" + version + ")" + marker
+		}
+		return spec.Dependency{Name: soname}
+	}
+
+	isDSO := ef.Type == elf.ET_DYN
+	isExec := f.Mode&0111 != 0
+	// Position-independent executables are shared objects too, but have
+	// a DT_DEBUG entry, which libraries lack.
+	debug, err := ef.DynValue(elf.DT_DEBUG)
+	if err != nil {
+		return nil, nil, err
+	}
+	hasDebug := len(debug) > 0
+
+	if isDSO && !hasDebug {
+		sonames, err := ef.DynString(elf.DT_SONAME)
+		if err != nil {
+			return nil, nil, err
+		}
+		soname := path.Base(f.Name)
+		if len(sonames) > 0 {
+			soname = sonames[0]
+		}
+		provides = append(provides, dep(soname, ""))
+
+		versions, err := ef.DynamicVersions()
+		if err != nil && ef.Section(".gnu.version_d") != nil {
+			return nil, nil, err
+		}
+		for _, v := range versions {
+			if v.Flags&elf.VER_FLG_BASE == 0 {
+				provides = append(provides, dep(soname, v.Name))
+			}
+		}
+	}
+
+	if !isExec {
+		return provides, nil, nil
+	}
+	needed, err := ef.DynString(elf.DT_NEEDED)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, lib := range needed {
+		requires = append(requires, dep(lib, ""))
+	}
+	needs, err := ef.DynamicVersionNeeds()
+	if err != nil && ef.Section(".gnu.version_r") != nil {
+		return nil, nil, err
+	}
+	for _, need := range needs {
+		for _, v := range need.Needs {
+			requires = append(requires, dep(need.Name, v.Dep))
+		}
+	}
+
+	// Objects with only a GNU-style hash table need a dynamic linker
+	// which understands it.
+	if ef.Section(".gnu.hash") != nil && ef.Section(".hash") == nil {
+		requires = append(requires, spec.Dependency{Name: "rtld(GNU_HASH)"})
+	}
+	return provides, requires, nil
+}
+
+// scriptDependencies requires the interpreter of a script.
+func scriptDependencies(f *GeneratorFile) (provides, requires []spec.Dependency, err error) {
+	head := make([]byte, 1024)
+	n, err := f.Content.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	if interp := shebang(head[:n]); interp != "" {
+		requires = append(requires, spec.Dependency{Name: interp})
+	}
+	return nil, requires, nil
+}
+
+var rePkgconfigVar = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// The comparison operators of pkg-config files, as dependency flags.
+var pkgconfigOperators = map[string]spec.DependencyFlags{
+	"<":  spec.DepLess,
+	"<=": spec.DepLess | spec.DepEqual,
+	"=":  spec.DepEqual,
+	"==": spec.DepEqual,
+	">=": spec.DepGreater | spec.DepEqual,
+	">":  spec.DepGreater,
+}
+
+/*
+pkgconfigDependencies works out the dependencies of a pkg-config file, as
+rpm's pkgconfigdeps.sh does with the help of pkg-config: the module provides
+itself at its version, and requires the modules it lists.
+*/
+func pkgconfigDependencies(f *GeneratorFile) (provides, requires []spec.Dependency, err error) {
+	if !strings.HasSuffix(f.Name, ".pc") {
+		return nil, nil, nil
+	}
+	vars := map[string]string{"pcfiledir": path.Dir(f.Name)}
+	fields := make(map[string]string)
+	expand := func(s string) string {
+		for i := 0; i < 16 && strings.Contains(s, "${"); i++ {
+			s = rePkgconfigVar.ReplaceAllStringFunc(s, func(m string) string {
+				return vars[m[2:len(m)-1]]
+			})
+		}
+		return s
+	}
+
+	s := bufio.NewScanner(io.NewSectionReader(f.Content, 0, f.Size))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.IndexAny(line, ":="); i > 0 {
+			key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+			if line[i] == '=' {
+				vars[key] = expand(value)
+			} else {
+				fields[strings.ToLower(key)] = expand(value)
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	name := strings.TrimSuffix(path.Base(f.Name), ".pc")
+	self := spec.Dependency{Name: "pkgconfig(" + name + ")"}
+	if v := fields["version"]; v != "" {
+		self.Flags, self.Version = spec.DepEqual, v
+	}
+	provides = append(provides, self)
+
+	for _, key := range []string{"requires", "requires.private"} {
+		mods, err := parsePkgconfigModules(fields[key])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", key, err)
+		}
+		requires = append(requires, mods...)
+	}
+	if len(requires) > 0 {
+		requires = append(requires, spec.Dependency{Name: "/usr/bin/pkg-config"})
+	}
+	return provides, requires, nil
+}
+
+// parsePkgconfigModules parses a list of modules, as in
+// "glib-2.0 >= 2.50, zlib".
+func parsePkgconfigModules(s string) ([]spec.Dependency, error) {
+	words := strings.Fields(strings.Replace(s, ",", " ", -1))
+	var deps []spec.Dependency
+	for i := 0; i < len(words); i++ {
+		d := spec.Dependency{Name: "pkgconfig(" + words[i] + ")"}
+		if i+1 < len(words) {
+			if flags, ok := pkgconfigOperators[words[i+1]]; ok {
+				if i+2 >= len(words) {
+					return nil, fmt.Errorf("no version after %s %s", words[i], words[i+1])
+				}
+				d.Flags, d.Version = flags, words[i+2]
+				i += 2
+			} else if words[i+1] == "!=" {
+				// rpm has no such dependencies; the module is
+				// still required.
+				i += 2
+			}
+		}
+		deps = append(deps, d)
+	}
+	return deps, nil
+}
@@ -0,0 +1,250 @@
+package rpm
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/nesv/rpm/spec"
+)
+
+func TestGenerateDependenciesELF(t *testing.T) {
+	tests := []struct {
+		file               BuildFile
+		provides, requires string
+	}{
+		{
+			BuildFile{Name: "/usr/bin/hello", Mode: 0755, Path: "testdata/elf/hello"},
+			"[]",
+			"[libc.so.6()(64bit) libc.so.6(GLIBC_2.2.5)(64bit) libc.so.6(GLIBC_2.34)(64bit) libhello.so.1()(64bit) libhello.so.1(HELLO_1.0)(64bit) rtld(GNU_HASH)]",
+		},
+		{
+			BuildFile{Name: "/usr/lib64/libhello.so.1", Mode: 0755, Path: "testdata/elf/libhello.so.1"},
+			"[libhello.so.1()(64bit) libhello.so.1(HELLO_1.0)(64bit)]",
+			"[libc.so.6()(64bit) libc.so.6(GLIBC_2.2.5)(64bit) rtld(GNU_HASH)]",
+		},
+		{
+			// Only executable files have their requirements generated.
+			BuildFile{Name: "/usr/lib64/libhello.so.1", Mode: 0644, Path: "testdata/elf/libhello.so.1"},
+			"[libhello.so.1()(64bit) libhello.so.1(HELLO_1.0)(64bit)]",
+			"[]",
+		},
+		{
+			// Files the ELF parser rejects have no dependencies.
+			BuildFile{Name: "/usr/lib64/libbroken.so", Mode: 0755, Data: append([]byte("\x7fELF\x02\x01\x01"), make([]byte, 40)...)},
+			"[]",
+			"[]",
+		},
+		{
+			// Kernel modules are left to their own generator.
+			BuildFile{Name: "/lib/modules/6.1/hello.ko.xz", Mode: 0644, Path: "testdata/elf/libhello.so.1"},
+			"[]",
+			"[]",
+		},
+	}
+	for _, test := range tests {
+		provides, requires, err := GenerateDependencies([]BuildFile{test.file}, DefaultFileAttrs)
+		if err != nil {
+			t.Errorf("%s: %v", test.file.Name, err)
+			continue
+		}
+		t.Logf("expecting %q and %q", test.provides, test.requires)
+		if got := fmt.Sprint(provides); got != test.provides {
+			t.Errorf("%s: wrong provides; got %q wanted %q", test.file.Name, got, test.provides)
+		}
+		if got := fmt.Sprint(requires); got != test.requires {
+			t.Errorf("%s: wrong requires; got %q wanted %q", test.file.Name, got, test.requires)
+		}
+	}
+}
+
+func TestGenerateDependencies(t *testing.T) {
+	pc := `prefix=/usr
+libdir=${prefix}/lib64
+includedir=${prefix}/include
+
+Name: demo
+Description: A demo library
+Version: 1.2.3
+Requires: glib-2.0 >= 2.50, zlib
+Requires.private: libfoo != 2, bar = 1.0
+Libs: -L${libdir} -ldemo
+Cflags: -I${includedir}/demo
+`
+	files := []BuildFile{
+		{Name: "/usr/bin/demo", Mode: 0755, Data: []byte("#!/usr/bin/python3 -s\nprint('demo')\n")},
+		{Name: "/usr/bin/demo2", Mode: 0755, Data: []byte("#! /bin/sh\necho demo\n")},
+		{Name: "/usr/share/demo/demo.sh", Mode: 0644, Data: []byte("#!/bin/bash\necho demo\n")},
+		{Name: "/usr/lib64/pkgconfig/demo.pc", Mode: 0644, Data: []byte(pc)},
+		{Name: "/usr/share/pkgconfig/empty.pc", Mode: 0644, Data: []byte("Name: empty\n")},
+		{Name: "/usr/bin/ghost", Mode: 0755, Flags: FileGhost},
+		{Name: "/usr/bin", Mode: fs.ModeDir | 0755},
+	}
+	provides, requires, err := GenerateDependencies(files, DefaultFileAttrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[pkgconfig(demo) = 1.2.3 pkgconfig(empty)]"
+	t.Logf("expecting %q", expected)
+	if got := fmt.Sprint(provides); got != expected {
+		t.Errorf("wrong provides; got %q wanted %q", got, expected)
+	}
+	expected = "[/bin/sh /usr/bin/pkg-config /usr/bin/python3 pkgconfig(bar) = 1.0 pkgconfig(glib-2.0) >= 2.50 pkgconfig(libfoo) pkgconfig(zlib)]"
+	t.Logf("expecting %q", expected)
+	if got := fmt.Sprint(requires); got != expected {
+		t.Errorf("wrong requires; got %q wanted %q", got, expected)
+	}
+
+	bad := []BuildFile{{Name: "/usr/lib64/pkgconfig/bad.pc", Mode: 0644, Data: []byte("Requires: foo >=\n")}}
+	if _, _, err := GenerateDependencies(bad, DefaultFileAttrs); err == nil {
+		t.Errorf("no error for a truncated pkg-config requirement")
+	}
+}
+
+func TestGenerateDependenciesCustom(t *testing.T) {
+	attrs := append([]FileAttr{{
+		Name:  "demo",
+		Path:  regexp.MustCompile(`^/usr/share/demo/`),
+		Magic: regexp.MustCompile(`text`),
+		Generator: DependencyGeneratorFunc(func(f *GeneratorFile) (provides, requires []spec.Dependency, err error) {
+			return []spec.Dependency{{Name: "demo(" + f.Name + ")"}}, nil, nil
+		}),
+		MagicAndPath: true,
+	}}, DefaultFileAttrs...)
+	files := []BuildFile{
+		{Name: "/usr/share/demo/a.txt", Mode: 0644, Data: []byte("text\n")},
+		{Name: "/usr/share/demo/b.bin", Mode: 0644, Data: []byte{0, 1, 2}},
+		{Name: "/usr/share/other/c.txt", Mode: 0644, Data: []byte("text\n")},
+	}
+	provides, _, err := GenerateDependencies(files, attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[demo(/usr/share/demo/a.txt)]"
+	t.Logf("expecting %q", expected)
+	if got := fmt.Sprint(provides); got != expected {
+		t.Errorf("wrong provides; got %q wanted %q", got, expected)
+	}
+}
+
+func TestFileMagic(t *testing.T) {
+	tests := []struct {
+		mode     fs.FileMode
+		data     string
+		expected string
+	}{
+		{0644, "", "empty"},
+		{0644, "hello\n", "ASCII text"},
+		{0644, "\x00\x01\x02", "data"},
+		{0755, "#!/bin/sh\necho\n", "a /bin/sh script, ASCII text executable"},
+		{0644, "#!/usr/bin/env python3\n", "a /usr/bin/env python3 script, ASCII text"},
+		{0755 | fs.ModeSetuid, "#!/bin/sh\n", "setuid a /bin/sh script, ASCII text executable"},
+	}
+	for _, test := range tests {
+		t.Logf("expecting %q", test.expected)
+		if got := FileMagic(test.mode, []byte(test.data)); got != test.expected {
+			t.Errorf("wrong magic for %q; got %q wanted %q", test.data, got, test.expected)
+		}
+	}
+}
+
+func TestFileAttrMatches(t *testing.T) {
+	a := FileAttr{
+		Path:         regexp.MustCompile(`^/usr/bin/`),
+		Magic:        regexp.MustCompile(`script`),
+		ExcludePath:  regexp.MustCompile(`\.debug$`),
+		ExcludeMagic: regexp.MustCompile(`python`),
+	}
+	tests := []struct {
+		name  string
+		mode  fs.FileMode
+		magic string
+		any   bool
+		both  bool
+		exe   bool
+	}{
+		{"/usr/bin/demo", 0755, "a /bin/sh script, ASCII text executable", true, true, true},
+		{"/usr/bin/demo", 0644, "ASCII text", true, false, false},
+		{"/usr/share/demo.sh", 0644, "a /bin/sh script, ASCII text", true, false, false},
+		{"/usr/share/demo.txt", 0755, "ASCII text", false, false, false},
+		{"/usr/bin/demo.debug", 0755, "a /bin/sh script, ASCII text executable", false, false, false},
+		{"/usr/bin/demo.py", 0755, "a /usr/bin/python3 script, ASCII text executable", false, false, false},
+	}
+	for _, test := range tests {
+		f := &GeneratorFile{Name: test.name, Mode: test.mode, Magic: test.magic}
+		a.MagicAndPath, a.ExecutableOnly = false, false
+		if got := a.Matches(f); got != test.any {
+			t.Errorf("%s %q: got %v wanted %v", test.name, test.magic, got, test.any)
+		}
+		a.MagicAndPath = true
+		if got := a.Matches(f); got != test.both {
+			t.Errorf("%s %q with magic and path: got %v wanted %v", test.name, test.magic, got, test.both)
+		}
+		a.ExecutableOnly = true
+		if got := a.Matches(f); got != test.exe {
+			t.Errorf("%s %q executable only: got %v wanted %v", test.name, test.magic, got, test.exe)
+		}
+	}
+}
+
+func TestBuilderFileAttrs(t *testing.T) {
+	mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	pkg := &spec.Package{
+		Name:     "hello",
+		Version:  "2.0",
+		Release:  "3",
+		Summary:  "Says hello",
+		License:  "MIT",
+		Arch:     "x86_64",
+		Requires: []spec.Dependency{{Name: "/usr/bin/python3"}},
+	}
+	build := func() *Header {
+		b := NewBuilder(pkg)
+		b.Files = []BuildFile{
+			{Name: "/usr/bin/hello", Mode: 0755, ModTime: mtime, Path: "testdata/elf/hello"},
+			{Name: "/usr/lib64/libhello.so.1", Mode: 0755, ModTime: mtime, Path: "testdata/elf/libhello.so.1"},
+			{Name: "/usr/bin/hello.py", Mode: 0755, ModTime: mtime, Data: []byte("#!/usr/bin/python3\n")},
+		}
+		b.FileAttrs = DefaultFileAttrs
+		b.BuildTime, b.BuildHost = mtime, "build.example.com"
+		return buildTestPackage(t, b).Header
+	}
+
+	h := build()
+	requires, err := h.Requires()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range requires {
+		if d.Flags&spec.DepRPMLib == 0 {
+			got = append(got, fmt.Sprintf("%s %#x", d, d.Flags))
+		}
+	}
+	expected := "[/usr/bin/python3 0x0 libc.so.6()(64bit) 0x4000 libc.so.6(GLIBC_2.2.5)(64bit) 0x4000 libc.so.6(GLIBC_2.34)(64bit) 0x4000 " +
+		"libhello.so.1()(64bit) 0x4000 libhello.so.1(HELLO_1.0)(64bit) 0x4000 rtld(GNU_HASH) 0x4000]"
+	t.Logf("expecting %q", expected)
+	if fmt.Sprint(got) != expected {
+		t.Errorf("wrong requires; got %q wanted %q", fmt.Sprint(got), expected)
+	}
+	provides, _ := h.Provides()
+	got = nil
+	for _, d := range provides {
+		got = append(got, fmt.Sprintf("%s %#x", d, d.Flags))
+	}
+	expected = "[libhello.so.1()(64bit) 0x8000 libhello.so.1(HELLO_1.0)(64bit) 0x8000 hello = 2.0-3 0x8]"
+	t.Logf("expecting %q", expected)
+	if fmt.Sprint(got) != expected {
+		t.Errorf("wrong provides; got %q wanted %q", fmt.Sprint(got), expected)
+	}
+
+	pkg.NoAutoReq = true
+	h = build()
+	requires, _ = h.Requires()
+	provides, _ = h.Provides()
+	if len(provides) != 3 || requires[0].Name != "/usr/bin/python3" || requires[1].Flags&spec.DepRPMLib == 0 {
+		t.Errorf("wrong dependencies with AutoReq off; got %v and %v", provides, requires)
+	}
+}
@@ -0,0 +1,274 @@
+package rpm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nesv/rpm/spec"
+)
+
+// The tags Diff compares, besides dependencies and files. Versions and build
+// details are left out, as they change with every rebuild.
+var diffTags = []Tag{
+	TagName, TagSummary, TagDescription, TagGroup, TagLicense, TagURL,
+	TagVendor, TagArch, TagSize,
+	TagPreIn, TagPreInProg, TagPostIn, TagPostInProg,
+	TagPreUn, TagPreUnProg, TagPostUn, TagPostUnProg,
+	TagPreTrans, TagPreTransProg, TagPostTrans, TagPostTransProg,
+	TagVerifyScript, TagVerifyScriptProg,
+}
+
+// The dependency types Diff compares, by the names rpmdiff gives them.
+var diffDependencies = []struct {
+	name string
+	get  func(h *Header) ([]spec.Dependency, error)
+}{
+	{"REQUIRES", (*Header).Requires},
+	{"PROVIDES", (*Header).Provides},
+	{"CONFLICTS", (*Header).Conflicts},
+	{"OBSOLETES", (*Header).Obsoletes},
+	{"RECOMMENDS", (*Header).Recommends},
+	{"SUGGESTS", (*Header).Suggests},
+	{"SUPPLEMENTS", (*Header).Supplements},
+	{"ENHANCES", (*Header).Enhances},
+}
+
+/*
+The checks Diff makes on the files both packages have, in the order of the
+letters rpmdiff shows for them: size, mode, digest, device number, number of
+hard links, symlink target, verify flags, user, group, file flags and
+modification time.
+*/
+const DiffChecks = "SM5DNLVUGFT"
+
+/*
+DiffOptions control what Diff reports.
+*/
+type DiffOptions struct {
+	// Ignore holds the letters of the file checks to leave out, as in
+	// "T" to ignore modification times.
+	Ignore string
+}
+
+/*
+A Difference is a difference Diff found between two packages.
+*/
+type Difference struct {
+	// Kind is "added", "removed" or "changed".
+	Kind string `json:"kind"`
+
+	// Category is "tag", "dependency" or "file".
+	Category string `json:"category"`
+
+	// Tag is the name of the tag, or the type of the dependency, as in
+	// "REQUIRES".
+	Tag string `json:"tag,omitempty"`
+
+	// Name is the dependency, as in "glibc >= 2.28", or the file name.
+	Name string `json:"name,omitempty"`
+
+	// Checks is set for changed files, with the letters of DiffChecks for
+	// the checks that failed and dots for the others, as in
+	// "S.5........".
+	Checks string `json:"checks,omitempty"`
+
+	// Old and New are the values of a tag, one per line.
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+/*
+Returns the difference as rpmdiff prints it, in example:
+
+	removed     REQUIRES glibc >= 2.28
+	S.5........ /usr/bin/hello
+*/
+func (d Difference) String() string {
+	subject := d.Name
+	switch d.Category {
+	case "tag":
+		subject = d.Tag
+	case "dependency":
+		subject = d.Tag + " " + d.Name
+	}
+
+	prefix := d.Kind
+	switch {
+	case d.Kind != "changed":
+	case d.Checks != "":
+		prefix = d.Checks
+	default:
+		prefix = "S.5........"
+	}
+	return fmt.Sprintf("%-12s%s", prefix, subject)
+}
+
+/*
+Compares the headers of two packages, as rpmdiff does, and returns the
+differences: first those of tags (the descriptive ones, the size and the
+scriptlets), then those of dependencies, then those of files, in order of
+their names. Both packages being the same, it returns nothing.
+*/
+func Diff(old, new *Header, opts DiffOptions) ([]Difference, error) {
+	var diffs []Difference
+	for _, tag := range diffTags {
+		o, oldOK := tagText(old, tag)
+		n, newOK := tagText(new, tag)
+		d := Difference{Category: "tag", Tag: tag.String(), Old: o, New: n}
+		switch {
+		case oldOK && !newOK:
+			d.Kind = "removed"
+		case newOK && !oldOK:
+			d.Kind = "added"
+		case o != n:
+			d.Kind = "changed"
+		default:
+			continue
+		}
+		diffs = append(diffs, d)
+	}
+
+	for _, dt := range diffDependencies {
+		o, err := dt.get(old)
+		if err != nil {
+			return nil, err
+		}
+		n, err := dt.get(new)
+		if err != nil {
+			return nil, err
+		}
+		oldSet, newSet := dependencySet(o), dependencySet(n)
+		for _, d := range o {
+			if !newSet[d.String()] {
+				diffs = append(diffs, Difference{Kind: "removed", Category: "dependency", Tag: dt.name, Name: d.String()})
+				newSet[d.String()] = true
+			}
+		}
+		for _, d := range n {
+			if !oldSet[d.String()] {
+				diffs = append(diffs, Difference{Kind: "added", Category: "dependency", Tag: dt.name, Name: d.String()})
+				oldSet[d.String()] = true
+			}
+		}
+	}
+
+	fileDiffs, err := diffFiles(old, new, opts)
+	if err != nil {
+		return nil, err
+	}
+	return append(diffs, fileDiffs...), nil
+}
+
+// tagText returns the values of a tag, one per line, and whether the header
+// has it.
+func tagText(h *Header, tag Tag) (string, bool) {
+	v, ok := qfLookup(h, tag)
+	if !ok {
+		return "", false
+	}
+	values := make([]string, v.count())
+	for i := range values {
+		values[i] = qfString(v, i)
+	}
+	return strings.Join(values, "\n"), true
+}
+
+func dependencySet(deps []spec.Dependency) map[string]bool {
+	set := make(map[string]bool, len(deps))
+	for _, d := range deps {
+		set[d.String()] = true
+	}
+	return set
+}
+
+func diffFiles(old, new *Header, opts DiffOptions) ([]Difference, error) {
+	oldFiles, err := old.Files()
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := new.Files()
+	if err != nil {
+		return nil, err
+	}
+	oldByName, newByName := filesByName(oldFiles), filesByName(newFiles)
+	oldLinks, newLinks := hardLinks(oldFiles), hardLinks(newFiles)
+
+	var names []string
+	for name := range oldByName {
+		names = append(names, name)
+	}
+	for name := range newByName {
+		if _, ok := oldByName[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []Difference
+	for _, name := range names {
+		o, inOld := oldByName[name]
+		n, inNew := newByName[name]
+		switch {
+		case !inNew:
+			diffs = append(diffs, Difference{Kind: "removed", Category: "file", Name: name})
+			continue
+		case !inOld:
+			diffs = append(diffs, Difference{Kind: "added", Category: "file", Name: name})
+			continue
+		}
+
+		changed := []bool{
+			o.Size != n.Size,
+			o.Mode != n.Mode,
+			o.Digest != n.Digest,
+			o.Rdev != n.Rdev,
+			oldLinks[name] != newLinks[name],
+			o.LinkTo != n.LinkTo,
+			o.VerifyFlags != n.VerifyFlags,
+			o.Owner != n.Owner,
+			o.Group != n.Group,
+			o.Flags != n.Flags,
+			!o.ModTime.Equal(n.ModTime),
+		}
+		checks := []byte(strings.Repeat(".", len(DiffChecks)))
+		differs := false
+		for i, c := range changed {
+			if c && !strings.ContainsRune(opts.Ignore, rune(DiffChecks[i])) {
+				checks[i] = DiffChecks[i]
+				differs = true
+			}
+		}
+		if differs {
+			diffs = append(diffs, Difference{Kind: "changed", Category: "file", Name: name, Checks: string(checks)})
+		}
+	}
+	return diffs, nil
+}
+
+func filesByName(files []File) map[string]File {
+	m := make(map[string]File, len(files))
+	for _, f := range files {
+		m[f.Name] = f
+	}
+	return m
+}
+
+// hardLinks returns the number of links of every regular file, which share
+// their device and inode numbers.
+func hardLinks(files []File) map[string]int {
+	count := make(map[[2]uint32]int)
+	for _, f := range files {
+		if uint32(f.Mode)&modeTypeMask == modeRegular {
+			count[[2]uint32{f.Device, f.Inode}]++
+		}
+	}
+	links := make(map[string]int, len(files))
+	for _, f := range files {
+		links[f.Name] = 1
+		if uint32(f.Mode)&modeTypeMask == modeRegular {
+			links[f.Name] = count[[2]uint32{f.Device, f.Inode}]
+		}
+	}
+	return links
+}
@@ -0,0 +1,86 @@
+package rpm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nesv/rpm/spec"
+)
+
+func TestDiff(t *testing.T) {
+	old := buildTestPackage(t, testBuilder()).Header
+
+	b := testBuilder()
+	b.Package.Summary = "Says hello, louder"
+	b.Package.Requires = append(b.Package.Requires, spec.Dependency{Name: "coreutils"})
+	b.Files[0].Data = []byte("#!/bin/sh\necho HELLO\n")
+	b.Files[1].ModTime = b.Files[1].ModTime.Add(time.Hour)
+	b.Files[3].Owner = "root"
+	b.Files[4] = BuildFile{Name: "/usr/share/hello/README", Mode: 0644, Data: []byte("read me\n")}
+	b.Scriptlets["post"] = spec.Scriptlet{Body: "echo installed!"}
+	new := buildTestPackage(t, b).Header
+
+	diffs, err := Diff(old, new, DiffOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range diffs {
+		got = append(got, d.String())
+	}
+	expected := strings.Join([]string{
+		"S.5........ SUMMARY",
+		"S.5........ SIZE",
+		"S.5........ POSTIN",
+		"added       REQUIRES coreutils",
+		".......U... /etc/hello.conf",
+		"..........T /usr/bin",
+		"..5........ /usr/bin/hello",
+		"added       /usr/share/hello/README",
+		"removed     /var/log/hello.log",
+	}, "\n")
+	t.Logf("expecting %q", expected)
+	if strings.Join(got, "\n") != expected {
+		t.Errorf("wrong differences; got %q wanted %q", strings.Join(got, "\n"), expected)
+	}
+	if diffs[0].Old != "Says hello" || diffs[0].New != "Says hello, louder" {
+		t.Errorf("wrong values; got %+v", diffs[0])
+	}
+
+	diffs, err = Diff(old, new, DiffOptions{Ignore: "T5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range diffs {
+		if d.Name == "/usr/bin" || d.Name == "/usr/bin/hello" {
+			t.Errorf("ignored check reported: %v", d)
+		}
+	}
+
+	data, err := json.Marshal(diffs[len(diffs)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"kind":"removed","category":"file","name":"/var/log/hello.log"}`; string(data) != want {
+		t.Errorf("wrong JSON; got %s wanted %s", data, want)
+	}
+
+	if diffs, err := Diff(old, old, DiffOptions{}); err != nil || len(diffs) != 0 {
+		t.Errorf("a package differs from itself; got %v (%v)", diffs, err)
+	}
+}
+
+func TestHardLinks(t *testing.T) {
+	files := []File{
+		{Name: "/a", Mode: 0100644, Device: 1, Inode: 1},
+		{Name: "/b", Mode: 0100644, Device: 1, Inode: 1},
+		{Name: "/c", Mode: 0100644, Device: 1, Inode: 2},
+		{Name: "/d", Mode: 040755, Device: 1, Inode: 2},
+	}
+	links := hardLinks(files)
+	if links["/a"] != 2 || links["/b"] != 2 || links["/c"] != 1 || links["/d"] != 1 {
+		t.Errorf("wrong links; got %v", links)
+	}
+}
@@ -0,0 +1,301 @@
+package rpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/md5"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha3"
+	_ "crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+/*
+The hash algorithms rpm identifies by their OpenPGP algorithm numbers, as used
+by the FILEDIGESTALGO and PAYLOADDIGESTALGO tags.
+*/
+var hashAlgorithms = map[int64]crypto.Hash{
+	1:  crypto.MD5,
+	2:  crypto.SHA1,
+	8:  crypto.SHA256,
+	9:  crypto.SHA384,
+	10: crypto.SHA512,
+	11: crypto.SHA224,
+	12: crypto.SHA3_256,
+	14: crypto.SHA3_512,
+}
+
+// hashName returns the name rpm prints for a hash algorithm.
+func hashName(h crypto.Hash) string {
+	return strings.Replace(h.String(), "SHA-", "SHA", 1)
+}
+
+/*
+A Check is the result of verifying a single digest (or other integrity
+property) of a package.
+*/
+type Check struct {
+	Name     string
+	Expected string
+	Actual   string
+	OK       bool
+}
+
+func (c Check) String() string {
+	if c.OK {
+		return c.Name + ": OK"
+	}
+	return fmt.Sprintf("%s: BAD (Expected %s != %s)", c.Name, c.Expected, c.Actual)
+}
+
+/*
+A DigestReport lists the integrity checks VerifyDigests ran on a package.
+Checks holds the checks of the package as a whole, in the order rpmkeys
+prints them, and Files the checks of the digests of individual files.
+*/
+type DigestReport struct {
+	Checks []Check
+	Files  []Check
+}
+
+/*
+Reports whether all checks passed. A report without any checks is not OK.
+*/
+func (r *DigestReport) OK() bool {
+	if len(r.Checks) == 0 {
+		return false
+	}
+	for _, checks := range [][]Check{r.Checks, r.Files} {
+		for _, c := range checks {
+			if !c.OK {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (r *DigestReport) check(name string, expected, actual string) {
+	r.Checks = append(r.Checks, Check{Name: name, Expected: expected, Actual: actual, OK: expected == actual})
+}
+
+/*
+Verifies the digests of the package, like "rpmkeys --checksig" does without
+checking signatures:
+
+  - the SHA256, SHA1 and SHA3-256 digests of the header, from the signature
+    header,
+  - the legacy MD5 digest of the header and payload, and their size,
+  - the digest of the compressed payload (PAYLOADDIGEST), and of the
+    uncompressed payload (PAYLOADDIGESTALT),
+  - the digest of every file in the payload (FILEDIGESTS).
+
+Only the checks for which the package has a digest are run. An error is
+returned if the package cannot be read at all; digests which do not match are
+reported in the DigestReport.
+*/
+func (p *Package) VerifyDigests() (*DigestReport, error) {
+	r := &DigestReport{}
+	header := p.Header.Bytes()
+	if header == nil {
+		return nil, fmt.Errorf("package header was not read from a file")
+	}
+
+	for _, d := range []struct {
+		tag  Tag
+		hash crypto.Hash
+	}{
+		{SigTagSHA256, crypto.SHA256},
+		{SigTagSHA1, crypto.SHA1},
+		{SigTagSHA3_256, crypto.SHA3_256},
+	} {
+		if expected := p.Signature.GetString(d.tag); expected != "" {
+			h := d.hash.New()
+			h.Write(header)
+			r.check("Header "+hashName(d.hash)+" digest", expected, hex.EncodeToString(h.Sum(nil)))
+		}
+	}
+
+	if err := p.verifyPayloadDigests(r); err != nil {
+		return nil, err
+	}
+	if err := p.verifyFileDigests(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+/*
+Checks the digests of the compressed payload, and the MD5 digest and size of
+the header and payload.
+*/
+func (p *Package) verifyPayloadDigests(r *DigestReport) error {
+	var (
+		writers []io.Writer
+		md5sum  hash.Hash
+		payload hash.Hash
+	)
+
+	expectedPayload := p.Header.GetStrings(TagPayloadDigest)
+	algo := p.payloadDigestAlgo()
+	if len(expectedPayload) > 0 && algo != 0 {
+		payload = algo.New()
+		writers = append(writers, payload)
+	}
+
+	expectedMD5 := p.Signature.GetBytes(SigTagMD5)
+	if expectedMD5 != nil {
+		md5sum = md5.New()
+		md5sum.Write(p.Header.Bytes())
+		writers = append(writers, md5sum)
+	}
+
+	size, err := io.Copy(io.MultiWriter(writers...), p.RawPayload())
+	if err != nil {
+		return err
+	}
+	size += int64(len(p.Header.Bytes()))
+
+	if n, ok := p.Signature.GetInt(SigTagLongSize); ok {
+		r.check("Header and payload size", fmt.Sprint(n), fmt.Sprint(size))
+	} else if n, ok := p.Signature.GetInt(SigTagSize); ok {
+		r.check("Header and payload size", fmt.Sprint(n), fmt.Sprint(size))
+	}
+	if payload != nil {
+		r.check("Payload "+hashName(algo)+" digest", expectedPayload[0], hex.EncodeToString(payload.Sum(nil)))
+	}
+	if md5sum != nil {
+		r.check("MD5 digest", hex.EncodeToString(expectedMD5), hex.EncodeToString(md5sum.Sum(nil)))
+	}
+	return nil
+}
+
+// payloadDigestAlgo returns the algorithm of the payload digests, or 0 if
+// it is unknown.
+func (p *Package) payloadDigestAlgo() crypto.Hash {
+	n, ok := p.Header.GetInt(TagPayloadDigestAlgo)
+	if !ok {
+		return 0
+	}
+	return hashAlgorithms[n]
+}
+
+/*
+Checks the digest of the uncompressed payload, and those of every file in it,
+in a single pass over the payload.
+*/
+func (p *Package) verifyFileDigests(r *DigestReport) error {
+	expectedAlt := p.Header.GetStrings(TagPayloadDigestAlt)
+	expectedFiles := p.Header.GetStrings(TagFileDigests)
+	algo := p.payloadDigestAlgo()
+	if (len(expectedAlt) == 0 || algo == 0) && len(expectedFiles) == 0 {
+		return nil
+	}
+
+	files, err := p.Header.Files()
+	if err != nil {
+		return err
+	}
+	fileAlgo := crypto.MD5
+	if n, ok := p.Header.GetInt(TagFileDigestAlgo); ok {
+		if fileAlgo = hashAlgorithms[n]; fileAlgo == 0 {
+			return fmt.Errorf("unknown file digest algorithm %d", n)
+		}
+	}
+
+	if err := p.digestFiles(r, files, fileAlgo, expectedAlt, algo); err != nil {
+		// A payload which cannot be read fails verification, rather
+		// than the verification itself failing.
+		r.Checks = append(r.Checks, Check{Name: "Payload", Expected: "readable payload", Actual: err.Error()})
+	}
+	return nil
+}
+
+func (p *Package) digestFiles(r *DigestReport, files []File, fileAlgo crypto.Hash, expectedAlt []string, algo crypto.Hash) error {
+	rc, err := p.DecompressedPayload()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	alt := io.Discard
+	var altsum hash.Hash
+	if len(expectedAlt) > 0 && algo != 0 {
+		altsum = algo.New()
+		alt = altsum
+	}
+	tee := io.TeeReader(rc, alt)
+	pr := newPayloadReader(tee, rc, files)
+
+	seen := make([]bool, len(files))
+	pending := make(map[[2]uint32][]int)
+	for {
+		pf, err := pr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if pf.Index < 0 || uint32(pf.File.Mode)&modeTypeMask != modeRegular || pf.File.Digest == "" {
+			continue
+		}
+
+		key, linked := hardLinkKey(pf)
+		if linked && pf.Size == 0 {
+			pending[key] = append(pending[key], pf.Index)
+			continue
+		}
+
+		h := fileAlgo.New()
+		if _, err := io.Copy(h, pr); err != nil {
+			return err
+		}
+		sum := hex.EncodeToString(h.Sum(nil))
+
+		indexes := append(pending[key], pf.Index)
+		delete(pending, key)
+		for _, i := range indexes {
+			seen[i] = true
+			r.Files = append(r.Files, Check{Name: files[i].Name, Expected: files[i].Digest, Actual: sum, OK: files[i].Digest == sum})
+		}
+	}
+
+	// Regular files with a digest must all be in the payload, unless they
+	// are %ghost files.
+	for i, f := range files {
+		if !seen[i] && f.Digest != "" && f.Flags&FileGhost == 0 && uint32(f.Mode)&modeTypeMask == modeRegular {
+			r.Files = append(r.Files, Check{Name: f.Name, Expected: f.Digest, Actual: "(missing)"})
+		}
+	}
+
+	if altsum != nil {
+		// Include whatever follows the trailer.
+		if _, err := io.Copy(io.Discard, tee); err != nil {
+			return err
+		}
+		r.check("Payload "+hashName(algo)+" ALT digest", expectedAlt[0], hex.EncodeToString(altsum.Sum(nil)))
+	}
+	return nil
+}
+
+/*
+Returns the report formatted like the output of "rpmkeys --checksig -v": one
+line per check, followed by the files whose digests do not match.
+*/
+func (r *DigestReport) String() string {
+	var b bytes.Buffer
+	for _, c := range r.Checks {
+		fmt.Fprintln(&b, c)
+	}
+	for _, c := range r.Files {
+		if !c.OK {
+			fmt.Fprintf(&b, "File %s\n", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package rpm
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func hexSHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// buildSignedPackage builds a package with all of the digests rpm adds,
+// computed over the given header entries and payload.
+func buildSignedPackage(t *testing.T, hdr []testEntry, archive []byte) []byte {
+	payload := compress(t, "gzip", archive)
+	hdr = append(hdr,
+		testString(TagPayloadCompressor, "gzip"),
+		testStrings(TagPayloadDigest, TypeStringArray, hexSHA256(payload)),
+		testStrings(TagPayloadDigestAlt, TypeStringArray, hexSHA256(archive)),
+		testInt32(TagPayloadDigestAlgo, 8),
+	)
+	header := buildHeader(hdr...)
+
+	sha1sum := sha1.Sum(header)
+	md5sum := md5.Sum(append(append([]byte(nil), header...), payload...))
+	sig := buildHeader(
+		testString(SigTagSHA1, hex.EncodeToString(sha1sum[:])),
+		testString(SigTagSHA256, hexSHA256(header)),
+		testInt32(SigTagSize, uint32(len(header)+len(payload))),
+		testEntry{SigTagMD5, TypeBin, 16, md5sum[:]},
+	)
+	return buildPackage(sig, header, payload)
+}
+
+func verifyDigests(t *testing.T, pkg []byte) *DigestReport {
+	p, err := ReadPackage(bytes.NewReader(pkg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := p.VerifyDigests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestVerifyDigests(t *testing.T) {
+	hdr := append([]testEntry{
+		testStrings(TagFileDigests, TypeStringArray, "", hexSHA256([]byte("#!/bin/sh\n")), "", hexSHA256([]byte("ab\n")), hexSHA256([]byte("ab\n"))),
+		testInt32(TagFileDigestAlgo, 8),
+	}, testFilesHeader...)
+	pkg := buildSignedPackage(t, hdr, testArchive)
+
+	r := verifyDigests(t, pkg)
+	expected := "Header SHA256 digest: OK\nHeader SHA1 digest: OK\nHeader and payload size: OK\nPayload SHA256 digest: OK\nMD5 digest: OK\nPayload SHA256 ALT digest: OK\n"
+	t.Logf("expecting %q", expected)
+	if got := r.String(); got != expected || !r.OK() {
+		t.Errorf("failed to verify digests; got %q wanted %q", got, expected)
+	}
+	if len(r.Files) != 3 {
+		t.Errorf("expected 3 file checks; got %v", r.Files)
+	}
+
+	// Corrupting the payload must be noticed by the payload digest and
+	// the MD5 digest, and the payload can no longer be decompressed.
+	bad := append([]byte(nil), pkg...)
+	bad[len(bad)-10] ^= 0xff
+	p, err := ReadPackage(bytes.NewReader(bad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ = p.VerifyDigests()
+	if r == nil || r.OK() {
+		t.Fatalf("corrupt payload passed verification")
+	}
+	var failed []string
+	for _, c := range r.Checks {
+		if !c.OK {
+			failed = append(failed, c.Name)
+		}
+	}
+	if got := fmt.Sprint(failed); got != "[Payload SHA256 digest MD5 digest Payload]" {
+		t.Errorf("wrong failed checks; got %s", got)
+	}
+}
+
+func TestVerifyFileDigests(t *testing.T) {
+	hdr := append([]testEntry{
+		testStrings(TagFileDigests, TypeStringArray, "", hexSHA256([]byte("tampered")), "", hexSHA256([]byte("ab\n")), hexSHA256([]byte("ab\n"))),
+		testInt32(TagFileDigestAlgo, 8),
+	}, testFilesHeader...)
+
+	r := verifyDigests(t, buildSignedPackage(t, hdr, testArchive))
+	if r.OK() {
+		t.Fatalf("bad file digest passed verification")
+	}
+	expected := "File /usr/bin/go: BAD (Expected " + hexSHA256([]byte("tampered")) + " != " + hexSHA256([]byte("#!/bin/sh\n")) + ")\n"
+	t.Logf("expecting the report to end with %q", expected)
+	if got := r.String(); !bytes.HasSuffix([]byte(got), []byte(expected)) {
+		t.Errorf("wrong report; got %q", got)
+	}
+}
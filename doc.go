@@ -1,8 +1,65 @@
 /*
-Package rpm currently serves no purpose other than to namespace the rpm/spec
-package.
+Package rpm reads and writes RPM package files.
+
+ReadPackage parses the lead, signature header and main header of a package
+from an io.ReaderAt; the headers are exposed as Header values holding every
+tagged entry, decoded according to its type.
+
+Header has typed accessors for the common tags (Name, EVR, Requires, Files,
+Changelog and so on), which assemble rpm's parallel tag arrays into
+structured values. Dependencies and changelog entries use the types of the
+rpm/spec package, so packages and spec files can be compared directly. The
+Tag constants are generated from tagtable.txt; run "go generate" after
+editing it.
+
+Payload returns a PayloadReader, which decompresses the payload (gzip, bzip2,
+xz, lzma or zstd, as named by the PAYLOADCOMPRESSOR tag) and iterates over the
+files in its cpio archive, joining each with its description in the header.
+WriteCPIO and WriteTar convert the payload to cpio and tar archives, like
+rpm2cpio and rpm2archive; the rpm2archive command wraps them. Extract unpacks
+the payload into a directory, without ever writing outside of it.
+Header.VerifyFiles checks installed files against their package, as "rpm -V"
+does; the rpmverify command runs it on the packages of an rpm database.
+
+VerifyDigests checks the header, payload and file digests of a package, like
+"rpmkeys --checksig" without the signatures, and VerifySignatures checks its
+OpenPGP signatures against a Keyring of public keys. WriteSigned adds or
+replaces the signatures of a package using a Signer, without touching its main
+header or payload.
+
+A Builder writes new binary packages, from package metadata in a
+spec.Package and a list of files held in memory or read from a directory
+tree, with their scriptlets and changelog. Built packages carry the size and
+digests rpm checks, and a gzip, xz or zstd compressed payload. Given a
+SOURCE_DATE_EPOCH, building the same input twice yields identical packages.
+BuildSpec builds the packages of an evaluated spec file from a buildroot,
+following its %files sections, and reports missing and unpackaged files as
+rpmbuild does. BuildSourcePackage writes the source package of a spec file,
+with its sources and patches, and Package.ExtractSource unpacks one again.
 
-In the future, this package may hold functions and structs for working with RPM
-packages directly, but for now, it is nothing more than a placeholder.
+A Builder with FileAttrs set generates dependencies from the files it packs,
+as rpmbuild does: DefaultFileAttrs holds rpm's generators for ELF files,
+scripts and pkg-config files, and other generators can be added as
+DependencyGenerators.
+
+Headers can be encoded to JSON, and to the XML of "rpm -q --xml", and decoded
+back without loss, through the encoding/json and encoding/xml interfaces.
+
+Diff compares two packages as rpmlint's rpmdiff does, reporting differences in
+their metadata, dependencies and files; the rpmdiff command wraps it.
+
+ReadDelta reads delta rpms, as made by deltarpm, and Delta.Apply rebuilds the
+new package from the old one and the delta, checking the result against the
+digest the delta holds; the applydeltarpm command wraps it. As the payload is
+compressed again with Go's compressors, packages of distributions are not
+reproduced byte for byte, but Delta.ApplyPayload rebuilds their uncompressed
+payloads, checked against the payload digest of the new header.
+
+A QueryFormat formats headers with rpm's --queryformat language, either
+those of packages or, like "rpmspec -q", those of the packages of a spec file.
+
+Spec files are handled by the rpm/spec package, and the database of installed
+packages, at the root of a system or container image, by the rpm/rpmdb
+package.
 */
 package rpm
@@ -0,0 +1,398 @@
+package rpm
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var ErrUnsafePath = errors.New("unsafe path in payload")
+
+/*
+ExtractOptions control how Extract unpacks a package.
+*/
+type ExtractOptions struct {
+	// ExcludeDocs skips the files marked %doc, like rpm's --excludedocs.
+	ExcludeDocs bool
+
+	// AllowDevices allows creating device nodes and named pipes, which
+	// are otherwise skipped. Creating device nodes usually requires root.
+	AllowDevices bool
+}
+
+/*
+An ExtractAction is what Extract did with a file of the payload.
+*/
+type ExtractAction int
+
+const (
+	// The file was created, replacing whatever was there before.
+	ExtractCreated ExtractAction = iota
+
+	// A %config(noreplace) file already existed, and the file was
+	// written next to it as "<name>.rpmnew".
+	ExtractSavedNew
+
+	// A %config file already existed, and was moved aside to
+	// "<name>.rpmorig" before the file was created.
+	ExtractSavedOrig
+
+	// The file was not written; see Reason.
+	ExtractSkipped
+)
+
+var extractActionNames = []string{"created", "saved as .rpmnew", "created, original saved as .rpmorig", "skipped"}
+
+func (a ExtractAction) String() string {
+	if int(a) < len(extractActionNames) {
+		return extractActionNames[a]
+	}
+	return fmt.Sprintf("ExtractAction(%d)", int(a))
+}
+
+/*
+An ExtractedFile reports what Extract did with a file of the payload. Name is
+the name of the file in the package, and Path is the (slash-separated) path
+it was written to, relative to the root directory.
+*/
+type ExtractedFile struct {
+	Name   string
+	Path   string
+	Action ExtractAction
+	Reason string
+}
+
+/*
+Unpacks the files in the package's payload into the directory root, which
+must exist, as if the package were installed into a chroot at root. No
+scriptlets are run, and no rpm database is written.
+
+All files are created through an os.Root, so nothing is ever written outside
+of root: payload names with ".." components are refused, and so is writing
+through a symlink which points out of root (including absolute symlinks, which
+would point into the host). Symlinks in the payload are created as they are.
+
+Files flagged %ghost are not created. %config files which already exist are
+kept, the way rpm does on installation: the new file is written as .rpmnew
+for %config(noreplace), and the old file is moved to .rpmorig otherwise.
+Device nodes and named pipes are only created if opts.AllowDevices is set.
+File owners are only applied when running as root, and are resolved against
+the /etc/passwd and /etc/group files inside root.
+
+Extract returns what was done with every file of the payload, in order. If it
+fails part way through, the files handled so far are returned along with the
+error.
+*/
+func (p *Package) Extract(root string, opts ExtractOptions) ([]ExtractedFile, error) {
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	pr, err := p.Payload()
+	if err != nil {
+		return nil, err
+	}
+	defer pr.Close()
+
+	x := &extractor{
+		root:    r,
+		opts:    opts,
+		chown:   os.Geteuid() == 0,
+		pending: make(map[[2]uint32][]string),
+	}
+	if x.chown {
+		x.users = readIDs(r, "etc/passwd")
+		x.groups = readIDs(r, "etc/group")
+	}
+
+	for {
+		pf, err := pr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return x.done, err
+		}
+		if err := x.extract(pf, pr); err != nil {
+			return x.done, err
+		}
+	}
+
+	// Hard links whose content never came are left empty.
+	for _, links := range x.pending {
+		for _, link := range links {
+			if err := x.writeFile(link, nil, 0644); err != nil {
+				return x.done, err
+			}
+		}
+	}
+	return x.done, nil
+}
+
+type extractor struct {
+	root  *os.Root
+	opts  ExtractOptions
+	chown bool
+	done  []ExtractedFile
+
+	// The ids of the users and groups inside the root directory.
+	users, groups map[string]int
+
+	// The members of hard link sets still waiting for their content.
+	pending map[[2]uint32][]string
+}
+
+func (x *extractor) skip(pf *PayloadFile, reason string) {
+	x.done = append(x.done, ExtractedFile{Name: pf.File.Name, Action: ExtractSkipped, Reason: reason})
+}
+
+func (x *extractor) extract(pf *PayloadFile, content io.Reader) error {
+	f := pf.File
+	name, err := safeName(f.Name)
+	if err != nil {
+		return err
+	}
+	typ := uint32(f.Mode) & modeTypeMask
+
+	switch {
+	case f.Flags&FileGhost != 0:
+		x.skip(pf, "%ghost")
+		return nil
+	case x.opts.ExcludeDocs && f.Flags&FileDoc != 0:
+		x.skip(pf, "%doc")
+		return nil
+	case (typ == modeChar || typ == modeBlock || typ == modeFIFO) && !x.opts.AllowDevices:
+		x.skip(pf, "device node")
+		return nil
+	}
+
+	if dir := path.Dir(name); dir != "." {
+		if err := x.root.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	ef := ExtractedFile{Name: f.Name, Path: name, Action: ExtractCreated}
+	perm := fs.FileMode(f.Mode & 0777)
+
+	switch typ {
+	case modeDir:
+		if fi, err := x.root.Lstat(name); err != nil || !fi.IsDir() {
+			if err := x.replace(name); err != nil {
+				return err
+			}
+			if err := x.root.Mkdir(name, perm); err != nil {
+				return err
+			}
+		}
+
+	case modeSymlink:
+		target, err := io.ReadAll(io.LimitReader(content, 4096))
+		if err != nil {
+			return err
+		}
+		if len(target) == 0 {
+			target = []byte(f.LinkTo)
+		}
+		if err := x.replace(name); err != nil {
+			return err
+		}
+		if err := x.root.Symlink(string(target), name); err != nil {
+			return err
+		}
+
+	case modeChar, modeBlock, modeFIFO:
+		if err := x.replace(name); err != nil {
+			return err
+		}
+		major, minor := deviceNumbers(pf)
+		if err := mknod(x.root, name, f.Mode, major, minor); err != nil {
+			return err
+		}
+
+	default:
+		if f.Flags&FileConfig != 0 {
+			if _, err := x.root.Lstat(name); err == nil {
+				if f.Flags&FileNoReplace != 0 {
+					ef.Path, ef.Action = name+".rpmnew", ExtractSavedNew
+				} else {
+					if err := x.root.Rename(name, name+".rpmorig"); err != nil {
+						return err
+					}
+					ef.Action = ExtractSavedOrig
+				}
+			}
+		}
+
+		key, linked := hardLinkKey(pf)
+		if linked && pf.Size == 0 {
+			// Wait for the member of the set that carries the
+			// content; the links share its attributes.
+			x.done = append(x.done, ef)
+			x.pending[key] = append(x.pending[key], ef.Path)
+			return nil
+		}
+
+		if err := x.writeFile(ef.Path, io.LimitReader(content, pf.Size), perm); err != nil {
+			return err
+		}
+		if linked {
+			for _, link := range x.pending[key] {
+				if err := x.replace(link); err != nil {
+					return err
+				}
+				if err := x.root.Link(ef.Path, link); err != nil {
+					return err
+				}
+			}
+			delete(x.pending, key)
+		}
+		name = ef.Path
+	}
+
+	x.done = append(x.done, ef)
+	return x.finish(name, pf)
+}
+
+/*
+Applies the mode, owner and modification time of the file to what was
+written at name.
+*/
+func (x *extractor) finish(name string, pf *PayloadFile) error {
+	f := pf.File
+	symlink := uint32(f.Mode)&modeTypeMask == modeSymlink
+
+	if x.chown {
+		uid, gid := int(pf.CPIO.UID), int(pf.CPIO.GID)
+		if id, ok := x.users[f.Owner]; ok {
+			uid = id
+		}
+		if id, ok := x.groups[f.Group]; ok {
+			gid = id
+		}
+		if err := x.root.Lchown(name, uid, gid); err != nil {
+			return err
+		}
+	}
+	if symlink {
+		return nil
+	}
+
+	// Applied after chown, which clears the setuid and setgid bits.
+	if err := x.root.Chmod(name, unixFileMode(uint32(f.Mode))&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+		return err
+	}
+	if !f.ModTime.IsZero() {
+		return x.root.Chtimes(name, f.ModTime, f.ModTime)
+	}
+	return nil
+}
+
+/*
+Removes whatever is at name, so it can be replaced. Non-empty directories are
+not removed, and result in an error.
+*/
+func (x *extractor) replace(name string) error {
+	err := x.root.Remove(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (x *extractor) writeFile(name string, content io.Reader, perm fs.FileMode) error {
+	if err := x.replace(name); err != nil {
+		return err
+	}
+	out, err := x.root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if content != nil {
+		if _, err := io.Copy(out, content); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	return out.Close()
+}
+
+/*
+Returns the name of a payload file relative to the root directory, refusing
+names which would point out of it.
+*/
+func safeName(name string) (string, error) {
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("%v: %s", ErrUnsafePath, name)
+		}
+	}
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if clean == "" || !fs.ValidPath(clean) {
+		return "", fmt.Errorf("%v: %q", ErrUnsafePath, name)
+	}
+	return clean, nil
+}
+
+// deviceNumbers returns the major and minor numbers of a device file.
+func deviceNumbers(pf *PayloadFile) (uint32, uint32) {
+	if pf.CPIO.Index < 0 {
+		return pf.CPIO.RDevMajor, pf.CPIO.RDevMinor
+	}
+	return uint32(pf.File.Rdev >> 8), uint32(pf.File.Rdev & 0xff)
+}
+
+/*
+Reads the ids of the users or groups from an /etc/passwd or /etc/group file
+inside the root directory.
+*/
+func readIDs(r *os.Root, name string) map[string]int {
+	ids := make(map[string]int)
+	readIDFile(r, name, func(name string, id int) {
+		ids[name] = id
+	})
+	return ids
+}
+
+/*
+Reads the names of the users or groups from an /etc/passwd or /etc/group file
+inside the root directory. An id listed more than once has its first name, as
+with getpwuid.
+*/
+func readNames(r *os.Root, name string) map[int]string {
+	names := make(map[int]string)
+	readIDFile(r, name, func(name string, id int) {
+		if _, ok := names[id]; !ok {
+			names[id] = name
+		}
+	})
+	return names
+}
+
+// readIDFile calls fn with the name and id on each line of an /etc/passwd or
+// /etc/group file.
+func readIDFile(r *os.Root, name string, fn func(name string, id int)) {
+	data, err := r.ReadFile(name)
+	if err != nil {
+		return
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := strings.Split(s.Text(), ":")
+		if len(fields) < 3 {
+			continue
+		}
+		if id, err := strconv.Atoi(fields[2]); err == nil {
+			fn(fields[0], id)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package rpm
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func extractPackage(t *testing.T, root string, opts ExtractOptions, hdr []testEntry, members ...testMember) ([]ExtractedFile, error) {
+	hdr = append([]testEntry{testString(TagName, "go")}, hdr...)
+	pkg, err := ReadPackage(bytes.NewReader(buildPackage(buildHeader(testInt32(SigTagSize, 0)), buildHeader(hdr...), compress(t, "gzip", buildCPIO(members...)))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg.Extract(root, opts)
+}
+
+func TestExtract(t *testing.T) {
+	root := t.TempDir()
+	done, err := extractPackage(t, root, ExtractOptions{}, testFilesHeader,
+		testMember{name: "./usr/bin", mode: 040755, ino: 1, nlink: 2},
+		testMember{name: "./usr/bin/go", mode: 0100755, ino: 2, nlink: 1, content: "#!/bin/sh\n"},
+		testMember{name: "./usr/bin/gofmt", mode: 0120777, ino: 3, nlink: 1, content: "go"},
+		testMember{name: "./usr/bin/a", mode: 0100644, ino: 4, nlink: 2},
+		testMember{name: "./usr/bin/b", mode: 0100644, ino: 4, nlink: 2, content: "ab\n"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 5 {
+		t.Errorf("expected 5 extracted files; got %+v", done)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(root, "usr/bin/go"))
+	if err != nil || string(content) != "#!/bin/sh\n" {
+		t.Errorf("wrong content of /usr/bin/go; got %q, %v", content, err)
+	}
+	if fi, err := os.Stat(filepath.Join(root, "usr/bin/go")); err != nil || fi.Mode() != 0755 {
+		t.Errorf("wrong mode of /usr/bin/go; got %v, %v", fi.Mode(), err)
+	}
+	if target, err := os.Readlink(filepath.Join(root, "usr/bin/gofmt")); err != nil || target != "go" {
+		t.Errorf("wrong symlink target of /usr/bin/gofmt; got %q, %v", target, err)
+	}
+
+	a, erra := os.Stat(filepath.Join(root, "usr/bin/a"))
+	b, errb := os.Stat(filepath.Join(root, "usr/bin/b"))
+	if erra != nil || errb != nil || !os.SameFile(a, b) {
+		t.Errorf("/usr/bin/a and /usr/bin/b are not hard linked (%v, %v)", erra, errb)
+	}
+}
+
+func TestExtractUnsafe(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "root")
+	os.Mkdir(root, 0755)
+
+	tests := map[string][]testMember{
+		"traversal": {
+			{name: "./../escaped", mode: 0100644, nlink: 1, content: "x"},
+		},
+		"absolute symlink": {
+			{name: "./lib", mode: 0120777, nlink: 1, content: parent},
+			{name: "./lib/escaped", mode: 0100644, nlink: 1, content: "x"},
+		},
+		"relative symlink": {
+			{name: "./lib", mode: 0120777, nlink: 1, content: "../.."},
+			{name: "./lib/escaped", mode: 0100644, nlink: 1, content: "x"},
+		},
+	}
+	for name, members := range tests {
+		if _, err := extractPackage(t, root, ExtractOptions{}, nil, members...); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if _, err := os.Lstat(filepath.Join(parent, "escaped")); err == nil {
+			t.Fatalf("%s: file written outside of the root directory", name)
+		}
+		os.RemoveAll(root)
+		os.Mkdir(root, 0755)
+	}
+}
+
+func TestExtractFlags(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "etc"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "etc/a.conf"), []byte("local a"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "etc/b.conf"), []byte("local b"), 0644)
+
+	hdr := []testEntry{
+		testStrings(TagBaseNames, TypeStringArray, "a.conf", "b.conf", "README", "null"),
+		testStrings(TagDirNames, TypeStringArray, "/etc/", "/usr/share/doc/go/", "/dev/"),
+		testInt32(TagDirIndexes, 0, 0, 1, 2),
+		testInt32(TagFileSizes, 3, 3, 3, 0),
+		testEntry{TagFileModes, TypeInt16, 4, []byte{0x81, 0xa4, 0x81, 0xa4, 0x81, 0xa4, 0x21, 0xb6}},
+		testInt32(TagFileFlags, uint32(FileConfig|FileNoReplace), uint32(FileConfig), uint32(FileDoc), 0),
+	}
+	done, err := extractPackage(t, root, ExtractOptions{ExcludeDocs: true}, hdr,
+		testMember{name: "./etc/a.conf", mode: 0100644, nlink: 1, content: "a\n\n"},
+		testMember{name: "./etc/b.conf", mode: 0100644, nlink: 1, content: "b\n\n"},
+		testMember{name: "./usr/share/doc/go/README", mode: 0100644, nlink: 1, content: "hi\n"},
+		testMember{name: "./dev/null", mode: 020666, nlink: 1},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, ef := range done {
+		got = append(got, fmt.Sprintf("%s %s %s %s", ef.Name, ef.Path, ef.Action, ef.Reason))
+	}
+	expected := `[/etc/a.conf etc/a.conf.rpmnew saved as .rpmnew  /etc/b.conf etc/b.conf created, original saved as .rpmorig  /usr/share/doc/go/README  skipped %doc /dev/null  skipped device node]`
+	t.Logf("expecting %q", expected)
+	if s := fmt.Sprint(got); s != expected {
+		t.Errorf("wrong extraction report; got %q wanted %q", s, expected)
+	}
+
+	for name, want := range map[string]string{
+		"etc/a.conf":         "local a",
+		"etc/a.conf.rpmnew":  "a\n\n",
+		"etc/b.conf":         "b\n\n",
+		"etc/b.conf.rpmorig": "local b",
+	} {
+		if content, err := ioutil.ReadFile(filepath.Join(root, name)); err != nil || string(content) != want {
+			t.Errorf("wrong content of %s; got %q wanted %q (%v)", name, content, want, err)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(root, "usr/share/doc/go/README")); err == nil {
+		t.Errorf("%%doc file was extracted")
+	}
+}
@@ -0,0 +1,516 @@
+package rpm
+
+import (
+	"crypto"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+The bits of the FILEVERIFYFLAGS tag, each of which enables a check of
+VerifyFiles. Files built without %verify have all of them set.
+*/
+const (
+	VerifyDigest uint32 = 1 << 0
+	VerifySize   uint32 = 1 << 1
+	VerifyLinkTo uint32 = 1 << 2
+	VerifyUser   uint32 = 1 << 3
+	VerifyGroup  uint32 = 1 << 4
+	VerifyMTime  uint32 = 1 << 5
+	VerifyMode   uint32 = 1 << 6
+	VerifyRdev   uint32 = 1 << 7
+	VerifyCaps   uint32 = 1 << 8
+)
+
+/*
+The checks VerifyFiles makes, in the order of the letters "rpm -V" shows for
+them: size, mode, digest, device number, symlink target, user, group,
+modification time and capabilities.
+*/
+const VerifyChecks = "SM5DLUGTP"
+
+// The bits of the checks, in the order of VerifyChecks.
+var verifyCheckBits = []uint32{VerifySize, VerifyMode, VerifyDigest, VerifyRdev, VerifyLinkTo, VerifyUser, VerifyGroup, VerifyMTime, VerifyCaps}
+
+// The states of the FILESTATES tag of installed packages.
+const (
+	fileStateReplaced     = 1
+	fileStateNotInstalled = 2
+	fileStateNetShared    = 3
+	fileStateWrongColor   = 4
+)
+
+/*
+VerifyOptions control what VerifyFiles checks.
+*/
+type VerifyOptions struct {
+	// Ignore holds the letters of the checks to leave out, as in "T" to
+	// ignore modification times, like rpm's --nomtime.
+	Ignore string
+
+	// NoConfig and NoGhost skip %config and %ghost files, like rpm's
+	// --noconfig and --noghost.
+	NoConfig bool
+	NoGhost  bool
+}
+
+/*
+A FileVerification is the result of checking an installed file against the
+header of its package.
+*/
+type FileVerification struct {
+	Name  string    `json:"name"`
+	Flags FileFlags `json:"flags,omitempty"`
+
+	// Missing is set if the file does not exist.
+	Missing bool `json:"missing,omitempty"`
+
+	// Checks has a letter of VerifyChecks for each check that failed, a
+	// "?" for each check which could not be made (as when the file cannot
+	// be read), and dots for the others, as in "S.5....T.".
+	Checks string `json:"checks,omitempty"`
+
+	// Reason tells why the file is missing, or why checks could not be
+	// made, if not simply because it does not exist.
+	Reason string `json:"reason,omitempty"`
+}
+
+/*
+Reports whether the file passed all its checks. Missing %ghost and
+%config(missingok) files pass, as rpm does not report them.
+*/
+func (v FileVerification) OK() bool {
+	if v.Missing {
+		return v.Flags&(FileGhost|FileMissingOK) != 0
+	}
+	return strings.Trim(v.Checks, ".") == ""
+}
+
+/*
+Returns the result as "rpm -V" prints it, with a letter for the kind of file
+(c for %config, d for %doc, g for %ghost, l for %license, r for %readme), in
+example:
+
+	S.5....T.  c /etc/foo
+	missing     /usr/bin/foo
+*/
+func (v FileVerification) String() string {
+	attr := ' '
+	switch {
+	case v.Flags&FileConfig != 0:
+		attr = 'c'
+	case v.Flags&FileDoc != 0:
+		attr = 'd'
+	case v.Flags&FileGhost != 0:
+		attr = 'g'
+	case v.Flags&FileLicense != 0:
+		attr = 'l'
+	case v.Flags&FilePubKey != 0:
+		attr = 'P'
+	case v.Flags&FileReadme != 0:
+		attr = 'r'
+	}
+
+	s := fmt.Sprintf("%s  %c %s", v.Checks, attr, v.Name)
+	if v.Missing {
+		s = fmt.Sprintf("missing   %c %s", attr, v.Name)
+	}
+	if v.Reason != "" {
+		s += " (" + v.Reason + ")"
+	}
+	return s
+}
+
+/*
+Checks the files of an installed package against its header, as "rpm -V"
+does, with root as the root directory it was installed in. Each file's size,
+mode, digest, device number, symlink target, user, group, modification time
+and capabilities are checked, except for those left out by the file's
+FILEVERIFYFLAGS (as set with %verify) or by opts:
+
+  - %ghost files are only checked for their mode, owner, group and device
+    number, and may be missing,
+  - symlinks are only checked for their target, and not their mode,
+  - non-regular files are not checked for their size, digest, modification
+    time or capabilities,
+  - files which were not installed, such as those shared over the network,
+    are left out; those replaced by another package are only checked for
+    existence.
+
+Users and groups are resolved against the /etc/passwd and /etc/group files
+inside root. All files are reached through an os.Root, so symlinks cannot lead
+out of root.
+
+VerifyFiles returns a result for every file it checked, in order; use OK to
+tell which failed. An error is returned if the header cannot be read.
+*/
+func (h *Header) VerifyFiles(root string, opts VerifyOptions) ([]FileVerification, error) {
+	files, err := h.Files()
+	if err != nil {
+		return nil, err
+	}
+	algo := crypto.MD5
+	if n, ok := h.GetInt(TagFileDigestAlgo); ok {
+		if algo = hashAlgorithms[n]; algo == 0 {
+			return nil, fmt.Errorf("unknown file digest algorithm %d", n)
+		}
+	}
+	states := h.GetInts(TagFileStates)
+	if states != nil && len(states) != len(files) {
+		return nil, fmt.Errorf("%v: %v has %d values for %d files", ErrBadHeader, TagFileStates, len(states), len(files))
+	}
+
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	v := &verifier{
+		root:   r,
+		algo:   algo,
+		users:  readNames(r, "etc/passwd"),
+		groups: readNames(r, "etc/group"),
+	}
+	var ignore uint32
+	for i, c := range VerifyChecks {
+		if strings.ContainsRune(opts.Ignore, c) {
+			ignore |= verifyCheckBits[i]
+		}
+	}
+
+	var results []FileVerification
+	for i, f := range files {
+		if (opts.NoConfig && f.Flags&FileConfig != 0) || (opts.NoGhost && f.Flags&FileGhost != 0) {
+			continue
+		}
+		checks := ^uint32(0)
+		if _, ok := h.Entry(TagFileVerifyFlags); ok {
+			checks = f.VerifyFlags
+		}
+		checks &^= ignore
+		if states != nil {
+			switch states[i] {
+			case fileStateNotInstalled, fileStateNetShared:
+				continue
+			case fileStateReplaced:
+				checks = 0
+			case fileStateWrongColor:
+				checks &^= VerifyDigest | VerifySize | VerifyMTime | VerifyRdev
+			}
+		}
+		results = append(results, v.verify(f, checks))
+	}
+	return results, nil
+}
+
+type verifier struct {
+	root   *os.Root
+	algo   crypto.Hash
+	users  map[int]string
+	groups map[int]string
+}
+
+// verify makes the given checks on file f.
+func (v *verifier) verify(f File, checks uint32) FileVerification {
+	result := FileVerification{Name: f.Name, Flags: f.Flags}
+	name, err := safeName(f.Name)
+	if err != nil {
+		result.Missing, result.Reason = true, err.Error()
+		return result
+	}
+	fi, err := v.root.Lstat(name)
+	if err != nil {
+		result.Missing = true
+		if !errors.Is(err, fs.ErrNotExist) {
+			result.Reason = pathErrorReason(err)
+		}
+		return result
+	}
+
+	if f.Flags&FileGhost != 0 {
+		checks &^= VerifyDigest | VerifySize | VerifyMTime | VerifyLinkTo
+	}
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		checks &^= VerifyMode
+	} else {
+		checks &^= VerifyLinkTo
+	}
+	if !fi.Mode().IsRegular() {
+		checks &^= VerifyDigest | VerifySize | VerifyMTime | VerifyCaps
+	}
+
+	var failed, unknown uint32
+	fail := func(check uint32, bad bool) {
+		if checks&check != 0 && bad {
+			failed |= check
+		}
+	}
+	st, hasStat := fileStat(fi)
+
+	fail(VerifySize, fi.Size() != f.Size)
+
+	mode, expected := unixMode(fi.Mode()), uint32(f.Mode)
+	if f.Flags&FileGhost != 0 {
+		// Comparing the type of %ghost files is meaningless.
+		mode, expected = mode&^modeTypeMask, expected&^modeTypeMask
+	}
+	fail(VerifyMode, mode != expected)
+
+	if checks&VerifyDigest != 0 {
+		sum, err := v.digest(name)
+		if err != nil {
+			unknown |= VerifyDigest
+			result.Reason = pathErrorReason(err)
+		} else {
+			fail(VerifyDigest, sum != f.Digest)
+		}
+	}
+
+	if checks&VerifyRdev != 0 {
+		wantType, gotType := uint32(f.Mode)&modeTypeMask, mode&modeTypeMask
+		isDev := func(t uint32) bool { return t == modeChar || t == modeBlock }
+		switch {
+		case isDev(wantType) != isDev(gotType) || (isDev(wantType) && wantType != gotType):
+			failed |= VerifyRdev
+		case !isDev(wantType):
+		case !hasStat || !st.hasDev:
+			unknown |= VerifyRdev
+		default:
+			fail(VerifyRdev, st.major != uint32(f.Rdev>>8) || st.minor != uint32(f.Rdev&0xff))
+		}
+	}
+
+	if checks&VerifyLinkTo != 0 {
+		target, err := v.root.Readlink(name)
+		if err != nil {
+			unknown |= VerifyLinkTo
+			result.Reason = pathErrorReason(err)
+		} else {
+			fail(VerifyLinkTo, target != f.LinkTo)
+		}
+	}
+
+	for _, id := range []struct {
+		check    uint32
+		id       uint32
+		names    map[int]string
+		expected string
+	}{
+		{VerifyUser, st.uid, v.users, f.Owner},
+		{VerifyGroup, st.gid, v.groups, f.Group},
+	} {
+		if checks&id.check == 0 {
+			continue
+		}
+		if !hasStat {
+			unknown |= id.check
+			continue
+		}
+		name, ok := id.names[int(id.id)]
+		fail(id.check, !ok || name != id.expected)
+	}
+
+	fail(VerifyMTime, fi.ModTime().Unix() != f.ModTime.Unix())
+
+	if checks&VerifyCaps != 0 {
+		// Capabilities which cannot be read, as on platforms without
+		// them, only matter if the file should have some.
+		if err := v.verifyCaps(name, f.Caps); err == errCapsDiffer {
+			failed |= VerifyCaps
+		} else if err != nil && f.Caps != "" {
+			unknown |= VerifyCaps
+			result.Reason = pathErrorReason(err)
+		}
+	}
+
+	c := []byte(strings.Repeat(".", len(VerifyChecks)))
+	for i, bit := range verifyCheckBits {
+		if unknown&bit != 0 {
+			c[i] = '?'
+		} else if failed&bit != 0 {
+			c[i] = VerifyChecks[i]
+		}
+	}
+	result.Checks = string(c)
+	return result
+}
+
+// digest returns the hex-encoded digest of the file at name.
+func (v *verifier) digest(name string) (string, error) {
+	f, err := v.root.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := v.algo.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var errCapsDiffer = errors.New("capabilities differ")
+
+// verifyCaps compares the capabilities of the file at name with those given
+// in the text form of cap_to_text, and returns errCapsDiffer if they differ.
+func (v *verifier) verifyCaps(name, text string) error {
+	expected, err := parseCaps(text)
+	if err != nil {
+		return err
+	}
+	f, err := v.root.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	actual, err := fileCaps(f)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return errCapsDiffer
+	}
+	return nil
+}
+
+// pathErrorReason returns the reason of an error about a file, without the
+// name of the file, as rpm prints it.
+func pathErrorReason(err error) string {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	return err.Error()
+}
+
+/*
+The capability sets of a file: effective, permitted and inheritable, with a
+bit for each capability.
+*/
+type capSets [3]uint64
+
+// The names of the capabilities, without their "cap_" prefix, by number.
+var capNames = []string{
+	"chown", "dac_override", "dac_read_search", "fowner", "fsetid", "kill",
+	"setgid", "setuid", "setpcap", "linux_immutable", "net_bind_service",
+	"net_broadcast", "net_admin", "net_raw", "ipc_lock", "ipc_owner",
+	"sys_module", "sys_rawio", "sys_chroot", "sys_ptrace", "sys_pacct",
+	"sys_admin", "sys_boot", "sys_nice", "sys_resource", "sys_time",
+	"sys_tty_config", "mknod", "lease", "audit_write", "audit_control",
+	"setfcap", "mac_override", "mac_admin", "syslog", "wake_alarm",
+	"block_suspend", "audit_read", "perfmon", "bpf", "checkpoint_restore",
+}
+
+/*
+Parses capabilities in the text form of libcap's cap_from_text, as stored in
+the FILECAPS tag: clauses separated by spaces, each a comma-separated list of
+capabilities (all of them, if empty or "all") followed by operations: "=" to
+set the capabilities to exactly the given sets, "+" to add them to the sets
+and "-" to remove them, the sets being any of e, i and p. An empty text has
+no capabilities.
+*/
+func parseCaps(text string) (capSets, error) {
+	var sets capSets
+	for _, clause := range strings.Fields(text) {
+		i := strings.IndexAny(clause, "=+-")
+		if i < 0 {
+			return sets, fmt.Errorf("bad capabilities %q", text)
+		}
+
+		var caps uint64
+		if list := strings.ToLower(clause[:i]); list == "" || list == "all" {
+			caps = 1<<uint(len(capNames)) - 1
+		} else {
+			for _, name := range strings.Split(list, ",") {
+				n := -1
+				for j, c := range capNames {
+					if name == "cap_"+c {
+						n = j
+					}
+				}
+				if j, err := strconv.Atoi(name); err == nil && j >= 0 && j < 64 {
+					n = j
+				}
+				if n < 0 {
+					return sets, fmt.Errorf("unknown capability %q", name)
+				}
+				caps |= 1 << uint(n)
+			}
+		}
+
+		for ops := clause[i:]; ops != ""; {
+			op := ops[0]
+			end := strings.IndexAny(ops[1:], "=+-") + 1
+			if end == 0 {
+				end = len(ops)
+			}
+			flags := ops[1:end]
+			ops = ops[end:]
+
+			if op == '=' {
+				for s := range sets {
+					sets[s] &^= caps
+				}
+			}
+			for _, f := range flags {
+				s := strings.IndexRune("epi", f)
+				if s < 0 {
+					return sets, fmt.Errorf("bad capabilities %q", text)
+				}
+				if op == '-' {
+					sets[s] &^= caps
+				} else {
+					sets[s] |= caps
+				}
+			}
+		}
+	}
+	return sets, nil
+}
+
+/*
+Parses the capabilities of a file from its security.capability extended
+attribute (a vfs_cap_data): a revision and flags, then the permitted and
+inheritable sets, in 32-bit words. If its effective flag is set, all the
+permitted and inheritable capabilities are effective too. A file without the
+attribute has no capabilities.
+*/
+func parseCapsXattr(b []byte) (capSets, error) {
+	var sets capSets
+	if b == nil {
+		return sets, nil
+	}
+	if len(b) < 4 {
+		return sets, errors.New("bad capabilities attribute")
+	}
+	magic := binary.LittleEndian.Uint32(b)
+
+	words := 0
+	switch magic & 0xff000000 {
+	case 0x01000000:
+		words = 1
+	case 0x02000000, 0x03000000:
+		words = 2
+	}
+	if words == 0 || len(b) < 4+8*words {
+		return sets, errors.New("bad capabilities attribute")
+	}
+	for i := 0; i < words; i++ {
+		sets[1] |= uint64(binary.LittleEndian.Uint32(b[4+8*i:])) << uint(32*i)
+		sets[2] |= uint64(binary.LittleEndian.Uint32(b[8+8*i:])) << uint(32*i)
+	}
+	if magic&1 != 0 {
+		sets[0] = sets[1] | sets[2]
+	}
+	return sets, nil
+}
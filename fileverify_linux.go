@@ -0,0 +1,31 @@
+package rpm
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// devNumbers splits a device number into its major and minor numbers, as
+// glibc encodes them.
+func devNumbers(dev uint64) (major, minor uint32, ok bool) {
+	return uint32(dev>>8&0xfff | dev>>32&^0xfff), uint32(dev&0xff | dev>>12&^0xff), true
+}
+
+/*
+Returns the capabilities of an open file, from its security.capability
+extended attribute.
+*/
+func fileCaps(f *os.File) (capSets, error) {
+	attr := []byte("security.capability\x00")
+	buf := make([]byte, 64)
+	n, _, errno := syscall.Syscall6(syscall.SYS_FGETXATTR, f.Fd(),
+		uintptr(unsafe.Pointer(&attr[0])), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0, 0)
+	switch errno {
+	case 0:
+		return parseCapsXattr(buf[:n])
+	case syscall.ENODATA, syscall.ENOTSUP:
+		return parseCapsXattr(nil)
+	}
+	return capSets{}, &os.PathError{Op: "getxattr", Path: f.Name(), Err: errno}
+}
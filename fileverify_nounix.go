@@ -0,0 +1,15 @@
+//go:build !unix
+
+package rpm
+
+import "io/fs"
+
+type statIDs struct {
+	uid, gid     uint32
+	major, minor uint32
+	hasDev       bool
+}
+
+func fileStat(fi fs.FileInfo) (statIDs, bool) {
+	return statIDs{}, false
+}
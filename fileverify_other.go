@@ -0,0 +1,16 @@
+//go:build !linux
+
+package rpm
+
+import (
+	"errors"
+	"os"
+)
+
+func devNumbers(dev uint64) (major, minor uint32, ok bool) {
+	return 0, 0, false
+}
+
+func fileCaps(f *os.File) (capSets, error) {
+	return capSets{}, &os.PathError{Op: "getxattr", Path: f.Name(), Err: errors.New("not supported on this platform")}
+}
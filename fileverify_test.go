@@ -0,0 +1,167 @@
+package rpm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyFiles(t *testing.T) {
+	if fi, err := os.Stat("."); err != nil {
+		t.Fatal(err)
+	} else if _, ok := fileStat(fi); !ok {
+		t.Skip("owners are not read on this platform")
+	}
+
+	// Whoever runs the test owns the files, and is called root.
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "etc"), 0755)
+	writeIDs := func(group string) {
+		os.WriteFile(filepath.Join(root, "etc/passwd"), []byte(fmt.Sprintf("root:x:%d:%d::/root:/bin/sh\n", os.Getuid(), os.Getgid())), 0644)
+		os.WriteFile(filepath.Join(root, "etc/group"), []byte(fmt.Sprintf("%s:x:%d:\n", group, os.Getgid())), 0644)
+	}
+	writeIDs("root")
+
+	b := testBuilder()
+	b.Files[3].Owner = ""
+	mtime := b.Files[0].ModTime
+	b.Files = append(b.Files,
+		BuildFile{Name: "/etc/hello.state", Mode: 0644, ModTime: mtime, Flags: FileConfig, NoVerify: VerifyDigest | VerifySize | VerifyMTime, Data: []byte("0\n")},
+		BuildFile{Name: "/usr/share/doc/hello/README", Mode: 0644, ModTime: mtime, Flags: FileDoc, Data: []byte("read me\n")},
+	)
+	p := buildTestPackage(t, b)
+	if _, err := p.Extract(root, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := func(opts VerifyOptions) []string {
+		results, err := p.Header.VerifyFiles(root, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []string
+		for _, r := range results {
+			if !r.OK() {
+				lines = append(lines, r.String())
+			}
+		}
+		return lines
+	}
+
+	if lines := failed(VerifyOptions{}); lines != nil {
+		t.Errorf("freshly installed files failed verification: %q", lines)
+	}
+
+	os.WriteFile(filepath.Join(root, "usr/bin/hello"), []byte("#!/bin/sh\necho goodbye\n"), 0755)
+	os.Chmod(filepath.Join(root, "etc/hello.conf"), 0600)
+	os.Remove(filepath.Join(root, "usr/bin/hi"))
+	os.Symlink("hola", filepath.Join(root, "usr/bin/hi"))
+	os.WriteFile(filepath.Join(root, "etc/hello.state"), []byte("1234\n"), 0644)
+	os.Remove(filepath.Join(root, "usr/share/doc/hello/README"))
+
+	expected := strings.Join([]string{
+		".M.......  c /etc/hello.conf",
+		"S.5....T.    /usr/bin/hello",
+		"....L....    /usr/bin/hi",
+		"missing   d /usr/share/doc/hello/README",
+	}, "\n")
+	t.Logf("expecting %q", expected)
+	if got := strings.Join(failed(VerifyOptions{}), "\n"); got != expected {
+		t.Errorf("wrong results; got %q wanted %q", got, expected)
+	}
+
+	expected = strings.Join([]string{
+		"missing   d /usr/share/doc/hello/README",
+	}, "\n")
+	if got := strings.Join(failed(VerifyOptions{Ignore: "S5TL", NoConfig: true}), "\n"); got != expected {
+		t.Errorf("wrong results with options; got %q wanted %q", got, expected)
+	}
+
+	os.Chtimes(filepath.Join(root, "usr/bin/hello"), time.Now(), mtime)
+	writeIDs("wheel")
+	expected = strings.Join([]string{
+		".M....G..  c /etc/hello.conf",
+		"......G..  c /etc/hello.state",
+		"......G..    /usr/bin",
+		"S.5...G..    /usr/bin/hello",
+		"....L.G..    /usr/bin/hi",
+		"missing   d /usr/share/doc/hello/README",
+	}, "\n")
+	if got := strings.Join(failed(VerifyOptions{}), "\n"); got != expected {
+		t.Errorf("wrong results with another group; got %q wanted %q", got, expected)
+	}
+}
+
+func TestVerifyFilesStates(t *testing.T) {
+	h := &Header{Entries: []Entry{
+		{Tag: TagBaseNames, Type: TypeStringArray, Count: 3, Value: []string{"a", "b", "c"}},
+		{Tag: TagDirNames, Type: TypeStringArray, Count: 1, Value: []string{"/nowhere/"}},
+		{Tag: TagDirIndexes, Type: TypeInt32, Count: 3, Value: []uint32{0, 0, 0}},
+		{Tag: TagFileStates, Type: TypeChar, Count: 3, Value: []byte{0, 2, 3}},
+	}}
+	results, err := h.VerifyFiles(t.TempDir(), VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].String() != "missing     /nowhere/a" {
+		t.Errorf("wrong results; got %v", results)
+	}
+}
+
+func TestParseCaps(t *testing.T) {
+	const raw, admin, chown = 1 << 13, 1 << 12, 1 << 0
+	all := uint64(1)<<uint(len(capNames)) - 1
+	tests := []struct {
+		text     string
+		expected capSets
+	}{
+		{"", capSets{}},
+		{"=", capSets{}},
+		{"cap_net_raw=ep", capSets{raw, raw, 0}},
+		{"cap_net_raw,cap_net_admin+ep cap_net_admin-e", capSets{raw, raw | admin, 0}},
+		{"=ep cap_chown-p", capSets{all, all &^ chown, 0}},
+		{"CAP_NET_RAW=eip", capSets{raw, raw, raw}},
+		{"0=p", capSets{0, chown, 0}},
+		{"cap_net_raw=p+e-p", capSets{raw, 0, 0}},
+	}
+	for _, test := range tests {
+		sets, err := parseCaps(test.text)
+		if err != nil {
+			t.Errorf("%q: %v", test.text, err)
+		} else if sets != test.expected {
+			t.Errorf("%q: got %x wanted %x", test.text, sets, test.expected)
+		}
+	}
+
+	for _, text := range []string{"cap_nope=ep", "cap_net_raw", "cap_net_raw=x"} {
+		if _, err := parseCaps(text); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
+
+func TestParseCapsXattr(t *testing.T) {
+	// Revision 2, with the effective flag, permitting cap_net_raw and
+	// cap_mac_admin.
+	attr := []byte{1, 0, 0, 2, 0, 0x20, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0}
+	sets, err := parseCapsXattr(attr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := parseCaps("cap_net_raw,cap_mac_admin=ep")
+	if sets != expected {
+		t.Errorf("wrong capabilities; got %x wanted %x", sets, expected)
+	}
+
+	if sets, err := parseCapsXattr(nil); err != nil || sets != (capSets{}) {
+		t.Errorf("wrong capabilities without the attribute; got %x (%v)", sets, err)
+	}
+	for _, b := range [][]byte{{1, 0}, {0, 0, 0, 9, 0, 0, 0, 0, 0, 0, 0, 0}, attr[:12]} {
+		if _, err := parseCapsXattr(b); err == nil {
+			t.Errorf("%x: expected an error", b)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package rpm
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// The owner and device numbers of a file. The device numbers are only set
+// if hasDev is, as not every platform's are known.
+type statIDs struct {
+	uid, gid     uint32
+	major, minor uint32
+	hasDev       bool
+}
+
+// fileStat returns the owner and device numbers of a file, from its
+// syscall.Stat_t.
+func fileStat(fi fs.FileInfo) (statIDs, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return statIDs{}, false
+	}
+	ids := statIDs{uid: uint32(st.Uid), gid: uint32(st.Gid)}
+	ids.major, ids.minor, ids.hasDev = devNumbers(uint64(st.Rdev))
+	return ids, true
+}
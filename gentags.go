@@ -0,0 +1,97 @@
+//go:build ignore
+
+// This program generates tagtable.go from tagtable.txt. Run it with
+// "go generate".
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+var types = map[string]string{
+	"null":         "TypeNull",
+	"char":         "TypeChar",
+	"int8":         "TypeInt8",
+	"int16":        "TypeInt16",
+	"int32":        "TypeInt32",
+	"int64":        "TypeInt64",
+	"string":       "TypeString",
+	"bin":          "TypeBin",
+	"string_array": "TypeStringArray",
+	"i18nstring":   "TypeI18NString",
+}
+
+type tag struct {
+	kind, name, value, typ string
+}
+
+func main() {
+	f, err := os.Open("tagtable.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	var tags []tag
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 4 || types[fields[3]] == "" || fields[0] != "tag" && fields[0] != "sig" {
+			log.Fatalf("tagtable.txt:%d: malformed line", n)
+		}
+		tags = append(tags, tag{fields[0], fields[1], fields[2], types[fields[3]]})
+	}
+	if err := s.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by gentags.go from tagtable.txt; DO NOT EDIT.\n\npackage rpm\n\n")
+
+	b.WriteString("// Main header tags.\nconst (\n")
+	for _, t := range tags {
+		if t.kind == "tag" {
+			fmt.Fprintf(&b, "Tag%s Tag = %s\n", t.name, t.value)
+		}
+	}
+	b.WriteString(")\n\n// Signature header tags.\nconst (\n")
+	for _, t := range tags {
+		if t.kind == "sig" {
+			fmt.Fprintf(&b, "SigTag%s Tag = %s\n", t.name, t.value)
+		}
+	}
+	b.WriteString(")\n\n")
+
+	for _, kind := range []string{"tag", "sig"} {
+		prefix, table := "Tag", "tagTable"
+		if kind == "sig" {
+			prefix, table = "SigTag", "sigTagTable"
+		}
+		fmt.Fprintf(&b, "var %s = map[Tag]tagInfo{\n", table)
+		for _, t := range tags {
+			if t.kind == kind {
+				fmt.Fprintf(&b, "%s%s: {%q, %s},\n", prefix, t.name, strings.ToUpper(t.name), t.typ)
+			}
+		}
+		b.WriteString("}\n\n")
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("tagtable.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
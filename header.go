@@ -0,0 +1,480 @@
+package rpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+var headerMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+
+// Limits on the size of a header, to keep malformed packages from causing
+// huge allocations. These are the same limits rpm applies.
+const (
+	maxHeaderTags = 0xffff
+	maxHeaderData = 16 << 20
+)
+
+/*
+A TagType is the data type of a header entry.
+*/
+type TagType uint32
+
+const (
+	TypeNull        TagType = 0
+	TypeChar        TagType = 1
+	TypeInt8        TagType = 2
+	TypeInt16       TagType = 3
+	TypeInt32       TagType = 4
+	TypeInt64       TagType = 5
+	TypeString      TagType = 6
+	TypeBin         TagType = 7
+	TypeStringArray TagType = 8
+	TypeI18NString  TagType = 9
+)
+
+var typeNames = []string{"NULL", "CHAR", "INT8", "INT16", "INT32", "INT64", "STRING", "BIN", "STRING_ARRAY", "I18NSTRING"}
+
+func (t TagType) String() string {
+	if int(t) < len(typeNames) {
+		return typeNames[t]
+	}
+	return fmt.Sprintf("TagType(%d)", uint32(t))
+}
+
+// The size of a single element of the fixed-size types.
+func (t TagType) size() int {
+	switch t {
+	case TypeChar, TypeInt8:
+		return 1
+	case TypeInt16:
+		return 2
+	case TypeInt32:
+		return 4
+	case TypeInt64:
+		return 8
+	}
+	return 0
+}
+
+/*
+An Entry is a single tag of a header, with its decoded value. Depending on
+Type, Value holds:
+
+	TypeNull                          nil
+	TypeChar, TypeInt8                []uint8
+	TypeInt16                         []uint16
+	TypeInt32                         []uint32
+	TypeInt64                         []uint64
+	TypeString                        string
+	TypeBin                           []byte
+	TypeStringArray, TypeI18NString   []string
+
+I18N strings hold one translation per locale listed in the header's
+HEADERI18NTABLE entry, the first of which is the untranslated string.
+*/
+type Entry struct {
+	Tag   Tag
+	Type  TagType
+	Count uint32
+	Value interface{}
+}
+
+/*
+A Header is the tagged data structure holding the metadata of a package: both
+the signature header and the main header of an RPM package are Headers.
+*/
+type Header struct {
+	Entries []Entry
+
+	// The header as it was read, starting with the magic.
+	raw []byte
+	idx map[Tag]int
+}
+
+/*
+Returns the entry for tag, and whether the header has it at all.
+*/
+func (h *Header) Entry(tag Tag) (*Entry, bool) {
+	if h.idx == nil {
+		h.reindex()
+	}
+	i, ok := h.idx[tag]
+	if !ok {
+		return nil, false
+	}
+	return &h.Entries[i], true
+}
+
+func (h *Header) reindex() {
+	h.idx = make(map[Tag]int, len(h.Entries))
+	for i, e := range h.Entries {
+		h.idx[e.Tag] = i
+	}
+}
+
+/*
+Returns the header exactly as it was read from the package, or nil if it was
+not read from one.
+*/
+func (h *Header) Bytes() []byte {
+	return h.raw
+}
+
+/*
+Encodes the header to its on-disk form, starting with the magic. Entries are
+written in order of their tags, as rpm does, with their data aligned according
+to their type.
+
+If the header has a region entry (HEADERSIGNATURES for a signature header,
+HEADERIMMUTABLE for a main header), the region is made to cover the whole
+header, and its trailer is regenerated.
+*/
+func (h *Header) MarshalBinary() ([]byte, error) {
+	entries := append([]Entry(nil), h.Entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return uint32(entries[i].Tag) < uint32(entries[j].Tag)
+	})
+
+	region := -1
+	for i, e := range entries {
+		if e.Tag == TagHeaderSignatures || e.Tag == TagHeaderImmutable {
+			region = i
+			break
+		}
+	}
+
+	var index, data bytes.Buffer
+	var regionIndex int
+	for i, e := range entries {
+		if i == region {
+			// Filled in once the size of the data store is known.
+			regionIndex = index.Len()
+			index.Write(make([]byte, 16))
+			continue
+		}
+
+		v, count, err := encodeValue(e.Type, e.Value)
+		if err != nil {
+			return nil, fmt.Errorf("tag %v: %v", e.Tag, err)
+		}
+		if n := e.Type.size(); n > 1 {
+			for data.Len()%n != 0 {
+				data.WriteByte(0)
+			}
+		}
+		binary.Write(&index, binary.BigEndian, []uint32{uint32(e.Tag), uint32(e.Type), uint32(data.Len()), count})
+		data.Write(v)
+	}
+
+	if region >= 0 {
+		tag := entries[region].Tag
+		b := index.Bytes()[regionIndex:]
+		binary.BigEndian.PutUint32(b, uint32(tag))
+		binary.BigEndian.PutUint32(b[4:], uint32(TypeBin))
+		binary.BigEndian.PutUint32(b[8:], uint32(data.Len()))
+		binary.BigEndian.PutUint32(b[12:], 16)
+
+		// The trailer points back at the start of the index.
+		binary.Write(&data, binary.BigEndian, []uint32{uint32(tag), uint32(TypeBin), uint32(-int32(len(entries) * 16)), 16})
+	}
+
+	if len(entries) == 0 || len(entries) > maxHeaderTags || data.Len() > maxHeaderData {
+		return nil, fmt.Errorf("%v: header too large or empty", ErrBadHeader)
+	}
+
+	var b bytes.Buffer
+	b.Write(headerMagic)
+	binary.Write(&b, binary.BigEndian, []uint32{0, uint32(len(entries)), uint32(data.Len())})
+	b.Write(index.Bytes())
+	b.Write(data.Bytes())
+	return b.Bytes(), nil
+}
+
+// encodeValue encodes a value as it is stored in the data store, and
+// returns it with its count.
+func encodeValue(typ TagType, value interface{}) ([]byte, uint32, error) {
+	var b bytes.Buffer
+	switch v := value.(type) {
+	case nil:
+		if typ == TypeNull {
+			return nil, 0, nil
+		}
+	case []byte:
+		if typ == TypeChar || typ == TypeInt8 || typ == TypeBin {
+			return v, uint32(len(v)), nil
+		}
+	case []uint16:
+		if typ == TypeInt16 {
+			binary.Write(&b, binary.BigEndian, v)
+			return b.Bytes(), uint32(len(v)), nil
+		}
+	case []uint32:
+		if typ == TypeInt32 {
+			binary.Write(&b, binary.BigEndian, v)
+			return b.Bytes(), uint32(len(v)), nil
+		}
+	case []uint64:
+		if typ == TypeInt64 {
+			binary.Write(&b, binary.BigEndian, v)
+			return b.Bytes(), uint32(len(v)), nil
+		}
+	case string:
+		if typ == TypeString {
+			return append([]byte(v), 0), 1, nil
+		}
+	case []string:
+		if typ == TypeStringArray || typ == TypeI18NString {
+			for _, s := range v {
+				b.WriteString(s)
+				b.WriteByte(0)
+			}
+			return b.Bytes(), uint32(len(v)), nil
+		}
+	}
+	return nil, 0, fmt.Errorf("value of type %T does not match %v", value, typ)
+}
+
+/*
+Reads a header starting at off, and returns it along with its size in bytes.
+*/
+func readHeader(r io.ReaderAt, off int64) (*Header, int64, error) {
+	var intro [16]byte
+	if _, err := r.ReadAt(intro[:], off); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+
+	nindex, hsize, err := parseIntro(intro[:])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size := 16 + int64(nindex)*16 + int64(hsize)
+	raw := make([]byte, size)
+	if _, err := r.ReadAt(raw, off); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+
+	h, err := parseHeader(raw)
+	return h, size, err
+}
+
+/*
+Parses a header stored without its magic, as the rpm database stores them: the
+blob starts with the number of entries and the size of the data store. Bytes
+returns the header with the magic put back.
+*/
+func ParseHeaderBlob(blob []byte) (*Header, error) {
+	raw := make([]byte, 8, 8+len(blob))
+	copy(raw, headerMagic)
+	raw = append(raw, blob...)
+	if len(raw) < 16 {
+		return nil, ErrBadHeader
+	}
+	if _, _, err := parseIntro(raw); err != nil {
+		return nil, err
+	}
+	return parseHeader(raw)
+}
+
+func parseIntro(b []byte) (nindex, hsize uint32, err error) {
+	if !bytes.Equal(b[:4], headerMagic) {
+		return 0, 0, ErrBadHeader
+	}
+	nindex = binary.BigEndian.Uint32(b[8:])
+	hsize = binary.BigEndian.Uint32(b[12:])
+	if nindex == 0 || nindex > maxHeaderTags {
+		return 0, 0, fmt.Errorf("%v: bad number of tags (%d)", ErrBadHeader, nindex)
+	}
+	if hsize > maxHeaderData {
+		return 0, 0, fmt.Errorf("%v: data store too large (%d bytes)", ErrBadHeader, hsize)
+	}
+	return nindex, hsize, nil
+}
+
+/*
+Parses a complete header, starting with its magic. Every entry is checked to
+lie within the data store, so a malformed header results in an error rather
+than a panic.
+*/
+func parseHeader(raw []byte) (*Header, error) {
+	if len(raw) < 16 {
+		return nil, ErrBadHeader
+	}
+	nindex, hsize, err := parseIntro(raw)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) != 16+int64(nindex)*16+int64(hsize) {
+		return nil, fmt.Errorf("%v: header size mismatch", ErrBadHeader)
+	}
+
+	index, data := raw[16:16+nindex*16], raw[16+nindex*16:]
+
+	// As rpm's hdrblobVerifyInfo does, make sure the data of the entries
+	// does not overlap before decoding any of it, so that entries sharing
+	// their data cannot make us decode the data store many times over.
+	type extent struct {
+		tag      Tag
+		off, end int64
+	}
+	extents := make([]extent, 0, nindex)
+	for i := uint32(0); i < nindex; i++ {
+		b := index[i*16:]
+		tag := Tag(int32(binary.BigEndian.Uint32(b)))
+		n, err := dataLength(data, TagType(binary.BigEndian.Uint32(b[4:])), int32(binary.BigEndian.Uint32(b[8:])), binary.BigEndian.Uint32(b[12:]))
+		if err != nil {
+			return nil, fmt.Errorf("%v: tag %v: %v", ErrBadHeader, tag, err)
+		}
+		if n > 0 {
+			off := int64(int32(binary.BigEndian.Uint32(b[8:])))
+			extents = append(extents, extent{tag, off, off + n})
+		}
+	}
+	sort.Slice(extents, func(i, j int) bool { return extents[i].off < extents[j].off })
+	for i := 1; i < len(extents); i++ {
+		if extents[i].off < extents[i-1].end {
+			return nil, fmt.Errorf("%v: tag %v: data overlaps that of tag %v", ErrBadHeader, extents[i].tag, extents[i-1].tag)
+		}
+	}
+
+	h := &Header{Entries: make([]Entry, nindex), raw: raw}
+	for i := range h.Entries {
+		b := index[i*16:]
+		tag := Tag(int32(binary.BigEndian.Uint32(b)))
+		typ := TagType(binary.BigEndian.Uint32(b[4:]))
+		off := int32(binary.BigEndian.Uint32(b[8:]))
+		count := binary.BigEndian.Uint32(b[12:])
+
+		v, err := decodeValue(data, typ, off, count)
+		if err != nil {
+			return nil, fmt.Errorf("%v: tag %v: %v", ErrBadHeader, tag, err)
+		}
+		h.Entries[i] = Entry{Tag: tag, Type: typ, Count: count, Value: v}
+	}
+	return h, nil
+}
+
+/*
+Returns the number of bytes of the data store the value of an entry takes,
+checking it lies within the data store, without decoding it.
+*/
+func dataLength(data []byte, typ TagType, off int32, count uint32) (int64, error) {
+	if off < 0 || int64(off) > int64(len(data)) {
+		return 0, fmt.Errorf("offset %d out of range", off)
+	}
+	if count == 0 || int64(count) > int64(len(data)) {
+		return 0, fmt.Errorf("bad count %d", count)
+	}
+	b := data[off:]
+
+	switch typ {
+	case TypeNull:
+		return 0, nil
+	case TypeChar, TypeInt8, TypeInt16, TypeInt32, TypeInt64, TypeBin:
+		n := int64(count)
+		if typ != TypeBin {
+			n *= int64(typ.size())
+		}
+		if n > int64(len(b)) {
+			return 0, fmt.Errorf("%d %v values overrun the data store", count, typ)
+		}
+		return n, nil
+	case TypeString, TypeStringArray, TypeI18NString:
+		if typ == TypeString && count != 1 {
+			return 0, fmt.Errorf("bad count %d for a string", count)
+		}
+		var n int64
+		for i := uint32(0); i < count; i++ {
+			j := bytes.IndexByte(b[n:], 0)
+			if j < 0 {
+				return 0, fmt.Errorf("unterminated string")
+			}
+			n += int64(j) + 1
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("unknown type %d", uint32(typ))
+}
+
+func decodeValue(data []byte, typ TagType, off int32, count uint32) (interface{}, error) {
+	if off < 0 || int64(off) > int64(len(data)) {
+		return nil, fmt.Errorf("offset %d out of range", off)
+	}
+	if count == 0 || int64(count) > int64(len(data)) {
+		return nil, fmt.Errorf("bad count %d", count)
+	}
+	b := data[off:]
+
+	if n := typ.size(); n > 0 {
+		if int64(count)*int64(n) > int64(len(b)) {
+			return nil, fmt.Errorf("%d %v values overrun the data store", count, typ)
+		}
+	}
+
+	switch typ {
+	case TypeNull:
+		return nil, nil
+	case TypeChar, TypeInt8:
+		return append([]uint8(nil), b[:count]...), nil
+	case TypeInt16:
+		v := make([]uint16, count)
+		for i := range v {
+			v[i] = binary.BigEndian.Uint16(b[i*2:])
+		}
+		return v, nil
+	case TypeInt32:
+		v := make([]uint32, count)
+		for i := range v {
+			v[i] = binary.BigEndian.Uint32(b[i*4:])
+		}
+		return v, nil
+	case TypeInt64:
+		v := make([]uint64, count)
+		for i := range v {
+			v[i] = binary.BigEndian.Uint64(b[i*8:])
+		}
+		return v, nil
+	case TypeBin:
+		if int64(count) > int64(len(b)) {
+			return nil, fmt.Errorf("%d bytes overrun the data store", count)
+		}
+		return append([]byte(nil), b[:count]...), nil
+	case TypeString:
+		if count != 1 {
+			return nil, fmt.Errorf("bad count %d for a string", count)
+		}
+		s, _, err := cString(b)
+		return s, err
+	case TypeStringArray, TypeI18NString:
+		v := make([]string, 0, count)
+		for i := uint32(0); i < count; i++ {
+			s, n, err := cString(b)
+			if err != nil {
+				return nil, err
+			}
+			v = append(v, s)
+			b = b[n:]
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown type %d", uint32(typ))
+}
+
+// cString returns the NUL-terminated string at the start of b, and the number
+// of bytes it occupies (including the NUL).
+func cString(b []byte) (string, int, error) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return "", 0, fmt.Errorf("unterminated string")
+	}
+	return string(b[:i]), i + 1, nil
+}
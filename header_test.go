@@ -0,0 +1,216 @@
+package rpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// testEntry is a header entry for buildHeader, with its value already
+// encoded.
+type testEntry struct {
+	tag   Tag
+	typ   TagType
+	count uint32
+	data  []byte
+}
+
+func testString(tag Tag, s string) testEntry {
+	return testEntry{tag, TypeString, 1, append([]byte(s), 0)}
+}
+
+func testStrings(tag Tag, typ TagType, ss ...string) testEntry {
+	var b []byte
+	for _, s := range ss {
+		b = append(append(b, s...), 0)
+	}
+	return testEntry{tag, typ, uint32(len(ss)), b}
+}
+
+func testInt32(tag Tag, vs ...uint32) testEntry {
+	b := make([]byte, 4*len(vs))
+	for i, v := range vs {
+		binary.BigEndian.PutUint32(b[i*4:], v)
+	}
+	return testEntry{tag, TypeInt32, uint32(len(vs)), b}
+}
+
+// buildHeader encodes a header from the given entries, aligning the data of
+// each one as rpm does.
+func buildHeader(entries ...testEntry) []byte {
+	var index, data bytes.Buffer
+	for _, e := range entries {
+		if n := e.typ.size(); n > 1 {
+			for data.Len()%n != 0 {
+				data.WriteByte(0)
+			}
+		}
+		binary.Write(&index, binary.BigEndian, []uint32{uint32(e.tag), uint32(e.typ), uint32(data.Len()), e.count})
+		data.Write(e.data)
+	}
+
+	var b bytes.Buffer
+	b.Write(headerMagic)
+	binary.Write(&b, binary.BigEndian, []uint32{0, uint32(len(entries)), uint32(data.Len())})
+	b.Write(index.Bytes())
+	b.Write(data.Bytes())
+	return b.Bytes()
+}
+
+func TestParseHeader(t *testing.T) {
+	raw := buildHeader(
+		testStrings(TagHeaderI18NTable, TypeStringArray, "C", "de"),
+		testString(1000, "go"),
+		testStrings(1004, TypeI18NString, "Go compiler", "Go-Compiler"),
+		testEntry{1001, TypeInt16, 2, []byte{0, 1, 0xff, 0xff}},
+		testInt32(1006, 1, 2, 3),
+		testEntry{1009, TypeInt64, 1, []byte{0, 0, 0, 1, 0, 0, 0, 0}},
+		testEntry{1012, TypeBin, 3, []byte{1, 2, 3}},
+		testEntry{1013, TypeChar, 2, []byte{'a', 'b'}},
+	)
+
+	h, err := parseHeader(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[Tag]string{
+		TagHeaderI18NTable: `[]string{"C", "de"}`,
+		1000:               `"go"`,
+		1004:               `[]string{"Go compiler", "Go-Compiler"}`,
+		1001:               `[]uint16{0x1, 0xffff}`,
+		1006:               `[]uint32{0x1, 0x2, 0x3}`,
+		1009:               `[]uint64{0x100000000}`,
+		1012:               `[]byte{0x1, 0x2, 0x3}`,
+		1013:               `[]byte{0x61, 0x62}`,
+	}
+	for tag, want := range tests {
+		e, ok := h.Entry(tag)
+		if !ok {
+			t.Errorf("tag %v not found", tag)
+		} else if got := fmt.Sprintf("%#v", e.Value); got != want {
+			t.Errorf("tag %v; got %s wanted %s", tag, got, want)
+		}
+	}
+	if _, ok := h.Entry(9999); ok {
+		t.Error("found a tag that is not in the header")
+	}
+	if !bytes.Equal(h.Bytes(), raw) {
+		t.Error("Bytes() does not return the header as it was read")
+	}
+}
+
+func TestParseHeaderMalformed(t *testing.T) {
+	intro := func(nindex, hsize uint32) []byte {
+		b := append([]byte(nil), headerMagic...)
+		b = append(b, 0, 0, 0, 0)
+		b = binary.BigEndian.AppendUint32(b, nindex)
+		return binary.BigEndian.AppendUint32(b, hsize)
+	}
+	entry := func(tag Tag, typ TagType, off int32, count uint32) []byte {
+		var b []byte
+		for _, v := range []uint32{uint32(tag), uint32(typ), uint32(off), count} {
+			b = binary.BigEndian.AppendUint32(b, v)
+		}
+		return b
+	}
+	join := func(bs ...[]byte) []byte { return bytes.Join(bs, nil) }
+
+	tests := map[string][]byte{
+		"bad magic":           append([]byte{0, 0, 0, 0}, intro(1, 0)[4:]...),
+		"no tags":             intro(0, 0),
+		"too many tags":       intro(0x10000, 0),
+		"huge data store":     intro(1, 1<<30),
+		"size mismatch":       join(intro(1, 4), entry(1000, TypeInt32, 0, 1)),
+		"offset out of range": join(intro(1, 4), entry(1000, TypeInt32, 8, 1), []byte{0, 0, 0, 0}),
+		"negative offset":     join(intro(1, 4), entry(1000, TypeInt32, -4, 1), []byte{0, 0, 0, 0}),
+		"int overrun":         join(intro(1, 4), entry(1000, TypeInt32, 0, 2), []byte{0, 0, 0, 0}),
+		"huge count":          join(intro(1, 4), entry(1000, TypeInt64, 0, 0x40000000), []byte{0, 0, 0, 0}),
+		"unterminated string": join(intro(1, 4), entry(1000, TypeString, 0, 1), []byte("abcd")),
+		"short string array":  join(intro(1, 4), entry(1000, TypeStringArray, 0, 3), []byte("a\x00b\x00")),
+		"bin overrun":         join(intro(1, 4), entry(1000, TypeBin, 2, 4), []byte{0, 0, 0, 0}),
+		"unknown type":        join(intro(1, 4), entry(1000, 42, 0, 1), []byte{0, 0, 0, 0}),
+		"zero count":          join(intro(1, 4), entry(1000, TypeInt32, 0, 0), []byte{0, 0, 0, 0}),
+		"shared data":         join(intro(2, 8), entry(1000, TypeInt32, 0, 2), entry(1001, TypeInt32, 0, 2), make([]byte, 8)),
+		"overlapping data":    join(intro(2, 8), entry(1000, TypeInt32, 4, 1), entry(1001, TypeBin, 2, 4), make([]byte, 8)),
+		"overlapping strings": join(intro(2, 4), entry(1000, TypeString, 0, 1), entry(1001, TypeString, 2, 1), []byte("abc\x00")),
+	}
+
+	for name, raw := range tests {
+		if _, err := parseHeader(raw); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseHeaderBlob(t *testing.T) {
+	raw := buildHeader(testString(TagName, "go"), testInt32(TagSize, 42))
+	h, err := ParseHeaderBlob(raw[8:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Name() != "go" || !bytes.Equal(h.Bytes(), raw) {
+		t.Errorf("wrong header; got %v", h.Entries)
+	}
+
+	for _, blob := range [][]byte{nil, raw[8:12], raw[8 : len(raw)-1]} {
+		if _, err := ParseHeaderBlob(blob); err == nil {
+			t.Errorf("%x: expected an error", blob)
+		}
+	}
+}
+
+func TestMarshalHeader(t *testing.T) {
+	raw := buildHeader(
+		testString(TagName, "go"),
+		testStrings(TagSummary, TypeI18NString, "Go compiler"),
+		testEntry{TagFileModes, TypeInt16, 2, []byte{0, 1, 0xff, 0xff}},
+		testInt32(TagBuildTime, 1, 2, 3),
+		testEntry{TagLongSize, TypeInt64, 1, []byte{0, 0, 0, 1, 0, 0, 0, 0}},
+		testEntry{TagSourcePkgID, TypeBin, 3, []byte{1, 2, 3}},
+		testEntry{TagHeaderImmutable, TypeBin, 16, make([]byte, 16)},
+	)
+	h, err := parseHeader(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := parseHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The region entry must come first, and its trailer must point back
+	// at the start of the index.
+	if h2.Entries[0].Tag != TagHeaderImmutable {
+		t.Errorf("region entry is not first; got %v", h2.Entries[0].Tag)
+	}
+	trailer := h2.Entries[0].Value.([]byte)
+	expected := fmt.Sprintf("%x", []uint32{uint32(TagHeaderImmutable), uint32(TypeBin), uint32(-int32(len(h2.Entries) * 16)), 16})
+	if got := fmt.Sprintf("%x", []uint32{binary.BigEndian.Uint32(trailer), binary.BigEndian.Uint32(trailer[4:]), binary.BigEndian.Uint32(trailer[8:]), binary.BigEndian.Uint32(trailer[12:])}); got != expected {
+		t.Errorf("wrong region trailer; got %s wanted %s", got, expected)
+	}
+
+	for _, e := range h.Entries {
+		if e.Tag == TagHeaderImmutable {
+			continue
+		}
+		e2, ok := h2.Entry(e.Tag)
+		if !ok {
+			t.Errorf("tag %v lost", e.Tag)
+			continue
+		}
+		if got, want := fmt.Sprintf("%v %d %#v", e2.Type, e2.Count, e2.Value), fmt.Sprintf("%v %d %#v", e.Type, e.Count, e.Value); got != want {
+			t.Errorf("tag %v; got %s wanted %s", e.Tag, got, want)
+		}
+	}
+
+	if _, err := (&Header{Entries: []Entry{{Tag: TagName, Type: TypeString, Value: []string{"go"}}}}).MarshalBinary(); err == nil {
+		t.Errorf("expected an error for a mistyped value")
+	}
+}
@@ -0,0 +1,91 @@
+package rpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// The size of the lead, at the very start of every package.
+const leadSize = 96
+
+var leadMagic = []byte{0xed, 0xab, 0xee, 0xdb}
+
+// Package types, as found in the lead.
+const (
+	LeadBinary = 0
+	LeadSource = 1
+)
+
+/*
+The Lead is the fixed-size structure at the start of every RPM package. It is
+mostly obsolete (rpm itself only looks at the magic and the package type), but
+is kept for the benefit of tools such as file(1).
+*/
+type Lead struct {
+	Major         uint8
+	Minor         uint8
+	Type          uint16
+	ArchNum       uint16
+	Name          string
+	OSNum         uint16
+	SignatureType uint16
+}
+
+/*
+Reports whether the lead describes a source package.
+*/
+func (l Lead) IsSource() bool {
+	return l.Type == LeadSource
+}
+
+func readLead(r io.ReaderAt) (Lead, error) {
+	var b [leadSize]byte
+	if _, err := r.ReadAt(b[:], 0); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Lead{}, fmt.Errorf("reading lead: %v", err)
+	}
+	if !bytes.Equal(b[:4], leadMagic) {
+		return Lead{}, ErrNotRPM
+	}
+
+	l := Lead{
+		Major:         b[4],
+		Minor:         b[5],
+		Type:          binary.BigEndian.Uint16(b[6:]),
+		ArchNum:       binary.BigEndian.Uint16(b[8:]),
+		OSNum:         binary.BigEndian.Uint16(b[76:]),
+		SignatureType: binary.BigEndian.Uint16(b[78:]),
+	}
+	if i := bytes.IndexByte(b[10:76], 0); i >= 0 {
+		l.Name = string(b[10 : 10+i])
+	} else {
+		l.Name = string(b[10:76])
+	}
+
+	if l.Major < 3 || l.Major > 4 {
+		return Lead{}, fmt.Errorf("unsupported package format version %d.%d", l.Major, l.Minor)
+	}
+	if l.SignatureType != 5 {
+		return Lead{}, fmt.Errorf("unsupported signature type %d", l.SignatureType)
+	}
+	return l, nil
+}
+
+/*
+Returns the lead in its on-disk form.
+*/
+func (l Lead) bytes() []byte {
+	b := make([]byte, leadSize)
+	copy(b, leadMagic)
+	b[4], b[5] = l.Major, l.Minor
+	binary.BigEndian.PutUint16(b[6:], l.Type)
+	binary.BigEndian.PutUint16(b[8:], l.ArchNum)
+	copy(b[10:75], l.Name)
+	binary.BigEndian.PutUint16(b[76:], l.OSNum)
+	binary.BigEndian.PutUint16(b[78:], l.SignatureType)
+	return b
+}
@@ -0,0 +1,332 @@
+package rpm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonEntry is the JSON form of an entry. Name is only informative: the tag
+// is given by its number.
+type jsonEntry struct {
+	Tag   Tag             `json:"tag"`
+	Name  string          `json:"name,omitempty"`
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+/*
+Encodes the header as a JSON array of its entries, each with its tag number,
+tag name, type and value, in example:
+
+	{"tag":1000,"name":"NAME","type":"STRING","value":"hello"}
+
+Integers are encoded as arrays of numbers, binary values as base64 strings,
+and string arrays as arrays of strings, so that UnmarshalJSON gets back the
+very same entries.
+*/
+func (h *Header) MarshalJSON() ([]byte, error) {
+	entries := make([]jsonEntry, len(h.Entries))
+	for i, e := range h.Entries {
+		var v interface{}
+		switch e.Type {
+		case TypeChar, TypeInt8, TypeInt16, TypeInt32, TypeInt64:
+			v = entryInts(e)
+		default:
+			v = e.Value
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("tag %v: %v", e.Tag, err)
+		}
+		entries[i] = jsonEntry{Tag: e.Tag, Type: e.Type.String(), Value: raw}
+		if _, ok := tagTable[e.Tag]; ok {
+			entries[i].Name = e.Tag.String()
+		}
+	}
+	return json.Marshal(entries)
+}
+
+/*
+Decodes a header encoded by MarshalJSON. The header can then be written out
+with MarshalBinary.
+*/
+func (h *Header) UnmarshalJSON(data []byte) error {
+	var entries []jsonEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	h.Entries, h.raw, h.idx = make([]Entry, len(entries)), nil, nil
+	for i, je := range entries {
+		typ, ok := typeByName(je.Type)
+		if !ok {
+			return fmt.Errorf("tag %v: unknown type %q", je.Tag, je.Type)
+		}
+
+		var v interface{}
+		var err error
+		switch typ {
+		case TypeNull:
+		case TypeChar, TypeInt8, TypeInt16, TypeInt32, TypeInt64:
+			var ints []uint64
+			if err = json.Unmarshal(je.Value, &ints); err == nil {
+				v, err = intsValue(typ, ints)
+			}
+		case TypeString:
+			var s string
+			err = json.Unmarshal(je.Value, &s)
+			v = s
+		case TypeBin:
+			var b []byte
+			err = json.Unmarshal(je.Value, &b)
+			v = b
+		case TypeStringArray, TypeI18NString:
+			var s []string
+			err = json.Unmarshal(je.Value, &s)
+			v = s
+		}
+		if err != nil {
+			return fmt.Errorf("tag %v: %v", je.Tag, err)
+		}
+		if h.Entries[i], err = newEntry(je.Tag, typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// xmlTag is an rpmTag element of rpm's XML format.
+type xmlTag struct {
+	Name   string     `xml:"name,attr"`
+	Type   string     `xml:"type,attr,omitempty"`
+	Values []xmlValue `xml:",any"`
+}
+
+// xmlValue is a string, integer or base64 element.
+type xmlValue struct {
+	XMLName xml.Name
+	Text    string `xml:",chardata"`
+}
+
+/*
+Encodes the header in the XML format of "rpm -q --xml": an rpmHeader element
+holding an rpmTag element for each entry, named after its tag (as in
+"Buildtime"), which holds a string, integer or base64 element for each value.
+
+So that UnmarshalXML gets back the very same entries, a type attribute is added
+to the entries whose type is not the one rpm uses for their tag, and unknown
+tags are named after their number, as in "Tag(1234)".
+*/
+func (h *Header) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Local: "rpmHeader"}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, entry := range h.Entries {
+		t := xmlTag{Name: entry.Tag.String()}
+		if info, ok := tagTable[entry.Tag]; ok {
+			t.Name = info.name[:1] + strings.ToLower(info.name[1:])
+		}
+		if typ, ok := entry.Tag.Type(); !ok || typ != entry.Type {
+			t.Type = entry.Type.String()
+		}
+
+		switch v := entry.Value.(type) {
+		case string:
+			t.Values = []xmlValue{{XMLName: xml.Name{Local: "string"}, Text: v}}
+		case []string:
+			for _, s := range v {
+				t.Values = append(t.Values, xmlValue{XMLName: xml.Name{Local: "string"}, Text: s})
+			}
+		default:
+			if b, ok := v.([]byte); ok && entry.Type == TypeBin {
+				t.Values = []xmlValue{{XMLName: xml.Name{Local: "base64"}, Text: base64.StdEncoding.EncodeToString(b)}}
+				break
+			}
+			for _, n := range entryInts(entry) {
+				t.Values = append(t.Values, xmlValue{XMLName: xml.Name{Local: "integer"}, Text: strconv.FormatUint(n, 10)})
+			}
+		}
+		if err := e.EncodeElement(t, xml.StartElement{Name: xml.Name{Local: "rpmTag"}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+/*
+Decodes a header in the XML format of "rpm -q --xml". The types of the entries
+are those rpm uses for their tags, unless given by a type attribute; entries
+of unknown tags without one are typed after their values.
+*/
+func (h *Header) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var doc struct {
+		Tags []xmlTag `xml:"rpmTag"`
+	}
+	if err := d.DecodeElement(&doc, &start); err != nil {
+		return err
+	}
+
+	h.Entries, h.raw, h.idx = make([]Entry, len(doc.Tags)), nil, nil
+	for i, t := range doc.Tags {
+		tag, ok := TagByName(t.Name)
+		if n, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(t.Name, "Tag("), ")"), 10, 32); err == nil {
+			tag, ok = Tag(n), true
+		}
+		if !ok {
+			return fmt.Errorf("unknown tag %q", t.Name)
+		}
+
+		typ, ok := tag.Type()
+		if t.Type != "" {
+			if typ, ok = typeByName(t.Type); !ok {
+				return fmt.Errorf("tag %v: unknown type %q", tag, t.Type)
+			}
+		} else if !ok {
+			typ = xmlValueType(t.Values)
+		}
+
+		var v interface{}
+		var err error
+		switch typ {
+		case TypeNull:
+		case TypeChar, TypeInt8, TypeInt16, TypeInt32, TypeInt64:
+			ints := make([]uint64, len(t.Values))
+			for j, x := range t.Values {
+				if ints[j], err = strconv.ParseUint(strings.TrimSpace(x.Text), 10, 64); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				v, err = intsValue(typ, ints)
+			}
+		case TypeString:
+			if len(t.Values) != 1 {
+				err = fmt.Errorf("%d values for a string", len(t.Values))
+			} else {
+				v = t.Values[0].Text
+			}
+		case TypeBin:
+			switch len(t.Values) {
+			case 0:
+				v = []byte(nil)
+			case 1:
+				// rpm breaks base64 into lines.
+				v, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(t.Values[0].Text), ""))
+			default:
+				err = fmt.Errorf("%d values for a binary tag", len(t.Values))
+			}
+		case TypeStringArray, TypeI18NString:
+			s := make([]string, len(t.Values))
+			for j, x := range t.Values {
+				s[j] = x.Text
+			}
+			v = s
+		}
+		if err != nil {
+			return fmt.Errorf("tag %v: %v", tag, err)
+		}
+		if h.Entries[i], err = newEntry(tag, typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// xmlValueType guesses the type of an entry of an unknown tag from its
+// values.
+func xmlValueType(values []xmlValue) TagType {
+	if len(values) > 0 {
+		switch values[0].XMLName.Local {
+		case "integer":
+			return TypeInt32
+		case "base64":
+			return TypeBin
+		}
+	}
+	if len(values) == 1 {
+		return TypeString
+	}
+	return TypeStringArray
+}
+
+// newEntry returns an entry with its count, checking that the value fits its
+// type.
+func newEntry(tag Tag, typ TagType, v interface{}) (Entry, error) {
+	if typ == TypeNull {
+		return Entry{Tag: tag, Type: typ}, nil
+	}
+	_, count, err := encodeValue(typ, v)
+	if err != nil {
+		return Entry{}, fmt.Errorf("tag %v: %v", tag, err)
+	}
+	return Entry{Tag: tag, Type: typ, Count: count, Value: v}, nil
+}
+
+// entryInts returns the values of an integer entry.
+func entryInts(e Entry) []uint64 {
+	var ints []uint64
+	switch v := e.Value.(type) {
+	case []uint8:
+		for _, i := range v {
+			ints = append(ints, uint64(i))
+		}
+	case []uint16:
+		for _, i := range v {
+			ints = append(ints, uint64(i))
+		}
+	case []uint32:
+		for _, i := range v {
+			ints = append(ints, uint64(i))
+		}
+	case []uint64:
+		ints = v
+	}
+	return ints
+}
+
+// intsValue converts integers to the value of an entry of the given type,
+// checking that they fit.
+func intsValue(typ TagType, ints []uint64) (interface{}, error) {
+	bits := uint(typ.size() * 8)
+	for _, n := range ints {
+		if bits < 64 && n>>bits != 0 {
+			return nil, fmt.Errorf("%d does not fit %v", n, typ)
+		}
+	}
+
+	switch typ {
+	case TypeChar, TypeInt8:
+		v := make([]uint8, len(ints))
+		for i, n := range ints {
+			v[i] = uint8(n)
+		}
+		return v, nil
+	case TypeInt16:
+		v := make([]uint16, len(ints))
+		for i, n := range ints {
+			v[i] = uint16(n)
+		}
+		return v, nil
+	case TypeInt32:
+		v := make([]uint32, len(ints))
+		for i, n := range ints {
+			v[i] = uint32(n)
+		}
+		return v, nil
+	}
+	return ints, nil
+}
+
+func typeByName(name string) (TagType, bool) {
+	for i, n := range typeNames {
+		if n == name {
+			return TagType(i), true
+		}
+	}
+	return 0, false
+}
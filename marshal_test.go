@@ -0,0 +1,138 @@
+package rpm
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeaderRoundTrip(t *testing.T) {
+	p := buildTestPackage(t, testBuilder())
+
+	codecs := map[string]struct {
+		marshal   func(v interface{}) ([]byte, error)
+		unmarshal func(data []byte, v interface{}) error
+	}{
+		"json": {json.Marshal, json.Unmarshal},
+		"xml":  {xml.Marshal, xml.Unmarshal},
+	}
+	for name, c := range codecs {
+		for _, h := range []*Header{p.Header, p.Signature} {
+			data, err := c.marshal(h)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			var decoded Header
+			if err := c.unmarshal(data, &decoded); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			b, err := decoded.MarshalBinary()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if !bytes.Equal(b, h.Bytes()) {
+				t.Errorf("%s: header differs after a round trip", name)
+			}
+		}
+	}
+}
+
+func TestHeaderMarshalXML(t *testing.T) {
+	h := &Header{Entries: []Entry{
+		{Tag: TagName, Type: TypeString, Count: 1, Value: "a<b"},
+		{Tag: TagEpoch, Type: TypeInt32, Count: 1, Value: []uint32{1}},
+		{Tag: TagFileModes, Type: TypeInt32, Count: 2, Value: []uint32{0100644, 040755}},
+		{Tag: TagSigMD5, Type: TypeBin, Count: 2, Value: []byte{1, 2}},
+		{Tag: 9999, Type: TypeInt16, Count: 1, Value: []uint16{7}},
+		{Tag: TagBaseNames, Type: TypeStringArray, Count: 2, Value: []string{"", "x"}},
+	}}
+	data, err := xml.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<rpmHeader><rpmTag name="Name"><string>a&lt;b</string></rpmTag>` +
+		`<rpmTag name="Epoch"><integer>1</integer></rpmTag>` +
+		`<rpmTag name="Filemodes" type="INT32"><integer>33188</integer><integer>16877</integer></rpmTag>` +
+		`<rpmTag name="Sigmd5"><base64>AQI=</base64></rpmTag>` +
+		`<rpmTag name="Tag(9999)" type="INT16"><integer>7</integer></rpmTag>` +
+		`<rpmTag name="Basenames"><string></string><string>x</string></rpmTag></rpmHeader>`
+	t.Logf("expecting %q", expected)
+	if string(data) != expected {
+		t.Errorf("wrong XML; got %q wanted %q", data, expected)
+	}
+
+	var decoded Header
+	if err := xml.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Entries, h.Entries) {
+		t.Errorf("wrong entries; got %v wanted %v", decoded.Entries, h.Entries)
+	}
+}
+
+func TestHeaderUnmarshalRPMXML(t *testing.T) {
+	// As printed by rpm -q --xml.
+	data := `<rpmHeader>
+  <rpmTag name="Name">
+	<string>hello</string>
+  </rpmTag>
+  <rpmTag name="Sigmd5">
+	<base64>AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8gISIjJCUmJygpKiss
+LS4vMA==
+	</base64>
+  </rpmTag>
+  <rpmTag name="Filemodes">
+	<integer>33188</integer>
+	<integer>16877</integer>
+  </rpmTag>
+  <rpmTag name="Summary">
+	<string>Says hello</string>
+  </rpmTag>
+</rpmHeader>
+`
+	var h Header
+	if err := xml.Unmarshal([]byte(data), &h); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range h.Entries {
+		got = append(got, fmt.Sprintf("%v %v %d", e.Tag, e.Type, e.Count))
+	}
+	expected := "[NAME STRING 1 SIGMD5 BIN 49 FILEMODES INT16 2 SUMMARY I18NSTRING 1]"
+	t.Logf("expecting %q", expected)
+	if fmt.Sprint(got) != expected {
+		t.Errorf("wrong entries; got %q wanted %q", fmt.Sprint(got), expected)
+	}
+	if h.Summary() != "Says hello" || h.GetBytes(TagSigMD5)[48] != 48 {
+		t.Errorf("wrong values; got %v", h.Entries)
+	}
+}
+
+func TestHeaderUnmarshalErrors(t *testing.T) {
+	for _, data := range []string{
+		`[{"tag":1000,"type":"NOPE","value":"x"}]`,
+		`[{"tag":1030,"type":"INT16","value":[65536]}]`,
+		`[{"tag":1000,"type":"STRING","value":[1]}]`,
+	} {
+		var h Header
+		if err := json.Unmarshal([]byte(data), &h); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+
+	for _, data := range []string{
+		`<rpmHeader><rpmTag name="Nope"><string>x</string></rpmTag></rpmHeader>`,
+		`<rpmHeader><rpmTag name="Name"><string>x</string><string>y</string></rpmTag></rpmHeader>`,
+		`<rpmHeader><rpmTag name="Epoch"><integer>x</integer></rpmTag></rpmHeader>`,
+		`<rpmHeader><rpmTag name="Sigmd5"><base64>!!</base64></rpmTag></rpmHeader>`,
+	} {
+		var h Header
+		if err := xml.NewDecoder(strings.NewReader(data)).Decode(&h); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
@@ -0,0 +1,527 @@
+package rpm
+
+import (
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/nesv/rpm/spec"
+)
+
+/*
+Returns the value of a string tag, or the first (untranslated) value of a
+string array or I18N string tag. It returns "" if the header has no such tag.
+*/
+func (h *Header) GetString(tag Tag) string {
+	e, ok := h.Entry(tag)
+	if !ok {
+		return ""
+	}
+	switch v := e.Value.(type) {
+	case string:
+		return v
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+/*
+Returns the values of a string array, I18N string or string tag, or nil if the
+header has no such tag.
+*/
+func (h *Header) GetStrings(tag Tag) []string {
+	e, ok := h.Entry(tag)
+	if !ok {
+		return nil
+	}
+	switch v := e.Value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	}
+	return nil
+}
+
+/*
+Returns the values of an integer tag of any size, or nil if the header has no
+such tag.
+*/
+func (h *Header) GetInts(tag Tag) []int64 {
+	e, ok := h.Entry(tag)
+	if !ok {
+		return nil
+	}
+
+	var ints []int64
+	switch v := e.Value.(type) {
+	case []uint8:
+		for _, i := range v {
+			ints = append(ints, int64(i))
+		}
+	case []uint16:
+		for _, i := range v {
+			ints = append(ints, int64(i))
+		}
+	case []uint32:
+		for _, i := range v {
+			ints = append(ints, int64(i))
+		}
+	case []uint64:
+		for _, i := range v {
+			ints = append(ints, int64(i))
+		}
+	}
+	return ints
+}
+
+/*
+Returns the first value of an integer tag, and whether the header has such a
+tag.
+*/
+func (h *Header) GetInt(tag Tag) (int64, bool) {
+	ints := h.GetInts(tag)
+	if len(ints) == 0 {
+		return 0, false
+	}
+	return ints[0], true
+}
+
+/*
+Returns the value of a binary tag, or nil if the header has no such tag.
+*/
+func (h *Header) GetBytes(tag Tag) []byte {
+	e, ok := h.Entry(tag)
+	if !ok {
+		return nil
+	}
+	b, _ := e.Value.([]byte)
+	return b
+}
+
+/*
+Returns the name of the package.
+*/
+func (h *Header) Name() string {
+	return h.GetString(TagName)
+}
+
+/*
+Returns the version of the package.
+*/
+func (h *Header) Version() string {
+	return h.GetString(TagVersion)
+}
+
+/*
+Returns the release of the package.
+*/
+func (h *Header) Release() string {
+	return h.GetString(TagRelease)
+}
+
+/*
+Returns the epoch of the package, and whether it has one.
+*/
+func (h *Header) Epoch() (int64, bool) {
+	return h.GetInt(TagEpoch)
+}
+
+/*
+Returns the "[epoch:]version-release" of the package.
+*/
+func (h *Header) EVR() string {
+	evr := h.Version() + "-" + h.Release()
+	if epoch, ok := h.Epoch(); ok {
+		evr = fmt.Sprintf("%d:%s", epoch, evr)
+	}
+	return evr
+}
+
+/*
+Returns the "name-[epoch:]version-release.arch" of the package, with "src" as
+the architecture of source packages, as rpm -q prints it.
+*/
+func (h *Header) NEVRA() string {
+	arch := h.Arch()
+	if h.IsSource() {
+		arch = "src"
+	}
+	return h.Name() + "-" + h.EVR() + "." + arch
+}
+
+/*
+Returns the architecture the package was built for.
+*/
+func (h *Header) Arch() string {
+	return h.GetString(TagArch)
+}
+
+/*
+Returns the operating system the package was built for.
+*/
+func (h *Header) OS() string {
+	return h.GetString(TagOS)
+}
+
+/*
+Returns the (untranslated) summary of the package.
+*/
+func (h *Header) Summary() string {
+	return h.GetString(TagSummary)
+}
+
+/*
+Returns the (untranslated) description of the package.
+*/
+func (h *Header) Description() string {
+	return h.GetString(TagDescription)
+}
+
+/*
+Returns the license of the package.
+*/
+func (h *Header) License() string {
+	return h.GetString(TagLicense)
+}
+
+/*
+Returns the URL of the package's upstream project.
+*/
+func (h *Header) URL() string {
+	return h.GetString(TagURL)
+}
+
+/*
+Returns the name of the source package the package was built from. Source
+packages have none.
+*/
+func (h *Header) SourceRPM() string {
+	return h.GetString(TagSourceRPM)
+}
+
+/*
+Reports whether the header is that of a source package. As with rpm, this is
+judged by the absence of the SOURCERPM tag.
+*/
+func (h *Header) IsSource() bool {
+	_, ok := h.Entry(TagSourceRPM)
+	return !ok
+}
+
+/*
+Returns the time the package was built, or the zero time if it is not known.
+*/
+func (h *Header) BuildTime() time.Time {
+	t, ok := h.GetInt(TagBuildTime)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(t, 0).UTC()
+}
+
+/*
+Returns the total size of the files in the package.
+*/
+func (h *Header) Size() int64 {
+	if n, ok := h.GetInt(TagLongSize); ok {
+		return n
+	}
+	n, _ := h.GetInt(TagSize)
+	return n
+}
+
+/*
+Assembles the dependencies held in the parallel name, flags and version tags
+of a dependency type. Flags and versions may be absent, as they are in old
+packages; otherwise all three must be of the same length.
+*/
+func (h *Header) dependencies(name, flags, version Tag) ([]spec.Dependency, error) {
+	names := h.GetStrings(name)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	fl, vers := h.GetInts(flags), h.GetStrings(version)
+	if fl != nil && len(fl) != len(names) || vers != nil && len(vers) != len(names) {
+		return nil, fmt.Errorf("%v: %v, %v and %v differ in length", ErrBadHeader, name, flags, version)
+	}
+
+	deps := make([]spec.Dependency, len(names))
+	for i, n := range names {
+		deps[i].Name = n
+		if fl != nil {
+			deps[i].Flags = spec.DependencyFlags(fl[i])
+		}
+		if vers != nil {
+			deps[i].Version = vers[i]
+		}
+	}
+	return deps, nil
+}
+
+/*
+Returns the Requires: of the package, including the rpmlib() dependencies rpm
+adds when building it.
+*/
+func (h *Header) Requires() ([]spec.Dependency, error) {
+	return h.dependencies(TagRequireName, TagRequireFlags, TagRequireVersion)
+}
+
+/*
+Returns the Provides: of the package.
+*/
+func (h *Header) Provides() ([]spec.Dependency, error) {
+	return h.dependencies(TagProvideName, TagProvideFlags, TagProvideVersion)
+}
+
+/*
+Returns the Conflicts: of the package.
+*/
+func (h *Header) Conflicts() ([]spec.Dependency, error) {
+	return h.dependencies(TagConflictName, TagConflictFlags, TagConflictVersion)
+}
+
+/*
+Returns the Obsoletes: of the package.
+*/
+func (h *Header) Obsoletes() ([]spec.Dependency, error) {
+	return h.dependencies(TagObsoleteName, TagObsoleteFlags, TagObsoleteVersion)
+}
+
+/*
+Returns the Recommends: of the package.
+*/
+func (h *Header) Recommends() ([]spec.Dependency, error) {
+	return h.dependencies(TagRecommendName, TagRecommendFlags, TagRecommendVersion)
+}
+
+/*
+Returns the Suggests: of the package.
+*/
+func (h *Header) Suggests() ([]spec.Dependency, error) {
+	return h.dependencies(TagSuggestName, TagSuggestFlags, TagSuggestVersion)
+}
+
+/*
+Returns the Supplements: of the package.
+*/
+func (h *Header) Supplements() ([]spec.Dependency, error) {
+	return h.dependencies(TagSupplementName, TagSupplementFlags, TagSupplementVersion)
+}
+
+/*
+Returns the Enhances: of the package.
+*/
+func (h *Header) Enhances() ([]spec.Dependency, error) {
+	return h.dependencies(TagEnhanceName, TagEnhanceFlags, TagEnhanceVersion)
+}
+
+/*
+Returns the changelog of the package, newest entry first.
+*/
+func (h *Header) Changelog() ([]spec.ChangelogEntry, error) {
+	times := h.GetInts(TagChangelogTime)
+	names := h.GetStrings(TagChangelogName)
+	texts := h.GetStrings(TagChangelogText)
+	if len(times) != len(names) || len(times) != len(texts) {
+		return nil, fmt.Errorf("%v: changelog tags differ in length", ErrBadHeader)
+	}
+
+	var entries []spec.ChangelogEntry
+	for i := range times {
+		entries = append(entries, spec.ChangelogEntry{
+			Time: time.Unix(times[i], 0).UTC(),
+			Name: names[i],
+			Text: texts[i],
+		})
+	}
+	return entries, nil
+}
+
+/*
+FileFlags are the attributes given to a file in the %files section of a spec
+file, as stored in the FILEFLAGS tag.
+*/
+type FileFlags uint32
+
+const (
+	FileConfig    FileFlags = 1 << 0  // %config
+	FileDoc       FileFlags = 1 << 1  // %doc
+	FileIcon      FileFlags = 1 << 2  // from Icon:
+	FileMissingOK FileFlags = 1 << 3  // %config(missingok)
+	FileNoReplace FileFlags = 1 << 4  // %config(noreplace)
+	FileSpecFile  FileFlags = 1 << 5  // the spec file of a source package
+	FileGhost     FileFlags = 1 << 6  // %ghost
+	FileLicense   FileFlags = 1 << 7  // %license
+	FileReadme    FileFlags = 1 << 8  // %readme
+	FilePubKey    FileFlags = 1 << 11 // %pubkey
+	FileArtifact  FileFlags = 1 << 12 // %artifact
+)
+
+/*
+A File describes one of the files of a package, as listed in its header.
+*/
+type File struct {
+	Name        string
+	Size        int64
+	Mode        uint16 // the st_mode, with the file type bits
+	Rdev        uint16
+	ModTime     time.Time
+	Digest      string // hex-encoded, using the header's FILEDIGESTALGO
+	LinkTo      string
+	Flags       FileFlags
+	VerifyFlags uint32
+	Owner       string
+	Group       string
+	Device      uint32
+	Inode       uint32
+	Lang        string
+	Caps        string
+}
+
+/*
+Returns the mode of the file as an fs.FileMode.
+*/
+func (f File) FileMode() fs.FileMode {
+	return unixFileMode(uint32(f.Mode))
+}
+
+// File type bits of a unix st_mode.
+const (
+	modeTypeMask = 0170000
+	modeSocket   = 0140000
+	modeSymlink  = 0120000
+	modeRegular  = 0100000
+	modeBlock    = 0060000
+	modeDir      = 0040000
+	modeChar     = 0020000
+	modeFIFO     = 0010000
+)
+
+// unixFileMode converts a unix st_mode to an fs.FileMode.
+func unixFileMode(m uint32) fs.FileMode {
+	mode := fs.FileMode(m & 0777)
+	switch m & modeTypeMask {
+	case modeSocket:
+		mode |= fs.ModeSocket
+	case modeSymlink:
+		mode |= fs.ModeSymlink
+	case modeBlock:
+		mode |= fs.ModeDevice
+	case modeDir:
+		mode |= fs.ModeDir
+	case modeChar:
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case modeFIFO:
+		mode |= fs.ModeNamedPipe
+	}
+	if m&04000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if m&02000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if m&01000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
+
+/*
+Returns the names of the files in the package, assembled from the BASENAMES,
+DIRNAMES and DIRINDEXES tags (or taken from OLDFILENAMES, in packages old
+enough to have it).
+*/
+func (h *Header) Filenames() ([]string, error) {
+	if names := h.GetStrings(TagOldFilenames); names != nil {
+		return names, nil
+	}
+
+	bases, dirs, idx := h.GetStrings(TagBaseNames), h.GetStrings(TagDirNames), h.GetInts(TagDirIndexes)
+	if len(bases) != len(idx) {
+		return nil, fmt.Errorf("%v: BASENAMES and DIRINDEXES differ in length", ErrBadHeader)
+	}
+
+	names := make([]string, len(bases))
+	for i, base := range bases {
+		if idx[i] < 0 || idx[i] >= int64(len(dirs)) {
+			return nil, fmt.Errorf("%v: directory index %d out of range", ErrBadHeader, idx[i])
+		}
+		names[i] = dirs[idx[i]] + base
+	}
+	return names, nil
+}
+
+/*
+Returns the files of the package, assembled from the parallel FILE* tags. Tags
+which are absent leave the matching field empty; tags which are present must
+have a value for every file.
+*/
+func (h *Header) Files() ([]File, error) {
+	names, err := h.Filenames()
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+
+	files := make([]File, len(names))
+	for i, n := range names {
+		files[i].Name = n
+	}
+
+	ints := func(tag Tag, set func(f *File, v int64)) error {
+		v := h.GetInts(tag)
+		if v == nil {
+			return nil
+		}
+		if len(v) != len(files) {
+			return fmt.Errorf("%v: %v has %d values for %d files", ErrBadHeader, tag, len(v), len(files))
+		}
+		for i := range files {
+			set(&files[i], v[i])
+		}
+		return nil
+	}
+	strs := func(tag Tag, set func(f *File, v string)) error {
+		v := h.GetStrings(tag)
+		if v == nil {
+			return nil
+		}
+		if len(v) != len(files) {
+			return fmt.Errorf("%v: %v has %d values for %d files", ErrBadHeader, tag, len(v), len(files))
+		}
+		for i := range files {
+			set(&files[i], v[i])
+		}
+		return nil
+	}
+
+	sizeTag := TagFileSizes
+	if _, ok := h.Entry(TagLongFileSizes); ok {
+		sizeTag = TagLongFileSizes
+	}
+
+	for _, err := range []error{
+		ints(sizeTag, func(f *File, v int64) { f.Size = v }),
+		ints(TagFileModes, func(f *File, v int64) { f.Mode = uint16(v) }),
+		ints(TagFileRDevs, func(f *File, v int64) { f.Rdev = uint16(v) }),
+		ints(TagFileMTimes, func(f *File, v int64) { f.ModTime = time.Unix(v, 0).UTC() }),
+		ints(TagFileFlags, func(f *File, v int64) { f.Flags = FileFlags(v) }),
+		ints(TagFileVerifyFlags, func(f *File, v int64) { f.VerifyFlags = uint32(v) }),
+		ints(TagFileDevices, func(f *File, v int64) { f.Device = uint32(v) }),
+		ints(TagFileInodes, func(f *File, v int64) { f.Inode = uint32(v) }),
+		strs(TagFileDigests, func(f *File, v string) { f.Digest = v }),
+		strs(TagFileLinkTos, func(f *File, v string) { f.LinkTo = v }),
+		strs(TagFileUserName, func(f *File, v string) { f.Owner = v }),
+		strs(TagFileGroupName, func(f *File, v string) { f.Group = v }),
+		strs(TagFileLangs, func(f *File, v string) { f.Lang = v }),
+		strs(TagFileCaps, func(f *File, v string) { f.Caps = v }),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
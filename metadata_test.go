@@ -0,0 +1,133 @@
+package rpm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testHeader(t *testing.T, entries ...testEntry) *Header {
+	h, err := parseHeader(buildHeader(entries...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestHeaderAccessors(t *testing.T) {
+	h := testHeader(t,
+		testString(TagName, "go"),
+		testString(TagVersion, "1.0.3"),
+		testString(TagRelease, "1"),
+		testInt32(TagEpoch, 2),
+		testString(TagArch, "x86_64"),
+		testStrings(TagSummary, TypeI18NString, "Go compiler", "Go-Compiler"),
+		testInt32(TagBuildTime, 1354838400),
+		testInt32(TagSize, 1234),
+		testString(TagSourceRPM, "go-1.0.3-1.src.rpm"),
+	)
+
+	tests := map[string][2]interface{}{
+		"Name":      {h.Name(), "go"},
+		"EVR":       {h.EVR(), "2:1.0.3-1"},
+		"NEVRA":     {h.NEVRA(), "go-2:1.0.3-1.x86_64"},
+		"Summary":   {h.Summary(), "Go compiler"},
+		"BuildTime": {h.BuildTime().Format("2006-01-02"), "2012-12-07"},
+		"Size":      {h.Size(), int64(1234)},
+		"IsSource":  {h.IsSource(), false},
+		"License":   {h.License(), ""},
+	}
+	for name, tt := range tests {
+		got, want := fmt.Sprintf("%#v", tt[0]), fmt.Sprintf("%#v", tt[1])
+		t.Logf("expecting %s() to be %s", name, want)
+		if got != want {
+			t.Errorf("%s(); got %s wanted %s", name, got, want)
+		}
+	}
+}
+
+func TestHeaderDependencies(t *testing.T) {
+	h := testHeader(t,
+		testStrings(TagRequireName, TypeStringArray, "libc.so.6()(64bit)", "bash", "rpmlib(PayloadIsXz)"),
+		testInt32(TagRequireFlags, 0x4000, 0x0c, 0x100000a),
+		testStrings(TagRequireVersion, TypeStringArray, "", "4.0", "5.2-1"),
+	)
+
+	deps, err := h.Requires()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[libc.so.6()(64bit) bash >= 4.0 rpmlib(PayloadIsXz) <= 5.2-1]`
+	t.Logf("expecting %q", expected)
+	if got := fmt.Sprint(deps); got != expected {
+		t.Errorf("Requires(); got %q wanted %q", got, expected)
+	}
+
+	if deps, err := h.Provides(); deps != nil || err != nil {
+		t.Errorf("Provides() of a header without provides; got %v, %v", deps, err)
+	}
+
+	h = testHeader(t,
+		testStrings(TagRequireName, TypeStringArray, "a", "b"),
+		testInt32(TagRequireFlags, 0),
+	)
+	if _, err := h.Requires(); err == nil {
+		t.Errorf("expected an error for mismatched dependency tags")
+	}
+}
+
+func TestHeaderFiles(t *testing.T) {
+	h := testHeader(t,
+		testStrings(TagBaseNames, TypeStringArray, "go", "bin", "gofmt"),
+		testStrings(TagDirNames, TypeStringArray, "/usr/", "/usr/bin/"),
+		testInt32(TagDirIndexes, 1, 0, 1),
+		testInt32(TagFileSizes, 100, 4096, 50),
+		testEntry{TagFileModes, TypeInt16, 3, []byte{0x81, 0xed, 0x41, 0xed, 0xa1, 0xff}},
+		testStrings(TagFileLinkTos, TypeStringArray, "", "", "go"),
+		testInt32(TagFileFlags, 0, 0, uint32(FileGhost)),
+	)
+
+	files, err := h.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"/usr/bin/go 100 -rwxr-xr-x  0",
+		"/usr/bin 4096 drwxr-xr-x  0",
+		"/usr/bin/gofmt 50 Lrwxrwxrwx go 64",
+	}
+	for i, f := range files {
+		got := fmt.Sprintf("%s %d %v %s %d", f.Name, f.Size, f.FileMode(), f.LinkTo, f.Flags)
+		t.Logf("expecting %q", expected[i])
+		if got != expected[i] {
+			t.Errorf("file %d; got %q wanted %q", i, got, expected[i])
+		}
+	}
+
+	h = testHeader(t,
+		testStrings(TagBaseNames, TypeStringArray, "go"),
+		testStrings(TagDirNames, TypeStringArray, "/usr/bin/"),
+		testInt32(TagDirIndexes, 5),
+	)
+	if _, err := h.Files(); err == nil {
+		t.Errorf("expected an error for an out of range directory index")
+	}
+}
+
+func TestHeaderChangelog(t *testing.T) {
+	h := testHeader(t,
+		testInt32(TagChangelogTime, 1354881600),
+		testStrings(TagChangelogName, TypeStringArray, "Taylor Goodwill <tgoodwill@synacor.com> - 1.0.3-1_synacor"),
+		testStrings(TagChangelogText, TypeStringArray, "- Initial Synacor Build"),
+	)
+
+	entries, err := h.Changelog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "* Fri Dec 07 2012 Taylor Goodwill <tgoodwill@synacor.com> - 1.0.3-1_synacor\n- Initial Synacor Build"
+	t.Logf("expecting %q", expected)
+	if len(entries) != 1 || entries[0].String() != expected {
+		t.Errorf("Changelog(); got %q wanted %q", entries, expected)
+	}
+}
@@ -0,0 +1,26 @@
+package rpm
+
+import (
+	"os"
+	"path"
+	"syscall"
+)
+
+/*
+Creates a device node or named pipe at name inside r. The node is created
+relative to its parent directory, opened through r, so that it cannot end up
+outside of r.
+*/
+func mknod(r *os.Root, name string, mode uint16, major, minor uint32) error {
+	dir, err := r.Open(path.Dir(name))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	dev := int(major&0xfff)<<8 | int(minor&0xff) | int(minor&^0xff)<<12 | int(major&^0xfff)<<32
+	if err := syscall.Mknodat(int(dir.Fd()), path.Base(name), uint32(mode), dev); err != nil {
+		return &os.PathError{Op: "mknod", Path: name, Err: err}
+	}
+	return nil
+}
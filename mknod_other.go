@@ -0,0 +1,12 @@
+//go:build !linux
+
+package rpm
+
+import (
+	"errors"
+	"os"
+)
+
+func mknod(r *os.Root, name string, mode uint16, major, minor uint32) error {
+	return &os.PathError{Op: "mknod", Path: name, Err: errors.New("not supported on this platform")}
+}
@@ -0,0 +1,70 @@
+package rpm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var (
+	ErrNotRPM    = errors.New("not an RPM package")
+	ErrBadHeader = errors.New("malformed header")
+)
+
+/*
+A Package is an RPM package file, as read by ReadPackage. Only the lead and the
+headers are held in memory; the payload is read from the underlying
+io.ReaderAt on demand.
+*/
+type Package struct {
+	Lead      Lead
+	Signature *Header
+	Header    *Header
+
+	// PayloadOffset is the offset of the (compressed) payload from the
+	// start of the package.
+	PayloadOffset int64
+
+	r io.ReaderAt
+}
+
+/*
+Reads the lead, signature header and main header of the RPM package in r.
+
+Every length and offset read from the package is checked before it is used, so
+a truncated or malformed package results in an error, rather than a panic or
+an unbounded allocation.
+*/
+func ReadPackage(r io.ReaderAt) (*Package, error) {
+	lead, err := readLead(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &Package{Lead: lead, r: r}
+
+	off := int64(leadSize)
+	var size int64
+	p.Signature, size, err = readHeader(r, off)
+	if err != nil {
+		return nil, fmt.Errorf("reading signature header: %v", err)
+	}
+
+	// The signature header is padded to a multiple of 8 bytes.
+	off += size + (8-size%8)%8
+
+	p.Header, size, err = readHeader(r, off)
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	p.PayloadOffset = off + size
+
+	return p, nil
+}
+
+/*
+Returns a reader for the raw (still compressed) payload of the package.
+*/
+func (p *Package) RawPayload() io.Reader {
+	return io.NewSectionReader(p.r, p.PayloadOffset, math.MaxInt64-p.PayloadOffset)
+}
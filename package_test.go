@@ -0,0 +1,77 @@
+package rpm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// buildPackage assembles a package from a signature header, a main header and
+// a payload, padding the signature header as rpm does.
+func buildPackage(sig, hdr, payload []byte) []byte {
+	lead := Lead{Major: 3, Minor: 0, Name: "go-1.1-1", SignatureType: 5, ArchNum: 1, OSNum: 1}
+
+	var b bytes.Buffer
+	b.Write(lead.bytes())
+	b.Write(sig)
+	for b.Len()%8 != 0 {
+		b.WriteByte(0)
+	}
+	b.Write(hdr)
+	b.Write(payload)
+	return b.Bytes()
+}
+
+var testPackage = buildPackage(
+	buildHeader(testInt32(1000, 1234), testString(1004, "0123456789abcdef")),
+	buildHeader(testString(1000, "go"), testString(1001, "1.1"), testString(1002, "1")),
+	[]byte("payload"),
+)
+
+func TestReadPackage(t *testing.T) {
+	p, err := ReadPackage(bytes.NewReader(testPackage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Lead.Name != "go-1.1-1" || p.Lead.IsSource() {
+		t.Errorf("wrong lead; got %+v", p.Lead)
+	}
+	if e, ok := p.Signature.Entry(1000); !ok || e.Value.([]uint32)[0] != 1234 {
+		t.Errorf("wrong signature size entry; got %+v", e)
+	}
+	if e, ok := p.Header.Entry(1000); !ok || e.Value.(string) != "go" {
+		t.Errorf("wrong name entry; got %+v", e)
+	}
+
+	payload, err := ioutil.ReadAll(p.RawPayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != "payload" {
+		t.Errorf("wrong payload; got %q wanted %q", payload, "payload")
+	}
+}
+
+func TestReadPackageMalformed(t *testing.T) {
+	if _, err := ReadPackage(bytes.NewReader(bytes.Repeat([]byte("not an rpm "), 10))); err != ErrNotRPM {
+		t.Errorf("got %v wanted %v", err, ErrNotRPM)
+	}
+
+	// Every truncation of a valid package that cuts into the headers must
+	// be rejected.
+	for n := 0; n < len(testPackage)-len("payload"); n++ {
+		if _, err := ReadPackage(bytes.NewReader(testPackage[:n])); err == nil {
+			t.Errorf("no error reading a package truncated to %d bytes", n)
+		}
+	}
+
+	// Corrupting any byte must never make the reader panic.
+	for i := 0; i < len(testPackage); i++ {
+		for _, v := range []byte{0x00, 0x7f, 0x80, 0xff} {
+			b := append([]byte(nil), testPackage...)
+			b[i] = v
+			ReadPackage(bytes.NewReader(b))
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package rpm
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+/*
+The decompressors for the values of the PAYLOADCOMPRESSOR tag. Packages
+without the tag have gzip-compressed payloads.
+*/
+var decompressors = map[string]func(io.Reader) (io.ReadCloser, error){
+	"gzip": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"bzip2": func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	},
+	"xz": func(r io.Reader) (io.ReadCloser, error) {
+		zr, err := xz.NewReader(r)
+		return io.NopCloser(zr), err
+	},
+	"lzma": func(r io.Reader) (io.ReadCloser, error) {
+		zr, err := lzma.NewReader(r)
+		return io.NopCloser(zr), err
+	},
+	"zstd": func(r io.Reader) (io.ReadCloser, error) {
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	},
+}
+
+/*
+Returns the compression of the package's payload, as named by its
+PAYLOADCOMPRESSOR tag ("gzip", "bzip2", "xz", "lzma" or "zstd").
+*/
+func (p *Package) PayloadCompressor() string {
+	if c := p.Header.GetString(TagPayloadCompressor); c != "" {
+		return c
+	}
+	return "gzip"
+}
+
+/*
+Returns a reader for the decompressed payload of the package, which is a cpio
+archive. The reader has to be closed once done with.
+*/
+func (p *Package) DecompressedPayload() (io.ReadCloser, error) {
+	c := p.PayloadCompressor()
+	decompress, ok := decompressors[c]
+	if !ok {
+		return nil, fmt.Errorf("unsupported payload compressor %q", c)
+	}
+	r, err := decompress(p.RawPayload())
+	if err != nil {
+		return nil, fmt.Errorf("reading %s payload: %v", c, err)
+	}
+	return r, nil
+}
+
+/*
+A PayloadFile is a member of a package's payload, along with the description
+of the file in the package header.
+*/
+type PayloadFile struct {
+	// CPIO is the header of the cpio archive member. For packages with
+	// files of 4GB or more, rpm writes a "stripped" archive, whose headers
+	// only hold the index of the file in the package header.
+	CPIO CPIOHeader
+
+	// File describes the file according to the package header, and Index
+	// is the index of the file in the header, or -1 if the header does not
+	// list it.
+	File  File
+	Index int
+
+	// Size is the size of the content that follows the member, which is 0
+	// for all but one of a set of hard links.
+	Size int64
+
+	// NLink is the number of hard links to the file.
+	NLink uint32
+}
+
+/*
+A PayloadReader iterates over the files in the payload of a package, like
+archive/tar's Reader does: Next advances to the next file, and Read reads its
+content.
+*/
+type PayloadReader struct {
+	c      io.Closer
+	cpio   *cpioReader
+	files  []File
+	byName map[string]int
+
+	// For stripped archives, which of the files carry the content of
+	// their set of hard links, and the number of links to each file.
+	hasContent []bool
+	nlinks     []uint32
+}
+
+/*
+Returns a PayloadReader for the package's payload. The payload is decompressed
+according to the PAYLOADCOMPRESSOR tag; only cpio payloads are supported.
+*/
+func (p *Package) Payload() (*PayloadReader, error) {
+	if f := p.Header.GetString(TagPayloadFormat); f != "" && f != "cpio" {
+		return nil, fmt.Errorf("unsupported payload format %q", f)
+	}
+
+	files, err := p.Header.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := p.DecompressedPayload()
+	if err != nil {
+		return nil, err
+	}
+	return newPayloadReader(rc, rc, files), nil
+}
+
+/*
+Creates a PayloadReader reading the cpio archive from r, for a package with
+the given files. Closing the PayloadReader closes c.
+*/
+func newPayloadReader(r io.Reader, c io.Closer, files []File) *PayloadReader {
+	pr := &PayloadReader{
+		c:      c,
+		cpio:   newCPIOReader(r),
+		files:  files,
+		byName: make(map[string]int, len(files)),
+	}
+	for i, f := range files {
+		// The files of source packages have no directory.
+		name := f.Name
+		if !strings.HasPrefix(name, "/") {
+			name = "/" + name
+		}
+		pr.byName[name] = i
+	}
+	return pr
+}
+
+/*
+Advances to the next file in the payload, and returns its description. It
+returns io.EOF at the end of the payload.
+*/
+func (r *PayloadReader) Next() (*PayloadFile, error) {
+	h, err := r.cpio.next()
+	if err != nil {
+		return nil, err
+	}
+
+	pf := &PayloadFile{CPIO: *h, Index: h.Index, Size: h.Size, NLink: h.NLink}
+	if h.Index >= 0 {
+		// A stripped member: everything comes from the package header.
+		if h.Index >= len(r.files) {
+			return nil, fmt.Errorf("%v: file index %d out of range", ErrBadArchive, h.Index)
+		}
+		pf.File = r.files[h.Index]
+		pf.Size, pf.NLink = 0, r.nlink(h.Index)
+		if uint32(pf.File.Mode)&modeTypeMask == modeSymlink {
+			// Symlinks are followed by their target, as in newc
+			// archives.
+			pf.Size = int64(len(pf.File.LinkTo))
+		} else if r.strippedHasContent(h.Index) {
+			pf.Size = pf.File.Size
+		}
+		r.cpio.setSize(pf.Size)
+		return pf, nil
+	}
+
+	name := strings.TrimPrefix(h.Name, ".")
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	pf.Index = -1
+	if i, ok := r.byName[name]; ok {
+		pf.File, pf.Index = r.files[i], i
+	} else {
+		pf.File = File{Name: name, Size: h.Size, Mode: uint16(h.Mode), ModTime: h.ModTime}
+	}
+	return pf, nil
+}
+
+/*
+Works out the hard links of a stripped archive from the package header: they
+are the regular files sharing an inode. Of every set of hard links, only the
+last member carries the content.
+*/
+func (r *PayloadReader) linkFiles() {
+	r.hasContent = make([]bool, len(r.files))
+	r.nlinks = make([]uint32, len(r.files))
+
+	last := make(map[[2]uint32]int)
+	links := make(map[[2]uint32][]int)
+	for i, f := range r.files {
+		r.nlinks[i] = 1
+		if uint32(f.Mode)&modeTypeMask != modeRegular {
+			continue
+		}
+		if f.Inode == 0 {
+			r.hasContent[i] = true
+			continue
+		}
+		key := [2]uint32{f.Device, f.Inode}
+		last[key] = i
+		links[key] = append(links[key], i)
+	}
+	for key, i := range last {
+		r.hasContent[i] = true
+		for _, j := range links[key] {
+			r.nlinks[j] = uint32(len(links[key]))
+		}
+	}
+}
+
+/*
+Reports whether the member for the file at index i carries content in a
+stripped archive.
+*/
+func (r *PayloadReader) strippedHasContent(i int) bool {
+	if r.hasContent == nil {
+		r.linkFiles()
+	}
+	return r.hasContent[i]
+}
+
+// nlink returns the number of hard links to the file at index i, for
+// stripped archives.
+func (r *PayloadReader) nlink(i int) uint32 {
+	if r.nlinks == nil {
+		r.linkFiles()
+	}
+	return r.nlinks[i]
+}
+
+/*
+Reads the content of the current file.
+*/
+func (r *PayloadReader) Read(b []byte) (int, error) {
+	return r.cpio.Read(b)
+}
+
+/*
+Closes the decompressor.
+*/
+func (r *PayloadReader) Close() error {
+	return r.c.Close()
+}
@@ -0,0 +1,117 @@
+package rpm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func compress(t *testing.T, compressor string, b []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch compressor {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "xz":
+		var err error
+		if w, err = xz.NewWriter(&buf); err != nil {
+			t.Fatal(err)
+		}
+	case "zstd":
+		var err error
+		if w, err = zstd.NewWriter(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Write(b)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// The header of a package holding a directory, a file, a symlink and two hard
+// links.
+var testFilesHeader = []testEntry{
+	testString(TagName, "go"),
+	testStrings(TagBaseNames, TypeStringArray, "bin", "go", "gofmt", "a", "b"),
+	testStrings(TagDirNames, TypeStringArray, "/usr/", "/usr/bin/"),
+	testInt32(TagDirIndexes, 0, 1, 1, 1, 1),
+	testInt32(TagFileSizes, 4096, 10, 2, 3, 3),
+	testEntry{TagFileModes, TypeInt16, 5, []byte{0x41, 0xed, 0x81, 0xed, 0xa1, 0xff, 0x81, 0xa4, 0x81, 0xa4}},
+	testStrings(TagFileLinkTos, TypeStringArray, "", "", "go", "", ""),
+	testInt32(TagFileInodes, 1, 2, 3, 4, 4),
+	testInt32(TagFileDevices, 1, 1, 1, 1, 1),
+}
+
+func readPayload(t *testing.T, pkg []byte) string {
+	p, err := ReadPackage(bytes.NewReader(pkg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := p.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var got []string
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%d %s %v %q", f.Index, f.File.Name, f.File.FileMode(), content))
+	}
+	return fmt.Sprint(got)
+}
+
+func TestPayload(t *testing.T) {
+	archive := buildCPIO(
+		testMember{name: "./usr/bin", mode: 040755, ino: 1, nlink: 2},
+		testMember{name: "./usr/bin/go", mode: 0100755, ino: 2, nlink: 1, content: "#!/bin/sh\n"},
+		testMember{name: "./usr/bin/gofmt", mode: 0120777, ino: 3, nlink: 1, content: "go"},
+		testMember{name: "./usr/bin/a", mode: 0100644, ino: 4, nlink: 2},
+		testMember{name: "./usr/bin/b", mode: 0100644, ino: 4, nlink: 2, content: "ab\n"},
+	)
+	expected := `[0 /usr/bin drwxr-xr-x "" 1 /usr/bin/go -rwxr-xr-x "#!/bin/sh\n" 2 /usr/bin/gofmt Lrwxrwxrwx "go" 3 /usr/bin/a -rw-r--r-- "" 4 /usr/bin/b -rw-r--r-- "ab\n"]`
+
+	for _, c := range []string{"gzip", "xz", "zstd"} {
+		hdr := append([]testEntry{testString(TagPayloadCompressor, c)}, testFilesHeader...)
+		pkg := buildPackage(buildHeader(testInt32(SigTagSize, 0)), buildHeader(hdr...), compress(t, c, archive))
+
+		t.Logf("expecting %s payload %q", c, expected)
+		if got := readPayload(t, pkg); got != expected {
+			t.Errorf("failed to read %s payload; got %q wanted %q", c, got, expected)
+		}
+	}
+}
+
+func TestStrippedPayload(t *testing.T) {
+	archive := buildCPIO(
+		testMember{index: 1},
+		testMember{index: 2, content: "#!/bin/sh\n"},
+		testMember{index: 3, content: "go"},
+		testMember{index: 4},
+		testMember{index: 5, content: "ab\n"},
+	)
+	pkg := buildPackage(buildHeader(testInt32(SigTagSize, 0)), buildHeader(testFilesHeader...), compress(t, "gzip", archive))
+
+	expected := `[0 /usr/bin drwxr-xr-x "" 1 /usr/bin/go -rwxr-xr-x "#!/bin/sh\n" 2 /usr/bin/gofmt Lrwxrwxrwx "go" 3 /usr/bin/a -rw-r--r-- "" 4 /usr/bin/b -rw-r--r-- "ab\n"]`
+	t.Logf("expecting %q", expected)
+	if got := readPayload(t, pkg); got != expected {
+		t.Errorf("failed to read stripped payload; got %q wanted %q", got, expected)
+	}
+}
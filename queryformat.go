@@ -0,0 +1,629 @@
+package rpm
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nesv/rpm/spec"
+)
+
+/*
+A QueryFormat is a parsed rpm query format, as given to "rpm -q --queryformat".
+
+The format is literal text, with backslash escapes such as "\n", in which:
+
+	%{TAG}              is replaced with the value of a tag
+	%-20{TAG}, %8{TAG}  pad the value to a width, to the left or right
+	%{TAG:fmt}          formats the value, with fmt one of date, day,
+	                    octal, hex, depflags, fflags, perms, shescape,
+	                    json, xml, base64, arraysize or string
+	[...]               repeats its contents for each element of the
+	                    array tags in it, which must have as many elements
+	%{=TAG}             gives the first element of TAG inside [...]
+	%{#TAG}             gives the number of elements of TAG
+	%|TAG?{a}:{b}|      is a if the header has TAG, and b otherwise (the
+	                    ":{b}" part may be left out)
+	%%                  is a literal "%"
+
+Tag names are case-insensitive. Besides the tags of the header, FILENAMES,
+EVR, NVR, NEVR, NVRA and NEVRA are computed when the header lacks them, and
+PROVIDES, REQUIRES, CONFLICTS and OBSOLETES stand for the tags of the names of
+dependencies. Missing tags are shown as "(none)".
+*/
+type QueryFormat struct {
+	items []qfItem
+}
+
+// The kinds of items of a query format.
+const (
+	qfLiteral = iota
+	qfTag
+	qfArray
+	qfCond
+)
+
+type qfItem struct {
+	kind int
+	text string // for literals
+
+	tag      Tag
+	pad      string // the width, as in "-20"
+	format   string
+	modifier byte // '=' or '#'
+
+	items, orElse []qfItem // the contents of arrays and conditionals
+}
+
+// The other names rpm accepts for the tags of dependency names.
+var qfAliases = map[string]Tag{
+	"PROVIDES":  TagProvideName,
+	"REQUIRES":  TagRequireName,
+	"CONFLICTS": TagConflictName,
+	"OBSOLETES": TagObsoleteName,
+}
+
+// The formats of %{TAG:fmt}, which are given the value and the index of the
+// element to format.
+var qfFormats = map[string]func(v qfValue, i int) string{
+	"":         qfString,
+	"string":   qfString,
+	"date":     qfTime("Mon Jan _2 15:04:05 2006"),
+	"day":      qfTime("Mon Jan 02 2006"),
+	"octal":    qfInt(func(n int64) string { return strconv.FormatInt(n, 8) }),
+	"hex":      qfInt(func(n int64) string { return strconv.FormatInt(n, 16) }),
+	"depflags": qfInt(func(n int64) string { return spec.Dependency{Flags: spec.DependencyFlags(n)}.Operator() }),
+	"fflags":   qfInt(func(n int64) string { return fileFlagsString(FileFlags(n)) }),
+	"perms":    qfInt(func(n int64) string { return permsString(uint32(n)) }),
+	"shescape": qfShellEscape,
+	"json":     qfJSON,
+	"xml":      qfXML,
+	"base64":   qfBase64,
+	"arraysize": func(v qfValue, i int) string {
+		return strconv.Itoa(v.count())
+	},
+}
+
+/*
+Parses a query format. Unknown tags and formats, and unbalanced brackets, are
+errors.
+*/
+func ParseQueryFormat(format string) (*QueryFormat, error) {
+	p := &qfParser{s: format}
+	items, err := p.parse(0, false)
+	if err != nil {
+		return nil, fmt.Errorf("query format: %v", err)
+	}
+	return &QueryFormat{items: items}, nil
+}
+
+type qfParser struct {
+	s   string
+	pos int
+}
+
+/*
+Parses items up to the closing byte end (or the end of the format when end is
+0), which is consumed.
+*/
+func (p *qfParser) parse(end byte, inArray bool) ([]qfItem, error) {
+	var items []qfItem
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			items = append(items, qfItem{kind: qfLiteral, text: lit.String()})
+			lit.Reset()
+		}
+	}
+
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == end:
+			p.pos++
+			flush()
+			return items, nil
+
+		case c == '\\' && p.pos+1 < len(p.s):
+			lit.WriteByte(unescape(p.s[p.pos+1]))
+			p.pos += 2
+
+		case c == '[':
+			if inArray {
+				return nil, fmt.Errorf("nested [ at %d", p.pos)
+			}
+			flush()
+			p.pos++
+			inner, err := p.parse(']', true)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, qfItem{kind: qfArray, items: inner})
+
+		case c == '%' && p.pos+1 < len(p.s) && p.s[p.pos+1] == '%':
+			lit.WriteByte('%')
+			p.pos += 2
+
+		case c == '%' && p.pos+1 < len(p.s) && p.s[p.pos+1] == '|':
+			flush()
+			p.pos += 2
+			it, err := p.conditional(inArray)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, it)
+
+		case c == '%':
+			flush()
+			p.pos++
+			it, err := p.tag()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, it)
+
+		default:
+			lit.WriteByte(c)
+			p.pos++
+		}
+	}
+	if end != 0 {
+		return nil, fmt.Errorf("missing %c", end)
+	}
+	flush()
+	return items, nil
+}
+
+func unescape(c byte) byte {
+	switch c {
+	case 'a':
+		return '\a'
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'v':
+		return '\v'
+	}
+	return c
+}
+
+// tag parses "[-width]{[=#]TAG[:fmt]}", after the "%".
+func (p *qfParser) tag() (qfItem, error) {
+	it := qfItem{kind: qfTag}
+	start := p.pos
+	if p.pos < len(p.s) && p.s[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	it.pad = p.s[start:p.pos]
+	if p.pos >= len(p.s) || p.s[p.pos] != '{' {
+		return it, fmt.Errorf("missing { after %% at %d", start-1)
+	}
+	p.pos++
+
+	end := strings.IndexByte(p.s[p.pos:], '}')
+	if end < 0 {
+		return it, fmt.Errorf("missing } at %d", p.pos)
+	}
+	body := p.s[p.pos : p.pos+end]
+	p.pos += end + 1
+
+	if body != "" && (body[0] == '=' || body[0] == '#') {
+		it.modifier, body = body[0], body[1:]
+	}
+	name := body
+	if i := strings.IndexByte(body, ':'); i >= 0 {
+		name, it.format = body[:i], body[i+1:]
+	}
+	if _, ok := qfFormats[it.format]; !ok {
+		return it, fmt.Errorf("unknown format %q", it.format)
+	}
+	var err error
+	it.tag, err = qfTagByName(name)
+	return it, err
+}
+
+// conditional parses "TAG?{...}:{...}|", after the "%|".
+func (p *qfParser) conditional(inArray bool) (qfItem, error) {
+	it := qfItem{kind: qfCond}
+	q := strings.IndexByte(p.s[p.pos:], '?')
+	if q < 0 {
+		return it, fmt.Errorf("missing ? in conditional at %d", p.pos)
+	}
+	var err error
+	if it.tag, err = qfTagByName(p.s[p.pos : p.pos+q]); err != nil {
+		return it, err
+	}
+	p.pos += q + 1
+
+	branch := func() ([]qfItem, error) {
+		if p.pos >= len(p.s) || p.s[p.pos] != '{' {
+			return nil, fmt.Errorf("missing { in conditional at %d", p.pos)
+		}
+		p.pos++
+		return p.parse('}', inArray)
+	}
+	if it.items, err = branch(); err != nil {
+		return it, err
+	}
+	if p.pos < len(p.s) && p.s[p.pos] == ':' {
+		p.pos++
+		if it.orElse, err = branch(); err != nil {
+			return it, err
+		}
+	}
+	if p.pos >= len(p.s) || p.s[p.pos] != '|' {
+		return it, fmt.Errorf("missing | after conditional at %d", p.pos)
+	}
+	p.pos++
+	return it, nil
+}
+
+func qfTagByName(name string) (Tag, error) {
+	if t, ok := qfAliases[strings.ToUpper(name)]; ok {
+		return t, nil
+	}
+	if t, ok := TagByName(name); ok {
+		return t, nil
+	}
+	return 0, fmt.Errorf("unknown tag %q", name)
+}
+
+// A qfValue is the value of a tag, as formatted by a query format.
+type qfValue struct {
+	strs []string
+	ints []int64
+	bin  []byte
+}
+
+func (v qfValue) count() int {
+	switch {
+	case v.strs != nil:
+		return len(v.strs)
+	case v.ints != nil:
+		return len(v.ints)
+	case v.bin != nil:
+		return 1
+	}
+	return 0
+}
+
+/*
+Returns the value of a tag for a query format, computing the extension tags
+the header does not have, and whether there is a value at all.
+*/
+func qfLookup(h *Header, tag Tag) (qfValue, bool) {
+	if e, ok := h.Entry(tag); ok {
+		switch v := e.Value.(type) {
+		case string:
+			return qfValue{strs: []string{v}}, true
+		case []string:
+			if e.Type == TypeI18NString && len(v) > 0 {
+				v = v[:1]
+			}
+			return qfValue{strs: v}, true
+		case []byte:
+			return qfValue{bin: v}, true
+		}
+		if ints := h.GetInts(tag); ints != nil {
+			return qfValue{ints: ints}, true
+		}
+		return qfValue{}, false
+	}
+
+	if h.Name() == "" {
+		return qfValue{}, false
+	}
+	nvr := h.Name() + "-" + h.Version() + "-" + h.Release()
+	var s string
+	switch tag {
+	case TagFilenames:
+		names, err := h.Filenames()
+		if err != nil || len(names) == 0 {
+			return qfValue{}, false
+		}
+		return qfValue{strs: names}, true
+	case TagEVR:
+		s = h.EVR()
+	case TagNVR:
+		s = nvr
+	case TagNEVR:
+		s = h.Name() + "-" + h.EVR()
+	case TagNVRA:
+		s = nvr + "." + h.Arch()
+	case TagNEVRA:
+		s = h.Name() + "-" + h.EVR() + "." + h.Arch()
+	default:
+		return qfValue{}, false
+	}
+	return qfValue{strs: []string{s}}, true
+}
+
+/*
+Formats the header. It fails if an array is iterated over tags with different
+numbers of elements.
+*/
+func (q *QueryFormat) Format(h *Header) (string, error) {
+	var b strings.Builder
+	if err := q.render(&b, h, q.items, -1); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+/*
+Formats the packages of an evaluated spec file, one after the other, as
+"rpmspec -q --queryformat" does. Every package the spec declares is
+formatted, unless builtOnly is set: then only those with a %files section,
+which are the ones that get built, are, as with "rpmspec -q --builtrpms".
+*/
+func (q *QueryFormat) FormatSpec(es *spec.EvaluatedSpec, builtOnly bool) (string, error) {
+	headers, err := SpecHeaders(es, builtOnly)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, h := range headers {
+		if err := q.render(&b, h, q.items, -1); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+/*
+Renders items to b; elem is the index of the array element being rendered,
+or -1 outside of arrays.
+*/
+func (q *QueryFormat) render(b *strings.Builder, h *Header, items []qfItem, elem int) error {
+	for _, it := range items {
+		switch it.kind {
+		case qfLiteral:
+			b.WriteString(it.text)
+
+		case qfTag:
+			s := "(none)"
+			if v, ok := qfLookup(h, it.tag); ok {
+				i := elem
+				if i < 0 || it.modifier == '=' {
+					i = 0
+				}
+				switch {
+				case it.modifier == '#':
+					s = strconv.Itoa(v.count())
+				case i >= v.count():
+					s = "(index out of range)"
+				default:
+					s = qfFormats[it.format](v, i)
+				}
+			}
+			if it.pad != "" {
+				s = fmt.Sprintf("%"+it.pad+"s", s)
+			}
+			b.WriteString(s)
+
+		case qfArray:
+			n, err := arrayCount(h, it.items)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < n; i++ {
+				if err := q.render(b, h, it.items, i); err != nil {
+					return err
+				}
+			}
+
+		case qfCond:
+			branch := it.orElse
+			if _, ok := qfLookup(h, it.tag); ok {
+				branch = it.items
+			}
+			if err := q.render(b, h, branch, elem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+/*
+Returns the number of times the contents of an array are repeated: the number
+of elements of the tags in it, leaving out those with a modifier and those the
+header lacks.
+*/
+func arrayCount(h *Header, items []qfItem) (int, error) {
+	n := -1
+	var walk func(items []qfItem) error
+	walk = func(items []qfItem) error {
+		for _, it := range items {
+			switch it.kind {
+			case qfTag:
+				v, ok := qfLookup(h, it.tag)
+				if !ok || it.modifier != 0 {
+					continue
+				}
+				if n >= 0 && v.count() != n {
+					return fmt.Errorf("array iterator used with different sized arrays")
+				}
+				n = v.count()
+			case qfCond:
+				if err := walk(it.items); err != nil {
+					return err
+				}
+				if err := walk(it.orElse); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(items); err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n, nil
+}
+
+func qfString(v qfValue, i int) string {
+	switch {
+	case v.strs != nil:
+		return v.strs[i]
+	case v.ints != nil:
+		return strconv.FormatInt(v.ints[i], 10)
+	}
+	return hex.EncodeToString(v.bin)
+}
+
+// qfInt returns a format of integers, which shows other values as rpm does.
+func qfInt(f func(n int64) string) func(v qfValue, i int) string {
+	return func(v qfValue, i int) string {
+		if v.ints == nil {
+			return "(not a number)"
+		}
+		return f(v.ints[i])
+	}
+}
+
+// qfTime returns a format of times given in seconds, in the local time zone.
+func qfTime(layout string) func(v qfValue, i int) string {
+	return qfInt(func(n int64) string {
+		return time.Unix(n, 0).Format(layout)
+	})
+}
+
+func qfShellEscape(v qfValue, i int) string {
+	if v.ints != nil {
+		return strconv.FormatInt(v.ints[i], 10)
+	}
+	return "'" + strings.ReplaceAll(qfString(v, i), "'", `'\''`) + "'"
+}
+
+func qfJSON(v qfValue, i int) string {
+	if v.ints != nil {
+		return strconv.FormatInt(v.ints[i], 10)
+	}
+	return jsonString(qfString(v, i))
+}
+
+func qfXML(v qfValue, i int) string {
+	switch {
+	case v.ints != nil:
+		return fmt.Sprintf("<integer>%d</integer>", v.ints[i])
+	case v.bin != nil:
+		return "<base64>" + base64.StdEncoding.EncodeToString(v.bin) + "</base64>"
+	case v.strs[i] == "":
+		return "<string/>"
+	}
+	return "<string>" + xmlEscaper.Replace(v.strs[i]) + "</string>"
+}
+
+func qfBase64(v qfValue, i int) string {
+	if v.bin != nil {
+		return base64.StdEncoding.EncodeToString(v.bin)
+	}
+	return base64.StdEncoding.EncodeToString([]byte(qfString(v, i)))
+}
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// jsonString quotes s as a JSON string, escaping only what JSON requires.
+func jsonString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+/*
+Returns the letters rpm uses for file flags, in example "cn" for
+%config(noreplace).
+*/
+func fileFlagsString(f FileFlags) string {
+	var b strings.Builder
+	for _, l := range []struct {
+		flag   FileFlags
+		letter byte
+	}{
+		{FileDoc, 'd'}, {FileConfig, 'c'}, {FileSpecFile, 's'},
+		{FileMissingOK, 'm'}, {FileNoReplace, 'n'}, {FileGhost, 'g'},
+		{FileLicense, 'l'}, {FileReadme, 'r'}, {FileArtifact, 'a'},
+	} {
+		if f&l.flag != 0 {
+			b.WriteByte(l.letter)
+		}
+	}
+	return b.String()
+}
+
+/*
+Returns a unix st_mode the way "ls -l" (and rpm) shows it, in example
+"drwxr-xr-x".
+*/
+func permsString(m uint32) string {
+	b := []byte("----------")
+	switch m & modeTypeMask {
+	case modeSocket:
+		b[0] = 's'
+	case modeSymlink:
+		b[0] = 'l'
+	case modeBlock:
+		b[0] = 'b'
+	case modeDir:
+		b[0] = 'd'
+	case modeChar:
+		b[0] = 'c'
+	case modeFIFO:
+		b[0] = 'p'
+	}
+	for i, c := range "rwxrwxrwx" {
+		if m&(1<<uint(8-i)) != 0 {
+			b[i+1] = byte(c)
+		}
+	}
+
+	special := func(bit uint32, i int, set byte) {
+		if m&bit == 0 {
+			return
+		}
+		if b[i] == 'x' {
+			b[i] = set
+		} else {
+			b[i] = set - 'a' + 'A'
+		}
+	}
+	special(04000, 3, 's')
+	special(02000, 6, 's')
+	special(01000, 9, 't')
+	return string(b)
+}
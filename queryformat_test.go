@@ -0,0 +1,118 @@
+package rpm
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nesv/rpm/spec"
+)
+
+func TestQueryFormat(t *testing.T) {
+	h := buildTestPackage(t, testBuilder()).Header
+	built := time.Unix(1714564800, 0)
+
+	tests := map[string]string{
+		`%{NAME}-%{VERSION}-%{RELEASE}.%{ARCH}\n`: "hello-2.0-3.x86_64\n",
+		`%{nevra} %{evr} %{NVR}`:                  "hello-1:2.0-3.x86_64 1:2.0-3 hello-2.0-3",
+		`%-8{NAME}|%8{VERSION}|`:                  "hello   |     2.0|",
+		`[%{FILENAMES} %{FILEMODES:perms} %{FILEFLAGS:fflags}\n]`: "/etc/hello.conf -rw-r--r-- cn\n" +
+			"/usr/bin drwxr-xr-x \n/usr/bin/hello -rwxr-xr-x \n/usr/bin/hi lrwxrwxrwx \n/var/log/hello.log -rw-r----- g\n",
+		`[%{=NAME}: %{PROVIDES} %{PROVIDEFLAGS:depflags} %{PROVIDEVERSION}\n]`: "hello: hello = 1:2.0-3\n",
+		`%{#REQUIRENAME} %{FILENAMES:arraysize}`:                               "6 5",
+		`%{BUILDTIME:date}|%{BUILDTIME:day}`:                                   built.Format("Mon Jan _2 15:04:05 2006") + "|" + built.Format("Mon Jan 02 2006"),
+		`%{FILEMODES:octal} %{FILESIZES:hex} %{NAME:hex}`:                      "100644 f (not a number)",
+		`%{SUMMARY:shescape} %{LICENSE:json} %{SUMMARY:xml} %{EPOCH:xml}`:      "'Says hello' \"MIT\" <string>Says hello</string> <integer>1</integer>",
+		`%|VENDOR?{vendor %{VENDOR}}:{no vendor}| %|LICENSE?{%{LICENSE}}|`:     "no vendor MIT",
+		`%{VENDOR} 100%% \t\"`:                                                 "(none) 100% \t\"",
+		`[%{FILENAMES}%|FILELINKTOS?{ -> %{FILELINKTOS}}|\n]`:                  "/etc/hello.conf -> \n/usr/bin -> \n/usr/bin/hello -> \n/usr/bin/hi -> hello\n/var/log/hello.log -> \n",
+	}
+	for format, expected := range tests {
+		q, err := ParseQueryFormat(format)
+		if err != nil {
+			t.Errorf("%q: %v", format, err)
+			continue
+		}
+		got, err := q.Format(h)
+		if err != nil {
+			t.Errorf("%q: %v", format, err)
+			continue
+		}
+		t.Logf("expecting %q", expected)
+		if got != expected {
+			t.Errorf("%q; got %q wanted %q", format, got, expected)
+		}
+	}
+
+	q, err := ParseQueryFormat(`[%{NAME} %{FILENAMES}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Format(h); err == nil {
+		t.Errorf("expected an error for arrays of different sizes")
+	}
+}
+
+func TestParseQueryFormatErrors(t *testing.T) {
+	for _, format := range []string{
+		"%{NOPE}",
+		"%{NAME:nope}",
+		"[%{NAME}",
+		"%|NAME?{x",
+		"%|NAME?{x}",
+		"%{NAME",
+		"[[%{NAME}]]",
+		"%NAME",
+	} {
+		if _, err := ParseQueryFormat(format); err == nil {
+			t.Errorf("%q: expected an error", format)
+		}
+	}
+}
+
+func TestQueryFormatSpec(t *testing.T) {
+	q, err := ParseQueryFormat(`%{NAME} %{ARCH} %{SOURCERPM} %|BUILDTIME?{built}:{not built}|\n`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := spec.ParseString(strings.Replace(buildSpec, "%post", "%package doc\nSummary: Doc\n\n%description doc\nDoc.\n\n%post", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	es, err := s.Evaluate(spec.Target{Arch: "x86_64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	built := "demo noarch demo-1.0-1.src.rpm not built\ndemo-data noarch demo-1.0-1.src.rpm not built\n"
+	for _, builtOnly := range []bool{false, true} {
+		got, err := q.FormatSpec(es, builtOnly)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := built
+		if !builtOnly {
+			expected += "demo-doc noarch demo-1.0-1.src.rpm not built\n"
+		}
+		t.Logf("expecting %q", expected)
+		if got != expected {
+			t.Errorf("built only %v: wrong output; got %q wanted %q", builtOnly, got, expected)
+		}
+	}
+}
+
+func TestPermsString(t *testing.T) {
+	tests := map[uint32]string{
+		0100644: "-rw-r--r--",
+		0104755: "-rwsr-xr-x",
+		0102644: "-rw-r-Sr--",
+		041777:  "drwxrwxrwt",
+		020620:  "crw--w----",
+		0140755: "srwxr-xr-x",
+	}
+	for m, want := range tests {
+		if got := permsString(m); got != want {
+			t.Errorf("mode %o; got %q wanted %q", m, got, want)
+		}
+	}
+}
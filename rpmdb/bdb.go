@@ -0,0 +1,251 @@
+package rpmdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+Before 4.16, rpm kept its database in Berkeley DB files, the packages in a
+hash database named Packages: each header blob is stored under its header
+number, a 4-byte integer in the byte order of the host, and number 0 holds the
+next number to be given out.
+
+Only the parts of the hash access method reading such a database needs are
+implemented here: the metadata page, the buckets and their chains of pages,
+and the overflow pages large items are stored on.
+*/
+
+const (
+	bdbHashMagic   = 0x061561
+	bdbMetaSize    = 512
+	bdbPageHdrSize = 26
+
+	// Page types.
+	bdbPageHashUnsorted = 2
+	bdbPageOverflow     = 7
+	bdbPageHash         = 13
+
+	// Item types of hash pages.
+	bdbKeyData = 1
+	bdbOffPage = 3
+)
+
+type bdbDB struct {
+	r        io.ReaderAt
+	size     int64
+	order    binary.ByteOrder
+	pageSize int
+	lastPage uint32
+	buckets  []uint32
+	closers  []io.Closer
+}
+
+func newBerkeleyDB(r io.ReaderAt, closers ...io.Closer) (*bdbDB, error) {
+	size, err := sizeOf(r)
+	if err != nil {
+		return nil, err
+	}
+	meta := make([]byte, bdbMetaSize)
+	if _, err := r.ReadAt(meta, 0); err != nil {
+		return nil, fmt.Errorf("reading metadata: %v", err)
+	}
+
+	// The database is in the byte order of the host which wrote it.
+	var order binary.ByteOrder = binary.LittleEndian
+	switch {
+	case binary.LittleEndian.Uint32(meta[12:]) == bdbHashMagic:
+	case binary.BigEndian.Uint32(meta[12:]) == bdbHashMagic:
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("not a berkeley db hash database")
+	}
+	if v := order.Uint32(meta[16:]); v < 8 || v > 10 {
+		return nil, fmt.Errorf("unsupported hash version %d", v)
+	}
+	if meta[24] != 0 {
+		return nil, errors.New("encrypted databases are not supported")
+	}
+	if meta[26]&1 != 0 {
+		return nil, errors.New("checksummed databases are not supported")
+	}
+
+	db := &bdbDB{
+		r:        r,
+		size:     size,
+		order:    order,
+		pageSize: int(order.Uint32(meta[20:])),
+		lastPage: order.Uint32(meta[32:]),
+		closers:  closers,
+	}
+	if db.pageSize < bdbMetaSize || db.pageSize > 65536 || db.pageSize&(db.pageSize-1) != 0 {
+		return nil, fmt.Errorf("bad page size %d", db.pageSize)
+	}
+	if int64(db.lastPage) >= size/int64(db.pageSize) {
+		return nil, fmt.Errorf("bad last page %d for a file of %d bytes", db.lastPage, size)
+	}
+
+	// The pages of the buckets are found from the spares, as in
+	// BS_TO_PAGE: bucket b is at page b + spares[log2(b+1)]. There cannot
+	// be more buckets than pages.
+	maxBucket := order.Uint32(meta[72:])
+	if maxBucket > db.lastPage {
+		return nil, fmt.Errorf("bad bucket count %d", maxBucket+1)
+	}
+	for b := uint32(0); b <= maxBucket; b++ {
+		log := 0
+		for 1<<uint(log) < b+1 {
+			log++
+		}
+		db.buckets = append(db.buckets, b+order.Uint32(meta[96+4*log:]))
+	}
+	return db, nil
+}
+
+func (db *bdbDB) Close() error {
+	var err error
+	for _, c := range db.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// page returns page n, and checks its type is one of types.
+func (db *bdbDB) page(n uint32, types ...byte) ([]byte, error) {
+	if n == 0 || n > db.lastPage {
+		return nil, fmt.Errorf("bad page number %d", n)
+	}
+	p := make([]byte, db.pageSize)
+	if _, err := db.r.ReadAt(p, int64(n)*int64(db.pageSize)); err != nil {
+		return nil, fmt.Errorf("page %d: %v", n, err)
+	}
+	for _, t := range types {
+		if p[25] == t {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("page %d: unexpected page type %d", n, p[25])
+}
+
+func (db *bdbDB) blobs(fn func(num uint32, blob []byte) error) error {
+	seen := make(map[uint32]bool)
+	for _, n := range db.buckets {
+		for n != 0 {
+			if seen[n] {
+				return fmt.Errorf("page %d: loop in bucket chain", n)
+			}
+			seen[n] = true
+
+			p, err := db.page(n, bdbPageHash, bdbPageHashUnsorted)
+			if err != nil {
+				return err
+			}
+			if err := db.hashPage(n, p, fn); err != nil {
+				return err
+			}
+			n = db.order.Uint32(p[16:])
+		}
+	}
+	return nil
+}
+
+// hashPage calls fn for the pairs of keys and data on a hash page.
+func (db *bdbDB) hashPage(n uint32, p []byte, fn func(num uint32, blob []byte) error) error {
+	entries := int(db.order.Uint16(p[20:]))
+	if entries%2 != 0 || bdbPageHdrSize+2*entries > len(p) {
+		return fmt.Errorf("page %d: bad entry count %d", n, entries)
+	}
+
+	// Items are stored from the end of the page, so each one ends where
+	// the one before it starts.
+	item := func(i int) ([]byte, error) {
+		start := int(db.order.Uint16(p[bdbPageHdrSize+2*i:]))
+		end := len(p)
+		if i > 0 {
+			end = int(db.order.Uint16(p[bdbPageHdrSize+2*(i-1):]))
+		}
+		if start < bdbPageHdrSize+2*entries || start >= end || end > len(p) {
+			return nil, fmt.Errorf("page %d: bad item offset %d", n, start)
+		}
+		return p[start:end], nil
+	}
+
+	for i := 0; i < entries; i += 2 {
+		key, err := item(i)
+		if err != nil {
+			return err
+		}
+		if key[0] != bdbKeyData || len(key) != 5 {
+			return fmt.Errorf("page %d: bad key", n)
+		}
+		num := db.order.Uint32(key[1:])
+
+		data, err := item(i + 1)
+		if err != nil {
+			return err
+		}
+		var blob []byte
+		switch data[0] {
+		case bdbKeyData:
+			blob = data[1:]
+		case bdbOffPage:
+			if len(data) < 12 {
+				return fmt.Errorf("page %d: bad overflow item", n)
+			}
+			blob, err = db.overflow(db.order.Uint32(data[4:]), db.order.Uint32(data[8:]))
+			if err != nil {
+				return fmt.Errorf("package %d: %v", num, err)
+			}
+		default:
+			return fmt.Errorf("page %d: unsupported item type %d", n, data[0])
+		}
+
+		// Number 0 is not a package.
+		if num == 0 {
+			continue
+		}
+		if err := fn(num, blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overflow returns the item of the given length stored on the chain of
+// overflow pages starting at page n.
+func (db *bdbDB) overflow(n, length uint32) ([]byte, error) {
+	if int64(length) > db.size {
+		return nil, fmt.Errorf("bad overflow length %d", length)
+	}
+	b := make([]byte, 0, length)
+	seen := make(map[uint32]bool)
+	for uint32(len(b)) < length {
+		if n == 0 {
+			return nil, errors.New("truncated overflow chain")
+		}
+		if seen[n] {
+			return nil, fmt.Errorf("page %d: loop in overflow chain", n)
+		}
+		seen[n] = true
+		p, err := db.page(n, bdbPageOverflow)
+		if err != nil {
+			return nil, err
+		}
+		// On overflow pages, the field holding the offset of the free
+		// space of hash pages holds the length of the data instead.
+		used := int(db.order.Uint16(p[22:]))
+		if used == 0 || bdbPageHdrSize+used > len(p) {
+			return nil, fmt.Errorf("page %d: bad length %d", n, used)
+		}
+		b = append(b, p[bdbPageHdrSize:bdbPageHdrSize+used]...)
+		n = db.order.Uint32(p[16:])
+	}
+	if uint32(len(b)) != length {
+		return nil, errors.New("overflow chain longer than its item")
+	}
+	return b, nil
+}
@@ -0,0 +1,153 @@
+package rpmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// testBerkeleyDB returns a hash database with a single bucket of 512-byte
+// pages, holding the given pairs of numbers and data, in the given byte
+// order, as written by a host of that order.
+func testBerkeleyDB(order binary.ByteOrder, nums []uint32, data [][]byte) []byte {
+	b := make([]byte, 1024)
+	meta := b[:512]
+	order.PutUint32(meta[12:], bdbHashMagic)
+	order.PutUint32(meta[16:], 9)
+	order.PutUint32(meta[20:], 512)
+	meta[25] = 8
+	order.PutUint32(meta[32:], 1)
+	order.PutUint32(meta[96:], 1)
+
+	p := b[512:]
+	order.PutUint32(p[8:], 1)
+	order.PutUint16(p[20:], uint16(2*len(nums)))
+	p[25] = bdbPageHash
+	end := len(p)
+	for i, num := range nums {
+		key := make([]byte, 5)
+		key[0] = bdbKeyData
+		order.PutUint32(key[1:], num)
+		for j, item := range [][]byte{key, append([]byte{bdbKeyData}, data[i]...)} {
+			end -= len(item)
+			copy(p[end:], item)
+			order.PutUint16(p[bdbPageHdrSize+2*(2*i+j):], uint16(end))
+		}
+	}
+	return b
+}
+
+func bdbBlobs(db *bdbDB) (string, error) {
+	var got []string
+	err := db.blobs(func(num uint32, blob []byte) error {
+		got = append(got, fmt.Sprintf("%d:%s", num, blob))
+		return nil
+	})
+	return fmt.Sprint(got), err
+}
+
+func TestBerkeleyDBByteOrder(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		b := testBerkeleyDB(order, []uint32{0, 7, 300}, [][]byte{{0, 0, 1, 45}, []byte("seven"), []byte("three hundred")})
+		db, err := newBerkeleyDB(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%v: %v", order, err)
+		}
+		got, err := bdbBlobs(db)
+		if err != nil {
+			t.Fatalf("%v: %v", order, err)
+		}
+		expected := "[7:seven 300:three hundred]"
+		if got != expected {
+			t.Errorf("%v: wrong blobs; got %q wanted %q", order, got, expected)
+		}
+	}
+}
+
+func TestBerkeleyDBOverflow(t *testing.T) {
+	data, err := os.ReadFile("testdata/bdb/var/lib/rpm/Packages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := newBerkeleyDB(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := db.overflow(0, 10)
+	if err == nil {
+		t.Errorf("expected an error; got %x", blob)
+	}
+
+	// Every large blob of the fixture is on overflow pages, so breaking
+	// the chains breaks reading.
+	for n := 1; n*db.pageSize < len(data); n++ {
+		if data[n*db.pageSize+25] == bdbPageOverflow {
+			data[n*db.pageSize+22] = 0xff
+			data[n*db.pageSize+23] = 0xff
+		}
+	}
+	if _, err := bdbBlobs(db); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestBerkeleyDBOverflowLoop(t *testing.T) {
+	b := testBerkeleyDB(binary.LittleEndian, []uint32{1}, [][]byte{[]byte("one")})
+	b = append(b, make([]byte, 512)...)
+	binary.LittleEndian.PutUint32(b[32:], 2)
+	p := b[1024:]
+	p[25] = bdbPageOverflow
+	binary.LittleEndian.PutUint32(p[16:], 2)
+	binary.LittleEndian.PutUint16(p[22:], 10)
+
+	db, err := newBerkeleyDB(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.overflow(2, 100); err == nil {
+		t.Error("loop: expected an error")
+	}
+	if _, err := db.overflow(2, 1<<31); err == nil {
+		t.Error("huge length: expected an error")
+	}
+	binary.LittleEndian.PutUint16(p[22:], 0)
+	if _, err := db.overflow(2, 100); err == nil {
+		t.Error("empty page: expected an error")
+	}
+}
+
+func TestBerkeleyDBCorrupt(t *testing.T) {
+	valid := testBerkeleyDB(binary.LittleEndian, []uint32{1}, [][]byte{[]byte("one")})
+	corrupt := func(fn func(b []byte)) []byte {
+		b := append([]byte(nil), valid...)
+		fn(b)
+		return b
+	}
+
+	tests := map[string][]byte{
+		"short":       valid[:100],
+		"magic":       corrupt(func(b []byte) { b[12] = 0 }),
+		"version":     corrupt(func(b []byte) { b[16] = 3 }),
+		"encrypted":   corrupt(func(b []byte) { b[24] = 1 }),
+		"page size":   corrupt(func(b []byte) { b[20] = 0xff }),
+		"buckets":     corrupt(func(b []byte) { b[72] = 9 }),
+		"last page":   corrupt(func(b []byte) { b[32], b[75] = 0xff, 0xff }),
+		"page type":   corrupt(func(b []byte) { b[512+25] = bdbPageOverflow }),
+		"entries":     corrupt(func(b []byte) { b[512+20] = 3 }),
+		"item offset": corrupt(func(b []byte) { b[512+bdbPageHdrSize] = 0xff }),
+		"item type":   corrupt(func(b []byte) { b[len(b)-9] = 2 }),
+		"loop":        corrupt(func(b []byte) { b[512+16] = 1 }),
+		"truncated":   valid[:600],
+	}
+	for name, b := range tests {
+		db, err := newBerkeleyDB(bytes.NewReader(b))
+		if err == nil {
+			_, err = bdbBlobs(db)
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package rpmdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"io"
+)
+
+/*
+The ndb format, rpm's own and SUSE's default, keeps the packages in
+Packages.db. The file starts with a header and a table of slots, one for each
+package, giving the blocks of 16 bytes its blob is kept in:
+
+	header  magic "RpmP", version, generation, slot pages, next number
+	slot    magic "Slot", header number (0 for a free slot), block offset, block count
+	blob    magic "BlbS", header number, time stamp, length, data, padding,
+	        adler32 of all of it, length, magic "BlbE"
+
+Everything is little-endian. The index files next to Packages.db are not
+needed to read the packages, and are not used.
+*/
+
+const (
+	ndbMagic        = "RpmP"
+	ndbSlotMagic    = "Slot"
+	ndbBlobMagic    = "BlbS"
+	ndbBlobEndMagic = "BlbE"
+	ndbHeaderSize   = 32
+	ndbSlotSize     = 16
+	ndbBlockSize    = 16
+	ndbPageSize     = 4096
+	ndbBlobHdrSize  = 16
+	ndbBlobTailSize = 12
+)
+
+type ndbDB struct {
+	r       io.ReaderAt
+	size    int64
+	slots   []byte
+	closers []io.Closer
+}
+
+func newNDB(r io.ReaderAt, closers ...io.Closer) (*ndbDB, error) {
+	size, err := sizeOf(r)
+	if err != nil {
+		return nil, err
+	}
+	hdr := make([]byte, ndbHeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	if string(hdr[:4]) != ndbMagic {
+		return nil, errors.New("not an ndb database")
+	}
+	if v := binary.LittleEndian.Uint32(hdr[4:]); v != 0 {
+		return nil, fmt.Errorf("unsupported version %d", v)
+	}
+
+	// The slots fill the rest of the slot pages after the header.
+	npages := binary.LittleEndian.Uint32(hdr[12:])
+	if npages == 0 || npages > 2048 {
+		return nil, fmt.Errorf("bad slot page count %d", npages)
+	}
+	slots := make([]byte, int(npages)*ndbPageSize-ndbHeaderSize)
+	if _, err := r.ReadAt(slots, ndbHeaderSize); err != nil {
+		return nil, fmt.Errorf("reading slots: %v", err)
+	}
+	return &ndbDB{r: r, size: size, slots: slots, closers: closers}, nil
+}
+
+func (db *ndbDB) Close() error {
+	var err error
+	for _, c := range db.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (db *ndbDB) blobs(fn func(num uint32, blob []byte) error) error {
+	for off := 0; off+ndbSlotSize <= len(db.slots); off += ndbSlotSize {
+		slot := db.slots[off : off+ndbSlotSize]
+		if string(slot[:4]) != ndbSlotMagic {
+			return fmt.Errorf("slot %d: bad magic", off/ndbSlotSize)
+		}
+		num := binary.LittleEndian.Uint32(slot[4:])
+		if num == 0 {
+			continue
+		}
+		blob, err := db.blob(num, binary.LittleEndian.Uint32(slot[8:]), binary.LittleEndian.Uint32(slot[12:]))
+		if err != nil {
+			return fmt.Errorf("package %d: %v", num, err)
+		}
+		if err := fn(num, blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blob returns the blob of package num kept in count blocks from block off,
+// checking it as rpmpkgVerifyblob does.
+func (db *ndbDB) blob(num, off, count uint32) ([]byte, error) {
+	if count == 0 || (int64(off)+int64(count))*ndbBlockSize > db.size {
+		return nil, fmt.Errorf("bad block count %d at block %d", count, off)
+	}
+	b := make([]byte, int(count)*ndbBlockSize)
+	if _, err := db.r.ReadAt(b, int64(off)*ndbBlockSize); err != nil {
+		return nil, err
+	}
+
+	if string(b[:4]) != ndbBlobMagic || binary.LittleEndian.Uint32(b[4:]) != num {
+		return nil, errors.New("bad blob header")
+	}
+	length := binary.LittleEndian.Uint32(b[12:])
+	if (ndbBlobHdrSize+uint64(length)+ndbBlobTailSize+ndbBlockSize-1)/ndbBlockSize != uint64(count) {
+		return nil, fmt.Errorf("bad blob length %d", length)
+	}
+
+	tail := b[len(b)-ndbBlobTailSize:]
+	if string(tail[8:]) != ndbBlobEndMagic || binary.LittleEndian.Uint32(tail[4:]) != length {
+		return nil, errors.New("bad blob tail")
+	}
+	if adler32.Checksum(b[:len(b)-ndbBlobTailSize]) != binary.LittleEndian.Uint32(tail) {
+		return nil, errors.New("bad blob checksum")
+	}
+	return b[ndbBlobHdrSize : ndbBlobHdrSize+length], nil
+}
@@ -0,0 +1,62 @@
+package rpmdb
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestNDBCorrupt(t *testing.T) {
+	valid, err := os.ReadFile("testdata/ndb/usr/lib/sysimage/rpm/Packages.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(fn func(b []byte)) []byte {
+		b := append([]byte(nil), valid...)
+		fn(b)
+		return b
+	}
+
+	// The first slot is that of package 14, whose blob is the first one
+	// after the slot page.
+	blob := ndbPageSize
+	tests := map[string][]byte{
+		"short":        valid[:16],
+		"magic":        corrupt(func(b []byte) { b[0] = 'X' }),
+		"version":      corrupt(func(b []byte) { b[4] = 1 }),
+		"slot pages":   corrupt(func(b []byte) { b[12] = 0 }),
+		"slot magic":   corrupt(func(b []byte) { b[ndbHeaderSize] = 'X' }),
+		"block count":  corrupt(func(b []byte) { b[ndbHeaderSize+12]++ }),
+		"blob magic":   corrupt(func(b []byte) { b[blob] = 'X' }),
+		"blob number":  corrupt(func(b []byte) { b[blob+4]++ }),
+		"blob length":  corrupt(func(b []byte) { b[blob+12]++ }),
+		"checksum":     corrupt(func(b []byte) { b[blob+ndbBlobHdrSize+8]++ }),
+		"truncated":    valid[:len(valid)-1],
+		"bad position": corrupt(func(b []byte) { b[ndbHeaderSize+8]++ }),
+		"huge blob":    corrupt(func(b []byte) { b[ndbHeaderSize+15] = 0x0f }),
+	}
+	for name, b := range tests {
+		db, err := newNDB(bytes.NewReader(b))
+		if err == nil {
+			err = db.blobs(func(uint32, []byte) error { return nil })
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	db, err := newNDB(bytes.NewReader(valid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nums []uint32
+	if err := db.blobs(func(num uint32, _ []byte) error {
+		nums = append(nums, num)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(nums) != 13 || nums[0] != 14 {
+		t.Errorf("wrong packages; got %v", nums)
+	}
+}
@@ -0,0 +1,300 @@
+/*
+Package rpmdb reads the database of installed packages rpm keeps, without
+needing rpm (or any C library) installed, so that the packages of a container
+image or a mounted system can be listed from its root directory.
+
+The database is read-only: it is never written to, and no locks are taken.
+*/
+package rpmdb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/nesv/rpm"
+)
+
+var ErrNoDatabase = errors.New("no rpm database found")
+
+// The directories rpm keeps its database in, newest first.
+var dbPaths = []string{"usr/lib/sysimage/rpm", "var/lib/rpm"}
+
+// An opener opens the named file of a database.
+type opener func(name string) (*os.File, error)
+
+// The files of the formats rpm keeps its database in, in the order they are
+// looked for, with the functions opening them.
+var dbFormats = []struct {
+	file string
+	open func(open opener, name string) (backend, error)
+}{
+	{"rpmdb.sqlite", openSQLite},
+	{"Packages.db", openNDB},
+	{"Packages", openBerkeleyDB},
+}
+
+/*
+A Package is an installed package: its header, as stored in the database, and
+its header number, which rpm shows as DBINSTANCE.
+*/
+type Package struct {
+	Num uint32
+	*rpm.Header
+}
+
+// A backend reads the header blobs of one of rpm's database formats.
+type backend interface {
+	// blobs calls fn for every header blob in the database.
+	blobs(fn func(num uint32, blob []byte) error) error
+	io.Closer
+}
+
+/*
+A DB is an open rpm database. Its packages are read when first needed, and
+kept in memory until the database is closed.
+*/
+type DB struct {
+	b    backend
+	pkgs []Package
+}
+
+/*
+Opens the rpm database of the system whose root directory is root, which may
+be "/" for the running system. It looks in /usr/lib/sysimage/rpm and then
+/var/lib/rpm for a database in any of the formats rpm uses: SQLite
+(rpmdb.sqlite), ndb (Packages.db) and Berkeley DB (Packages). It fails with
+ErrNoDatabase if there is none.
+
+The database files are opened through an os.Root, so symlinks in the root
+directory (such as /var/lib/rpm pointing to /usr/lib/sysimage/rpm) cannot
+lead out of it.
+*/
+func Open(root string) (*DB, error) {
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	for _, dir := range dbPaths {
+		for _, format := range dbFormats {
+			name := path.Join(dir, format.file)
+			if _, err := r.Stat(name); errors.Is(err, os.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			return openDB(format.open, r.Open, name)
+		}
+	}
+	return nil, ErrNoDatabase
+}
+
+/*
+Opens an rpm database in the SQLite format used since rpm 4.16, as found in
+rpmdb.sqlite. Changes committed to the write-ahead log next to it
+(rpmdb.sqlite-wal), but not yet copied to the database, are seen as well.
+*/
+func OpenSQLite(name string) (*DB, error) {
+	return openDB(openSQLite, os.Open, name)
+}
+
+/*
+Opens an rpm database in the ndb format, as found in Packages.db.
+*/
+func OpenNDB(name string) (*DB, error) {
+	return openDB(openNDB, os.Open, name)
+}
+
+/*
+Opens an rpm database in the Berkeley DB format used before rpm 4.16, as found
+in Packages. The database may have been written on a host of either byte
+order.
+*/
+func OpenBerkeleyDB(name string) (*DB, error) {
+	return openDB(openBerkeleyDB, os.Open, name)
+}
+
+func openDB(openBackend func(opener, string) (backend, error), open opener, name string) (*DB, error) {
+	b, err := openBackend(open, name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return &DB{b: b}, nil
+}
+
+func openSQLite(open opener, name string) (backend, error) {
+	f, err := open(name)
+	if err != nil {
+		return nil, err
+	}
+	wal, err := open(name + "-wal")
+	if errors.Is(err, os.ErrNotExist) {
+		db, err := newSQLiteDB(f, nil, f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return db, nil
+	} else if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	db, err := newSQLiteDB(f, wal, f, wal)
+	if err != nil {
+		f.Close()
+		wal.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func openNDB(open opener, name string) (backend, error) {
+	f, err := open(name)
+	if err != nil {
+		return nil, err
+	}
+	db, err := newNDB(f, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func openBerkeleyDB(open opener, name string) (backend, error) {
+	f, err := open(name)
+	if err != nil {
+		return nil, err
+	}
+	db, err := newBerkeleyDB(f, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+/*
+Closes the database files.
+*/
+func (db *DB) Close() error {
+	db.pkgs = nil
+	return db.b.Close()
+}
+
+/*
+Returns the installed packages, in order of their header numbers.
+*/
+func (db *DB) Packages() ([]Package, error) {
+	if db.pkgs != nil {
+		return db.pkgs, nil
+	}
+
+	pkgs := []Package{}
+	err := db.b.blobs(func(num uint32, blob []byte) error {
+		h, err := rpm.ParseHeaderBlob(blob)
+		if err != nil {
+			return fmt.Errorf("package %d: %v", num, err)
+		}
+		pkgs = append(pkgs, Package{Num: num, Header: h})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Num < pkgs[j].Num })
+	db.pkgs = pkgs
+	return pkgs, nil
+}
+
+// find returns the packages for which match is true.
+func (db *DB) find(match func(p Package) (bool, error)) ([]Package, error) {
+	pkgs, err := db.Packages()
+	if err != nil {
+		return nil, err
+	}
+	var found []Package
+	for _, p := range pkgs {
+		ok, err := match(p)
+		if err != nil {
+			return nil, fmt.Errorf("package %d: %v", p.Num, err)
+		}
+		if ok {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+/*
+Returns the installed packages with the given name, as "rpm -q name" does.
+*/
+func (db *DB) ByName(name string) ([]Package, error) {
+	return db.find(func(p Package) (bool, error) {
+		return p.Name() == name, nil
+	})
+}
+
+/*
+Returns the installed packages which provide the capability, as
+"rpm -q --whatprovides" does: the capability is either the name of something
+provided (whatever its version), or a file the package holds.
+*/
+func (db *DB) WhatProvides(capability string) ([]Package, error) {
+	return db.find(func(p Package) (bool, error) {
+		for _, name := range p.GetStrings(rpm.TagProvideName) {
+			if name == capability {
+				return true, nil
+			}
+		}
+		if path.IsAbs(capability) {
+			return hasFile(p, capability)
+		}
+		return false, nil
+	})
+}
+
+/*
+Returns the installed packages which hold the file at the given absolute path,
+as "rpm -qf" does, without resolving symlinks.
+*/
+func (db *DB) ByFile(name string) ([]Package, error) {
+	name = path.Clean(name)
+	return db.find(func(p Package) (bool, error) {
+		return hasFile(p, name)
+	})
+}
+
+// sizeOf returns the size of the database file r reads.
+func sizeOf(r io.ReaderAt) (int64, error) {
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size(), nil
+	case interface{ Stat() (os.FileInfo, error) }:
+		fi, err := r.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return fi.Size(), nil
+	}
+	return 0, errors.New("cannot tell the size of the database")
+}
+
+func hasFile(p Package, name string) (bool, error) {
+	names, err := p.Filenames()
+	if err != nil {
+		return false, err
+	}
+	for _, n := range names {
+		if n == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,120 @@
+package rpmdb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func packageNames(pkgs []Package) string {
+	var names []string
+	for _, p := range pkgs {
+		names = append(names, fmt.Sprintf("%d:%s-%s", p.Num, p.Name(), p.Version()))
+	}
+	return fmt.Sprint(names)
+}
+
+func TestOpen(t *testing.T) {
+	// The fixtures hold the same packages, in each of the formats.
+	for _, root := range []string{"testdata/sqlite", "testdata/ndb", "testdata/bdb"} {
+		t.Run(root, func(t *testing.T) {
+			db, err := Open(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			testPackages(t, db)
+		})
+	}
+}
+
+func testPackages(t *testing.T, db *DB) {
+
+	pkgs, err := db.Packages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nums []uint32
+	for _, p := range pkgs {
+		nums = append(nums, p.Num)
+	}
+	expected := "[1 2 3 5 6 7 8 9 10 11 12 13 14]"
+	t.Logf("expecting %q", expected)
+	if fmt.Sprint(nums) != expected {
+		t.Errorf("wrong header numbers; got %q wanted %q", fmt.Sprint(nums), expected)
+	}
+
+	// pkg05 is large enough to need overflow pages.
+	files, err := pkgs[4].Filenames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkgs[4].Name() != "pkg05" || len(files) != 401 || files[400] != "/usr/share/pkg05/file399" {
+		t.Errorf("wrong package; got %s with %d files", pkgs[4].Name(), len(files))
+	}
+
+	queries := []struct {
+		name     string
+		query    func(string) ([]Package, error)
+		arg      string
+		expected string
+	}{
+		{"ByName", db.ByName, "hello", "[1:hello-2.0]"},
+		{"ByName", db.ByName, "nope", "[]"},
+		{"WhatProvides", db.WhatProvides, "greeter", "[1:hello-2.0]"},
+		{"WhatProvides", db.WhatProvides, "cap0", "[7:pkg06-1.6 10:pkg09-1.9 13:pkg12-1.12]"},
+		{"WhatProvides", db.WhatProvides, "/usr/bin/hello", "[1:hello-2.0]"},
+		{"ByFile", db.ByFile, "/usr/share/pkg05/file042", "[6:pkg05-1.5]"},
+		{"ByFile", db.ByFile, "/usr/bin//hello", "[1:hello-2.0]"},
+		{"ByFile", db.ByFile, "/usr/bin/nope", "[]"},
+	}
+	for _, q := range queries {
+		pkgs, err := q.query(q.arg)
+		if err != nil {
+			t.Fatalf("%s(%q): %v", q.name, q.arg, err)
+		}
+		if got := packageNames(pkgs); got != q.expected {
+			t.Errorf("%s(%q): got %q wanted %q", q.name, q.arg, got, q.expected)
+		}
+	}
+}
+
+func TestOpenWAL(t *testing.T) {
+	db, err := Open("testdata/wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	pkgs, err := db.Packages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[1:hello-2.0 3:pkg02-1.2 4:pkg03-1.3]"
+	t.Logf("expecting %q", expected)
+	if got := packageNames(pkgs); got != expected {
+		t.Errorf("wrong packages; got %q wanted %q", got, expected)
+	}
+}
+
+func TestOpenMissing(t *testing.T) {
+	if _, err := Open("testdata"); !errors.Is(err, ErrNoDatabase) {
+		t.Errorf("wrong error; got %v wanted %v", err, ErrNoDatabase)
+	}
+	for _, open := range []func(string) (*DB, error){OpenSQLite, OpenNDB, OpenBerkeleyDB} {
+		if _, err := open("testdata/nope"); err == nil {
+			t.Error("expected an error")
+		}
+	}
+
+	// Each format fails on the others' files.
+	if _, err := OpenNDB("testdata/bdb/var/lib/rpm/Packages"); err == nil {
+		t.Error("ndb: expected an error")
+	}
+	if _, err := OpenBerkeleyDB("testdata/sqlite/var/lib/rpm/rpmdb.sqlite"); err == nil {
+		t.Error("bdb: expected an error")
+	}
+	if _, err := OpenSQLite("testdata/ndb/usr/lib/sysimage/rpm/Packages.db"); err == nil {
+		t.Error("sqlite: expected an error")
+	}
+}
@@ -0,0 +1,448 @@
+package rpmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+/*
+The SQLite database rpm keeps since 4.16 holds a single table, Packages, with
+the header number as its row id and the header blob in its second column:
+
+	CREATE TABLE 'Packages' (hnum INTEGER PRIMARY KEY AUTOINCREMENT, blob BLOB NOT NULL)
+
+Only as much of the file format as reading such a table needs is implemented
+here: the database header, table b-trees, overflow pages, records and the
+write-ahead log. Indexes are not used, and the database is never written to.
+*/
+
+const (
+	sqliteMagic   = "SQLite format 3\x00"
+	sqliteTable   = "Packages"
+	walMagic      = 0x377f0682
+	walHeaderSize = 32
+	walFrameSize  = 24
+)
+
+type sqliteDB struct {
+	r        io.ReaderAt
+	size     int64
+	pageSize int
+	usable   int
+	npages   uint32
+	wal      map[uint32][]byte
+	closers  []io.Closer
+}
+
+func newSQLiteDB(r io.ReaderAt, wal io.ReaderAt, closers ...io.Closer) (*sqliteDB, error) {
+	size, err := sizeOf(r)
+	if err != nil {
+		return nil, err
+	}
+	hdr := make([]byte, 100)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, fmt.Errorf("reading database header: %v", err)
+	}
+	if string(hdr[:16]) != sqliteMagic {
+		return nil, errors.New("not an sqlite database")
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(hdr[16:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("bad page size %d", pageSize)
+	}
+	usable := pageSize - int(hdr[20])
+	if usable < 480 {
+		return nil, fmt.Errorf("bad reserved space %d", hdr[20])
+	}
+
+	db := &sqliteDB{r: r, size: size, pageSize: pageSize, usable: usable, closers: closers}
+	// The page count is only valid if written by a version of SQLite which
+	// keeps it, as told by the version number matching the change counter.
+	if binary.BigEndian.Uint32(hdr[24:]) == binary.BigEndian.Uint32(hdr[92:]) {
+		db.npages = binary.BigEndian.Uint32(hdr[28:])
+	}
+	if wal != nil {
+		if err := db.readWAL(wal); err != nil {
+			return nil, fmt.Errorf("write-ahead log: %v", err)
+		}
+	}
+	return db, nil
+}
+
+/*
+readWAL reads the frames of the write-ahead log which belong to committed
+transactions. Frames are checked against the salts and the running checksum
+of the log header, as SQLite does on recovery: the first frame which does not
+match ends the log, and frames after the last commit are left out.
+*/
+func (db *sqliteDB) readWAL(r io.ReaderAt) error {
+	hdr := make([]byte, walHeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err == io.EOF {
+		// An empty log, as left by a clean shutdown.
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	magic := binary.BigEndian.Uint32(hdr)
+	if magic&^1 != walMagic {
+		return errors.New("bad magic")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if magic&1 != 0 {
+		order = binary.BigEndian
+	}
+	if size := int(binary.BigEndian.Uint32(hdr[8:])); size != db.pageSize && !(size == 1 && db.pageSize == 65536) {
+		return fmt.Errorf("page size %d does not match the database's %d", size, db.pageSize)
+	}
+	s0, s1 := walChecksum(order, 0, 0, hdr[:24])
+	if s0 != binary.BigEndian.Uint32(hdr[24:]) || s1 != binary.BigEndian.Uint32(hdr[28:]) {
+		return errors.New("bad header checksum")
+	}
+	salts := hdr[16:24]
+
+	db.wal = make(map[uint32][]byte)
+	pending := make(map[uint32][]byte)
+	frame := make([]byte, walFrameSize+db.pageSize)
+	for off := int64(walHeaderSize); ; off += int64(len(frame)) {
+		if _, err := r.ReadAt(frame, off); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !bytes.Equal(frame[8:16], salts) {
+			return nil
+		}
+		s0, s1 = walChecksum(order, s0, s1, frame[:8])
+		s0, s1 = walChecksum(order, s0, s1, frame[walFrameSize:])
+		if s0 != binary.BigEndian.Uint32(frame[16:]) || s1 != binary.BigEndian.Uint32(frame[20:]) {
+			return nil
+		}
+
+		pgno := binary.BigEndian.Uint32(frame)
+		if pgno == 0 {
+			return nil
+		}
+		pending[pgno] = append([]byte(nil), frame[walFrameSize:]...)
+		if commit := binary.BigEndian.Uint32(frame[4:]); commit != 0 {
+			for n, page := range pending {
+				db.wal[n] = page
+			}
+			pending = make(map[uint32][]byte)
+			db.npages = commit
+		}
+	}
+}
+
+// walChecksum continues the checksum s0, s1 over b, whose length is a
+// multiple of 8.
+func walChecksum(order binary.ByteOrder, s0, s1 uint32, b []byte) (uint32, uint32) {
+	for i := 0; i+8 <= len(b); i += 8 {
+		s0 += order.Uint32(b[i:]) + s1
+		s1 += order.Uint32(b[i+4:]) + s0
+	}
+	return s0, s1
+}
+
+func (db *sqliteDB) Close() error {
+	var err error
+	for _, c := range db.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// page returns the page numbered n, from the write-ahead log if it has it.
+func (db *sqliteDB) page(n uint32) ([]byte, error) {
+	if n == 0 || (db.npages != 0 && n > db.npages) {
+		return nil, fmt.Errorf("bad page number %d", n)
+	}
+	if p, ok := db.wal[n]; ok {
+		return p, nil
+	}
+	p := make([]byte, db.pageSize)
+	if _, err := db.r.ReadAt(p, int64(n-1)*int64(db.pageSize)); err != nil {
+		return nil, fmt.Errorf("page %d: %v", n, err)
+	}
+	return p, nil
+}
+
+/*
+scan calls fn with the row id and record of every row of the table whose
+b-tree has its root at the given page, in order of their row ids.
+*/
+func (db *sqliteDB) scan(root uint32, fn func(rowid int64, record []byte) error) error {
+	return db.scanPage(root, make(map[uint32]bool), fn)
+}
+
+func (db *sqliteDB) scanPage(n uint32, seen map[uint32]bool, fn func(rowid int64, record []byte) error) error {
+	if seen[n] {
+		return fmt.Errorf("page %d: loop in b-tree", n)
+	}
+	seen[n] = true
+
+	p, err := db.page(n)
+	if err != nil {
+		return err
+	}
+	off := 0
+	if n == 1 {
+		off = 100
+	}
+	p = p[:db.usable]
+
+	hdrSize := 8
+	switch p[off] {
+	case 0x0d:
+	case 0x05:
+		hdrSize = 12
+	default:
+		return fmt.Errorf("page %d: not a table b-tree page", n)
+	}
+	ncells := int(binary.BigEndian.Uint16(p[off+3:]))
+	if off+hdrSize+2*ncells > len(p) {
+		return fmt.Errorf("page %d: bad cell count %d", n, ncells)
+	}
+
+	for i := 0; i < ncells; i++ {
+		cell := int(binary.BigEndian.Uint16(p[off+hdrSize+2*i:]))
+		if cell >= len(p) {
+			return fmt.Errorf("page %d: bad cell offset %d", n, cell)
+		}
+
+		if p[off] == 0x05 {
+			if cell+4 > len(p) {
+				return fmt.Errorf("page %d: truncated cell", n)
+			}
+			if err := db.scanPage(binary.BigEndian.Uint32(p[cell:]), seen, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rowid, record, err := db.leafCell(p[cell:])
+		if err != nil {
+			return fmt.Errorf("page %d: %v", n, err)
+		}
+		if err := fn(rowid, record); err != nil {
+			return err
+		}
+	}
+
+	if p[off] == 0x05 {
+		return db.scanPage(binary.BigEndian.Uint32(p[off+8:]), seen, fn)
+	}
+	return nil
+}
+
+// leafCell returns the row id and record of a table b-tree leaf cell,
+// gathering the part of the record kept on overflow pages.
+func (db *sqliteDB) leafCell(b []byte) (int64, []byte, error) {
+	size, n := varint(b)
+	if n == 0 {
+		return 0, nil, errors.New("bad payload size")
+	}
+	b = b[n:]
+	rowid, n := varint(b)
+	if n == 0 {
+		return 0, nil, errors.New("bad row id")
+	}
+	b = b[n:]
+	// A payload cannot be larger than the pages of the database and its
+	// log put together.
+	if pages := db.size/int64(db.pageSize) + int64(len(db.wal)); size > math.MaxInt32 || int64(size) > pages*int64(db.usable) {
+		return 0, nil, fmt.Errorf("bad payload size %d", size)
+	}
+
+	local := db.localPayload(int(size))
+	if local > len(b) || (local < int(size) && local+4 > len(b)) {
+		return 0, nil, errors.New("truncated cell")
+	}
+	record := make([]byte, 0, size)
+	record = append(record, b[:local]...)
+	if local == int(size) {
+		return int64(rowid), record, nil
+	}
+
+	next := binary.BigEndian.Uint32(b[local:])
+	seen := make(map[uint32]bool)
+	for len(record) < int(size) {
+		if seen[next] {
+			return 0, nil, fmt.Errorf("overflow: loop at page %d", next)
+		}
+		seen[next] = true
+		p, err := db.page(next)
+		if err != nil {
+			return 0, nil, fmt.Errorf("overflow: %v", err)
+		}
+		chunk := p[4:db.usable]
+		if left := int(size) - len(record); len(chunk) > left {
+			chunk = chunk[:left]
+		}
+		record = append(record, chunk...)
+		next = binary.BigEndian.Uint32(p)
+	}
+	return int64(rowid), record, nil
+}
+
+// localPayload returns how much of a payload of the given size a table leaf
+// cell keeps on its page, the rest going to overflow pages.
+func (db *sqliteDB) localPayload(size int) int {
+	u := db.usable
+	max := u - 35
+	if size <= max {
+		return size
+	}
+	min := (u-12)*32/255 - 23
+	k := min + (size-min)%(u-4)
+	if k <= max {
+		return k
+	}
+	return min
+}
+
+/*
+Returns the varint at the start of b, and its length, which is 0 if b does
+not hold a whole varint. A varint is big-endian, with 7 bits to a byte, the
+high bit of which is set on all but the last; the ninth byte, if any,
+contributes all its 8 bits.
+*/
+func varint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 9 && i < len(b); i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+/*
+Returns the values of a record: nil for NULL, int64 for integers, float64,
+[]byte for blobs, and string for text.
+*/
+func parseRecord(b []byte) ([]interface{}, error) {
+	hdrSize, n := varint(b)
+	if n == 0 || hdrSize < uint64(n) || hdrSize > uint64(len(b)) {
+		return nil, errors.New("bad record header")
+	}
+	types, data := b[n:hdrSize], b[hdrSize:]
+
+	var values []interface{}
+	for len(types) > 0 {
+		t, n := varint(types)
+		if n == 0 {
+			return nil, errors.New("bad record header")
+		}
+		types = types[n:]
+
+		var size int
+		switch {
+		case t <= 4:
+			size = int(t)
+		case t == 5:
+			size = 6
+		case t == 6 || t == 7:
+			size = 8
+		case t == 8 || t == 9:
+		case t >= 12:
+			size = int((t - 12) / 2)
+		default:
+			return nil, fmt.Errorf("bad serial type %d", t)
+		}
+		if size > len(data) {
+			return nil, errors.New("truncated record")
+		}
+		v := data[:size]
+		data = data[size:]
+
+		switch {
+		case t == 0:
+			values = append(values, nil)
+		case t <= 6:
+			// Sign-extend the big-endian integer.
+			i := int64(int8(v[0]))
+			for _, c := range v[1:] {
+				i = i<<8 | int64(c)
+			}
+			values = append(values, i)
+		case t == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case t == 8:
+			values = append(values, int64(0))
+		case t == 9:
+			values = append(values, int64(1))
+		case t%2 == 0:
+			values = append(values, v)
+		default:
+			values = append(values, string(v))
+		}
+	}
+	return values, nil
+}
+
+// table returns the root page of the table with the given name, from the
+// schema table at page 1.
+func (db *sqliteDB) table(name string) (uint32, error) {
+	var root uint32
+	err := db.scan(1, func(_ int64, record []byte) error {
+		values, err := parseRecord(record)
+		if err != nil {
+			return fmt.Errorf("schema: %v", err)
+		}
+		if len(values) < 4 || values[0] != "table" || values[1] != name {
+			return nil
+		}
+		n, ok := values[3].(int64)
+		if !ok || n <= 0 || n > math.MaxUint32 {
+			return fmt.Errorf("schema: bad root page for table %s", name)
+		}
+		root = uint32(n)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if root == 0 {
+		return 0, fmt.Errorf("no %s table", name)
+	}
+	return root, nil
+}
+
+func (db *sqliteDB) blobs(fn func(num uint32, blob []byte) error) error {
+	root, err := db.table(sqliteTable)
+	if err != nil {
+		return err
+	}
+	return db.scan(root, func(rowid int64, record []byte) error {
+		if rowid <= 0 || rowid > math.MaxUint32 {
+			return fmt.Errorf("bad header number %d", rowid)
+		}
+		values, err := parseRecord(record)
+		if err != nil {
+			return fmt.Errorf("package %d: %v", rowid, err)
+		}
+		if len(values) < 2 {
+			return fmt.Errorf("package %d: no blob", rowid)
+		}
+		blob, ok := values[1].([]byte)
+		if !ok {
+			return fmt.Errorf("package %d: no blob", rowid)
+		}
+		return fn(uint32(rowid), blob)
+	})
+}
@@ -0,0 +1,168 @@
+package rpmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestVarint(t *testing.T) {
+	tests := []struct {
+		b []byte
+		v uint64
+		n int
+	}{
+		{[]byte{0x00}, 0, 1},
+		{[]byte{0x7f, 0xff}, 0x7f, 1},
+		{[]byte{0x81, 0x00}, 0x80, 2},
+		{[]byte{0x82, 0x80, 0x01}, 0x8001, 3},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, 1<<64 - 1, 9},
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01}, 1, 9},
+		{[]byte{0x81}, 0, 0},
+		{nil, 0, 0},
+	}
+	for _, test := range tests {
+		v, n := varint(test.b)
+		if v != test.v || n != test.n {
+			t.Errorf("%x: got %d, %d wanted %d, %d", test.b, v, n, test.v, test.n)
+		}
+	}
+}
+
+func TestParseRecord(t *testing.T) {
+	record := []byte{
+		// The header: its size, then the serial types.
+		10, 0, 1, 2, 6, 7, 8, 9, 16, 19,
+		0xfe,
+		0x01, 0x00,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe,
+		0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		1, 2,
+		'a', 'b', 'c',
+	}
+	values, err := parseRecord(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{nil, int64(-2), int64(256), int64(-2), 1.5, int64(0), int64(1), []byte{1, 2}, "abc"}
+	t.Logf("expecting %v", expected)
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("wrong values; got %v wanted %v", values, expected)
+	}
+
+	for _, b := range [][]byte{nil, {5, 0}, {2, 10}, {2, 1}, {2, 17, 'a'}} {
+		if _, err := parseRecord(b); err == nil {
+			t.Errorf("%x: expected an error", b)
+		}
+	}
+}
+
+func TestLocalPayload(t *testing.T) {
+	db := &sqliteDB{usable: 4096}
+	for _, test := range [][2]int{{100, 100}, {4061, 4061}, {4062, 489}, {5000, 908}, {48000, 2988}} {
+		if got := db.localPayload(test[0]); got != test[1] {
+			t.Errorf("%d: got %d wanted %d", test[0], got, test[1])
+		}
+	}
+}
+
+func TestSQLiteCorrupt(t *testing.T) {
+	data, err := os.ReadFile("testdata/sqlite/var/lib/rpm/rpmdb.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(fn func(b []byte)) []byte {
+		b := append([]byte(nil), data...)
+		fn(b)
+		return b
+	}
+
+	tests := map[string][]byte{
+		"short":      data[:50],
+		"magic":      corrupt(func(b []byte) { b[0] = 'X' }),
+		"page size":  corrupt(func(b []byte) { b[16], b[17] = 0x03, 0x00 }),
+		"page type":  corrupt(func(b []byte) { b[100] = 0x0a }),
+		"cell count": corrupt(func(b []byte) { b[103], b[104] = 0xff, 0xff }),
+		"truncated":  data[:4096*3],
+	}
+	for name, b := range tests {
+		db, err := newSQLiteDB(bytes.NewReader(b), nil)
+		if err == nil {
+			err = db.blobs(func(uint32, []byte) error { return nil })
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSQLiteOverflow(t *testing.T) {
+	// A database of 40 pages of 512 bytes, whose first overflow page
+	// points to itself.
+	data := make([]byte, 40*512)
+	binary.BigEndian.PutUint32(data[512:], 2)
+	db := &sqliteDB{r: bytes.NewReader(data), size: int64(len(data)), pageSize: 512, usable: 512}
+
+	cell := append([]byte{0xce, 0x10, 0x01}, make([]byte, db.localPayload(10000))...)
+	cell = binary.BigEndian.AppendUint32(cell, 2)
+	if _, _, err := db.leafCell(cell); err == nil {
+		t.Error("loop: expected an error")
+	}
+
+	// A payload larger than the whole database.
+	cell = append([]byte{0x84, 0x80, 0x80, 0x80, 0x00, 0x01}, make([]byte, 100)...)
+	if _, _, err := db.leafCell(cell); err == nil {
+		t.Error("huge payload: expected an error")
+	}
+}
+
+func TestSQLiteWALChecksum(t *testing.T) {
+	dir := "testdata/wal/usr/lib/sysimage/rpm/"
+	data, err := os.ReadFile(dir + "rpmdb.sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal, err := os.ReadFile(dir + "rpmdb.sqlite-wal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nums := func(wal []byte) string {
+		db, err := newSQLiteDB(bytes.NewReader(data), bytes.NewReader(wal))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var nums []uint32
+		if err := db.blobs(func(num uint32, _ []byte) error {
+			nums = append(nums, num)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(nums)
+	}
+
+	if got := nums(wal); got != "[1 3 4]" {
+		t.Errorf("wrong packages; got %s wanted [1 3 4]", got)
+	}
+	if got := nums(nil); got != "[1 2 3]" {
+		t.Errorf("wrong packages without the log; got %s wanted [1 2 3]", got)
+	}
+
+	// A frame whose checksum does not match ends the log, leaving out the
+	// transaction it is part of.
+	bad := append([]byte(nil), wal...)
+	bad[walHeaderSize+walFrameSize+100] ^= 0xff
+	if got := nums(bad); got != "[1 2 3]" {
+		t.Errorf("wrong packages with a bad frame; got %s wanted [1 2 3]", got)
+	}
+
+	bad = append([]byte(nil), wal...)
+	bad[0] = 0
+	if _, err := newSQLiteDB(bytes.NewReader(data), bytes.NewReader(bad)); err == nil {
+		t.Error("bad magic: expected an error")
+	}
+}
@@ -0,0 +1,202 @@
+package rpm
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+/*
+A Signer makes the OpenPGP signatures of packages. Sign returns a binary
+(not armored) detached signature packet of the data read from r.
+
+Signers for keys held in memory are created with NewSigner or ReadSigner;
+other implementations can hand the data to a hardware token or a signing
+service.
+*/
+type Signer interface {
+	Sign(r io.Reader) ([]byte, error)
+}
+
+type entitySigner struct {
+	entity *openpgp.Entity
+	config *packet.Config
+}
+
+/*
+Returns a Signer for the private key of an OpenPGP entity, which has to be
+decrypted already. Signatures are made with SHA256.
+*/
+func NewSigner(e *openpgp.Entity) Signer {
+	return &entitySigner{entity: e, config: &packet.Config{DefaultHash: crypto.SHA256}}
+}
+
+/*
+Reads an ASCII-armored private key, decrypting it with passphrase if it is
+encrypted, and returns a Signer for it. If r holds several keys, the first is
+used.
+*/
+func ReadSigner(r io.Reader, passphrase []byte) (Signer, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return nil, fmt.Errorf("no key")
+	}
+	e := entities[0]
+	if e.PrivateKey == nil {
+		return nil, fmt.Errorf("no private key")
+	}
+	if e.PrivateKey.Encrypted {
+		if err := e.DecryptPrivateKeys(passphrase); err != nil {
+			return nil, err
+		}
+	}
+	return NewSigner(e), nil
+}
+
+func (s *entitySigner) Sign(r io.Reader) ([]byte, error) {
+	var b bytes.Buffer
+	if err := openpgp.DetachSign(&b, s.entity, r, s.config); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+/*
+SignOptions control how WriteSigned signs a package.
+*/
+type SignOptions struct {
+	// HeaderOnly leaves out the signature of the header and payload,
+	// like rpmsign does by default since rpm 4.16. The header signature
+	// covers the payload through the payload digest in the header.
+	HeaderOnly bool
+}
+
+/*
+Writes the package to w with its signatures replaced by new ones made by s: a
+signature of the main header, and (unless opts.HeaderOnly is set) one of the
+header and payload.
+
+The signature tags are chosen by the signature's algorithm the way rpmsign
+does: RSAHEADER and PGP for RSA and EdDSA keys, DSAHEADER and GPG for DSA
+keys, and OPENPGP for version 6 signatures, which only sign the header. Only
+the signature header is rewritten; the lead, the main header and the payload
+are copied unchanged, so the package's digests remain valid. Reserved space
+in the signature header is used up, as rpmsign does, to keep the size of the
+signature header unchanged where possible.
+*/
+func (p *Package) WriteSigned(w io.Writer, s Signer, opts SignOptions) error {
+	header := p.Header.Bytes()
+	if header == nil {
+		return fmt.Errorf("package header was not read from a file")
+	}
+
+	hdrsig, err := s.Sign(bytes.NewReader(header))
+	if err != nil {
+		return err
+	}
+	version, algo, err := signatureInfo(hdrsig)
+	if err != nil {
+		return err
+	}
+
+	var added []Entry
+	switch {
+	case version == 6:
+		added = append(added, Entry{Tag: SigTagOpenPGP, Type: TypeStringArray, Value: []string{base64.StdEncoding.EncodeToString(hdrsig)}})
+		opts.HeaderOnly = true
+	case algo == packet.PubKeyAlgoDSA:
+		added = append(added, Entry{Tag: SigTagDSA, Type: TypeBin, Value: hdrsig})
+	case algo == packet.PubKeyAlgoRSA || algo == packet.PubKeyAlgoRSASignOnly || algo == packet.PubKeyAlgoEdDSA || algo == packet.PubKeyAlgoEd25519:
+		added = append(added, Entry{Tag: SigTagRSA, Type: TypeBin, Value: hdrsig})
+	default:
+		return fmt.Errorf("unsupported signature algorithm %s", algorithmName(algo))
+	}
+
+	if !opts.HeaderOnly {
+		sig, err := s.Sign(io.MultiReader(bytes.NewReader(header), p.RawPayload()))
+		if err != nil {
+			return err
+		}
+		tag := SigTagPGP
+		if algo == packet.PubKeyAlgoDSA {
+			tag = SigTagGPG
+		}
+		added = append(added, Entry{Tag: tag, Type: TypeBin, Value: sig})
+	}
+
+	sigheader, err := p.resign(added)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	b.Write(p.Lead.bytes())
+	b.Write(sigheader)
+	for b.Len()%8 != 0 {
+		b.WriteByte(0)
+	}
+	b.Write(header)
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, p.RawPayload())
+	return err
+}
+
+/*
+Returns the encoded signature header of the package, with its OpenPGP
+signatures replaced by the added entries.
+*/
+func (p *Package) resign(added []Entry) ([]byte, error) {
+	var entries []Entry
+	reserved := -1
+	for _, e := range p.Signature.Entries {
+		switch e.Tag {
+		case SigTagOpenPGP, SigTagRSA, SigTagDSA, SigTagPGP, SigTagGPG:
+			continue
+		case SigTagReservedSpace:
+			reserved = len(entries)
+		}
+		entries = append(entries, e)
+	}
+	entries = append(entries, added...)
+
+	h := &Header{Entries: entries}
+	raw, err := h.MarshalBinary()
+	if err != nil || reserved < 0 {
+		return raw, err
+	}
+
+	// Shrink the reserved space by however much the header grew, if it
+	// can take it.
+	old := len(p.Signature.Bytes())
+	space, _ := entries[reserved].Value.([]byte)
+	if grown := len(raw) - old; grown != 0 && grown <= len(space) {
+		entries[reserved].Value = make([]byte, len(space)-grown)
+		entries[reserved].Count = uint32(len(space) - grown)
+		return h.MarshalBinary()
+	}
+	return raw, nil
+}
+
+// signatureInfo returns the version and public key algorithm of a binary
+// signature packet.
+func signatureInfo(sig []byte) (int, packet.PublicKeyAlgorithm, error) {
+	p, err := packet.Read(bytes.NewReader(sig))
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading signature: %v", err)
+	}
+	s, ok := p.(*packet.Signature)
+	if !ok {
+		return 0, 0, fmt.Errorf("signer did not return a signature packet")
+	}
+	return s.Version, s.PubKeyAlgo, nil
+}
@@ -0,0 +1,135 @@
+package rpm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestWriteSigned(t *testing.T) {
+	rsaKey := newTestKey(t, packet.PubKeyAlgoRSA)
+	edKey := newTestKey(t, packet.PubKeyAlgoEdDSA)
+	kr, err := ReadKeyring(strings.NewReader(armoredPublicKey(t, rsaKey)), strings.NewReader(armoredPublicKey(t, edKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned := buildSignedPackage(t, testFilesHeader, testArchive)
+	orig, err := ReadPackage(bytes.NewReader(unsigned))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key      *openpgp.Entity
+		opts     SignOptions
+		expected []Tag
+	}{
+		{rsaKey, SignOptions{}, []Tag{SigTagRSA, SigTagPGP}},
+		{edKey, SignOptions{HeaderOnly: true}, []Tag{SigTagRSA}},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		if err := orig.WriteSigned(&b, NewSigner(tt.key), tt.opts); err != nil {
+			t.Fatal(err)
+		}
+		p, err := ReadPackage(bytes.NewReader(b.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(p.Header.Bytes(), orig.Header.Bytes()) {
+			t.Errorf("signing changed the main header")
+		}
+		if r, err := p.VerifyDigests(); err != nil || !r.OK() {
+			t.Errorf("digests of the signed package do not verify: %v\n%v", err, r)
+		}
+
+		checks, err := p.VerifySignatures(kr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(checks) != len(tt.expected) {
+			t.Fatalf("expected %d signatures; got %v", len(tt.expected), checks)
+		}
+		for i, c := range checks {
+			t.Logf("expecting %v", tt.expected[i].SignatureString())
+			if c.Tag != tt.expected[i] || !c.OK || c.KeyID != tt.key.PrimaryKey.KeyId {
+				t.Errorf("wrong signature; got %v in %v wanted %v", c, c.Tag.SignatureString(), tt.expected[i].SignatureString())
+			}
+		}
+
+		// Signing again replaces the signatures.
+		var again bytes.Buffer
+		if err := p.WriteSigned(&again, NewSigner(tt.key), tt.opts); err != nil {
+			t.Fatal(err)
+		}
+		p, _ = ReadPackage(bytes.NewReader(again.Bytes()))
+		if checks, _ := p.VerifySignatures(kr); len(checks) != len(tt.expected) {
+			t.Errorf("re-signing did not replace the signatures; got %v", checks)
+		}
+	}
+}
+
+func TestReservedSpace(t *testing.T) {
+	header := buildHeader(testString(TagName, "go"))
+	sig := buildHeader(
+		testEntry{TagHeaderSignatures, TypeBin, 16, make([]byte, 16)},
+		testInt32(SigTagSize, uint32(len(header)+7)),
+		testBin(SigTagReservedSpace, make([]byte, 4096)),
+	)
+	orig, err := ReadPackage(bytes.NewReader(buildPackage(sig, header, []byte("payload"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := orig.WriteSigned(&b, NewSigner(newTestKey(t, packet.PubKeyAlgoEdDSA)), SignOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ReadPackage(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(p.Signature.Bytes()), len(orig.Signature.Bytes()); got != want {
+		t.Errorf("signature header changed size; got %d wanted %d", got, want)
+	}
+	if p.PayloadOffset != orig.PayloadOffset {
+		t.Errorf("payload moved; got offset %d wanted %d", p.PayloadOffset, orig.PayloadOffset)
+	}
+}
+
+func TestReadSigner(t *testing.T) {
+	key := newTestKey(t, packet.PubKeyAlgoEdDSA)
+	if err := key.EncryptPrivateKeys([]byte("secret"), nil); err != nil {
+		t.Fatal(err)
+	}
+	var armored bytes.Buffer
+	w, _ := armor.Encode(&armored, openpgp.PrivateKeyType, nil)
+	if err := key.SerializePrivateWithoutSigning(w, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	if _, err := ReadSigner(bytes.NewReader(armored.Bytes()), []byte("wrong")); err == nil {
+		t.Errorf("expected an error for a wrong passphrase")
+	}
+	s, err := ReadSigner(bytes.NewReader(armored.Bytes()), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Sign(strings.NewReader("data")); err != nil {
+		t.Errorf("signing with decrypted key: %v", err)
+	}
+
+	var empty bytes.Buffer
+	w, _ = armor.Encode(&empty, openpgp.PrivateKeyType, nil)
+	w.Close()
+	if _, err := ReadSigner(bytes.NewReader(empty.Bytes()), nil); err == nil {
+		t.Errorf("expected an error for an armored block without keys")
+	}
+}
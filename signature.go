@@ -0,0 +1,448 @@
+package rpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/dsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+var (
+	ErrNoSignatures = errors.New("package is not signed")
+	ErrUnknownKey   = errors.New("signing key not in keyring")
+)
+
+/*
+A Keyring is a set of OpenPGP public keys that package signatures are checked
+against, like the keys imported with "rpmkeys --import".
+*/
+type Keyring struct {
+	entities openpgp.EntityList
+}
+
+/*
+Reads the ASCII-armored public keys (such as RPM-GPG-KEY-* files) from the
+given readers into a new Keyring.
+*/
+func ReadKeyring(readers ...io.Reader) (*Keyring, error) {
+	kr := &Keyring{}
+	for _, r := range readers {
+		if err := kr.Add(r); err != nil {
+			return nil, err
+		}
+	}
+	return kr, nil
+}
+
+/*
+Loads the ASCII-armored public keys in the given files into a new Keyring. A
+directory (such as /etc/pki/rpm-gpg) loads every file in it.
+*/
+func LoadKeyring(paths ...string) (*Keyring, error) {
+	kr := &Keyring{}
+	for _, p := range paths {
+		files := []string{p}
+		if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+			if files, err = filepath.Glob(filepath.Join(p, "*")); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, name := range files {
+			data, err := ioutil.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			if err := kr.Add(bytes.NewReader(data)); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	return kr, nil
+}
+
+/*
+Adds the ASCII-armored public keys read from r to the keyring.
+*/
+func (kr *Keyring) Add(r io.Reader) error {
+	entities, err := openpgp.ReadArmoredKeyRing(r)
+	if err != nil {
+		return err
+	}
+	kr.entities = append(kr.entities, entities...)
+	return nil
+}
+
+/*
+Returns the number of keys (not counting subkeys) in the keyring.
+*/
+func (kr *Keyring) Len() int {
+	return len(kr.entities)
+}
+
+/*
+A SignatureCheck is the result of verifying one of the OpenPGP signatures of a
+package.
+*/
+type SignatureCheck struct {
+	// Tag is the signature header tag holding the signature.
+	Tag Tag
+
+	// HeaderOnly is true for signatures of the main header alone
+	// (RSAHEADER, DSAHEADER, OPENPGP), and false for signatures of the
+	// header and the payload (PGP, GPG).
+	HeaderOnly bool
+
+	Version   int
+	KeyID     uint64
+	Algorithm string // "RSA", "DSA", "EdDSA"...
+	Hash      crypto.Hash
+	Created   time.Time
+
+	// Signer is the primary identity of the key which made the
+	// signature, if it is in the keyring.
+	Signer string
+
+	OK  bool
+	Err error
+}
+
+/*
+Returns the result of the check the way "rpmkeys --checksig -v" prints it, in
+example "Header V4 RSA/SHA256 Signature, key ID fd431d51: OK".
+*/
+func (c SignatureCheck) String() string {
+	name := fmt.Sprintf("V%d %s/%s Signature, key ID %08x", c.Version, c.Algorithm, hashName(c.Hash), uint32(c.KeyID))
+	if c.HeaderOnly {
+		name = "Header " + name
+	}
+	if c.OK {
+		return name + ": OK"
+	}
+	return fmt.Sprintf("%s: BAD (%v)", name, c.Err)
+}
+
+// The signature header tags holding OpenPGP signatures, and whether they
+// sign the header alone.
+var signatureTags = []struct {
+	tag        Tag
+	headerOnly bool
+}{
+	{SigTagOpenPGP, true},
+	{SigTagRSA, true},
+	{SigTagDSA, true},
+	{SigTagPGP, false},
+	{SigTagGPG, false},
+}
+
+/*
+Verifies the OpenPGP signatures of the package against the keys in kr,
+returning one SignatureCheck per signature found. Header-only signatures are
+checked against the main header, and header+payload signatures against the
+header followed by the (compressed) payload.
+
+Version 3 and 4 signatures made with RSA, DSA or EdDSA keys are supported, as
+are the version 4 and 6 signatures of rpm's OPENPGP tag. As with rpm, the
+expiry of keys is not taken into account.
+
+ErrNoSignatures is returned if the package has no signatures at all.
+*/
+func (p *Package) VerifySignatures(kr *Keyring) ([]SignatureCheck, error) {
+	var checks []SignatureCheck
+	for _, st := range signatureTags {
+		e, ok := p.Signature.Entry(st.tag)
+		if !ok {
+			continue
+		}
+
+		var sigs [][]byte
+		switch v := e.Value.(type) {
+		case []byte:
+			sigs = [][]byte{v}
+		case []string:
+			for _, s := range v {
+				sig, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return nil, fmt.Errorf("%v: %v", st.tag.SignatureString(), err)
+				}
+				sigs = append(sigs, sig)
+			}
+		default:
+			return nil, fmt.Errorf("%v: %v entry has type %v", ErrBadHeader, st.tag.SignatureString(), e.Type)
+		}
+
+		for _, sig := range sigs {
+			signed := io.Reader(bytes.NewReader(p.Header.Bytes()))
+			if !st.headerOnly {
+				signed = io.MultiReader(signed, p.RawPayload())
+			}
+			c := verifySignature(kr, sig, signed)
+			c.Tag, c.HeaderOnly = st.tag, st.headerOnly
+			checks = append(checks, c)
+		}
+	}
+
+	if len(checks) == 0 {
+		return nil, ErrNoSignatures
+	}
+	return checks, nil
+}
+
+// The names rpm gives to public key algorithms.
+var pubKeyAlgoNames = map[packet.PublicKeyAlgorithm]string{
+	packet.PubKeyAlgoRSA:         "RSA",
+	packet.PubKeyAlgoRSASignOnly: "RSA",
+	packet.PubKeyAlgoDSA:         "DSA",
+	packet.PubKeyAlgoECDSA:       "ECDSA",
+	packet.PubKeyAlgoEdDSA:       "EdDSA",
+	packet.PubKeyAlgoEd25519:     "Ed25519",
+	packet.PubKeyAlgoEd448:       "Ed448",
+}
+
+func algorithmName(a packet.PublicKeyAlgorithm) string {
+	if name, ok := pubKeyAlgoNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("algorithm %d", a)
+}
+
+/*
+Verifies a single binary OpenPGP signature packet over the data read from
+signed.
+*/
+func verifySignature(kr *Keyring, sig []byte, signed io.Reader) SignatureCheck {
+	if len(sig) > 2 && sigVersion(sig) == 3 {
+		return verifyV3Signature(kr, sig, signed)
+	}
+
+	var c SignatureCheck
+	p, err := packet.Read(bytes.NewReader(sig))
+	if err != nil {
+		c.Err = err
+		return c
+	}
+	s, ok := p.(*packet.Signature)
+	if !ok {
+		c.Err = fmt.Errorf("not a signature packet")
+		return c
+	}
+
+	c.Version, c.Algorithm, c.Hash, c.Created = s.Version, algorithmName(s.PubKeyAlgo), s.Hash, s.CreationTime
+	if s.IssuerKeyId != nil {
+		c.KeyID = *s.IssuerKeyId
+	}
+
+	// Keys are checked as of the time of signing, so that keys which
+	// have expired since still verify the packages they signed.
+	config := &packet.Config{Time: func() time.Time { return s.CreationTime }}
+	_, signer, err := openpgp.VerifyDetachedSignature(kr.entities, signed, bytes.NewReader(sig), config)
+	if err == pgperrors.ErrUnknownIssuer {
+		err = ErrUnknownKey
+	}
+	if err == nil || err == pgperrors.ErrKeyExpired || err == pgperrors.ErrSignatureExpired {
+		c.OK = true
+		c.Signer = primaryIdentity(signer)
+		return c
+	}
+	c.Err = err
+	return c
+}
+
+func primaryIdentity(e *openpgp.Entity) string {
+	if e == nil {
+		return ""
+	}
+	if _, id := e.PrimarySelfSignature(); id != nil {
+		return id.Name
+	}
+	for name := range e.Identities {
+		return name
+	}
+	return ""
+}
+
+/*
+Returns the version of the signature packet in sig, skipping the packet
+header, or 0 if the packet header cannot be read.
+*/
+func sigVersion(sig []byte) int {
+	body, err := packetBody(sig)
+	if err != nil || len(body) == 0 {
+		return 0
+	}
+	return int(body[0])
+}
+
+// packetBody returns the body of the single OpenPGP packet in b.
+func packetBody(b []byte) ([]byte, error) {
+	if len(b) < 2 || b[0]&0x80 == 0 {
+		return nil, fmt.Errorf("bad packet header")
+	}
+
+	var n, hdr int
+	if b[0]&0x40 == 0 {
+		// Old format: the length type is in the low two bits.
+		switch b[0] & 3 {
+		case 0:
+			n, hdr = int(b[1]), 2
+		case 1:
+			if len(b) < 3 {
+				return nil, fmt.Errorf("short packet header")
+			}
+			n, hdr = int(binary.BigEndian.Uint16(b[1:])), 3
+		case 2:
+			if len(b) < 5 {
+				return nil, fmt.Errorf("short packet header")
+			}
+			n, hdr = int(binary.BigEndian.Uint32(b[1:])), 5
+		default:
+			n, hdr = len(b)-1, 1
+		}
+	} else {
+		switch l := int(b[1]); {
+		case l < 192:
+			n, hdr = l, 2
+		case l < 224:
+			if len(b) < 3 {
+				return nil, fmt.Errorf("short packet header")
+			}
+			n, hdr = (l-192)<<8+int(b[2])+192, 3
+		case l == 255:
+			if len(b) < 6 {
+				return nil, fmt.Errorf("short packet header")
+			}
+			n, hdr = int(binary.BigEndian.Uint32(b[2:])), 6
+		default:
+			return nil, fmt.Errorf("partial packet lengths are not supported")
+		}
+	}
+	if n < 0 || hdr+n > len(b) {
+		return nil, fmt.Errorf("packet length %d overruns the signature", n)
+	}
+	return b[hdr : hdr+n], nil
+}
+
+/*
+Verifies a version 3 signature, as made by old versions of rpm and gpg. These
+are no longer supported by OpenPGP libraries, but are simple enough: the
+digest is made over the signed data, followed by the signature type and
+creation time.
+*/
+func verifyV3Signature(kr *Keyring, sig []byte, signed io.Reader) SignatureCheck {
+	c := SignatureCheck{Version: 3}
+	body, err := packetBody(sig)
+	if err != nil {
+		c.Err = err
+		return c
+	}
+	// version, hashed length (5), type, time, key id, algorithms, hash
+	// prefix, MPIs.
+	if len(body) < 19 || body[1] != 5 {
+		c.Err = fmt.Errorf("malformed v3 signature")
+		return c
+	}
+
+	algo := packet.PublicKeyAlgorithm(body[15])
+	hashID := body[16]
+	c.Algorithm = algorithmName(algo)
+	c.KeyID = binary.BigEndian.Uint64(body[7:])
+	c.Created = time.Unix(int64(binary.BigEndian.Uint32(body[3:])), 0)
+	for h, id := range map[crypto.Hash]byte{crypto.MD5: 1, crypto.SHA1: 2, crypto.SHA256: 8, crypto.SHA384: 9, crypto.SHA512: 10, crypto.SHA224: 11} {
+		if id == hashID {
+			c.Hash = h
+		}
+	}
+	if c.Hash == 0 || !c.Hash.Available() {
+		c.Err = fmt.Errorf("unsupported hash algorithm %d", hashID)
+		return c
+	}
+
+	h := c.Hash.New()
+	if _, err := io.Copy(h, signed); err != nil {
+		c.Err = err
+		return c
+	}
+	h.Write(body[2:7])
+	digest := h.Sum(nil)
+	if !bytes.Equal(digest[:2], body[17:19]) {
+		c.Err = fmt.Errorf("digest mismatch")
+		return c
+	}
+
+	mpis, err := readMPIs(body[19:])
+	if err != nil {
+		c.Err = err
+		return c
+	}
+
+	keys := kr.entities.KeysById(c.KeyID)
+	if len(keys) == 0 {
+		c.Err = ErrUnknownKey
+		return c
+	}
+	for _, key := range keys {
+		switch pub := key.PublicKey.PublicKey.(type) {
+		case *rsa.PublicKey:
+			if len(mpis) != 1 {
+				c.Err = fmt.Errorf("malformed RSA signature")
+				return c
+			}
+			if mpis[0].BitLen() > pub.N.BitLen() {
+				err = fmt.Errorf("RSA verification failure")
+				break
+			}
+			s := mpis[0].FillBytes(make([]byte, (pub.N.BitLen()+7)/8))
+			err = rsa.VerifyPKCS1v15(pub, c.Hash, digest, s)
+		case *dsa.PublicKey:
+			if len(mpis) != 2 {
+				c.Err = fmt.Errorf("malformed DSA signature")
+				return c
+			}
+			if n := (pub.Q.BitLen() + 7) / 8; len(digest) > n {
+				digest = digest[:n]
+			}
+			if !dsa.Verify(pub, digest, mpis[0], mpis[1]) {
+				err = fmt.Errorf("DSA verification failure")
+			}
+		default:
+			err = fmt.Errorf("unsupported key type for a v3 signature")
+		}
+		if err == nil {
+			c.OK, c.Signer = true, primaryIdentity(key.Entity)
+			return c
+		}
+	}
+	c.Err = err
+	return c
+}
+
+// readMPIs reads the OpenPGP multiprecision integers making up b.
+func readMPIs(b []byte) ([]*big.Int, error) {
+	var mpis []*big.Int
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, fmt.Errorf("truncated MPI")
+		}
+		n := (int(binary.BigEndian.Uint16(b)) + 7) / 8
+		if len(b) < 2+n {
+			return nil, fmt.Errorf("truncated MPI")
+		}
+		mpis = append(mpis, new(big.Int).SetBytes(b[2:2+n]))
+		b = b[2+n:]
+	}
+	return mpis, nil
+}
@@ -0,0 +1,171 @@
+package rpm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func testBin(tag Tag, b []byte) testEntry {
+	return testEntry{tag, TypeBin, uint32(len(b)), b}
+}
+
+func newTestKey(t *testing.T, algo packet.PublicKeyAlgorithm) *openpgp.Entity {
+	e, err := openpgp.NewEntity("Test Key", "", "test@example.com", &packet.Config{Algorithm: algo, RSABits: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func armoredPublicKey(t *testing.T, e *openpgp.Entity) string {
+	var b bytes.Buffer
+	w, err := armor.Encode(&b, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return b.String()
+}
+
+func detachSign(t *testing.T, e *openpgp.Entity, data []byte) []byte {
+	var b bytes.Buffer
+	if err := openpgp.DetachSign(&b, e, bytes.NewReader(data), &packet.Config{DefaultHash: crypto.SHA256}); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// v3Sign makes an old-style version 3 RSA/SHA256 signature of data.
+func v3Sign(t *testing.T, e *openpgp.Entity, data []byte) []byte {
+	created := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(created[1:], uint32(time.Now().Unix()))
+
+	h := sha256.New()
+	h.Write(data)
+	h.Write(created)
+	digest := h.Sum(nil)
+	s, err := rsa.SignPKCS1v15(nil, e.PrivateKey.PrivateKey.(*rsa.PrivateKey), crypto.SHA256, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	body.Write([]byte{3, 5})
+	body.Write(created)
+	binary.Write(&body, binary.BigEndian, e.PrimaryKey.KeyId)
+	body.Write([]byte{byte(packet.PubKeyAlgoRSA), 8, digest[0], digest[1]})
+	binary.Write(&body, binary.BigEndian, uint16(len(s)*8))
+	body.Write(s)
+
+	sig := []byte{0x89, 0, 0}
+	binary.BigEndian.PutUint16(sig[1:], uint16(body.Len()))
+	return append(sig, body.Bytes()...)
+}
+
+func TestVerifyV3SignatureOversized(t *testing.T) {
+	rsaKey := newTestKey(t, packet.PubKeyAlgoRSA)
+	header := buildHeader(testString(TagName, "go"), testString(TagVersion, "1.1"))
+	payload := []byte("payload")
+
+	// Give the signature an MPI a byte longer than the modulus.
+	v3 := v3Sign(t, rsaKey, append(append([]byte(nil), header...), payload...))
+	mpi := v3[24:]
+	sig := append([]byte(nil), v3[:22]...)
+	sig = binary.BigEndian.AppendUint16(sig, uint16((len(mpi)+1)*8))
+	sig = append(append(sig, 0xff), mpi...)
+	binary.BigEndian.PutUint16(sig[1:], uint16(len(sig)-3))
+
+	pkg, err := ReadPackage(bytes.NewReader(buildPackage(buildHeader(testBin(SigTagPGP, sig)), header, payload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kr, err := ReadKeyring(strings.NewReader(armoredPublicKey(t, rsaKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks, err := pkg.VerifySignatures(kr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 1 || checks[0].OK || checks[0].Err == nil {
+		t.Errorf("oversized signature verified; got %v", checks)
+	}
+}
+
+func TestVerifySignatures(t *testing.T) {
+	rsaKey := newTestKey(t, packet.PubKeyAlgoRSA)
+	edKey := newTestKey(t, packet.PubKeyAlgoEdDSA)
+	otherKey := newTestKey(t, packet.PubKeyAlgoEdDSA)
+
+	header := buildHeader(testString(TagName, "go"), testString(TagVersion, "1.1"))
+	payload := []byte("payload")
+	signed := append(append([]byte(nil), header...), payload...)
+
+	sig := buildHeader(
+		testBin(SigTagRSA, detachSign(t, rsaKey, header)),
+		testBin(SigTagPGP, v3Sign(t, rsaKey, signed)),
+		testBin(SigTagGPG, detachSign(t, edKey, signed)),
+		testBin(SigTagDSA, detachSign(t, otherKey, header)),
+	)
+	pkg, err := ReadPackage(bytes.NewReader(buildPackage(sig, header, payload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kr, err := ReadKeyring(strings.NewReader(armoredPublicKey(t, rsaKey)), strings.NewReader(armoredPublicKey(t, edKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks, err := pkg.VerifySignatures(kr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		fmt.Sprintf("Header V4 RSA/SHA256 Signature, key ID %08x: OK", uint32(rsaKey.PrimaryKey.KeyId)),
+		fmt.Sprintf("Header V4 EdDSA/SHA256 Signature, key ID %08x: BAD (signing key not in keyring)", uint32(otherKey.PrimaryKey.KeyId)),
+		fmt.Sprintf("V3 RSA/SHA256 Signature, key ID %08x: OK", uint32(rsaKey.PrimaryKey.KeyId)),
+		fmt.Sprintf("V4 EdDSA/SHA256 Signature, key ID %08x: OK", uint32(edKey.PrimaryKey.KeyId)),
+	}
+	var got []string
+	for _, c := range checks {
+		got = append(got, c.String())
+	}
+	t.Logf("expecting %q", expected)
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("wrong signature checks; got %q wanted %q", got, expected)
+	}
+	if checks[0].Signer != "Test Key <test@example.com>" {
+		t.Errorf("wrong signer; got %q", checks[0].Signer)
+	}
+
+	// Tampering with the payload breaks the header+payload signatures
+	// only.
+	tampered := buildPackage(sig, header, []byte("PAYLOAD"))
+	pkg, _ = ReadPackage(bytes.NewReader(tampered))
+	checks, _ = pkg.VerifySignatures(kr)
+	for _, c := range checks {
+		if want := c.HeaderOnly && c.Tag == SigTagRSA; c.OK != want {
+			t.Errorf("after tampering with the payload; got %v", c)
+		}
+	}
+
+	pkg, _ = ReadPackage(bytes.NewReader(testPackage))
+	if _, err := pkg.VerifySignatures(kr); err != ErrNoSignatures {
+		t.Errorf("unsigned package; got %v wanted %v", err, ErrNoSignatures)
+	}
+}
@@ -0,0 +1,148 @@
+package spec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The macros used to test build conditionals, as defined in rpm's own macro
+// file. The %bcond family of macros is handled by the expander itself.
+const conditionalMacros = `
+%with()		%{expand:%%{?with_%{1}:1}%%{!?with_%{1}:0}}
+%without()	%{expand:%%{?with_%{1}:0}%%{!?with_%{1}:1}}
+`
+
+// The maximum number of build conditionals BuildConditionalCombinations will
+// enumerate the combinations of.
+const maxConditionalCombinations = 12
+
+/*
+A BuildConditional is a build option declared by a spec file with %bcond,
+%bcond_with or %bcond_without, and tested with "%{with name}".
+
+Default reports whether the option is enabled when neither --with nor
+--without is given, and Enabled whether it was enabled in the evaluation the
+BuildConditional came from. Line is the line of the spec file that declared
+it, and File the file that line is in.
+*/
+type BuildConditional struct {
+	Name    string
+	Default bool
+	Enabled bool
+	File    string
+	Line    int
+}
+
+/*
+Handles the %bcond, %bcond_with and %bcond_without primitives. As with rpm,
+"%bcond_with foo" declares an option that is off unless --with foo is given,
+"%bcond_without foo" one that is on unless --without foo is given, and
+"%bcond foo <expr>" one whose default is the value of the expression.
+*/
+func (e *expander) bcond(kind, args string) error {
+	args, err := e.expand(strings.TrimSpace(args))
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(args)
+	if len(fields) == 0 || kind != "bcond" && len(fields) != 1 {
+		return fmt.Errorf("%%%s requires exactly one option name", kind)
+	}
+	name := fields[0]
+
+	def := kind == "bcond_without"
+	if kind == "bcond" {
+		if len(fields) < 2 {
+			return fmt.Errorf("%%bcond %s requires a default value", name)
+		}
+		v, err := evalExpr(strings.Join(fields[1:], " "))
+		if err != nil {
+			return err
+		}
+		def = v.truth()
+	}
+
+	enabled := def
+	if _, ok := e.lookup("_with_" + name); ok && !def {
+		enabled = true
+	}
+	if _, ok := e.lookup("_without_" + name); ok && def {
+		enabled = false
+	}
+	if enabled {
+		e.macros["with_"+name] = NewMacro("with_"+name, "1", true)
+	}
+
+	if e.onBcond != nil {
+		e.onBcond(name, def)
+	}
+	return nil
+}
+
+func (ev *evaluator) declareConditional(name string, def bool) {
+	for i, c := range ev.spec.Conditionals {
+		if c.Name == name {
+			c.Default, c.File, c.Line = def, ev.file, ev.line
+			ev.spec.Conditionals[i] = c
+			return
+		}
+	}
+	ev.spec.Conditionals = append(ev.spec.Conditionals, BuildConditional{Name: name, Default: def, File: ev.file, Line: ev.line})
+}
+
+/*
+Returns the build conditionals declared by the spec file when it is evaluated
+for the given target. Since declarations may themselves be conditional, the
+list can differ between targets.
+*/
+func (s *SpecFile) BuildConditionals(t Target) ([]BuildConditional, error) {
+	ev, err := s.Evaluate(t)
+	if err != nil {
+		return nil, err
+	}
+	return ev.Conditionals, nil
+}
+
+/*
+Returns a copy of the target for every combination of the build conditionals
+the spec file declares for it, with the With and Without lists filled in; the
+first combination is the one with every option at its default. Each target is
+named after the options it flips, in example "x86_64 --with docs".
+
+The number of combinations doubles with every option, so an error is returned
+for spec files declaring more than 12 of them.
+*/
+func (s *SpecFile) BuildConditionalCombinations(t Target) ([]Target, error) {
+	conds, err := s.BuildConditionals(t)
+	if err != nil {
+		return nil, err
+	}
+	if len(conds) > maxConditionalCombinations {
+		return nil, fmt.Errorf("too many build conditionals (%d) to combine", len(conds))
+	}
+
+	targets := make([]Target, 0, 1<<uint(len(conds)))
+	for mask := 0; mask < 1<<uint(len(conds)); mask++ {
+		c := t
+		c.With = append([]string(nil), t.With...)
+		c.Without = append([]string(nil), t.Without...)
+
+		name := []string{t.String()}
+		for i, cond := range conds {
+			if mask&(1<<uint(i)) == 0 {
+				continue
+			}
+			if cond.Default {
+				c.Without = append(c.Without, cond.Name)
+				name = append(name, "--without "+cond.Name)
+			} else {
+				c.With = append(c.With, cond.Name)
+				name = append(name, "--with "+cond.Name)
+			}
+		}
+		c.Name = strings.Join(name, " ")
+		targets = append(targets, c)
+	}
+	return targets, nil
+}
@@ -0,0 +1,122 @@
+package spec
+
+import (
+	"fmt"
+	"testing"
+)
+
+var bcondSpec = `Name:    flags
+Version: 1
+Release: 1
+Summary: Build conditionals
+
+%bcond_with    docs
+%bcond_without tests
+%bcond         lto %[0%{?rhel} >= 9]
+%if %{with docs}
+%bcond_with    pdf
+%endif
+
+%if %{with docs}
+BuildRequires: sphinx
+%endif
+%if %{with tests}
+BuildRequires: pytest
+%endif
+%if %{without lto}
+BuildRequires: no-lto
+%endif
+%if %{with pdf}
+BuildRequires: latex
+%endif
+`
+
+func TestBuildConditionals(t *testing.T) {
+	s, _ := ParseString(bcondSpec)
+
+	conds, err := s.BuildConditionals(Target{Arch: "x86_64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	econds := []BuildConditional{
+		{Name: "docs", Default: false, Enabled: false, Line: 6},
+		{Name: "tests", Default: true, Enabled: true, Line: 7},
+		{Name: "lto", Default: false, Enabled: false, Line: 8},
+	}
+	if fmt.Sprint(conds) != fmt.Sprint(econds) {
+		t.Errorf("wrong conditionals; got %v wanted %v", conds, econds)
+	}
+
+	el9, _ := NewTarget("x86_64", "rhel-9")
+	el9.With = []string{"docs"}
+	conds, err = s.BuildConditionals(el9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	econds = []BuildConditional{
+		{Name: "docs", Default: false, Enabled: true, Line: 6},
+		{Name: "tests", Default: true, Enabled: true, Line: 7},
+		{Name: "lto", Default: true, Enabled: true, Line: 8},
+		{Name: "pdf", Default: false, Enabled: false, Line: 10},
+	}
+	if fmt.Sprint(conds) != fmt.Sprint(econds) {
+		t.Errorf("wrong conditionals; got %v wanted %v", conds, econds)
+	}
+}
+
+func TestBuildConditionalOverrides(t *testing.T) {
+	s, _ := ParseString(bcondSpec)
+
+	tests := []struct {
+		with, without []string
+		breqs         string
+	}{
+		{nil, nil, "pytest, no-lto"},
+		{[]string{"docs", "lto"}, []string{"tests"}, "sphinx"},
+		{[]string{"docs", "pdf", "tests"}, nil, "sphinx, pytest, no-lto, latex"},
+	}
+
+	for _, tt := range tests {
+		ev, err := s.Evaluate(Target{Arch: "x86_64", With: tt.with, Without: tt.without})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := joinDependencies(ev.BuildRequires); got != tt.breqs {
+			t.Errorf("--with %v --without %v; got %q wanted %q", tt.with, tt.without, got, tt.breqs)
+		}
+	}
+}
+
+func TestBuildConditionalCombinations(t *testing.T) {
+	s, _ := ParseString(bcondSpec)
+
+	targets, err := s.BuildConditionalCombinations(Target{Arch: "x86_64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, t := range targets {
+		names = append(names, t.String())
+	}
+	enames := []string{
+		"x86_64",
+		"x86_64 --with docs",
+		"x86_64 --without tests",
+		"x86_64 --with docs --without tests",
+		"x86_64 --with lto",
+		"x86_64 --with docs --with lto",
+		"x86_64 --without tests --with lto",
+		"x86_64 --with docs --without tests --with lto",
+	}
+	if fmt.Sprintf("%q", names) != fmt.Sprintf("%q", enames) {
+		t.Errorf("wrong combinations; got %q wanted %q", names, enames)
+	}
+
+	m := s.EvaluateMatrix(targets...)
+	for i, err := range m.Errors {
+		if err != nil {
+			t.Errorf("%s: %v", targets[i], err)
+		}
+	}
+}
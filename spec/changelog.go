@@ -0,0 +1,112 @@
+package spec
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+A ChangelogEntry is a single entry of a %changelog section, as it is stored in
+a package's CHANGELOGTIME, CHANGELOGNAME and CHANGELOGTEXT tags.
+
+Name holds the rest of the entry's heading after the date, which is usually
+the author and the version ("Jane Doe <jane@example.com> - 1.0-1"), and Text
+holds the lines below it.
+*/
+type ChangelogEntry struct {
+	Time time.Time
+	Name string
+	Text string
+}
+
+/*
+Returns the entry formatted the way it appears in a spec file.
+*/
+func (c ChangelogEntry) String() string {
+	s := fmt.Sprintf("* %s %s", c.Time.UTC().Format("Mon Jan 02 2006"), c.Name)
+	if c.Text != "" {
+		s += "\n" + c.Text
+	}
+	return s
+}
+
+// The date formats accepted in changelog headings. rpm allows a full
+// timestamp, as printed by date(1), in place of a plain day.
+var changelogDateFormats = []struct {
+	layout string
+	fields int
+}{
+	{"Mon Jan 2 2006", 4},
+	{"Mon Jan 2 15:04:05 MST 2006", 6},
+}
+
+/*
+Parses the contents of a %changelog section (without the section header).
+
+Every entry starts with a line of the form "* <date> <name>", where the date
+is written as "Mon Jan 2 2006". As rpm does, plain dates are taken to be at
+noon UTC. Lines before the first entry are ignored, and trailing blank lines
+are dropped from the text of each entry.
+*/
+func ParseChangelog(s string) ([]ChangelogEntry, error) {
+	var (
+		entries []ChangelogEntry
+		text    []string
+	)
+	flush := func() {
+		if len(entries) == 0 {
+			return
+		}
+		for len(text) > 0 && strings.TrimSpace(text[len(text)-1]) == "" {
+			text = text[:len(text)-1]
+		}
+		entries[len(entries)-1].Text = strings.Join(text, "\n")
+		text = nil
+	}
+
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if !strings.HasPrefix(line, "*") {
+			if len(entries) > 0 {
+				text = append(text, line)
+			}
+			continue
+		}
+
+		flush()
+		entry, err := parseChangelogHeading(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	flush()
+
+	return entries, nil
+}
+
+func parseChangelogHeading(s string) (ChangelogEntry, error) {
+	fields := strings.Fields(s)
+	for _, f := range changelogDateFormats {
+		if len(fields) < f.fields {
+			continue
+		}
+		t, err := time.Parse(f.layout, strings.Join(fields[:f.fields], " "))
+		if err != nil {
+			continue
+		}
+		if f.fields == 4 {
+			t = t.Add(12 * time.Hour)
+		}
+
+		// The name is the rest of the line, with its spacing intact.
+		name := s
+		for i := 0; i < f.fields; i++ {
+			name = strings.TrimLeft(name, " \t")
+			name = name[len(fields[i]):]
+		}
+		return ChangelogEntry{Time: t, Name: strings.TrimSpace(name)}, nil
+	}
+	return ChangelogEntry{}, fmt.Errorf("bad date in %%changelog: %q", s)
+}
@@ -0,0 +1,51 @@
+package spec
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseChangelog(t *testing.T) {
+	entries, err := ParseChangelog(`
+* Mon Jan 08 2024 Jane Doe <jane@example.com> - 2.0-1
+- Update to 2.0
+  - with a nested item
+
+* Thu Dec 07 2023 John Doe <john@example.com> - 1.0-1
+- Initial package
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[{"2024-01-08T12:00:00Z" "Jane Doe <jane@example.com> - 2.0-1" "- Update to 2.0\n  - with a nested item"} {"2023-12-07T12:00:00Z" "John Doe <john@example.com> - 1.0-1" "- Initial package"}]`
+	var got []string
+	for _, e := range entries {
+		got = append(got, fmt.Sprintf("{%q %q %q}", e.Time.Format("2006-01-02T15:04:05Z07:00"), e.Name, e.Text))
+	}
+	t.Logf("expecting %s", expected)
+	if s := fmt.Sprintf("%s", got); s != expected {
+		t.Errorf("failed to parse changelog; got %s wanted %s", s, expected)
+	}
+
+	if _, err := ParseChangelog("* Someday John Doe\n- oops\n"); err == nil {
+		t.Errorf("expected an error for a bad date")
+	}
+}
+
+func TestEvaluateChangelog(t *testing.T) {
+	spec, err := ParseString(testSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := spec.Evaluate(Target{Arch: "x86_64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "* Fri Dec 07 2012 Taylor Goodwill <tgoodwill@synacor.com> - 1.0.3-1_synacor\n- Initial Synacor Build"
+	t.Logf("expecting %q", expected)
+	if len(ev.Changelog) != 1 || ev.Changelog[0].String() != expected {
+		t.Errorf("failed to evaluate %%changelog; got %q wanted %q", ev.Changelog, expected)
+	}
+}
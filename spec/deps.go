@@ -0,0 +1,216 @@
+package spec
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+DependencyFlags holds the sense flags of a dependency. The values are the
+same as rpm's RPMSENSE_* flags, so they can be stored in, and read from, the
+*FLAGS tags of a binary package header unchanged.
+*/
+type DependencyFlags uint32
+
+const (
+	DepAny          DependencyFlags = 0
+	DepLess         DependencyFlags = 1 << 1
+	DepGreater      DependencyFlags = 1 << 2
+	DepEqual        DependencyFlags = 1 << 3
+	DepPostTrans    DependencyFlags = 1 << 5
+	DepPreReq       DependencyFlags = 1 << 6
+	DepPreTrans     DependencyFlags = 1 << 7
+	DepInterp       DependencyFlags = 1 << 8
+	DepScriptPre    DependencyFlags = 1 << 9
+	DepScriptPost   DependencyFlags = 1 << 10
+	DepScriptPreun  DependencyFlags = 1 << 11
+	DepScriptPostun DependencyFlags = 1 << 12
+	DepScriptVerify DependencyFlags = 1 << 13
+	DepFindRequires DependencyFlags = 1 << 14
+	DepFindProvides DependencyFlags = 1 << 15
+	DepMissingOK    DependencyFlags = 1 << 19
+	DepPreunTrans   DependencyFlags = 1 << 20
+	DepPostunTrans  DependencyFlags = 1 << 21
+	DepRPMLib       DependencyFlags = 1 << 24
+	DepConfig       DependencyFlags = 1 << 28
+	DepMeta         DependencyFlags = 1 << 29
+
+	// DepSenseMask selects the comparison bits of a DependencyFlags value.
+	DepSenseMask = DepLess | DepGreater | DepEqual
+)
+
+var depQualifiers = map[string]DependencyFlags{
+	"pre":         DepScriptPre,
+	"post":        DepScriptPost,
+	"preun":       DepScriptPreun,
+	"postun":      DepScriptPostun,
+	"pretrans":    DepPreTrans,
+	"posttrans":   DepPostTrans,
+	"preuntrans":  DepPreunTrans,
+	"postuntrans": DepPostunTrans,
+	"verify":      DepScriptVerify,
+	"interp":      DepInterp,
+	"meta":        DepMeta,
+}
+
+var depOperators = map[string]DependencyFlags{
+	"<":  DepLess,
+	"<=": DepLess | DepEqual,
+	"=<": DepLess | DepEqual,
+	"=":  DepEqual,
+	"==": DepEqual,
+	">=": DepGreater | DepEqual,
+	"=>": DepGreater | DepEqual,
+	">":  DepGreater,
+}
+
+/*
+A Dependency is a single entry of a Requires:, Provides:, Conflicts:,
+Obsoletes: (or any of the weak dependency) tags.
+
+Rich (boolean) dependencies such as "(foo if bar)" are kept verbatim in Name,
+with no flags or version.
+*/
+type Dependency struct {
+	Name    string
+	Flags   DependencyFlags
+	Version string
+}
+
+/*
+Returns the comparison operator of the dependency ("<", "<=", "=", ">=" or
+">"), or a zero-length string for unversioned dependencies.
+*/
+func (d Dependency) Operator() string {
+	switch d.Flags & DepSenseMask {
+	case DepLess:
+		return "<"
+	case DepLess | DepEqual:
+		return "<="
+	case DepEqual:
+		return "="
+	case DepGreater | DepEqual:
+		return ">="
+	case DepGreater:
+		return ">"
+	}
+	return ""
+}
+
+/*
+Returns the dependency formatted the way it would be written in a spec file,
+in example "go = 1.1-1".
+*/
+func (d Dependency) String() string {
+	if op := d.Operator(); op != "" && d.Version != "" {
+		return fmt.Sprintf("%s %s %s", d.Name, op, d.Version)
+	}
+	return d.Name
+}
+
+/*
+Reports whether the version constraint of the dependency is satisfied by the
+given "[epoch:]version[-release]" string. Unversioned dependencies are
+satisfied by any version.
+*/
+func (d Dependency) Matches(evr string) bool {
+	if d.Flags&DepSenseMask == 0 || d.Version == "" {
+		return true
+	}
+
+	c := CompareEVR(evr, d.Version)
+	switch {
+	case c < 0:
+		return d.Flags&DepLess != 0
+	case c > 0:
+		return d.Flags&DepGreater != 0
+	}
+	return d.Flags&DepEqual != 0
+}
+
+/*
+ParseDependencies splits the value of a dependency tag into its individual
+dependencies. As with rpm, the entries may be separated by whitespace and/or
+commas, and each may be followed by a comparison operator and a version.
+*/
+func ParseDependencies(s string) ([]Dependency, error) {
+	toks, err := dependencyTokens(s)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := make([]Dependency, 0, len(toks))
+	for i := 0; i < len(toks); i++ {
+		if _, ok := depOperators[toks[i]]; ok {
+			return nil, fmt.Errorf("dependency %q: operator without a name", s)
+		}
+
+		d := Dependency{Name: toks[i]}
+		if i+1 < len(toks) {
+			if flags, ok := depOperators[toks[i+1]]; ok {
+				if i+2 >= len(toks) {
+					return nil, fmt.Errorf("dependency %q: missing version after %q", s, toks[i+1])
+				}
+				d.Flags, d.Version = flags, toks[i+2]
+				i += 2
+			}
+		}
+
+		deps = append(deps, d)
+	}
+
+	return deps, nil
+}
+
+/*
+Parses the qualifier list from a tag such as "Requires(pre,post):" and returns
+the corresponding flags.
+*/
+func parseDependencyQualifiers(s string) (DependencyFlags, error) {
+	var flags DependencyFlags
+	for _, q := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		f, ok := depQualifiers[strings.ToLower(q)]
+		if !ok {
+			return 0, fmt.Errorf("unknown dependency qualifier %q", q)
+		}
+		flags |= f
+	}
+	return flags, nil
+}
+
+// dependencyTokens splits a dependency list on whitespace and commas, keeping
+// parenthesised rich dependencies together.
+func dependencyTokens(s string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == ',':
+			i++
+		case c == '(':
+			depth, j := 0, i
+			for ; j < len(s); j++ {
+				if s[j] == '(' {
+					depth++
+				} else if s[j] == ')' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if j == len(s) {
+				return nil, fmt.Errorf("dependency %q: unbalanced parentheses", s)
+			}
+			toks = append(toks, s[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(s) && s[j] != ' ' && s[j] != '\t' && s[j] != ',' {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		}
+	}
+	return toks, nil
+}
@@ -0,0 +1,47 @@
+package spec
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseDependencies(t *testing.T) {
+	edeps := []Dependency{
+		{Name: "foo"},
+		{Name: "bar", Flags: DepGreater | DepEqual, Version: "1.2"},
+		{Name: "libc.so.6()(64bit)"},
+		{Name: "(baz if qux)"},
+		{Name: "quux", Flags: DepEqual, Version: "1:2.0-1"},
+	}
+	t.Logf("expecting %v", edeps)
+
+	pdeps, err := ParseDependencies("foo, bar >= 1.2 libc.so.6()(64bit),(baz if qux) quux = 1:2.0-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(pdeps) != fmt.Sprint(edeps) {
+		t.Errorf("wrong dependencies; got %v wanted %v", pdeps, edeps)
+	}
+
+	for _, bad := range []string{">= 1.0", "foo >=", "(foo if bar"} {
+		if _, err := ParseDependencies(bad); err == nil {
+			t.Errorf("expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestDependencyString(t *testing.T) {
+	d := Dependency{Name: "go", Flags: DepEqual | DepScriptPost, Version: "1.1-1"}
+	if d.String() != "go = 1.1-1" {
+		t.Errorf("got %q wanted %q", d.String(), "go = 1.1-1")
+	}
+}
+
+func TestDependencyMatches(t *testing.T) {
+	d := Dependency{Name: "go", Flags: DepGreater | DepEqual, Version: "1.1"}
+	for evr, want := range map[string]bool{"1.0-1": false, "1.1-1": true, "1.2": true, "1:0.1": true} {
+		if got := d.Matches(evr); got != want {
+			t.Errorf("%v matches %q; got %v wanted %v", d, evr, got, want)
+		}
+	}
+}
@@ -0,0 +1,961 @@
+package spec
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	reTag     = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9]*)\s*(?:\(([^)]*)\))?\s*:\s*(.*?)\s*$`)
+	reSrcTag  = regexp.MustCompile(`^(?i:(source|patch))(\d*)$`)
+	reSection = regexp.MustCompile(`^%([a-z_]+)(?:\s+(.*?))?\s*$`)
+)
+
+// The sections of a spec file, as introduced by "%<name>" lines.
+var sections = map[string]bool{
+	"package": true, "description": true, "prep": true, "conf": true,
+	"build": true, "install": true, "check": true, "clean": true,
+	"files": true, "changelog": true, "pre": true, "post": true,
+	"preun": true, "postun": true, "pretrans": true, "posttrans": true,
+	"preuntrans": true, "postuntrans": true, "verifyscript": true,
+	"triggerprein": true, "triggerin": true, "triggerun": true,
+	"triggerpostun": true, "filetriggerin": true, "filetriggerun": true,
+	"filetriggerpostun": true, "transfiletriggerin": true,
+	"transfiletriggerun": true, "transfiletriggerpostun": true,
+	"sourcelist": true, "patchlist": true, "generate_buildrequires": true,
+	"end": true,
+}
+
+/*
+A Target describes the platform a spec file is evaluated for.
+
+Arch is the target architecture (in example "x86_64"), and OS the target
+operating system, which defaults to "linux". Any macros in Macros are defined
+before the spec file is evaluated, and can be used to describe a distribution
+release (in example "%fedora" and "%dist").
+
+With and Without list the build conditionals to enable or disable, as with
+rpmbuild's --with and --without options.
+*/
+type Target struct {
+	Name   string
+	Arch   string
+	OS     string
+	Macros MacroSet
+
+	With    []string
+	Without []string
+}
+
+/*
+Returns the name of the target, falling back to its architecture when no name
+was set.
+*/
+func (t Target) String() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Arch
+}
+
+func (t Target) os() string {
+	if t.OS == "" {
+		return "linux"
+	}
+	return t.OS
+}
+
+/*
+Returns the macros that are defined before any spec file is evaluated for the
+target.
+*/
+func (t Target) macros() MacroSet {
+	ms := parseMacroFile([]byte(conditionalMacros))
+	for name, value := range map[string]string{
+		"nil":           "",
+		"_arch":         t.Arch,
+		"_target_cpu":   t.Arch,
+		"_target_arch":  t.Arch,
+		"_os":           t.os(),
+		"_target_os":    t.os(),
+		"_topdir":       "/builddir/build",
+		"_sourcedir":    "%{_topdir}/SOURCES",
+		"_builddir":     "%{_topdir}/BUILD",
+		"_buildrootdir": "%{_topdir}/BUILDROOT",
+		"buildroot":     "%{_buildrootdir}/%{name}-%{version}-%{release}.%{_arch}",
+	} {
+		ms[name] = NewMacro(name, value, false)
+	}
+	ms.Update(t.Macros)
+
+	for _, name := range t.With {
+		ms["_with_"+name] = NewMacro("_with_"+name, "--with-"+name, false)
+	}
+	for _, name := range t.Without {
+		ms["_without_"+name] = NewMacro("_without_"+name, "--without-"+name, false)
+	}
+	return ms
+}
+
+/*
+A Package holds the metadata of one of the (sub)packages built from a spec
+file, after evaluation for a particular Target.
+*/
+type Package struct {
+	Name         string
+	Epoch        string
+	Version      string
+	Release      string
+	Summary      string
+	Description  string
+	License      string
+	Group        string
+	URL          string
+	Vendor       string
+	Packager     string
+	Distribution string
+
+	// BuildArch is the value of the BuildArch: tag (in example "noarch"),
+	// and Arch the architecture the package is built for.
+	BuildArch string
+	Arch      string
+
+	Requires    []Dependency
+	Provides    []Dependency
+	Conflicts   []Dependency
+	Obsoletes   []Dependency
+	Recommends  []Dependency
+	Suggests    []Dependency
+	Supplements []Dependency
+	Enhances    []Dependency
+
+	// NoAutoReq and NoAutoProv turn off the dependencies rpmbuild
+	// generates from the files of the package, as set with "AutoReq: no",
+	// "AutoProv: no" or "AutoReqProv: no".
+	NoAutoReq  bool
+	NoAutoProv bool
+
+	// Files holds the entries of the package's %files section, and
+	// FileLists the files named with "%files -f", which are generated
+	// during the build. Files is nil for packages without a %files
+	// section, which rpmbuild does not build.
+	Files     []FileEntry
+	FileLists []string
+
+	// Scriptlets are keyed by the name of their section ("pre", "post",
+	// "preun" and so on).
+	Scriptlets map[string]Scriptlet
+}
+
+/*
+Returns the full "[epoch:]version-release" string of the package.
+*/
+func (p *Package) EVR() string {
+	evr := p.Version + "-" + p.Release
+	if p.Epoch != "" {
+		evr = p.Epoch + ":" + evr
+	}
+	return evr
+}
+
+/*
+A Line is a line of a spec file after evaluation, along with the file and the
+number of the line it came from. File is the name the spec file was parsed
+under (see ParseFS), or the name of the %include'd file the line came from.
+*/
+type Line struct {
+	File   string
+	Number int
+	Text   string
+}
+
+/*
+An EvaluatedSpec holds the result of evaluating a spec file for a Target: all
+conditionals have been resolved and all macros expanded.
+
+The first element of Packages is always the main package.
+*/
+type EvaluatedSpec struct {
+	Target         Target
+	Packages       []*Package
+	BuildRequires  []Dependency
+	BuildConflicts []Dependency
+	Sources        map[string]string
+	Patches        map[string]string
+	ExclusiveArch  []string
+	ExcludeArch    []string
+	ExclusiveOS    []string
+	ExcludeOS      []string
+
+	// NoSource and NoPatch hold the numbers of the sources and patches
+	// left out of the source package, as given by the NoSource: and
+	// NoPatch: tags.
+	NoSource []string
+	NoPatch  []string
+
+	// Conditionals lists the build conditionals declared by the spec file,
+	// in the order they were declared.
+	Conditionals []BuildConditional
+
+	// Macros holds the macros defined at the end of the evaluation, and
+	// Lines the evaluated spec file, without any conditionals or macro
+	// definitions.
+	Macros MacroSet
+	Lines  []Line
+
+	// Changelog holds the entries of the %changelog section, newest
+	// first.
+	Changelog []ChangelogEntry
+
+	// IncludedFiles lists every file pulled in with %include or
+	// %{load:...} during the evaluation, in the order they were first
+	// read.
+	IncludedFiles []string
+}
+
+/*
+Returns the package named name, or nil if the spec file does not build such a
+package.
+*/
+func (e *EvaluatedSpec) Package(name string) *Package {
+	for _, p := range e.Packages {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+/*
+Reports whether the spec file can be built for the target, according to its
+ExclusiveArch:, ExcludeArch:, ExclusiveOS: and ExcludeOS: tags.
+*/
+func (e *EvaluatedSpec) ArchSupported() bool {
+	arch, os := e.Target.Arch, e.Target.os()
+	if len(e.ExclusiveArch) > 0 && !containsString(e.ExclusiveArch, arch) {
+		// Packages which are entirely noarch may list "noarch" in
+		// ExclusiveArch, to mean "any architecture".
+		if !containsString(e.ExclusiveArch, "noarch") || e.Packages[0].Arch != "noarch" {
+			return false
+		}
+	}
+	if containsString(e.ExcludeArch, arch) {
+		return false
+	}
+	if len(e.ExclusiveOS) > 0 && !containsString(e.ExclusiveOS, os) {
+		return false
+	}
+	return !containsString(e.ExcludeOS, os)
+}
+
+/*
+A SyntaxError is returned when a spec file cannot be evaluated. File and Line
+locate the offending line, which may be in an %include'd file.
+*/
+type SyntaxError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *SyntaxError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+/*
+Evaluates the spec file for the given target, the way rpmbuild would parse it:
+conditionals (%if, %ifarch, %ifos and friends) are resolved, macros are
+defined and expanded as they are encountered, and the preamble of every
+package is collected.
+*/
+func (s *SpecFile) Evaluate(t Target) (*EvaluatedSpec, error) {
+	ev := newEvaluator(t)
+	ev.fsys = s.fsys
+	if s.name != "" {
+		ev.includes = []string{s.name}
+	}
+	if err := ev.run(s.name, string(s.raw)); err != nil {
+		return nil, err
+	}
+	ev.endSection()
+
+	if ev.changelog != nil {
+		entries, err := ParseChangelog(strings.Join(ev.changelog, "\n"))
+		if err != nil {
+			return nil, &SyntaxError{File: ev.changelogPos.File, Line: ev.changelogPos.Line, Err: err}
+		}
+		ev.spec.Changelog = entries
+	}
+	return ev.finish(), nil
+}
+
+// The state of one level of %if nesting.
+type condState struct {
+	active  bool // the current branch is being evaluated
+	taken   bool // one of the branches has already been taken
+	parent  bool // the enclosing block is active
+	sawElse bool
+	file    string
+	line    int
+}
+
+type evaluator struct {
+	spec *EvaluatedSpec
+	exp  *expander
+
+	conds   []condState
+	section string
+	pkg     *Package
+	desc    []string
+
+	// The lines of the %changelog section, and where it starts.
+	changelog    []string
+	changelogPos Position
+
+	// The parser of the current %files section, and the lines and
+	// interpreter of the current scriptlet.
+	files  *filesParser
+	script []string
+	prog   []string
+
+	// The file and line being evaluated, the file system includes are
+	// read from, and the stack of files being included.
+	file     string
+	line     int
+	fsys     fs.FS
+	includes []string
+}
+
+func newEvaluator(t Target) *evaluator {
+	main := &Package{}
+	ms := t.macros()
+	ev := &evaluator{
+		spec: &EvaluatedSpec{
+			Target:   t,
+			Packages: []*Package{main},
+			Sources:  make(map[string]string),
+			Patches:  make(map[string]string),
+			Macros:   ms,
+		},
+		exp:     newExpander(ms),
+		section: "package",
+		pkg:     main,
+	}
+	ev.exp.onBcond = ev.declareConditional
+	ev.exp.onLoad = ev.load
+	return ev
+}
+
+func (ev *evaluator) active() bool {
+	return len(ev.conds) == 0 || ev.conds[len(ev.conds)-1].active
+}
+
+func (ev *evaluator) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{File: ev.file, Line: ev.line, Err: fmt.Errorf(format, args...)}
+}
+
+/*
+Evaluates the contents of a spec file (or of a file it includes). Conditionals
+have to be closed in the same file they were opened in.
+*/
+func (ev *evaluator) run(name, data string) error {
+	file, line, nconds := ev.file, ev.line, len(ev.conds)
+	ev.file = name
+	defer func() { ev.file, ev.line = file, line }()
+
+	lines := strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	for i := 0; i < len(lines); i++ {
+		ev.line = i + 1
+		text := lines[i]
+
+		// Macro definitions may continue over several lines.
+		if trimmed := strings.TrimSpace(text); strings.HasPrefix(trimmed, "%define") || strings.HasPrefix(trimmed, "%global") {
+			for strings.HasSuffix(text, "\\") && i+1 < len(lines) {
+				i++
+				text += "\n" + lines[i]
+			}
+		}
+
+		if err := ev.processLine(text); err != nil {
+			if _, ok := err.(*SyntaxError); ok {
+				return err
+			}
+			return &SyntaxError{File: ev.file, Line: ev.line, Err: err}
+		}
+	}
+
+	if len(ev.conds) > nconds {
+		ev.line = ev.conds[len(ev.conds)-1].line
+		return ev.errorf("unclosed %%if")
+	}
+	return nil
+}
+
+func (ev *evaluator) processLine(text string) error {
+	if handled, err := ev.conditional(text); handled || err != nil {
+		return err
+	}
+	if !ev.active() {
+		return nil
+	}
+
+	expanded, err := ev.exp.expand(text)
+	if err != nil {
+		return err
+	}
+
+	// A line which only held macro definitions expands to nothing at all,
+	// and is dropped from the output.
+	if expanded == "" && text != "" {
+		return nil
+	}
+
+	for _, l := range strings.Split(expanded, "\n") {
+		if trimmed := strings.TrimSpace(l); strings.HasPrefix(trimmed, "%include") {
+			if err := ev.include(strings.TrimSpace(trimmed[len("%include"):])); err != nil {
+				return err
+			}
+			continue
+		}
+
+		ev.spec.Lines = append(ev.spec.Lines, Line{File: ev.file, Number: ev.line, Text: l})
+		if err := ev.content(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Handles the conditional directives. It returns true if text was one, whether
+or not it was in an active block.
+*/
+func (ev *evaluator) conditional(text string) (bool, error) {
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "%if") && !strings.HasPrefix(trimmed, "%el") && !strings.HasPrefix(trimmed, "%endif") {
+		return false, nil
+	}
+
+	word, rest := trimmed, ""
+	if i := strings.IndexAny(trimmed, " \t"); i >= 0 {
+		word, rest = trimmed[:i], strings.TrimSpace(trimmed[i:])
+	}
+
+	switch word {
+	case "%if", "%ifarch", "%ifnarch", "%ifos", "%ifnos":
+		parent := ev.active()
+		cond := condState{parent: parent, file: ev.file, line: ev.line}
+		if parent {
+			ok, err := ev.test(word[3:], rest)
+			if err != nil {
+				return true, err
+			}
+			cond.active, cond.taken = ok, ok
+		}
+		ev.conds = append(ev.conds, cond)
+
+	case "%elif", "%elseif", "%elifarch", "%elifnarch", "%elifos", "%elifnos":
+		if len(ev.conds) == 0 || ev.conds[len(ev.conds)-1].file != ev.file {
+			return true, ev.errorf("%s without %%if", word)
+		}
+		cond := &ev.conds[len(ev.conds)-1]
+		if cond.sawElse {
+			return true, ev.errorf("%s after %%else", word)
+		}
+		cond.active = false
+		if cond.parent && !cond.taken {
+			kind := strings.TrimPrefix(strings.TrimPrefix(word, "%elseif"), "%elif")
+			ok, err := ev.test(kind, rest)
+			if err != nil {
+				return true, err
+			}
+			cond.active, cond.taken = ok, ok
+		}
+
+	case "%else":
+		if len(ev.conds) == 0 || ev.conds[len(ev.conds)-1].file != ev.file {
+			return true, ev.errorf("%%else without %%if")
+		}
+		cond := &ev.conds[len(ev.conds)-1]
+		if cond.sawElse {
+			return true, ev.errorf("more than one %%else")
+		}
+		cond.sawElse = true
+		cond.active = cond.parent && !cond.taken
+		cond.taken = true
+
+	case "%endif":
+		if len(ev.conds) == 0 || ev.conds[len(ev.conds)-1].file != ev.file {
+			return true, ev.errorf("%%endif without %%if")
+		}
+		ev.conds = ev.conds[:len(ev.conds)-1]
+
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+/*
+Evaluates the condition of an %if-style directive. Kind is what followed "%if"
+or "%elif" in the directive: "" for expressions, or "arch", "narch", "os" and
+"nos".
+*/
+func (ev *evaluator) test(kind, rest string) (bool, error) {
+	expanded, err := ev.exp.expand(rest)
+	if err != nil {
+		return false, err
+	}
+
+	if kind == "" {
+		v, err := evalExpr(expanded)
+		if err != nil {
+			return false, err
+		}
+		return v.truth(), nil
+	}
+
+	want := ev.spec.Target.Arch
+	if kind == "os" || kind == "nos" {
+		want = ev.spec.Target.os()
+	}
+	found := containsString(splitList(expanded), want)
+	if strings.HasPrefix(kind, "n") {
+		return !found, nil
+	}
+	return found, nil
+}
+
+/*
+Handles a line of evaluated spec file content, according to the section it
+appears in.
+*/
+func (ev *evaluator) content(l string) error {
+	if m := reSection.FindStringSubmatch(strings.TrimRight(l, " \t")); m != nil && sections[m[1]] {
+		return ev.startSection(m[1], m[2])
+	}
+
+	switch ev.section {
+	case "package":
+		return ev.tag(l)
+	case "description":
+		ev.desc = append(ev.desc, l)
+	case "changelog":
+		ev.changelog = append(ev.changelog, l)
+	case "files":
+		entries, err := ev.files.parseLine(l)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			e.Pos = Position{File: ev.file, Line: ev.line}
+			ev.pkg.Files = append(ev.pkg.Files, e)
+		}
+	case "pre", "post", "preun", "postun", "pretrans", "posttrans", "preuntrans", "postuntrans", "verifyscript":
+		ev.script = append(ev.script, l)
+	case "sourcelist", "patchlist":
+		if v := strings.TrimSpace(l); v != "" && !strings.HasPrefix(v, "#") {
+			kind := "source"
+			if ev.section == "patchlist" {
+				kind = "patch"
+			}
+			ev.addSource(kind, "", v)
+		}
+	}
+	return nil
+}
+
+func (ev *evaluator) startSection(name, args string) error {
+	ev.endSection()
+	ev.section = name
+
+	switch name {
+	case "package":
+		pkgname, err := ev.packageName(args, true)
+		if err != nil {
+			return err
+		}
+		if ev.spec.Package(pkgname) != nil {
+			return ev.errorf("package %s already exists", pkgname)
+		}
+		ev.pkg = &Package{Name: pkgname}
+		ev.spec.Packages = append(ev.spec.Packages, ev.pkg)
+
+	case "description":
+		if err := ev.sectionPackage(name, args); err != nil {
+			return err
+		}
+		ev.desc = nil
+
+	case "changelog":
+		ev.changelog = []string{}
+		ev.changelogPos = Position{File: ev.file, Line: ev.line}
+
+	case "files":
+		if err := ev.sectionPackage(name, args); err != nil {
+			return err
+		}
+		if ev.pkg.Files == nil {
+			ev.pkg.Files = []FileEntry{}
+		}
+		fields := strings.Fields(args)
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] == "-f" {
+				ev.pkg.FileLists = append(ev.pkg.FileLists, fields[i+1])
+			}
+		}
+		ev.files = newFilesParser(ev.pkg.Name, ev.dir("_docdir", "/usr/share/doc"), ev.dir("_defaultlicensedir", "/usr/share/licenses"))
+
+	case "pre", "post", "preun", "postun", "pretrans", "posttrans", "preuntrans", "postuntrans", "verifyscript":
+		if err := ev.sectionPackage(name, args); err != nil {
+			return err
+		}
+		if _, ok := ev.pkg.Scriptlets[name]; ok {
+			return ev.errorf("second %%%s for package %s", name, ev.pkg.Name)
+		}
+		ev.script, ev.prog = []string{}, nil
+		fields := strings.Fields(args)
+		for i, f := range fields {
+			if f == "-p" {
+				if i+1 >= len(fields) {
+					return ev.errorf("-p requires a program")
+				}
+				ev.prog = []string{fields[i+1]}
+			}
+		}
+	}
+	return nil
+}
+
+// sectionPackage makes the package a section header refers to the current
+// package.
+func (ev *evaluator) sectionPackage(section, args string) error {
+	pkgname, err := ev.packageName(args, false)
+	if err != nil {
+		return err
+	}
+	if ev.pkg = ev.spec.Package(pkgname); ev.pkg == nil {
+		return ev.errorf("%%%s for nonexistent package %s", section, pkgname)
+	}
+	return nil
+}
+
+// dir returns the expansion of a directory macro, or def if it is not
+// defined.
+func (ev *evaluator) dir(macro, def string) string {
+	if v, err := ev.exp.expand("%{?" + macro + "}"); err == nil && v != "" {
+		return v
+	}
+	return def
+}
+
+func (ev *evaluator) endSection() {
+	if ev.section == "description" && ev.pkg != nil {
+		for len(ev.desc) > 0 && strings.TrimSpace(ev.desc[len(ev.desc)-1]) == "" {
+			ev.desc = ev.desc[:len(ev.desc)-1]
+		}
+		ev.pkg.Description = strings.Join(ev.desc, "\n")
+		ev.desc = nil
+	}
+
+	if ev.script != nil {
+		for len(ev.script) > 0 && strings.TrimSpace(ev.script[len(ev.script)-1]) == "" {
+			ev.script = ev.script[:len(ev.script)-1]
+		}
+		if ev.pkg.Scriptlets == nil {
+			ev.pkg.Scriptlets = make(map[string]Scriptlet)
+		}
+		ev.pkg.Scriptlets[ev.section] = Scriptlet{Program: ev.prog, Body: strings.Join(ev.script, "\n")}
+		ev.script, ev.prog = nil, nil
+	}
+}
+
+/*
+Works out the name of the package a section header refers to, from its
+arguments: "-n name" gives the full name of the package, and a plain "name"
+is appended to the name of the main package. Options other than -n are
+skipped.
+*/
+func (ev *evaluator) packageName(args string, required bool) (string, error) {
+	main := ev.spec.Packages[0].Name
+	fields := strings.Fields(args)
+	for i := 0; i < len(fields); i++ {
+		switch f := fields[i]; {
+		case f == "-n":
+			if i+1 >= len(fields) {
+				return "", ev.errorf("-n requires a package name")
+			}
+			return fields[i+1], nil
+		case f == "-l" || f == "-f" || f == "-p":
+			// Options taking an argument, which does not name the
+			// package.
+			i++
+		case strings.HasPrefix(f, "-"):
+		default:
+			return main + "-" + f, nil
+		}
+	}
+
+	if required {
+		return "", ev.errorf("%%package requires a name")
+	}
+	return main, nil
+}
+
+func (ev *evaluator) tag(l string) error {
+	trimmed := strings.TrimSpace(l)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return nil
+	}
+
+	m := reTag.FindStringSubmatch(trimmed)
+	if m == nil {
+		return nil
+	}
+	name, qual, value := strings.ToLower(m[1]), m[2], m[3]
+	isMain := ev.pkg == ev.spec.Packages[0]
+
+	if sm := reSrcTag.FindStringSubmatch(name); sm != nil {
+		ev.addSource(strings.ToLower(sm[1]), sm[2], value)
+		return nil
+	}
+
+	var err error
+	p := ev.pkg
+	switch name {
+	case "name":
+		if isMain {
+			p.Name = value
+			ev.exp.macros["name"] = NewMacro("name", value, false)
+		}
+	case "version", "release", "epoch":
+		if !isMain {
+			break
+		}
+		switch name {
+		case "version":
+			p.Version = value
+		case "release":
+			p.Release = value
+		case "epoch":
+			p.Epoch = value
+		}
+		ev.exp.macros[name] = NewMacro(name, value, false)
+	case "summary":
+		p.Summary = value
+	case "license", "copyright":
+		p.License = value
+	case "group":
+		p.Group = value
+	case "url":
+		p.URL = value
+	case "vendor":
+		p.Vendor = value
+	case "packager":
+		p.Packager = value
+	case "distribution":
+		p.Distribution = value
+	case "buildarch", "buildarchitectures", "buildarchs":
+		p.BuildArch = value
+	case "exclusivearch":
+		ev.spec.ExclusiveArch = append(ev.spec.ExclusiveArch, splitList(value)...)
+	case "excludearch":
+		ev.spec.ExcludeArch = append(ev.spec.ExcludeArch, splitList(value)...)
+	case "exclusiveos":
+		ev.spec.ExclusiveOS = append(ev.spec.ExclusiveOS, splitList(value)...)
+	case "excludeos":
+		ev.spec.ExcludeOS = append(ev.spec.ExcludeOS, splitList(value)...)
+	case "nosource", "nopatch":
+		nums := splitList(value)
+		for _, n := range nums {
+			if _, err := strconv.ParseUint(n, 10, 32); err != nil {
+				return fmt.Errorf("bad %s number %q", name, n)
+			}
+		}
+		if name == "nosource" {
+			ev.spec.NoSource = append(ev.spec.NoSource, nums...)
+		} else {
+			ev.spec.NoPatch = append(ev.spec.NoPatch, nums...)
+		}
+	case "autoreq", "autoprov", "autoreqprov":
+		off := false
+		switch strings.ToLower(value) {
+		case "0", "n", "no", "f", "false", "off":
+			off = true
+		case "1", "y", "yes", "t", "true", "on":
+		default:
+			return fmt.Errorf("bad %s value %q", name, value)
+		}
+		if name != "autoprov" {
+			p.NoAutoReq = off
+		}
+		if name != "autoreq" {
+			p.NoAutoProv = off
+		}
+	case "buildrequires", "buildprereq":
+		err = ev.deps(&ev.spec.BuildRequires, qual, value)
+	case "buildconflicts":
+		err = ev.deps(&ev.spec.BuildConflicts, qual, value)
+	case "requires", "prereq":
+		err = ev.deps(&p.Requires, qual, value)
+	case "provides":
+		err = ev.deps(&p.Provides, qual, value)
+	case "conflicts":
+		err = ev.deps(&p.Conflicts, qual, value)
+	case "obsoletes":
+		err = ev.deps(&p.Obsoletes, qual, value)
+	case "recommends":
+		err = ev.deps(&p.Recommends, qual, value)
+	case "suggests":
+		err = ev.deps(&p.Suggests, qual, value)
+	case "supplements":
+		err = ev.deps(&p.Supplements, qual, value)
+	case "enhances":
+		err = ev.deps(&p.Enhances, qual, value)
+	}
+	return err
+}
+
+func (ev *evaluator) deps(dst *[]Dependency, qual, value string) error {
+	flags, err := parseDependencyQualifiers(qual)
+	if err != nil {
+		return err
+	}
+	deps, err := ParseDependencies(value)
+	if err != nil {
+		return err
+	}
+	for _, d := range deps {
+		d.Flags |= flags
+		*dst = append(*dst, d)
+	}
+	return nil
+}
+
+/*
+Records a Source or Patch tag, numbering it after the last one when no number
+is given (as in %sourcelist sections), and defines the matching %{SOURCEn} or
+%{PATCHn} macro.
+*/
+func (ev *evaluator) addSource(kind, num, value string) {
+	dst, prefix := ev.spec.Sources, "SOURCE"
+	if kind == "patch" {
+		dst, prefix = ev.spec.Patches, "PATCH"
+	}
+
+	if num == "" {
+		if ev.section == "package" {
+			num = "0"
+		} else {
+			next := 0
+			for k := range dst {
+				if n, err := strconv.Atoi(k); err == nil && n >= next {
+					next = n + 1
+				}
+			}
+			num = strconv.Itoa(next)
+		}
+	}
+	dst[num] = value
+
+	ref := "%{_sourcedir}/" + SourceFileName(value)
+	ev.exp.macros[prefix+num] = NewMacro(prefix+num, ref, false)
+	if num == "0" {
+		ev.exp.macros[prefix] = NewMacro(prefix, ref, false)
+	}
+}
+
+/*
+Returns the name of the file a Source or Patch tag refers to in the SOURCE
+directory: the last element of its path or URL.
+*/
+func SourceFileName(value string) string {
+	if i := strings.LastIndexAny(value, "/#="); i >= 0 {
+		return value[i+1:]
+	}
+	return value
+}
+
+/*
+Fills in the fields subpackages inherit from the main package, and returns the
+evaluated spec.
+*/
+func (ev *evaluator) finish() *EvaluatedSpec {
+	main := ev.spec.Packages[0]
+	for _, p := range ev.spec.Packages {
+		if p != main {
+			p.Epoch, p.Version, p.Release = main.Epoch, main.Version, main.Release
+			inherit(&p.License, main.License)
+			inherit(&p.Group, main.Group)
+			inherit(&p.URL, main.URL)
+			inherit(&p.Vendor, main.Vendor)
+			inherit(&p.Packager, main.Packager)
+			inherit(&p.Distribution, main.Distribution)
+			inherit(&p.BuildArch, main.BuildArch)
+		}
+
+		p.Arch = ev.spec.Target.Arch
+		if p.BuildArch != "" {
+			p.Arch = p.BuildArch
+		}
+	}
+
+	for i, c := range ev.spec.Conditionals {
+		_, ev.spec.Conditionals[i].Enabled = ev.exp.macros["with_"+c.Name]
+	}
+	return ev.spec
+}
+
+func inherit(dst *string, value string) {
+	if *dst == "" {
+		*dst = value
+	}
+}
+
+// splitList splits a whitespace and/or comma separated list.
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+func containsString(list []string, s string) bool {
+	for _, i := range list {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Returns the numbers of the Source or Patch tags of an evaluated spec file, the
+keys of its Sources or Patches, in numerical order. Keys which are not numbers
+are ordered as strings.
+*/
+func SourceNumbers(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, erra := strconv.Atoi(keys[i])
+		b, errb := strconv.Atoi(keys[j])
+		if erra == nil && errb == nil {
+			return a < b
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,313 @@
+package spec
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var condSpec = `%global srcname demo
+%if 0%{?fedora} >= 39
+%global with_docs 1
+%else
+%global with_docs 0
+%endif
+
+Name:           %{srcname}
+Version:        2.0
+Release:        3%{?dist}
+Epoch:          1
+Summary:        A demonstration package
+License:        MIT
+Source0:        https://example.com/%{name}-%{version}.tar.gz
+Source1:        %{name}.conf
+Patch0:         %{name}-fix.patch
+NoSource:       0
+ExclusiveArch:  x86_64 aarch64 ppc64le
+BuildRequires:  gcc, make
+%ifarch x86_64
+BuildRequires:  nasm >= 2.15
+%elifarch aarch64
+BuildRequires:  arm-helper
+%endif
+Requires(post): systemd
+
+%description
+Demo for %{_arch}.
+
+%package        devel
+Summary:        Headers for %{name}
+Requires:       %{name}%{?_isa} = %{epoch}:%{version}-%{release}
+
+%description devel
+Development files.
+
+%if %{with_docs}
+%package -n     %{srcname}-doc
+Summary:        Documentation
+BuildArch:      noarch
+
+%description -n %{srcname}-doc
+Docs.
+%endif
+
+%prep
+%autosetup
+
+%build
+make %{?_smp_mflags}
+
+%files
+%{_bindir}/demo
+`
+
+func TestEvaluate(t *testing.T) {
+	s, _ := ParseString(condSpec)
+	ev, err := s.Evaluate(Target{Arch: "x86_64", Macros: MacroSet{
+		"fedora": NewMacro("fedora", "40", false),
+		"dist":   NewMacro("dist", ".fc40", false),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, p := range ev.Packages {
+		names = append(names, p.Name)
+	}
+	if fmt.Sprint(names) != "[demo demo-devel demo-doc]" {
+		t.Errorf("wrong packages; got %q", names)
+	}
+
+	main := ev.Packages[0]
+	if main.EVR() != "1:2.0-3.fc40" {
+		t.Errorf("wrong EVR; got %q wanted %q", main.EVR(), "1:2.0-3.fc40")
+	}
+	if main.Description != "Demo for x86_64." {
+		t.Errorf("wrong description; got %q", main.Description)
+	}
+	if len(main.Requires) != 1 || main.Requires[0].Flags&DepScriptPost == 0 {
+		t.Errorf("wrong requires; got %v", main.Requires)
+	}
+
+	devel := ev.Package("demo-devel")
+	if devel == nil {
+		t.Fatal("demo-devel was not found")
+	}
+	if got := joinDependencies(devel.Requires); got != "demo = 1:2.0-3.fc40" {
+		t.Errorf("wrong devel requires; got %q", got)
+	}
+	if devel.License != "MIT" || devel.Arch != "x86_64" {
+		t.Errorf("devel did not inherit from main; got %+v", devel)
+	}
+
+	if doc := ev.Package("demo-doc"); doc == nil || doc.Arch != "noarch" || doc.Description != "Docs." {
+		t.Errorf("wrong doc package; got %+v", doc)
+	}
+
+	if got := joinDependencies(ev.BuildRequires); got != "gcc, make, nasm >= 2.15" {
+		t.Errorf("wrong build requires; got %q", got)
+	}
+	if ev.Sources["0"] != "https://example.com/demo-2.0.tar.gz" || ev.Sources["1"] != "demo.conf" {
+		t.Errorf("wrong sources; got %q", ev.Sources)
+	}
+	if ev.Patches["0"] != "demo-fix.patch" {
+		t.Errorf("wrong patches; got %q", ev.Patches)
+	}
+	if fmt.Sprint(ev.NoSource) != "[0]" || ev.NoPatch != nil {
+		t.Errorf("wrong nosource or nopatch; got %q and %q", ev.NoSource, ev.NoPatch)
+	}
+	if !ev.ArchSupported() {
+		t.Error("x86_64 should be supported")
+	}
+}
+
+func TestEvaluateConditionals(t *testing.T) {
+	s, _ := ParseString(condSpec)
+	ev, err := s.Evaluate(Target{Arch: "s390x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ev.Packages) != 2 {
+		t.Errorf("docs should not be built without %%fedora; got %d packages", len(ev.Packages))
+	}
+	if got := joinDependencies(ev.BuildRequires); got != "gcc, make" {
+		t.Errorf("wrong build requires; got %q", got)
+	}
+	if ev.ArchSupported() {
+		t.Error("s390x should not be supported")
+	}
+	if ev.Packages[0].Release != "3" {
+		t.Errorf("wrong release; got %q", ev.Packages[0].Release)
+	}
+}
+
+func TestEvaluateTestSpec(t *testing.T) {
+	ev, err := parsedSpec.Evaluate(Target{Arch: "x86_64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ereqs := "vim-common, go = 1.1-1"
+	if vim := ev.Package("go-vim"); vim == nil || joinDependencies(vim.Requires) != ereqs {
+		t.Errorf("wrong go-vim requires; got %+v wanted %q", vim, ereqs)
+	}
+	if ev.Macros["GOARCH"].Value != "amd64" {
+		t.Errorf("wrong GOARCH; got %q wanted %q", ev.Macros["GOARCH"].Value, "amd64")
+	}
+
+	for _, l := range ev.Lines {
+		if strings.HasPrefix(l.Text, "%if") || strings.HasPrefix(l.Text, "%global") {
+			t.Errorf("line %d was not evaluated: %q", l.Number, l.Text)
+		}
+	}
+}
+
+func TestSourceFileName(t *testing.T) {
+	tests := map[string]string{
+		"demo-1.0.tar.gz":                           "demo-1.0.tar.gz",
+		"https://example.com/demo-1.0.tar.gz":       "demo-1.0.tar.gz",
+		"https://example.com/v1.0.tar.gz#/demo.tgz": "demo.tgz",
+		"https://example.com/get?file=demo.zip":     "demo.zip",
+	}
+	for value, want := range tests {
+		if got := SourceFileName(value); got != want {
+			t.Errorf("%q; got %q wanted %q", value, got, want)
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := map[string]int{
+		"Name: x\n%if 1\n":                  2,
+		"Name: x\n%endif\n":                 2,
+		"%if 1\n%else\n%else\n%endif\n":     3,
+		"Name: x\n\n%if foo\n%endif\n":      3,
+		"%package\n":                        1,
+		"%description -n nope\ntext\n":      1,
+		"Name: x\n%package a\n%package a\n": 3,
+		"Name: x\nNoSource: 1 x\n":          2,
+		"Name: x\nAutoReq: maybe\n":         2,
+	}
+
+	for src, line := range tests {
+		s, _ := ParseString(src)
+		_, err := s.Evaluate(Target{Arch: "x86_64"})
+		serr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("%q: expected a syntax error; got %v", src, err)
+		} else if serr.Line != line {
+			t.Errorf("%q: wrong line; got %d wanted %d", src, serr.Line, line)
+		}
+	}
+}
+
+func TestEvaluateAutoReqProv(t *testing.T) {
+	src := `Name: demo
+AutoReqProv: no
+
+%package a
+Summary: A
+AutoReq: 0
+
+%package b
+Summary: B
+AutoProv: off
+
+%package c
+Summary: C
+AutoReqProv: yes
+`
+	s, err := ParseString(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := s.Evaluate(Target{Arch: "x86_64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range ev.Packages {
+		got = append(got, fmt.Sprintf("%s:%v/%v", p.Name, p.NoAutoReq, p.NoAutoProv))
+	}
+	expected := "[demo:true/true demo-a:true/false demo-b:false/true demo-c:false/false]"
+	t.Logf("expecting %q", expected)
+	if fmt.Sprint(got) != expected {
+		t.Errorf("wrong autoreq settings; got %q wanted %q", fmt.Sprint(got), expected)
+	}
+}
+
+var filesSpec = `Name: demo
+Version: 1.0
+Release: 1
+
+%package tools
+Summary: Tools
+
+%description
+Demo.
+
+%post -p /sbin/ldconfig
+
+%preun
+if [ $1 -eq 0 ]; then
+  echo removing
+fi
+
+%post tools -p <lua>
+print("hello")
+
+%files -f demo.lang
+%defattr(-,root,root)
+%{_bindir}/demo
+%config(noreplace) /etc/demo.conf
+
+%files tools
+%attr(0700,demo,demo) /usr/libexec/demo-tool
+`
+
+func TestEvaluateFiles(t *testing.T) {
+	s, _ := ParseString(filesSpec)
+	ev, err := s.Evaluate(Target{Arch: "x86_64", Macros: MacroSet{"_bindir": NewMacro("_bindir", "/usr/bin", false)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	main, tools := ev.Packages[0], ev.Package("demo-tools")
+	if len(main.Files) != 2 || main.Files[0].Path != "/usr/bin/demo" || !main.Files[1].NoReplace {
+		t.Errorf("wrong files; got %+v", main.Files)
+	}
+	if main.Files[1].Pos.Line != 24 || main.Files[0].DefAttr.Owner != "root" {
+		t.Errorf("wrong position or %%defattr; got %+v", main.Files[1])
+	}
+	if fmt.Sprint(main.FileLists) != "[demo.lang]" {
+		t.Errorf("wrong file lists; got %q", main.FileLists)
+	}
+	if len(tools.Files) != 1 || tools.Files[0].Attr.Owner != "demo" {
+		t.Errorf("wrong tools files; got %+v", tools.Files)
+	}
+
+	expected := map[string]string{
+		"post":  `[/sbin/ldconfig] ""`,
+		"preun": `[/bin/sh] "if [ $1 -eq 0 ]; then\n  echo removing\nfi"`,
+	}
+	for name, want := range expected {
+		s := main.Scriptlets[name]
+		if got := fmt.Sprintf("%v %q", s.Interpreter(), s.Body); got != want {
+			t.Errorf("%%%s; got %s wanted %s", name, got, want)
+		}
+	}
+	if s := tools.Scriptlets["post"]; s.Program[0] != "<lua>" || s.Body != `print("hello")` {
+		t.Errorf("wrong tools %%post; got %+v", s)
+	}
+
+	s, _ = ParseString("Name: demo\n%post\na\n%post\nb\n")
+	if _, err := s.Evaluate(Target{Arch: "x86_64"}); err == nil {
+		t.Errorf("expected an error for a second %%post")
+	}
+	s, _ = ParseString("Name: demo\n%files nope\n")
+	if _, err := s.Evaluate(Target{Arch: "x86_64"}); err == nil {
+		t.Errorf("expected an error for %%files of a nonexistent package")
+	}
+}
@@ -0,0 +1,573 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// The maximum nesting of macro expansions, before giving up. This is the same
+// limit rpm uses to detect recursive macro definitions.
+const maxMacroDepth = 64
+
+var ErrMacroRecursion = errors.New("too many levels of recursion in macro expansion")
+
+/*
+An expander performs rpm-style macro expansion against a MacroSet.
+
+Besides plain macro references, it understands the conditional forms
+(%{?name}, %{!?name:text}), parametric macros, expressions (%[...]), the
+%define, %global and %undefine primitives, and a handful of the built-in
+macros (%{expand:...}, %{lower:...} and friends). Shell (%(...)) and Lua
+(%{lua:...}) expansions are never executed, and are left in place.
+*/
+type expander struct {
+	macros MacroSet
+
+	// Frames hold the local macros (%1, %*, %{-f}...) of the parametric
+	// macros currently being expanded, innermost last.
+	frames []MacroSet
+	depth  int
+
+	// OnBcond, if set, is called for every build conditional declared
+	// with %bcond, %bcond_with or %bcond_without.
+	onBcond func(name string, def bool)
+
+	// OnLoad, if set, is called to handle %{load:path}.
+	onLoad func(path string) error
+}
+
+func newExpander(macros MacroSet) *expander {
+	if macros == nil {
+		macros = make(MacroSet)
+	}
+	return &expander{macros: macros}
+}
+
+func (e *expander) lookup(name string) (RPMMacro, bool) {
+	if len(e.frames) > 0 {
+		if m, ok := e.frames[len(e.frames)-1][name]; ok {
+			return m, true
+		}
+	}
+	m, ok := e.macros[name]
+	return m, ok
+}
+
+func (e *expander) expand(s string) (string, error) {
+	if e.depth++; e.depth > maxMacroDepth {
+		e.depth--
+		return "", ErrMacroRecursion
+	}
+	defer func() { e.depth-- }()
+
+	if strings.IndexByte(s, '%') < 0 {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		j := strings.IndexByte(s[i:], '%')
+		if j < 0 {
+			b.WriteString(s[i:])
+			break
+		}
+		b.WriteString(s[i : i+j])
+		i += j
+
+		n, err := e.expandAt(s, i, &b)
+		if err != nil {
+			return "", err
+		}
+		i = n
+	}
+	return b.String(), nil
+}
+
+/*
+Expands the macro starting at s[i] (which is always a '%'), writes the result
+to b, and returns the index of the first byte following the macro.
+*/
+func (e *expander) expandAt(s string, i int, b *strings.Builder) (int, error) {
+	if i+1 >= len(s) {
+		b.WriteByte('%')
+		return i + 1, nil
+	}
+
+	switch c := s[i+1]; {
+	case c == '%':
+		b.WriteByte('%')
+		return i + 2, nil
+
+	case c == '{':
+		end := matchingBrace(s, i+1, '{', '}')
+		if end < 0 {
+			return 0, fmt.Errorf("unterminated macro %q", s[i:])
+		}
+		out, err := e.expandBraced(s[i+2:end], s[i:end+1])
+		if err != nil {
+			return 0, err
+		}
+		b.WriteString(out)
+		return end + 1, nil
+
+	case c == '[':
+		end := matchingBrace(s, i+1, '[', ']')
+		if end < 0 {
+			return 0, fmt.Errorf("unterminated expression %q", s[i:])
+		}
+		expr, err := e.expand(s[i+2 : end])
+		if err != nil {
+			return 0, err
+		}
+		v, err := evalExpr(expr)
+		if err != nil {
+			return 0, err
+		}
+		b.WriteString(v.String())
+		return end + 1, nil
+
+	case c == '(':
+		// Shell expansions are never run; copy them through untouched.
+		end := matchingBrace(s, i+1, '(', ')')
+		if end < 0 {
+			return 0, fmt.Errorf("unterminated shell expansion %q", s[i:])
+		}
+		b.WriteString(s[i : end+1])
+		return end + 1, nil
+
+	case c == '?' || c == '!':
+		j := i + 1
+		for j < len(s) && (s[j] == '?' || s[j] == '!') {
+			j++
+		}
+		name := s[j : j+macroNameLen(s[j:])]
+		if name == "" || !strings.Contains(s[i+1:j], "?") {
+			b.WriteByte('%')
+			return i + 1, nil
+		}
+		out, err := e.conditional(name, strings.Count(s[i+1:j], "!")%2 == 1, "", false)
+		if err != nil {
+			return 0, err
+		}
+		b.WriteString(out)
+		return j + len(name), nil
+	}
+
+	n := macroNameLen(s[i+1:])
+	if n == 0 {
+		b.WriteByte('%')
+		return i + 1, nil
+	}
+	name := s[i+1 : i+1+n]
+	end := i + 1 + n
+
+	switch name {
+	case "define", "global", "undefine":
+		body, next := restOfLine(s, end)
+		return next, e.define(name, body)
+	case "dnl":
+		_, next := restOfLine(s, end)
+		return next, nil
+	case "bcond", "bcond_with", "bcond_without":
+		if _, ok := e.lookup(name); !ok {
+			args, next := restOfLine(s, end)
+			return next, e.bcond(name, args)
+		}
+	}
+
+	m, ok := e.lookup(name)
+	if !ok {
+		if !e.unsetOption(name) {
+			b.WriteString(s[i:end])
+		}
+		return end, nil
+	}
+
+	if m.Parametric {
+		// A parametric macro used without braces takes the rest of the
+		// line as its arguments.
+		args, next := restOfLine(s, end)
+		if strings.HasSuffix(args, "\n") {
+			args = args[:len(args)-1]
+			next--
+		}
+		out, err := e.call(m, args)
+		if err != nil {
+			return 0, err
+		}
+		b.WriteString(out)
+		return next, nil
+	}
+
+	out, err := e.expand(m.Value)
+	if err != nil {
+		return 0, err
+	}
+	b.WriteString(out)
+	return end, nil
+}
+
+/*
+Expands the contents of a "%{...}" macro. The raw argument is the complete
+macro text, including the braces, and is what undefined macros expand to.
+*/
+func (e *expander) expandBraced(body, raw string) (string, error) {
+	j := 0
+	for j < len(body) && (body[j] == '?' || body[j] == '!') {
+		j++
+	}
+	flags := body[:j]
+
+	k := j
+	for k < len(body) && body[k] != ':' && body[k] != ' ' && body[k] != '\t' {
+		k++
+	}
+	name := body[j:k]
+
+	var arg string
+	var hasArg, hasSpace bool
+	if k < len(body) {
+		hasArg, hasSpace = body[k] == ':', body[k] != ':'
+		arg = body[k+1:]
+	}
+
+	if strings.Contains(flags, "?") {
+		return e.conditional(name, strings.Count(flags, "!")%2 == 1, arg, hasArg)
+	}
+
+	if hasArg {
+		if out, ok, err := e.builtin(name, arg); ok {
+			return out, err
+		}
+	}
+
+	m, ok := e.lookup(name)
+	if !ok {
+		switch {
+		case e.unsetOption(name):
+			return "", nil
+		case name == "bcond" || name == "bcond_with" || name == "bcond_without":
+			return "", e.bcond(name, arg)
+		}
+		return raw, nil
+	}
+	if m.Parametric {
+		args, err := e.expand(arg)
+		if err != nil {
+			return "", err
+		}
+		return e.call(m, args)
+	} else if hasSpace && strings.TrimSpace(arg) != "" {
+		return raw, nil
+	}
+	return e.expand(m.Value)
+}
+
+// unsetOption reports whether name refers to an option (%{-f}) that was not
+// passed to the parametric macro being expanded; those expand to nothing.
+func (e *expander) unsetOption(name string) bool {
+	return len(e.frames) > 0 && strings.HasPrefix(name, "-")
+}
+
+/*
+Expands the conditional forms %{?name}, %{?name:text}, %{!?name:text} and
+their unbraced equivalents.
+*/
+func (e *expander) conditional(name string, negate bool, text string, hasText bool) (string, error) {
+	m, defined := e.lookup(name)
+	if negate {
+		if !defined && hasText {
+			return e.expand(text)
+		}
+		return "", nil
+	}
+
+	if !defined {
+		return "", nil
+	} else if hasText {
+		return e.expand(text)
+	} else if m.Parametric {
+		return e.call(m, "")
+	}
+	return e.expand(m.Value)
+}
+
+/*
+Handles the built-in macros which take an argument after a colon. The second
+return value reports whether name was a built-in at all.
+*/
+func (e *expander) builtin(name, arg string) (string, bool, error) {
+	var fn func(string) string
+	switch name {
+	case "lua":
+		return "%{lua:" + arg + "}", true, nil
+	case "load":
+		if e.onLoad == nil {
+			return "%{load:" + arg + "}", true, nil
+		}
+		out, err := e.expand(arg)
+		if err == nil {
+			err = e.onLoad(strings.TrimSpace(out))
+		}
+		return "", true, err
+	case "expand":
+		out, err := e.expand(arg)
+		if err == nil {
+			out, err = e.expand(out)
+		}
+		return out, true, err
+	case "expr":
+		out, err := e.expand(arg)
+		if err != nil {
+			return "", true, err
+		}
+		v, err := evalExpr(out)
+		return v.String(), true, err
+	case "defined", "undefined":
+		out, err := e.expand(arg)
+		_, ok := e.lookup(strings.TrimSpace(out))
+		if name == "undefined" {
+			ok = !ok
+		}
+		if ok {
+			return "1", true, err
+		}
+		return "0", true, err
+	case "S", "P":
+		out, err := e.expand(arg)
+		if err != nil {
+			return "", true, err
+		}
+		ref := "%{SOURCE" + strings.TrimSpace(out) + "}"
+		if name == "P" {
+			ref = "%{PATCH" + strings.TrimSpace(out) + "}"
+		}
+		out, err = e.expand(ref)
+		return out, true, err
+	case "error":
+		out, err := e.expand(arg)
+		if err == nil {
+			err = errors.New(out)
+		}
+		return "", true, err
+	case "echo", "warn", "verbose":
+		return "", true, nil
+	case "lower":
+		fn = strings.ToLower
+	case "upper":
+		fn = strings.ToUpper
+	case "len":
+		fn = func(s string) string { return strconv.Itoa(len(s)) }
+	case "quote":
+		fn = func(s string) string { return s }
+	case "basename":
+		fn = path.Base
+	case "dirname":
+		fn = path.Dir
+	case "suffix":
+		fn = func(s string) string {
+			if i := strings.LastIndexByte(s, '.'); i >= 0 {
+				return s[i+1:]
+			}
+			return ""
+		}
+	case "shrink":
+		fn = func(s string) string { return strings.Join(strings.Fields(s), " ") }
+	case "url2path", "u2p":
+		fn = func(s string) string {
+			if i := strings.Index(s, "://"); i >= 0 {
+				if j := strings.IndexByte(s[i+3:], '/'); j >= 0 {
+					return s[i+3+j:]
+				}
+			}
+			return s
+		}
+	default:
+		return "", false, nil
+	}
+
+	out, err := e.expand(arg)
+	if err != nil {
+		return "", true, err
+	}
+	return fn(out), true, nil
+}
+
+/*
+Handles the %define, %global and %undefine primitives. The body is everything
+that followed the primitive on the line.
+*/
+func (e *expander) define(kind, body string) error {
+	body = strings.TrimSpace(strings.Replace(body, "\\\n", "\n", -1))
+
+	n := macroNameLen(body)
+	name := body[:n]
+	if n < 3 {
+		return fmt.Errorf("macro %%%s has illegal name (%%%s)", name, kind)
+	}
+
+	if kind == "undefine" {
+		delete(e.macros, name)
+		return nil
+	}
+
+	var m RPMMacro
+	rest := body[n:]
+	if strings.HasPrefix(rest, "(") {
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return fmt.Errorf("macro %%%s has unterminated opts", name)
+		}
+		m.Parametric, m.Opts = true, rest[1:end]
+		rest = rest[end+1:]
+	}
+	m.Name, m.Value = name, strings.TrimSpace(rest)
+	if m.Value == "" {
+		return fmt.Errorf("macro %%%s has empty body", name)
+	}
+
+	if kind == "global" {
+		v, err := e.expand(m.Value)
+		if err != nil {
+			return err
+		}
+		m.Value, m.IsGlobal = v, true
+	}
+
+	e.macros[name] = m
+	return nil
+}
+
+/*
+Calls the parametric macro m with the (already expanded) whitespace-separated
+arguments, in args.
+*/
+func (e *expander) call(m RPMMacro, args string) (string, error) {
+	frame := MacroSet{"0": NewMacro("0", m.Name, false), "**": NewMacro("**", args, false)}
+
+	fields := strings.Fields(args)
+	var positional []string
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if f == "--" {
+			positional = append(positional, fields[i+1:]...)
+			break
+		} else if len(f) < 2 || f[0] != '-' || len(positional) > 0 {
+			positional = append(positional, f)
+			continue
+		}
+
+		for k := 1; k < len(f); k++ {
+			c := f[k]
+			idx := strings.IndexByte(m.Opts, c)
+			if idx < 0 || c == ':' {
+				return "", fmt.Errorf("unknown option %c in %s(%s)", c, m.Name, m.Opts)
+			}
+
+			opt := "-" + string(c)
+			if idx+1 < len(m.Opts) && m.Opts[idx+1] == ':' {
+				val := f[k+1:]
+				if val == "" {
+					if i+1 >= len(fields) {
+						return "", fmt.Errorf("option %c of %s requires an argument", c, m.Name)
+					}
+					i++
+					val = fields[i]
+				}
+				frame[opt] = NewMacro(opt, opt+" "+val, false)
+				frame[opt+"*"] = NewMacro(opt+"*", val, false)
+				break
+			}
+			frame[opt] = NewMacro(opt, opt, false)
+		}
+	}
+
+	for i, a := range positional {
+		n := strconv.Itoa(i + 1)
+		frame[n] = NewMacro(n, a, false)
+	}
+	frame["#"] = NewMacro("#", strconv.Itoa(len(positional)), false)
+	frame["*"] = NewMacro("*", strings.Join(positional, " "), false)
+
+	e.frames = append(e.frames, frame)
+	defer func() { e.frames = e.frames[:len(e.frames)-1] }()
+	return e.expand(m.Value)
+}
+
+/*
+Returns the length of the macro name at the start of s. Besides regular names,
+this also recognizes the local macros of parametric macros: %1, %*, %**, %#,
+%-f and %-f*.
+*/
+func macroNameLen(s string) int {
+	if s == "" {
+		return 0
+	}
+
+	switch c := s[0]; {
+	case c == '*':
+		if strings.HasPrefix(s, "**") {
+			return 2
+		}
+		return 1
+	case c == '#':
+		return 1
+	case c == '-':
+		if len(s) > 1 && (isAlpha(s[1]) || isDigit(s[1])) {
+			if len(s) > 2 && s[2] == '*' {
+				return 3
+			}
+			return 2
+		}
+		return 0
+	case isDigit(c):
+		n := 0
+		for n < len(s) && isDigit(s[n]) {
+			n++
+		}
+		return n
+	}
+
+	n := 0
+	for n < len(s) && (isAlpha(s[n]) || isDigit(s[n]) || s[n] == '_') {
+		n++
+	}
+	return n
+}
+
+/*
+Returns the index of the bracket closing the one at s[open], or -1 if it is
+never closed.
+*/
+func matchingBrace(s string, open int, l, r byte) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case l:
+			depth++
+		case r:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+/*
+Returns the remainder of the line starting at s[i] (honouring backslash-newline
+continuations, and including the terminating newline if any), and the index
+following it.
+*/
+func restOfLine(s string, i int) (string, int) {
+	for j := i; j < len(s); j++ {
+		if s[j] == '\n' && (j == i || s[j-1] != '\\') {
+			return s[i : j+1], j + 1
+		}
+	}
+	return s[i:], len(s)
+}
@@ -0,0 +1,93 @@
+package spec
+
+import "testing"
+
+func TestExpandMacros(t *testing.T) {
+	ms := MacroSet{
+		"name":    NewMacro("name", "go", false),
+		"version": NewMacro("version", "1.1", false),
+		"nvr":     NewMacro("nvr", "%{name}-%{version}", false),
+		"empty":   NewMacro("empty", "", false),
+	}
+
+	tests := map[string]string{
+		"%{name}-%{version}":           "go-1.1",
+		"%name-%version":               "go-1.1",
+		"%{nvr}.tar.gz":                "go-1.1.tar.gz",
+		"100%%":                        "100%",
+		"%{undefined_macro}":           "%{undefined_macro}",
+		"%undefined_macro":             "%undefined_macro",
+		"1%{?dist}":                    "1",
+		"%{?name:has name}":            "has name",
+		"%{!?name:no name}":            "",
+		"%{!?dist:no dist}":            "no dist",
+		"%?name":                       "go",
+		"%{?empty}x":                   "x",
+		"%{upper:%{name}}":             "GO",
+		"%{len:%{nvr}}":                "6",
+		"%{basename:/usr/lib/foo.so}":  "foo.so",
+		"%{dirname:/usr/lib/foo.so}":   "/usr/lib",
+		"%{suffix:foo.tar.gz}":         "gz",
+		"%{defined:name}%{defined:xx}": "10",
+		"%[1 + 2]":                     "3",
+		"%{expr:3 * 4}":                "12",
+		"%{expand:%%{name}}":           "go",
+		"%(echo %{name})":              "%(echo %{name})",
+		"%{lua: print(1)}":             "%{lua: print(1)}",
+		"a %dnl comment\nb":            "a b",
+	}
+
+	for in, want := range tests {
+		got, err := ExpandMacros([]byte(in), ms)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+		} else if string(got) != want {
+			t.Errorf("%q; got %q wanted %q", in, got, want)
+		}
+	}
+}
+
+func TestExpandMacrosDefine(t *testing.T) {
+	ms := make(MacroSet)
+	in := "%define foo bar\n%global baz %{foo}-1\n%define qux %{foo}-2\n%undefine foo\n%{baz} %{qux}"
+	want := "bar-1 %{foo}-2"
+
+	got, err := ExpandMacros([]byte(in), ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got %q wanted %q", got, want)
+	}
+
+	if _, err := ExpandMacros([]byte("%define x 1"), ms); err == nil {
+		t.Error("expected an error defining a macro with a short name")
+	}
+}
+
+func TestExpandMacrosParametric(t *testing.T) {
+	ms := make(MacroSet)
+	in := `%define greet(n:q) %{?-q:quietly }hello %{-n*} (%#: %*)
+%greet -q -n world a b
+%{greet x}`
+	want := "quietly hello world (2: a b)\nhello  (1: x)"
+
+	got, err := ExpandMacros([]byte(in), ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got %q wanted %q", got, want)
+	}
+
+	if _, err := ExpandMacros([]byte("%greet -z"), ms); err == nil {
+		t.Error("expected an error passing an unknown option")
+	}
+}
+
+func TestExpandMacrosRecursion(t *testing.T) {
+	ms := MacroSet{"loop": NewMacro("loop", "%{loop}", false)}
+	if _, err := ExpandMacros([]byte("%{loop}"), ms); err != ErrMacroRecursion {
+		t.Errorf("got %v wanted %v", err, ErrMacroRecursion)
+	}
+}
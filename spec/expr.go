@@ -0,0 +1,327 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+An exprValue is the result of evaluating an rpm expression, as used by "%if"
+and "%[...]". It is either an integer, a string, or a version (v"1.2").
+*/
+type exprValue struct {
+	kind byte // 'i', 's' or 'v'
+	i    int64
+	s    string
+}
+
+func (v exprValue) truth() bool {
+	if v.kind == 'i' {
+		return v.i != 0
+	}
+	return v.s != ""
+}
+
+func (v exprValue) String() string {
+	if v.kind == 'i' {
+		return strconv.FormatInt(v.i, 10)
+	}
+	return v.s
+}
+
+func intValue(b bool) exprValue {
+	if b {
+		return exprValue{kind: 'i', i: 1}
+	}
+	return exprValue{kind: 'i'}
+}
+
+/*
+Evaluates the expression in s, with the grammar and semantics of rpm's
+expression parser. Macros must already have been expanded.
+*/
+func evalExpr(s string) (exprValue, error) {
+	p := &exprParser{src: s}
+	if err := p.next(); err != nil {
+		return exprValue{}, err
+	}
+	if p.tok == "" {
+		return exprValue{}, errors.New("empty expression")
+	}
+
+	v, err := p.ternary()
+	if err != nil {
+		return exprValue{}, err
+	}
+	if p.tok != "" {
+		return exprValue{}, fmt.Errorf("syntax error in expression %q near %q", s, p.tok)
+	}
+	return v, nil
+}
+
+type exprParser struct {
+	src string
+	pos int
+
+	tok string // current token; "" at the end of input
+	val exprValue
+}
+
+func (p *exprParser) next() error {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		p.tok = ""
+		return nil
+	}
+
+	s := p.src[p.pos:]
+	switch c := s[0]; {
+	case isDigit(c):
+		n := 0
+		for n < len(s) && isDigit(s[n]) {
+			n++
+		}
+		i, err := strconv.ParseInt(s[:n], 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad number %q in expression", s[:n])
+		}
+		p.tok, p.val = "num", exprValue{kind: 'i', i: i}
+		p.pos += n
+
+	case c == '"' || c == 'v' && len(s) > 1 && s[1] == '"':
+		kind, start := byte('s'), 1
+		if c == 'v' {
+			kind, start = 'v', 2
+		}
+		end := strings.IndexByte(s[start:], '"')
+		if end < 0 {
+			return fmt.Errorf("unterminated string in expression %q", p.src)
+		}
+		p.tok, p.val = "str", exprValue{kind: kind, s: s[start : start+end]}
+		p.pos += start + end + 1
+
+	default:
+		for _, op := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "(", ")", "?", ":"} {
+			if strings.HasPrefix(s, op) {
+				p.tok = op
+				p.pos += len(op)
+				return nil
+			}
+		}
+		if isAlpha(c) || c == '_' {
+			return fmt.Errorf("bare words are not supported in expressions: %q", p.src)
+		}
+		return fmt.Errorf("syntax error in expression %q", p.src)
+	}
+	return nil
+}
+
+func (p *exprParser) ternary() (exprValue, error) {
+	cond, err := p.or()
+	if err != nil || p.tok != "?" {
+		return cond, err
+	}
+	if err := p.next(); err != nil {
+		return exprValue{}, err
+	}
+
+	a, err := p.ternary()
+	if err != nil {
+		return exprValue{}, err
+	}
+	if p.tok != ":" {
+		return exprValue{}, fmt.Errorf("missing ':' in expression %q", p.src)
+	}
+	if err := p.next(); err != nil {
+		return exprValue{}, err
+	}
+
+	b, err := p.ternary()
+	if err != nil {
+		return exprValue{}, err
+	}
+	if cond.truth() {
+		return a, nil
+	}
+	return b, nil
+}
+
+func (p *exprParser) or() (exprValue, error) {
+	v, err := p.and()
+	for err == nil && p.tok == "||" {
+		var w exprValue
+		if err = p.next(); err != nil {
+			break
+		}
+		if w, err = p.and(); err == nil && !v.truth() {
+			v = w
+		}
+	}
+	return v, err
+}
+
+func (p *exprParser) and() (exprValue, error) {
+	v, err := p.comparison()
+	for err == nil && p.tok == "&&" {
+		var w exprValue
+		if err = p.next(); err != nil {
+			break
+		}
+		if w, err = p.comparison(); err == nil && v.truth() {
+			v = w
+		}
+	}
+	return v, err
+}
+
+func (p *exprParser) comparison() (exprValue, error) {
+	v, err := p.additive()
+	for err == nil {
+		op := p.tok
+		if op != "==" && op != "!=" && op != "<" && op != "<=" && op != ">" && op != ">=" {
+			break
+		}
+
+		var w exprValue
+		if err = p.next(); err != nil {
+			break
+		}
+		if w, err = p.additive(); err != nil {
+			break
+		}
+		if v.kind != w.kind {
+			return exprValue{}, fmt.Errorf("types must match in expression %q", p.src)
+		}
+
+		var c int
+		switch v.kind {
+		case 'i':
+			if v.i < w.i {
+				c = -1
+			} else if v.i > w.i {
+				c = 1
+			}
+		case 's':
+			c = strings.Compare(v.s, w.s)
+		case 'v':
+			c = CompareEVR(v.s, w.s)
+		}
+
+		switch op {
+		case "==":
+			v = intValue(c == 0)
+		case "!=":
+			v = intValue(c != 0)
+		case "<":
+			v = intValue(c < 0)
+		case "<=":
+			v = intValue(c <= 0)
+		case ">":
+			v = intValue(c > 0)
+		case ">=":
+			v = intValue(c >= 0)
+		}
+	}
+	return v, err
+}
+
+func (p *exprParser) additive() (exprValue, error) {
+	v, err := p.multiplicative()
+	for err == nil && (p.tok == "+" || p.tok == "-") {
+		op := p.tok
+		var w exprValue
+		if err = p.next(); err != nil {
+			break
+		}
+		if w, err = p.multiplicative(); err != nil {
+			break
+		}
+
+		switch {
+		case v.kind == 'i' && w.kind == 'i':
+			if op == "+" {
+				v.i += w.i
+			} else {
+				v.i -= w.i
+			}
+		case v.kind == 's' && w.kind == 's' && op == "+":
+			v.s += w.s
+		default:
+			return exprValue{}, fmt.Errorf("invalid operand types for %q in expression %q", op, p.src)
+		}
+	}
+	return v, err
+}
+
+func (p *exprParser) multiplicative() (exprValue, error) {
+	v, err := p.unary()
+	for err == nil && (p.tok == "*" || p.tok == "/") {
+		op := p.tok
+		var w exprValue
+		if err = p.next(); err != nil {
+			break
+		}
+		if w, err = p.unary(); err != nil {
+			break
+		}
+		if v.kind != 'i' || w.kind != 'i' {
+			return exprValue{}, fmt.Errorf("invalid operand types for %q in expression %q", op, p.src)
+		}
+
+		if op == "*" {
+			v.i *= w.i
+		} else if w.i == 0 {
+			return exprValue{}, fmt.Errorf("division by zero in expression %q", p.src)
+		} else {
+			v.i /= w.i
+		}
+	}
+	return v, err
+}
+
+func (p *exprParser) unary() (exprValue, error) {
+	switch p.tok {
+	case "!", "-":
+		op := p.tok
+		if err := p.next(); err != nil {
+			return exprValue{}, err
+		}
+		v, err := p.unary()
+		if err != nil {
+			return exprValue{}, err
+		}
+		if op == "!" {
+			return intValue(!v.truth()), nil
+		}
+		if v.kind != 'i' {
+			return exprValue{}, fmt.Errorf("unary minus on a non-integer in expression %q", p.src)
+		}
+		v.i = -v.i
+		return v, nil
+
+	case "(":
+		if err := p.next(); err != nil {
+			return exprValue{}, err
+		}
+		v, err := p.ternary()
+		if err != nil {
+			return exprValue{}, err
+		}
+		if p.tok != ")" {
+			return exprValue{}, fmt.Errorf("unmatched '(' in expression %q", p.src)
+		}
+		return v, p.next()
+
+	case "num", "str":
+		v := p.val
+		return v, p.next()
+
+	case "":
+		return exprValue{}, fmt.Errorf("unexpected end of expression %q", p.src)
+	}
+	return exprValue{}, fmt.Errorf("syntax error in expression %q near %q", p.src, p.tok)
+}
@@ -0,0 +1,42 @@
+package spec
+
+import "testing"
+
+func TestEvalExpr(t *testing.T) {
+	tests := map[string]string{
+		"1":                         "1",
+		"0":                         "0",
+		"2 + 3 * 4":                 "14",
+		"(2 + 3) * 4":               "20",
+		"-3 + 1":                    "-2",
+		"!0":                        "1",
+		"038 >= 38":                 "1",
+		"1 && 0 || 1":               "1",
+		`"x86_64" == "x86_64"`:      "1",
+		`"a" + "b"`:                 "ab",
+		`v"1.10" > v"1.9"`:          "1",
+		`v"1.0~rc1" < v"1.0"`:       "1",
+		"1 ? 2 : 3":                 "2",
+		"0 ? 2 : 0 ? 3 : 4":         "4",
+		`"" || "fallback"`:          "fallback",
+		"10 / 3":                    "3",
+		"0%{?fedora}"[:1] + " == 0": "1",
+	}
+
+	for expr, want := range tests {
+		v, err := evalExpr(expr)
+		if err != nil {
+			t.Errorf("%q: %v", expr, err)
+		} else if v.String() != want {
+			t.Errorf("%q; got %q wanted %q", expr, v, want)
+		}
+	}
+}
+
+func TestEvalExprErrors(t *testing.T) {
+	for _, expr := range []string{"", "1 +", "(1", `"a" == 1`, "1 / 0", "foo", `"abc`} {
+		if _, err := evalExpr(expr); err == nil {
+			t.Errorf("expected an error evaluating %q", expr)
+		}
+	}
+}
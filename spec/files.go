@@ -0,0 +1,313 @@
+package spec
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+/*
+FileAttributes are the mode and ownership given to files by %attr and
+%defattr. Empty fields (written as "-" in the spec file) leave the mode of the
+installed file, and root ownership.
+*/
+type FileAttributes struct {
+	Mode  string // octal
+	Owner string
+	Group string
+
+	// DirMode is the mode of directories, which only %defattr sets.
+	DirMode string
+}
+
+/*
+A FileEntry is a path listed in a %files section, along with the directives
+that apply to it.
+*/
+type FileEntry struct {
+	// Path is the absolute path of the file once installed, and may hold
+	// glob patterns. A directory stands for everything in it, unless Dir
+	// is set.
+	Path string
+
+	// Source is set for %doc and %license files given by a relative path,
+	// which are taken from the build directory rather than the buildroot.
+	// It may hold glob patterns; Path is then the directory the files are
+	// installed in, which is named after the package.
+	Source string
+
+	// Attr holds the attributes given with %attr, and DefAttr those of the
+	// %defattr in effect.
+	Attr    FileAttributes
+	DefAttr FileAttributes
+
+	Dir       bool
+	Config    bool
+	NoReplace bool
+	MissingOK bool
+	Doc       bool
+	License   bool
+	Readme    bool
+	Ghost     bool
+	Exclude   bool
+	Artifact  bool
+	Lang      string
+	Caps      string
+
+	// NoVerify lists the checks turned off with %verify(not ...), such as
+	// "md5" or "mtime".
+	NoVerify []string
+
+	Pos Position
+}
+
+// The directives of %files sections.
+var filesDirectives = map[string]bool{
+	"defattr": true, "attr": true, "config": true, "verify": true,
+	"lang": true, "caps": true, "doc": true, "license": true, "readme": true,
+	"dir": true, "ghost": true, "exclude": true, "artifact": true,
+	"docdir": true,
+}
+
+// The checks %verify can turn off.
+var verifyChecks = map[string]bool{
+	"md5": true, "filedigest": true, "size": true, "link": true, "user": true,
+	"owner": true, "group": true, "mtime": true, "mode": true, "rdev": true,
+	"caps": true,
+}
+
+/*
+A filesParser parses the lines of a %files section (or of a file list given
+with "%files -f"), keeping track of the %defattr in effect.
+*/
+type filesParser struct {
+	pkg        string
+	docdir     string
+	licensedir string
+	defattr    FileAttributes
+}
+
+func newFilesParser(pkg, docdir, licensedir string) *filesParser {
+	return &filesParser{pkg: pkg, docdir: docdir, licensedir: licensedir}
+}
+
+/*
+ParseFileList parses the contents of a file list, as given with "%files -f",
+for the package pkg. Relative %doc and %license paths are placed under
+/usr/share/doc and /usr/share/licenses.
+*/
+func ParseFileList(data []byte, pkg *Package) ([]FileEntry, error) {
+	fp := newFilesParser(pkg.Name, "/usr/share/doc", "/usr/share/licenses")
+	var entries []FileEntry
+	for i, l := range strings.Split(string(data), "\n") {
+		e, err := fp.parseLine(l)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		entries = append(entries, e...)
+	}
+	return entries, nil
+}
+
+// A filesToken is a directive ("%config(noreplace)" has name "config" and
+// args "noreplace") or, with an empty name, a path.
+type filesToken struct {
+	name, args string
+	path       string
+}
+
+func tokenizeFilesLine(l string) ([]filesToken, error) {
+	var tokens []filesToken
+	for i := 0; i < len(l); {
+		switch c := l[i]; {
+		case c == ' ' || c == '\t':
+			i++
+
+		case c == '%' && filesDirectives[directiveName(l[i+1:])]:
+			j := i + 1 + len(directiveName(l[i+1:]))
+			t := filesToken{name: l[i+1 : j]}
+			if j < len(l) && l[j] == '(' {
+				end := strings.IndexByte(l[j:], ')')
+				if end < 0 {
+					return nil, fmt.Errorf("missing ) in %%%s", t.name)
+				}
+				t.args = l[j+1 : j+end]
+				j += end + 1
+			}
+			tokens = append(tokens, t)
+			i = j
+
+		case c == '"':
+			end := strings.IndexByte(l[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted path")
+			}
+			tokens = append(tokens, filesToken{path: l[i+1 : i+1+end]})
+			i += end + 2
+
+		default:
+			j := i
+			for j < len(l) && l[j] != ' ' && l[j] != '\t' {
+				j++
+			}
+			tokens = append(tokens, filesToken{path: l[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// directiveName returns the name of the directive at the start of s.
+func directiveName(s string) string {
+	i := 0
+	for i < len(s) && (s[i] >= 'a' && s[i] <= 'z' || s[i] == '_') {
+		i++
+	}
+	return s[:i]
+}
+
+// splitArgs splits the arguments of a directive, which are separated by
+// commas and/or whitespace.
+func splitArgs(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// attrValue checks a field of %attr or %defattr, turning "-" into "".
+func attrValue(s string, mode bool) (string, error) {
+	if s == "-" {
+		return "", nil
+	}
+	if mode {
+		if _, err := strconv.ParseUint(s, 8, 32); err != nil {
+			return "", fmt.Errorf("bad mode %q", s)
+		}
+	}
+	return s, nil
+}
+
+func parseAttributes(args string, defattr bool) (FileAttributes, error) {
+	fields := splitArgs(args)
+	if len(fields) < 3 || len(fields) > 3 && !defattr || len(fields) > 4 {
+		return FileAttributes{}, fmt.Errorf("bad attributes (%s)", args)
+	}
+
+	var attr FileAttributes
+	var err error
+	if attr.Mode, err = attrValue(fields[0], true); err != nil {
+		return attr, err
+	}
+	attr.Owner, _ = attrValue(fields[1], false)
+	attr.Group, _ = attrValue(fields[2], false)
+	if len(fields) == 4 {
+		if attr.DirMode, err = attrValue(fields[3], true); err != nil {
+			return attr, err
+		}
+	}
+	return attr, nil
+}
+
+/*
+Parses a line of a %files section, and returns the entries for the paths it
+lists. A line may list several paths, which share its directives.
+*/
+func (fp *filesParser) parseLine(l string) ([]FileEntry, error) {
+	trimmed := strings.TrimSpace(l)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return nil, nil
+	}
+
+	tokens, err := tokenizeFilesLine(trimmed)
+	if err != nil {
+		return nil, err
+	}
+
+	var proto FileEntry
+	var paths []string
+	for _, t := range tokens {
+		if t.name == "" {
+			paths = append(paths, t.path)
+			continue
+		}
+
+		switch t.name {
+		case "defattr":
+			if fp.defattr, err = parseAttributes(t.args, true); err != nil {
+				return nil, err
+			}
+		case "attr":
+			if proto.Attr, err = parseAttributes(t.args, false); err != nil {
+				return nil, err
+			}
+		case "config":
+			proto.Config = true
+			for _, a := range splitArgs(t.args) {
+				switch a {
+				case "noreplace":
+					proto.NoReplace = true
+				case "missingok":
+					proto.MissingOK = true
+				default:
+					return nil, fmt.Errorf("unknown %%config option %q", a)
+				}
+			}
+		case "verify":
+			fields := splitArgs(t.args)
+			if len(fields) == 0 || fields[0] != "not" {
+				return nil, fmt.Errorf("only %%verify(not ...) is supported")
+			}
+			for _, f := range fields[1:] {
+				if !verifyChecks[f] {
+					return nil, fmt.Errorf("unknown %%verify check %q", f)
+				}
+			}
+			proto.NoVerify = fields[1:]
+		case "lang":
+			proto.Lang = t.args
+		case "caps":
+			proto.Caps = t.args
+		case "doc":
+			proto.Doc = true
+		case "license":
+			proto.License = true
+		case "readme":
+			proto.Readme = true
+		case "dir":
+			proto.Dir = true
+		case "ghost":
+			proto.Ghost = true
+		case "exclude":
+			proto.Exclude = true
+		case "artifact":
+			proto.Artifact = true
+		case "docdir":
+			// Marks directories whose contents are documentation;
+			// nothing is packaged by it.
+			return nil, nil
+		}
+	}
+	proto.DefAttr = fp.defattr
+
+	var entries []FileEntry
+	for _, p := range paths {
+		e := proto
+		switch {
+		case strings.HasPrefix(p, "/"):
+			e.Path = path.Clean(p)
+		case e.Doc || e.License:
+			dir := fp.docdir
+			if e.License {
+				dir = fp.licensedir
+			}
+			e.Path, e.Source = path.Join(dir, fp.pkg), path.Clean(p)
+		default:
+			// Left for the build to reject, as the path may hold a
+			// macro which is not defined for the target.
+			e.Path = p
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
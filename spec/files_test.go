@@ -0,0 +1,90 @@
+package spec
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseFilesLine(t *testing.T) {
+	fp := newFilesParser("demo", "/usr/share/doc", "/usr/share/licenses")
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"%defattr(-,root,root,0755)", "[]"},
+		{"/usr/bin/demo", `[{/usr/bin/demo  {   } { root root 0755} [] []}]`},
+		{"%attr(4755, root, wheel) /usr/bin/su-demo", `[{/usr/bin/su-demo  {4755 root wheel } { root root 0755} [] []}]`},
+		{"%config(noreplace) %verify(not md5 mtime) /etc/demo.conf", `[{/etc/demo.conf  {   } { root root 0755} [config noreplace] [md5 mtime]}]`},
+		{"%doc README NEWS", `[{/usr/share/doc/demo README {   } { root root 0755} [doc] []} {/usr/share/doc/demo NEWS {   } { root root 0755} [doc] []}]`},
+		{"%license COPYING", `[{/usr/share/licenses/demo COPYING {   } { root root 0755} [license] []}]`},
+		{"%dir %lang(de) /usr/share/demo/de", `[{/usr/share/demo/de  {   } { root root 0755} [dir lang=de] []}]`},
+		{`%ghost "/var/log/demo log"`, `[{/var/log/demo log  {   } { root root 0755} [ghost] []}]`},
+		{"%exclude /usr/lib/*.la", `[{/usr/lib/*.la  {   } { root root 0755} [exclude] []}]`},
+		{"%docdir /usr/share/demo", "[]"},
+		{"# a comment", "[]"},
+		{"%{_bindir}/demo", `[{%{_bindir}/demo  {   } { root root 0755} [] []}]`},
+	}
+
+	for _, test := range tests {
+		entries, err := fp.parseLine(test.line)
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+			continue
+		}
+		got := make([]string, len(entries))
+		for i, e := range entries {
+			got[i] = fmt.Sprintf("{%s %s %v %v %v %v}", e.Path, e.Source, e.Attr, e.DefAttr, entryFlags(e), e.NoVerify)
+		}
+		if fmt.Sprint(got) != test.expected {
+			t.Errorf("%q; got %s wanted %s", test.line, fmt.Sprint(got), test.expected)
+		}
+	}
+}
+
+func entryFlags(e FileEntry) []string {
+	var flags []string
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{e.Dir, "dir"}, {e.Config, "config"}, {e.NoReplace, "noreplace"}, {e.MissingOK, "missingok"},
+		{e.Doc, "doc"}, {e.License, "license"}, {e.Ghost, "ghost"}, {e.Exclude, "exclude"},
+		{e.Lang != "", "lang=" + e.Lang},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	return flags
+}
+
+func TestParseFilesLineErrors(t *testing.T) {
+	for _, line := range []string{
+		"%attr(0755,root) /usr/bin/demo",
+		"%attr(0999,root,root) /usr/bin/demo",
+		"%defattr(-,root,root,-,-)",
+		"%config(sometimes) /etc/demo.conf",
+		"%verify(md5) /etc/demo.conf",
+		"%verify(not colour) /etc/demo.conf",
+		"%attr(0755,root,root /usr/bin/demo",
+		`"/usr/bin/demo`,
+	} {
+		fp := newFilesParser("demo", "/usr/share/doc", "/usr/share/licenses")
+		if _, err := fp.parseLine(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
+func TestParseFileList(t *testing.T) {
+	entries, err := ParseFileList([]byte("%lang(fr) /usr/share/locale/fr/demo.mo\n\n%doc extra.txt\n"), &Package{Name: "demo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Lang != "fr" || entries[1].Path != "/usr/share/doc/demo" {
+		t.Errorf("wrong entries; got %+v", entries)
+	}
+	if _, err := ParseFileList([]byte("/ok\n%config(bad) /etc/x\n"), &Package{Name: "demo"}); err == nil || err.Error() != `line 2: unknown %config option "bad"` {
+		t.Errorf("wrong error; got %v", err)
+	}
+}
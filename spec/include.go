@@ -0,0 +1,133 @@
+package spec
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// The maximum nesting of %include statements.
+const maxIncludeDepth = 32
+
+/*
+ParseFS reads the spec file called name from fsys, and parses it.
+
+The file system is also used to resolve the files the spec pulls in with
+%include and %{load:...} when it is evaluated, so it would usually be the
+directory holding the spec file and its sources (the SOURCE directory).
+*/
+func ParseFS(fsys fs.FS, name string) (*SpecFile, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	spec.name, spec.fsys = name, fsys
+	return spec, nil
+}
+
+/*
+Returns the name the spec file was read from with ParseFS, or "" when it was
+parsed from memory.
+*/
+func (s *SpecFile) Filename() string {
+	return s.name
+}
+
+/*
+Sets the file system %include and %{load:...} statements are resolved against
+when the spec file is evaluated. Without one, evaluating a spec file that
+includes other files fails.
+*/
+func (s *SpecFile) SetSourceFS(fsys fs.FS) {
+	s.fsys = fsys
+}
+
+/*
+Resolves a path given to %include or %{load:...} to a name in the source file
+system. Paths inside %{_sourcedir} (which is where %{SOURCEn} points) are made
+relative to it; other absolute paths are looked up from the root of the file
+system.
+*/
+func (ev *evaluator) resolve(p string) (string, error) {
+	if ev.fsys == nil {
+		return "", fmt.Errorf("cannot read %s: no source file system", p)
+	}
+
+	name := p
+	if srcdir, err := ev.exp.expand("%{_sourcedir}"); err == nil && strings.HasPrefix(p, srcdir+"/") {
+		name = p[len(srcdir)+1:]
+	}
+	name = strings.TrimPrefix(path.Clean(name), "/")
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("invalid path %s", p)
+	}
+	return name, nil
+}
+
+/*
+Reads the named file from the source file system, recording it in the list of
+included files, and refusing to read a file that is already being included.
+*/
+func (ev *evaluator) read(p string) (string, []byte, error) {
+	name, err := ev.resolve(p)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, i := range ev.includes {
+		if i == name {
+			return "", nil, fmt.Errorf("%s includes itself: %s", name, strings.Join(append(ev.includes, name), " -> "))
+		}
+	}
+	if len(ev.includes) >= maxIncludeDepth {
+		return "", nil, fmt.Errorf("%%include nested too deeply")
+	}
+
+	data, err := fs.ReadFile(ev.fsys, name)
+	if err != nil {
+		return "", nil, err
+	}
+	if !containsString(ev.spec.IncludedFiles, name) {
+		ev.spec.IncludedFiles = append(ev.spec.IncludedFiles, name)
+	}
+	return name, data, nil
+}
+
+/*
+Handles "%include path": the lines of the file are evaluated as if they
+appeared in place of the %include statement.
+*/
+func (ev *evaluator) include(p string) error {
+	if p == "" {
+		return ev.errorf("%%include requires a file name")
+	}
+
+	name, data, err := ev.read(p)
+	if err != nil {
+		return ev.errorf("%%include: %v", err)
+	}
+
+	ev.includes = append(ev.includes, name)
+	defer func() { ev.includes = ev.includes[:len(ev.includes)-1] }()
+	return ev.run(name, string(data))
+}
+
+/*
+Handles "%{load:path}": the macro definitions in the file are added to the
+current macros.
+*/
+func (ev *evaluator) load(p string) error {
+	_, data, err := ev.read(p)
+	if err != nil {
+		return fmt.Errorf("%%{load:%s}: %v", p, err)
+	}
+
+	ev.exp.macros.Update(parseMacroFile(data))
+	return nil
+}
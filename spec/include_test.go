@@ -0,0 +1,107 @@
+package spec
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var includeFS = fstest.MapFS{
+	"demo.spec": {Data: []byte(`Name:    demo
+Version: 1.0
+Release: 1
+Summary: Includes
+Source1: macros.demo
+Source2: common.inc
+%{load:%{SOURCE1}}
+
+%include %{SOURCE2}
+
+%description
+%{demo_description}
+`)},
+	"macros.demo": {Data: []byte("%demo_description Loaded from a macro file.\n%demo_dep libdemo\n")},
+	"common.inc": {Data: []byte(`# shared fragment
+%if 1
+Requires: %{demo_dep}
+%endif
+%include nested.inc
+`)},
+	"nested.inc": {Data: []byte("BuildRequires: gcc\n")},
+	"bad.spec":   {Data: []byte("Name: bad\nSource0: bad.inc\n%include %{SOURCE0}\n")},
+	"bad.inc":    {Data: []byte("Summary: fine\n\n%if 1 +\n%endif\n")},
+	"cycle.spec": {Data: []byte("Name: cycle\n%include a.inc\n")},
+	"a.inc":      {Data: []byte("%include b.inc\n")},
+	"b.inc":      {Data: []byte("%include a.inc\n")},
+	"split.spec": {Data: []byte("Name: split\n%if 1\n%include endif.inc\n")},
+	"endif.inc":  {Data: []byte("%endif\n")},
+}
+
+func TestIncludes(t *testing.T) {
+	s, err := ParseFS(includeFS, "demo.spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev, err := s.Evaluate(Target{Arch: "x86_64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	efiles := []string{"macros.demo", "common.inc", "nested.inc"}
+	if fmt.Sprintf("%q", ev.IncludedFiles) != fmt.Sprintf("%q", efiles) {
+		t.Errorf("wrong included files; got %q wanted %q", ev.IncludedFiles, efiles)
+	}
+
+	main := ev.Packages[0]
+	if main.Description != "Loaded from a macro file." {
+		t.Errorf("wrong description; got %q", main.Description)
+	}
+	if got := joinDependencies(main.Requires); got != "libdemo" {
+		t.Errorf("wrong requires; got %q", got)
+	}
+	if got := joinDependencies(ev.BuildRequires); got != "gcc" {
+		t.Errorf("wrong build requires; got %q", got)
+	}
+
+	var found bool
+	for _, l := range ev.Lines {
+		if strings.HasPrefix(l.Text, "BuildRequires:") {
+			found = true
+			if l.File != "nested.inc" || l.Number != 1 {
+				t.Errorf("wrong origin for %q; got %s:%d", l.Text, l.File, l.Number)
+			}
+		}
+		if strings.HasPrefix(l.Text, "%include") {
+			t.Errorf("%%include was not resolved: %q", l.Text)
+		}
+	}
+	if !found {
+		t.Error("the included BuildRequires line is missing")
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	tests := map[string]string{
+		"bad.spec":   "bad.inc:3:",
+		"cycle.spec": "b.inc:1: %include: a.inc includes itself",
+		"split.spec": "endif.inc:1: %endif without %if",
+	}
+
+	for name, want := range tests {
+		s, err := ParseFS(includeFS, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.Evaluate(Target{Arch: "x86_64"})
+		if err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("%s: got error %v wanted %q", name, err, want)
+		}
+	}
+
+	s, _ := ParseString("Name: x\n%include foo.inc\n")
+	if _, err := s.Evaluate(Target{Arch: "x86_64"}); err == nil {
+		t.Error("expected an error including a file without a source file system")
+	}
+}
@@ -1,11 +1,11 @@
 package spec
 
 import (
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"regexp"
+	"strings"
 )
 
 var (
@@ -20,6 +20,11 @@ type RPMMacro struct {
 	Name     string
 	Value    string
 	IsGlobal bool
+
+	// Parametric macros ("%define foo(ab:) ...") take arguments, parsed
+	// according to the getopt(3)-style option string in Opts.
+	Parametric bool
+	Opts       string
 }
 
 /*
@@ -42,7 +47,12 @@ func (m RPMMacro) String() string {
 		fmtstr = "%%define %s %s"
 	}
 
-	return fmt.Sprintf(fmtstr, m.Name, m.Value)
+	name := m.Name
+	if m.Parametric {
+		name = fmt.Sprintf("%s(%s)", m.Name, m.Opts)
+	}
+
+	return fmt.Sprintf(fmtstr, name, m.Value)
 }
 
 /*
@@ -50,7 +60,8 @@ Quickly test if the associated `RPMMacro` is equal to the provided one, in
 values only.
 */
 func (m RPMMacro) Equals(n RPMMacro) bool {
-	if m.Name == n.Name && m.Value == n.Value && m.IsGlobal == n.IsGlobal {
+	if m.Name == n.Name && m.Value == n.Value && m.IsGlobal == n.IsGlobal &&
+		m.Parametric == n.Parametric && m.Opts == n.Opts {
 		return true
 	}
 
@@ -78,7 +89,8 @@ Creates a new MacroSet.
 
 Optionally, you can provide several pathnames, by which to load in pre-defined
 macros (in example "$HOME/.rpmmacros"). Providing a directory (such as
-"/etc/rpm/macros") will result in an error.
+"/etc/rpm/macros") will result in an error. To start from one of the bundled
+platform or distribution profiles instead, see LoadProfiles.
 */
 func NewMacroSet(paths ...string) (ms MacroSet, err error) {
 	ms = make(MacroSet)
@@ -119,10 +131,62 @@ func loadMacroFile(path string) (ms MacroSet, err error) {
 		return
 	}
 
-	ms = parseMacroDefinitions(b)
+	ms = parseMacroFile(b)
 	return
 }
 
+/*
+Parses the contents of an rpm macro file (such as "/usr/lib/rpm/macros" or
+"$HOME/.rpmmacros"), where each definition is written as "%name value" or
+"%name(opts) value", and may be continued onto the following lines with a
+trailing backslash. "%define" and "%global" statements are understood as well.
+Macro bodies are not expanded.
+*/
+func parseMacroFile(b []byte) MacroSet {
+	ms := make(MacroSet)
+
+	lines := strings.Split(strings.Replace(string(b), "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		for strings.HasSuffix(line, "\\") && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + "\n" + strings.TrimRight(lines[i], " \t")
+		}
+		if !strings.HasPrefix(line, "%") {
+			// Comments, blank lines and junk.
+			continue
+		}
+
+		global := false
+		line = line[1:]
+		if strings.HasPrefix(line, "define ") || strings.HasPrefix(line, "global ") {
+			global = line[0] == 'g'
+			line = strings.TrimSpace(line[len("define "):])
+		}
+
+		n := macroNameLen(line)
+		if n == 0 {
+			continue
+		}
+
+		macro := NewMacro(line[:n], "", global)
+		rest := line[n:]
+		if strings.HasPrefix(rest, "(") {
+			end := strings.IndexByte(rest, ')')
+			if end < 0 {
+				continue
+			}
+			macro.Parametric, macro.Opts = true, rest[1:end]
+			rest = rest[end+1:]
+		}
+		macro.Value = strings.TrimSpace(rest)
+
+		ms[macro.Name] = macro
+	}
+
+	return ms
+}
+
 /*
 This function takes a byte slice, and parses it, looking for "%define" or
 "%global" statements, and returns any discovered macros in a `MacroSet`.
@@ -157,10 +221,20 @@ func parseMacroDefinitions(b []byte) (ms MacroSet) {
 
 /*
 Expands the macros in the provided byte slice, using the macros present in the
-provided `*MacroSet`. On a successful invocation, this function will return
+provided `MacroSet`. On a successful invocation, this function will return
 a byte slice with all of the macros expanded, and a `nil` error.
+
+References to undefined macros are left as they are, as rpm does. Any
+"%define", "%global" or "%undefine" statements encountered along the way are
+applied to `macros`.
 */
 func ExpandMacros(b []byte, macros MacroSet) (expanded []byte, err error) {
-	err = errors.New("Not implemented")
+	var s string
+	s, err = newExpander(macros).expand(string(b))
+	if err != nil {
+		return
+	}
+
+	expanded = []byte(s)
 	return
 }
@@ -50,5 +50,26 @@ func TestParseMacroDefinitions(t *testing.T) {
 }
 
 func TestNewMacroSetWithPaths(t *testing.T) {
-	return
+	ms, err := NewMacroSet("../testdata/rpmmacros")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emacros := []RPMMacro{
+		{Name: "_topdir", Value: "%(echo $HOME)/rpmbuild"},
+		{Name: "packager", Value: "Jane Doe <jane@example.com>"},
+		{Name: "_smp_mflags", Value: "-j4"},
+		{Name: "vendor_tag", Value: "example", IsGlobal: true},
+		{Name: "multi", Value: "first\nsecond"},
+		{Name: "with_opts", Value: "%{-x:x given} %1", Parametric: true, Opts: "x"},
+	}
+	for _, m := range emacros {
+		if !m.Equals(ms[m.Name]) {
+			t.Errorf("wrong macro %q; got %+v wanted %+v", m.Name, ms[m.Name], m)
+		}
+	}
+
+	if _, err := NewMacroSet("../testdata/nonexistent"); err == nil {
+		t.Error("expected an error loading a nonexistent file")
+	}
 }
@@ -0,0 +1,140 @@
+package spec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+A Matrix holds the results of evaluating a spec file against several
+targets. Results and Errors are parallel to Targets: for every target, exactly
+one of them is set.
+*/
+type Matrix struct {
+	Targets []Target
+	Results []*EvaluatedSpec
+	Errors  []error
+}
+
+/*
+A FieldDiff describes a field of the evaluated spec file which does not have
+the same value for every target of a Matrix. Values is parallel to the
+matrix' Targets.
+*/
+type FieldDiff struct {
+	Field  string
+	Values []string
+}
+
+/*
+Evaluates the spec file once for every given target. Failing to evaluate the
+spec for one target does not stop the others from being evaluated; the error
+is recorded in the matrix instead.
+*/
+func (s *SpecFile) EvaluateMatrix(targets ...Target) *Matrix {
+	m := &Matrix{
+		Targets: targets,
+		Results: make([]*EvaluatedSpec, len(targets)),
+		Errors:  make([]error, len(targets)),
+	}
+	for i, t := range targets {
+		m.Results[i], m.Errors[i] = s.Evaluate(t)
+	}
+	return m
+}
+
+/*
+Returns the fields whose values vary between the targets of the matrix,
+sorted by field name. Fields are named after the EvaluatedSpec fields they
+come from; package fields are prefixed with the name of the package (in
+example "go-vim.Requires"), and each source or patch gets its own field
+("Source0").
+*/
+func (m *Matrix) Diff() []FieldDiff {
+	flat := make([]map[string]string, len(m.Targets))
+	names := make(map[string]struct{})
+	for i := range m.Targets {
+		if m.Errors[i] != nil {
+			flat[i] = map[string]string{"Error": m.Errors[i].Error()}
+		} else {
+			flat[i] = m.Results[i].fields()
+		}
+		for name := range flat[i] {
+			names[name] = struct{}{}
+		}
+	}
+
+	var diffs []FieldDiff
+	for name := range names {
+		values := make([]string, len(flat))
+		differs := false
+		for i, f := range flat {
+			values[i] = f[name]
+			if values[i] != values[0] {
+				differs = true
+			}
+		}
+		if differs {
+			diffs = append(diffs, FieldDiff{Field: name, Values: values})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Field < diffs[j].Field })
+	return diffs
+}
+
+/*
+Flattens the evaluated spec into a set of field names and string values, for
+comparison.
+*/
+func (e *EvaluatedSpec) fields() map[string]string {
+	f := map[string]string{
+		"ArchSupported":  fmt.Sprint(e.ArchSupported()),
+		"ExclusiveArch":  strings.Join(e.ExclusiveArch, " "),
+		"ExcludeArch":    strings.Join(e.ExcludeArch, " "),
+		"ExclusiveOS":    strings.Join(e.ExclusiveOS, " "),
+		"ExcludeOS":      strings.Join(e.ExcludeOS, " "),
+		"BuildRequires":  joinDependencies(e.BuildRequires),
+		"BuildConflicts": joinDependencies(e.BuildConflicts),
+	}
+
+	for _, k := range SourceNumbers(e.Sources) {
+		f["Source"+k] = e.Sources[k]
+	}
+	for _, k := range SourceNumbers(e.Patches) {
+		f["Patch"+k] = e.Patches[k]
+	}
+
+	var pkgs []string
+	for _, p := range e.Packages {
+		pkgs = append(pkgs, p.Name)
+		for name, value := range map[string]string{
+			"EVR":         p.EVR(),
+			"Arch":        p.Arch,
+			"Summary":     p.Summary,
+			"License":     p.License,
+			"Requires":    joinDependencies(p.Requires),
+			"Provides":    joinDependencies(p.Provides),
+			"Conflicts":   joinDependencies(p.Conflicts),
+			"Obsoletes":   joinDependencies(p.Obsoletes),
+			"Recommends":  joinDependencies(p.Recommends),
+			"Suggests":    joinDependencies(p.Suggests),
+			"Supplements": joinDependencies(p.Supplements),
+			"Enhances":    joinDependencies(p.Enhances),
+		} {
+			f[p.Name+"."+name] = value
+		}
+	}
+	f["Packages"] = strings.Join(pkgs, " ")
+
+	return f
+}
+
+func joinDependencies(deps []Dependency) string {
+	s := make([]string, len(deps))
+	for i, d := range deps {
+		s[i] = d.String()
+	}
+	return strings.Join(s, ", ")
+}
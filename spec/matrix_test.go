@@ -0,0 +1,42 @@
+package spec
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEvaluateMatrix(t *testing.T) {
+	s, _ := ParseString(condSpec)
+	m := s.EvaluateMatrix(
+		Target{Arch: "x86_64"},
+		Target{Arch: "aarch64"},
+		Target{Name: "fc40-s390x", Arch: "s390x", Macros: MacroSet{"fedora": NewMacro("fedora", "40", false)}},
+	)
+
+	for i, err := range m.Errors {
+		if err != nil {
+			t.Fatalf("%s: %v", m.Targets[i], err)
+		}
+	}
+
+	diffs := make(map[string][]string)
+	for _, d := range m.Diff() {
+		diffs[d.Field] = d.Values
+	}
+	t.Logf("diff: %q", diffs)
+
+	ediffs := map[string][]string{
+		"ArchSupported": {"true", "true", "false"},
+		"BuildRequires": {"gcc, make, nasm >= 2.15", "gcc, make, arm-helper", "gcc, make"},
+		"Packages":      {"demo demo-devel", "demo demo-devel", "demo demo-devel demo-doc"},
+		"demo.Arch":     {"x86_64", "aarch64", "s390x"},
+	}
+	for field, values := range ediffs {
+		if fmt.Sprintf("%q", diffs[field]) != fmt.Sprintf("%q", values) {
+			t.Errorf("wrong diff for %s; got %q wanted %q", field, diffs[field], values)
+		}
+	}
+	if _, ok := diffs["Source0"]; ok {
+		t.Error("Source0 should not differ between targets")
+	}
+}
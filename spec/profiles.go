@@ -0,0 +1,236 @@
+package spec
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+The macros every profile starts from: the standard directory layout, and the
+architecture lists used by %ifarch (%ix86, %arm64...). This is a small subset
+of rpm's own /usr/lib/rpm/macros.
+*/
+const linuxMacros = `
+%_usr			/usr
+%_usrsrc		%{_usr}/src
+%_prefix		/usr
+%_exec_prefix		%{_prefix}
+%_bindir		%{_exec_prefix}/bin
+%_sbindir		%{_exec_prefix}/sbin
+%_libexecdir		%{_exec_prefix}/libexec
+%_datadir		%{_prefix}/share
+%_sysconfdir		/etc
+%_sharedstatedir	/var/lib
+%_localstatedir		/var
+%_lib			lib
+%_libdir		%{_prefix}/%{_lib}
+%_includedir		%{_prefix}/include
+%_infodir		%{_datadir}/info
+%_mandir		%{_datadir}/man
+%_docdir		%{_datadir}/doc
+%_defaultdocdir		%{_datadir}/doc
+%_defaultlicensedir	%{_datadir}/licenses
+%_initddir		%{_sysconfdir}/rc.d/init.d
+%_rundir		/run
+%_unitdir		%{_prefix}/lib/systemd/system
+%_userunitdir		%{_prefix}/lib/systemd/user
+%_tmppath		/var/tmp
+%_isa			%{?__isa:(%{__isa})}
+
+%ix86			i386 i486 i586 i686 pentium3 pentium4 athlon geode
+%x86_64			x86_64 amd64 em64t
+%arm32			armv3l armv4b armv4l armv4tl armv5tl armv5tel armv5tejl armv6l armv6hl armv7l armv7hl armv7hnl armv8l armv8hl armv8hnl armv8hcnl
+%arm			%{arm32}
+%arm64			aarch64
+%power64		ppc64 ppc64p7 ppc64le
+%s390x			s390x
+%mips32			mips mipsel mipsr6 mipsr6el
+%mips64			mips64 mips64el mips64r6 mips64r6el
+%mips			%{mips32} %{mips64}
+%riscv64		riscv64
+%riscv			%{riscv64}
+`
+
+/*
+The platform profiles, keyed by architecture. These correspond to the
+/usr/lib/rpm/platform/<arch>-linux/macros files.
+*/
+var platformProfiles = map[string]string{
+	"x86_64": `
+%_lib		lib64
+%__isa_name	x86
+%__isa_bits	64
+%__isa		%{__isa_name}-%{__isa_bits}
+`,
+	"aarch64": `
+%_lib		lib64
+%__isa_name	aarch
+%__isa_bits	64
+%__isa		%{__isa_name}-%{__isa_bits}
+`,
+	"i686": `
+%_lib		lib
+%__isa_name	x86
+%__isa_bits	32
+%__isa		%{__isa_name}-%{__isa_bits}
+`,
+	"ppc64le": `
+%_lib		lib64
+%__isa_name	ppc
+%__isa_bits	64
+%__isa		%{__isa_name}-%{__isa_bits}
+`,
+	"s390x": `
+%_lib		lib64
+%__isa_name	s390
+%__isa_bits	64
+%__isa		%{__isa_name}-%{__isa_bits}
+`,
+	"riscv64": `
+%_lib		lib64
+%__isa_name	riscv
+%__isa_bits	64
+%__isa		%{__isa_name}-%{__isa_bits}
+`,
+	"noarch": `
+%_lib		lib
+`,
+}
+
+var reDistroProfile = regexp.MustCompile(`^(fedora|rhel|el|opensuse-leap|opensuse-tumbleweed)(?:-?(\d+)(?:\.(\d+))?)?$`)
+
+/*
+Returns the macro file text of the distribution profile called name, or false
+if there is no such profile.
+*/
+func distroProfile(name string) (string, bool) {
+	m := reDistroProfile.FindStringSubmatch(name)
+	if m == nil {
+		return "", false
+	}
+	major, minor := m[2], m[3]
+
+	var b strings.Builder
+	switch m[1] {
+	case "fedora":
+		if major == "" || minor != "" {
+			return "", false
+		}
+		fmt.Fprintf(&b, "%%fedora %s\n%%fc%s 1\n%%dist .fc%s\n", major, major, major)
+		if n, _ := strconv.Atoi(major); n >= 42 {
+			// Fedora 42 merged /usr/sbin into /usr/bin.
+			b.WriteString("%_sbindir %{_bindir}\n")
+		}
+
+	case "rhel", "el":
+		if major == "" || minor != "" {
+			return "", false
+		}
+		fmt.Fprintf(&b, "%%rhel %s\n%%el%s 1\n%%dist .el%s\n", major, major, major)
+
+	case "opensuse-leap":
+		if major != "15" || minor == "" {
+			return "", false
+		}
+		n, _ := strconv.Atoi(minor)
+		fmt.Fprintf(&b, "%%suse_version 1500\n%%sle_version 15%02d00\n%%is_opensuse 1\n", n)
+		b.WriteString(suseMacros)
+		b.WriteString("%_libexecdir %{_prefix}/lib\n")
+
+	case "opensuse-tumbleweed":
+		if major != "" {
+			return "", false
+		}
+		b.WriteString("%suse_version 1699\n%is_opensuse 1\n")
+		b.WriteString(suseMacros)
+	}
+	return b.String(), true
+}
+
+// The directory layout openSUSE uses, where it differs from rpm's defaults.
+const suseMacros = `
+%_docdir		%{_datadir}/doc/packages
+%_defaultdocdir		%{_datadir}/doc/packages
+%_initddir		%{_sysconfdir}/init.d
+`
+
+/*
+Returns the names of the bundled profiles. The platform profiles are listed
+by name; the distribution profiles take a release number, and are listed as
+patterns, in example "fedora-N".
+*/
+func Profiles() []string {
+	names := []string{"fedora-N", "rhel-N", "el-N", "opensuse-leap-15.N", "opensuse-tumbleweed"}
+	for arch := range platformProfiles {
+		names = append(names, arch)
+	}
+	sort.Strings(names[5:])
+	return names
+}
+
+/*
+Loads the named bundled macro profiles (see Profiles), and returns the macros
+they define.
+
+Every profile builds on a common set of Linux defaults (%_prefix, %_libdir,
+%ix86 and the like), and the profiles are applied in order. In example,
+LoadProfiles("aarch64", "rhel-9") gives the macros of an EL 9 aarch64 build
+root, including %_arch, %_lib, %_isa and %dist.
+*/
+func LoadProfiles(names ...string) (MacroSet, error) {
+	ms := parseMacroFile([]byte(linuxMacros))
+	for _, name := range names {
+		text, ok := platformProfiles[name]
+		if ok {
+			text += fmt.Sprintf("%%_arch %s\n%%_build_arch %s\n%%_target_cpu %s\n", name, name, name)
+		} else if text, ok = distroProfile(name); !ok {
+			return nil, fmt.Errorf("unknown macro profile %q", name)
+		}
+		ms.Update(parseMacroFile([]byte(text)))
+	}
+	return ms, nil
+}
+
+/*
+Creates a Target for the given architecture and (optional) distribution
+release, using the bundled profiles for its macros. The name of the target is
+"<distro>/<arch>", or just the architecture when no distribution is given.
+*/
+func NewTarget(arch, distro string) (Target, error) {
+	profiles, name := []string{arch}, arch
+	if distro != "" {
+		profiles, name = append(profiles, distro), distro+"/"+arch
+	}
+
+	ms, err := LoadProfiles(profiles...)
+	if err != nil {
+		return Target{}, err
+	}
+	return Target{Name: name, Arch: arch, Macros: ms}, nil
+}
+
+/*
+Creates a Target for every combination of the given architectures and
+distribution releases, such as for passing to EvaluateMatrix. The targets are
+ordered by distribution first.
+*/
+func NewTargets(archs []string, distros ...string) ([]Target, error) {
+	if len(distros) == 0 {
+		distros = []string{""}
+	}
+
+	var targets []Target
+	for _, distro := range distros {
+		for _, arch := range archs {
+			t, err := NewTarget(arch, distro)
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, t)
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,88 @@
+package spec
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	ms, err := LoadProfiles("aarch64", "rhel-9")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"%{_arch}":    "aarch64",
+		"%{_libdir}":  "/usr/lib64",
+		"%{_isa}":     "(aarch-64)",
+		"%{?dist}":    ".el9",
+		"%{rhel}":     "9",
+		"%{?fedora}":  "",
+		"%{_bindir}":  "/usr/bin",
+		"%{_sbindir}": "/usr/sbin",
+	}
+	for in, want := range tests {
+		got, err := ExpandMacros([]byte(in), ms)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+		} else if string(got) != want {
+			t.Errorf("%q; got %q wanted %q", in, got, want)
+		}
+	}
+}
+
+func TestLoadProfilesDistributions(t *testing.T) {
+	tests := map[string]map[string]string{
+		"noarch":              {"%{_libdir}": "/usr/lib", "%{_isa}": ""},
+		"fedora-42":           {"%{dist}": ".fc42", "%{fc42}": "1", "%{_sbindir}": "/usr/bin"},
+		"el8":                 {"%{dist}": ".el8", "%{el8}": "1"},
+		"opensuse-leap-15.5":  {"%{sle_version}": "150500", "%{_docdir}": "/usr/share/doc/packages", "%{?dist}": ""},
+		"opensuse-tumbleweed": {"%{is_opensuse}": "1", "%{_libexecdir}": "/usr/libexec"},
+	}
+
+	for profile, macros := range tests {
+		ms, err := LoadProfiles(profile)
+		if err != nil {
+			t.Errorf("%s: %v", profile, err)
+			continue
+		}
+		for in, want := range macros {
+			if got, _ := ExpandMacros([]byte(in), ms); string(got) != want {
+				t.Errorf("%s: %q; got %q wanted %q", profile, in, got, want)
+			}
+		}
+	}
+
+	for _, bad := range []string{"fedora", "rhel-9.2", "opensuse-leap-42", "solaris"} {
+		if _, err := LoadProfiles(bad); err == nil {
+			t.Errorf("expected an error loading profile %q", bad)
+		}
+	}
+}
+
+func TestNewTargets(t *testing.T) {
+	targets, err := NewTargets([]string{"x86_64", "i686"}, "fedora-40", "rhel-9")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, t := range targets {
+		names = append(names, t.String())
+	}
+	enames := []string{"fedora-40/x86_64", "fedora-40/i686", "rhel-9/x86_64", "rhel-9/i686"}
+	if fmt.Sprintf("%q", names) != fmt.Sprintf("%q", enames) {
+		t.Errorf("wrong targets; got %q wanted %q", names, enames)
+	}
+
+	ev, err := parsedSpec.Evaluate(targets[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Macros["GOARCH"].Value != "386" {
+		t.Errorf("%%ifarch %%ix86 did not match i686; GOARCH is %q", ev.Macros["GOARCH"].Value)
+	}
+	if ev.Packages[0].Release != "1.fc40" {
+		t.Errorf("wrong release; got %q wanted %q", ev.Packages[0].Release, "1.fc40")
+	}
+}
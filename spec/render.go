@@ -0,0 +1,68 @@
+package spec
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+/*
+A Position locates a line of a spec file, or of a file it included.
+*/
+type Position struct {
+	File string
+	Line int
+}
+
+/*
+A SourceMap maps each line of a rendered spec file back to the line of the
+input it was expanded from. The first element is for the first line of the
+output.
+*/
+type SourceMap []Position
+
+/*
+Returns the position of the input line that the given (1-based) line of the
+rendered output came from.
+*/
+func (m SourceMap) Lookup(line int) (Position, bool) {
+	if line < 1 || line > len(m) {
+		return Position{}, false
+	}
+	return m[line-1], true
+}
+
+/*
+Writes the evaluated spec file to w, the way "rpmspec --parse" prints it: all
+macros are expanded, and conditionals and macro definitions are left out.
+Shell (%(...)) and Lua expansions, and macros that are not defined (such as
+%setup, unless a profile defines it) are written as they are.
+
+If withSourceMap is true, a SourceMap for the output is returned as well.
+*/
+func (e *EvaluatedSpec) Render(w io.Writer, withSourceMap bool) (SourceMap, error) {
+	var sm SourceMap
+	if withSourceMap {
+		sm = make(SourceMap, 0, len(e.Lines))
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, l := range e.Lines {
+		if _, err := bw.WriteString(l.Text + "\n"); err != nil {
+			return nil, err
+		}
+		if withSourceMap {
+			sm = append(sm, Position{File: l.File, Line: l.Number})
+		}
+	}
+	return sm, bw.Flush()
+}
+
+/*
+Returns the evaluated spec file as text; see Render.
+*/
+func (e *EvaluatedSpec) String() string {
+	var b strings.Builder
+	e.Render(&b, false)
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package spec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	s, _ := ParseString(`%global ver 2.0
+Name: demo
+Version: %{ver}
+Release: 1%{?dist}
+Summary: Rendering
+%ifarch x86_64
+BuildRequires: nasm
+%else
+BuildRequires: gcc
+%endif
+
+%description
+Built for %{_arch}.
+
+%build
+make %(nproc) ARCH=%{_arch}
+`)
+	ev, err := s.Evaluate(Target{Arch: "x86_64", Macros: MacroSet{"dist": NewMacro("dist", ".fc40", false)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eout := `Name: demo
+Version: 2.0
+Release: 1.fc40
+Summary: Rendering
+BuildRequires: nasm
+
+%description
+Built for x86_64.
+
+%build
+make %(nproc) ARCH=x86_64
+`
+	var b bytes.Buffer
+	sm, err := ev.Render(&b, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != eout {
+		t.Errorf("wrong output; got\n%s\nwanted\n%s", b.String(), eout)
+	}
+	if ev.String() != eout {
+		t.Errorf("String() differs from Render()")
+	}
+
+	elines := []int{2, 3, 4, 5, 7, 11, 12, 13, 14, 15, 16}
+	if len(sm) != len(elines) {
+		t.Fatalf("wrong source map length; got %d wanted %d", len(sm), len(elines))
+	}
+	for i, want := range elines {
+		if pos, ok := sm.Lookup(i + 1); !ok || pos.Line != want {
+			t.Errorf("output line %d; got input line %d wanted %d", i+1, pos.Line, want)
+		}
+	}
+	if _, ok := sm.Lookup(0); ok {
+		t.Error("line 0 should not be in the source map")
+	}
+
+	if sm, _ := ev.Render(&b, false); sm != nil {
+		t.Error("no source map should be returned when not asked for")
+	}
+}
@@ -0,0 +1,26 @@
+package spec
+
+/*
+A Scriptlet is one of the scripts rpm runs when a package is installed,
+upgraded or removed, such as the body of a %post section.
+*/
+type Scriptlet struct {
+	// Program is the interpreter and its arguments, as given with "-p".
+	// It defaults to /bin/sh; "<lua>" selects rpm's built-in Lua
+	// interpreter.
+	Program []string
+
+	// Body is the script itself, which may be empty when Program does
+	// all the work (as in "%post -p /sbin/ldconfig").
+	Body string
+}
+
+/*
+Returns the interpreter of the scriptlet, with its arguments.
+*/
+func (s Scriptlet) Interpreter() []string {
+	if len(s.Program) == 0 {
+		return []string{"/bin/sh"}
+	}
+	return s.Program
+}
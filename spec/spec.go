@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"regexp"
 	"strings"
@@ -30,6 +31,11 @@ var (
 type SpecFile struct {
 	raw    []byte
 	macros MacroSet
+
+	// The name the spec file was read from, and the file system its
+	// sources (and any %include'd files) live in.
+	name string
+	fsys fs.FS
 }
 
 func (s *SpecFile) findSubmatch(re *regexp.Regexp, nmatches int) ([]byte, error) {
@@ -222,7 +228,9 @@ func (s *SpecFile) Summary() string {
 Returns the release of the package in the spec file. The "release" can also
 be referred to as the "build number", and sometimes has an additional "dist"
 tag attached to it. If there is a "dist" macro in the release string,
-it will be stripped.
+it will be stripped, since the distribution is not known here; evaluate the
+spec for a Target built from one of the distribution profiles (see
+LoadProfiles) to get the release the way it would be built.
 
 A zero-length string indicates the spec file failed to be parsed, and may
 indicated a malformed spec.
@@ -0,0 +1,177 @@
+package spec
+
+import (
+	"strconv"
+	"strings"
+)
+
+/*
+CompareVersions compares two version (or release) strings using the same
+algorithm as rpm's rpmvercmp(). It returns -1 if a is older than b, 0 if they
+are equal, and 1 if a is newer than b.
+
+Versions are split into alternating runs of digits and letters; numeric runs
+are compared numerically, alphabetic runs lexically, and a numeric run is
+always newer than an alphabetic one. A tilde ("1.0~rc1") sorts before
+anything, even the end of the string, and a caret ("1.0^git1") sorts after the
+end of the string but before anything else.
+*/
+func CompareVersions(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	one, two := a, b
+	for len(one) > 0 || len(two) > 0 {
+		one, two = trimVersionSeparators(one), trimVersionSeparators(two)
+
+		// Handle the tilde separator; it sorts before everything else.
+		if strings.HasPrefix(one, "~") || strings.HasPrefix(two, "~") {
+			if !strings.HasPrefix(one, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(two, "~") {
+				return -1
+			}
+			one, two = one[1:], two[1:]
+			continue
+		}
+
+		// Handle the caret separator. It is like the tilde, except that if
+		// one of the strings ends, that one sorts first.
+		if strings.HasPrefix(one, "^") || strings.HasPrefix(two, "^") {
+			if len(one) == 0 {
+				return -1
+			}
+			if len(two) == 0 {
+				return 1
+			}
+			if one[0] != '^' {
+				return 1
+			}
+			if two[0] != '^' {
+				return -1
+			}
+			one, two = one[1:], two[1:]
+			continue
+		}
+
+		if len(one) == 0 || len(two) == 0 {
+			break
+		}
+
+		// Grab the first completely alphabetic or completely numeric
+		// segment from both strings; the type is decided by the first one.
+		isnum := isDigit(one[0])
+		seg1, seg2 := versionSegment(one, isnum), versionSegment(two, isnum)
+		one, two = one[len(seg1):], two[len(seg2):]
+
+		// If the segments are of different types, the numeric one is
+		// newer.
+		if len(seg2) == 0 {
+			if isnum {
+				return 1
+			}
+			return -1
+		}
+
+		if isnum {
+			seg1 = strings.TrimLeft(seg1, "0")
+			seg2 = strings.TrimLeft(seg2, "0")
+			if len(seg1) > len(seg2) {
+				return 1
+			} else if len(seg2) > len(seg1) {
+				return -1
+			}
+		}
+
+		if c := strings.Compare(seg1, seg2); c != 0 {
+			return c
+		}
+	}
+
+	if len(one) == 0 && len(two) == 0 {
+		return 0
+	}
+	if len(one) == 0 {
+		return -1
+	}
+	return 1
+}
+
+/*
+ParseEVR splits an "[epoch:]version[-release]" string into its components.
+The epoch and release are returned as zero-length strings when they are not
+present.
+*/
+func ParseEVR(evr string) (epoch, version, release string) {
+	if i := strings.IndexByte(evr, ':'); i >= 0 {
+		if _, err := strconv.ParseUint(evr[:i], 10, 32); err == nil {
+			epoch, evr = evr[:i], evr[i+1:]
+		}
+	}
+	if i := strings.LastIndexByte(evr, '-'); i >= 0 {
+		evr, release = evr[:i], evr[i+1:]
+	}
+	return epoch, evr, release
+}
+
+/*
+CompareEVR compares two "[epoch:]version[-release]" strings the way rpm does
+when resolving versioned dependencies: a missing epoch is treated as 0, and
+the releases are only compared when both strings carry one.
+*/
+func CompareEVR(a, b string) int {
+	e1, v1, r1 := ParseEVR(a)
+	e2, v2, r2 := ParseEVR(b)
+
+	if c := compareEpochs(e1, e2); c != 0 {
+		return c
+	}
+	if c := CompareVersions(v1, v2); c != 0 {
+		return c
+	}
+	if r1 == "" || r2 == "" {
+		return 0
+	}
+	return CompareVersions(r1, r2)
+}
+
+func compareEpochs(a, b string) int {
+	ea, _ := strconv.ParseUint(a, 10, 32)
+	eb, _ := strconv.ParseUint(b, 10, 32)
+	if ea < eb {
+		return -1
+	} else if ea > eb {
+		return 1
+	}
+	return 0
+}
+
+func versionSegment(s string, numeric bool) string {
+	i := 0
+	for i < len(s) {
+		if numeric && !isDigit(s[i]) || !numeric && !isAlpha(s[i]) {
+			break
+		}
+		i++
+	}
+	return s[:i]
+}
+
+// trimVersionSeparators strips everything up to the next alphanumeric
+// character, tilde or caret.
+func trimVersionSeparators(s string) string {
+	for len(s) > 0 && !isDigit(s[0]) && !isAlpha(s[0]) && s[0] != '~' && s[0] != '^' {
+		s = s[1:]
+	}
+	return s
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,57 @@
+package spec
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0.1", "2.0", 1},
+		{"1.10", "1.9", 1},
+		{"1.001", "1.1", 0},
+		{"1.0a", "1.0", 1},
+		{"1.0", "1.0a", -1},
+		{"a", "1", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		{"1.0^", "1.0~", 1},
+		{"1_0", "1.0", 0},
+	}
+
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q); got %d wanted %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCompareEVR(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1:1.0-1", "2.0-1", 1},
+		{"0:1.0-1", "1.0-1", 0},
+		{"1.0-2", "1.0-1", 1},
+		{"1.0", "1.0-1", 0},
+		{"1.0-1.fc39", "1.0-1.fc40", -1},
+	}
+
+	for _, tt := range tests {
+		if got := CompareEVR(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareEVR(%q, %q); got %d wanted %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParseEVR(t *testing.T) {
+	e, v, r := ParseEVR("2:1.1-3.el9")
+	if e != "2" || v != "1.1" || r != "3.el9" {
+		t.Errorf("got %q %q %q wanted %q %q %q", e, v, r, "2", "1.1", "3.el9")
+	}
+}
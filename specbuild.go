@@ -0,0 +1,468 @@
+package rpm
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nesv/rpm/spec"
+)
+
+var ErrFilesCheck = errors.New("missing or unpackaged files")
+
+// The bits of the FILEVERIFYFLAGS tag, by the names %verify uses.
+var verifyBits = map[string]uint32{
+	"md5": VerifyDigest, "filedigest": VerifyDigest, "size": VerifySize,
+	"link": VerifyLinkTo, "user": VerifyUser, "owner": VerifyUser,
+	"group": VerifyGroup, "mtime": VerifyMTime, "mode": VerifyMode,
+	"rdev": VerifyRdev, "caps": VerifyCaps,
+}
+
+// The directories whose contents are documentation, as with rpm's
+// %__docdir_path.
+var docDirs = []string{"/usr/share/doc/", "/usr/share/man/", "/usr/share/info/", "/usr/doc/", "/usr/man/", "/usr/info/"}
+
+/*
+SpecBuildOptions control how packages are built from a spec file.
+*/
+type SpecBuildOptions struct {
+	// BuildDir is the directory the sources were built in, which relative
+	// %doc and %license files, and the file lists of "%files -f", are
+	// read from.
+	BuildDir string
+
+	// Compressor is the payload compression of the packages, as for
+	// Builder.
+	Compressor string
+}
+
+/*
+A FilesReport lists the problems found when matching the %files sections of a
+spec file against a buildroot, as rpmbuild's check for missing and unpackaged
+files does.
+*/
+type FilesReport struct {
+	// Missing lists the %files entries which match nothing.
+	Missing []string
+
+	// Unpackaged lists the files of the buildroot that are not in any
+	// package, and not excluded with %exclude either.
+	Unpackaged []string
+}
+
+/*
+Reports whether every listed file was found, and every installed file is
+packaged.
+*/
+func (r *FilesReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Unpackaged) == 0
+}
+
+/*
+Returns the report in the form rpmbuild prints it.
+*/
+func (r *FilesReport) String() string {
+	var b strings.Builder
+	for _, m := range r.Missing {
+		fmt.Fprintf(&b, "File not found: %s\n", m)
+	}
+	if len(r.Unpackaged) > 0 {
+		b.WriteString("Installed (but unpackaged) file(s) found:\n")
+		for _, u := range r.Unpackaged {
+			fmt.Fprintf(&b, "   %s\n", u)
+		}
+	}
+	return b.String()
+}
+
+// A buildrootFile is a file found in the buildroot (or the build directory,
+// for relative %doc files).
+type buildrootFile struct {
+	name string // the absolute path once installed
+	path string // the path on disk, or "" for missing %ghost files
+	info fs.FileInfo
+}
+
+/*
+Returns a Builder for every package of an evaluated spec file that has a
+%files section, with its files taken from the buildroot, along with the report
+of missing and unpackaged files.
+
+The entries of the %files sections are matched against the buildroot the way
+rpmbuild does: glob patterns are expanded, a directory stands for everything
+in it unless listed with %dir, and %exclude removes files from a package while
+still accounting for them. Modes and owners come from %attr and %defattr,
+falling back to the installed files' own modes and root ownership.
+*/
+func SpecBuilders(es *spec.EvaluatedSpec, buildroot string, opts SpecBuildOptions) ([]*Builder, *FilesReport, error) {
+	installed, err := walkBuildroot(buildroot)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	main := es.Packages[0]
+	report := &FilesReport{}
+	accounted := make(map[string]bool)
+
+	var builders []*Builder
+	for _, pkg := range es.Packages {
+		if pkg.Files == nil {
+			continue
+		}
+		entries := pkg.Files
+		for _, list := range pkg.FileLists {
+			if opts.BuildDir == "" {
+				return nil, nil, fmt.Errorf("%%files -f %s: no build directory", list)
+			}
+			data, err := os.ReadFile(filepath.Join(opts.BuildDir, list))
+			if err != nil {
+				return nil, nil, err
+			}
+			more, err := spec.ParseFileList(data, pkg)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", list, err)
+			}
+			entries = append(append([]spec.FileEntry(nil), entries...), more...)
+		}
+
+		files, err := packageFiles(entries, installed, buildroot, opts.BuildDir, report, accounted)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		b := NewBuilder(pkg)
+		b.Files = files
+		b.Scriptlets = pkg.Scriptlets
+		b.Changelog = es.Changelog
+		b.Compressor = opts.Compressor
+		b.FileAttrs = DefaultFileAttrs
+		b.SourceRPM = fmt.Sprintf("%s-%s-%s.src.rpm", main.Name, main.Version, main.Release)
+		builders = append(builders, b)
+	}
+
+	names := make([]string, 0, len(installed))
+	for name, f := range installed {
+		if !f.info.IsDir() && !accounted[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	report.Unpackaged = names
+	return builders, report, nil
+}
+
+/*
+Returns the headers of the packages an evaluated spec file declares, as
+"rpmspec -q" sees them: with the metadata, dependencies, scriptlets and
+changelog of the packages, but no files, build time or payload. If builtOnly
+is set, only the packages with a %files section, which are the ones that get
+built, are returned.
+*/
+func SpecHeaders(es *spec.EvaluatedSpec, builtOnly bool) ([]*Header, error) {
+	main := es.Packages[0]
+	var headers []*Header
+	for _, pkg := range es.Packages {
+		if builtOnly && pkg.Files == nil {
+			continue
+		}
+		b := NewBuilder(pkg)
+		b.Scriptlets = pkg.Scriptlets
+		b.Changelog = es.Changelog
+		b.SourceRPM = fmt.Sprintf("%s-%s-%s.src.rpm", main.Name, main.Version, main.Release)
+		if b.Scriptlets == nil {
+			b.Scriptlets = make(map[string]spec.Scriptlet)
+		}
+		h, err := b.header(nil, false, time.Time{}, false)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, h)
+	}
+	return headers, nil
+}
+
+/*
+Builds the packages of an evaluated spec file from the buildroot, and writes
+them to outdir/ARCH/NAME-VERSION-RELEASE.ARCH.rpm, as rpmbuild does. It returns
+the paths of the packages written.
+
+Nothing is written if files are missing or unpackaged: the error is then
+ErrFilesCheck, and the report says which files.
+*/
+func BuildSpec(es *spec.EvaluatedSpec, buildroot, outdir string, opts SpecBuildOptions) ([]string, *FilesReport, error) {
+	builders, report, err := SpecBuilders(es, buildroot, opts)
+	if err != nil {
+		return nil, report, err
+	}
+	if !report.OK() {
+		return nil, report, ErrFilesCheck
+	}
+
+	var written []string
+	for _, b := range builders {
+		p := b.Package
+		arch := b.arch()
+		name := filepath.Join(outdir, arch, fmt.Sprintf("%s-%s-%s.%s.rpm", p.Name, p.Version, p.Release, arch))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return written, report, err
+		}
+		if err := writeFile(name, b); err != nil {
+			return written, report, err
+		}
+		written = append(written, name)
+	}
+	return written, report, nil
+}
+
+func writeFile(name string, b *Builder) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := b.Write(f); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+	return f.Close()
+}
+
+// walkBuildroot returns everything in the buildroot, by its installed path.
+func walkBuildroot(buildroot string) (map[string]buildrootFile, error) {
+	installed := make(map[string]buildrootFile)
+	err := filepath.WalkDir(buildroot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == buildroot {
+			return err
+		}
+		rel, err := filepath.Rel(buildroot, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name := "/" + filepath.ToSlash(rel)
+		installed[name] = buildrootFile{name: name, path: p, info: info}
+		return nil
+	})
+	return installed, err
+}
+
+// matchInstalled returns the installed files a %files path matches, along
+// with the contents of matched directories unless dirOnly is set.
+func matchInstalled(installed map[string]buildrootFile, pattern string, dirOnly bool) []buildrootFile {
+	var matched []buildrootFile
+	if !strings.ContainsAny(pattern, "*?[") {
+		if f, ok := installed[pattern]; ok {
+			matched = append(matched, f)
+		}
+	} else {
+		for name, f := range installed {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = append(matched, f)
+			}
+		}
+	}
+
+	if !dirOnly {
+		for _, m := range append([]buildrootFile(nil), matched...) {
+			if !m.info.IsDir() {
+				continue
+			}
+			for name, f := range installed {
+				if strings.HasPrefix(name, m.name+"/") {
+					matched = append(matched, f)
+				}
+			}
+		}
+	}
+	return matched
+}
+
+// matchSources returns the files in the build directory a relative %doc or
+// %license entry matches, installed under the entry's path.
+func matchSources(e spec.FileEntry, builddir string) ([]buildrootFile, error) {
+	if builddir == "" {
+		return nil, fmt.Errorf("%s: no build directory", e.Source)
+	}
+	paths, err := filepath.Glob(filepath.Join(builddir, filepath.FromSlash(e.Source)))
+	if err != nil || len(paths) == 0 {
+		return nil, err
+	}
+
+	var matched []buildrootFile
+	for _, p := range paths {
+		dest := path.Join(e.Path, filepath.Base(p))
+		err := filepath.WalkDir(p, func(q string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(p, q)
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			matched = append(matched, buildrootFile{name: path.Join(dest, filepath.ToSlash(rel)), path: q, info: info})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return matched, nil
+}
+
+/*
+Works out the files of a package from the entries of its %files section,
+recording what is missing in the report, and what was matched in accounted.
+*/
+func packageFiles(entries []spec.FileEntry, installed map[string]buildrootFile, buildroot, builddir string, report *FilesReport, accounted map[string]bool) ([]BuildFile, error) {
+	files := make(map[string]BuildFile)
+	excluded := make(map[string]bool)
+	docdirs := make(map[string]spec.FileEntry)
+
+	for _, e := range entries {
+		var matched []buildrootFile
+		var err error
+		switch {
+		case e.Source != "":
+			if matched, err = matchSources(e, builddir); err != nil {
+				return nil, err
+			}
+			docdirs[e.Path] = e
+		case !strings.HasPrefix(e.Path, "/"):
+			return nil, &spec.SyntaxError{File: e.Pos.File, Line: e.Pos.Line, Err: fmt.Errorf("file %s must begin with \"/\"", e.Path)}
+		default:
+			matched = matchInstalled(installed, e.Path, e.Dir)
+		}
+
+		if len(matched) == 0 {
+			switch {
+			case e.Ghost && !strings.ContainsAny(e.Path, "*?["):
+				// %ghost files need not be installed.
+				matched = []buildrootFile{{name: e.Path}}
+			case e.Source != "":
+				report.Missing = append(report.Missing, filepath.Join(builddir, e.Source))
+				continue
+			default:
+				report.Missing = append(report.Missing, filepath.Join(buildroot, e.Path))
+				continue
+			}
+		}
+
+		for _, m := range matched {
+			accounted[m.name] = true
+			if e.Exclude {
+				excluded[m.name] = true
+				continue
+			}
+			f, err := buildFile(m, e)
+			if err != nil {
+				return nil, err
+			}
+			files[m.name] = f
+		}
+	}
+
+	// The directories relative %doc and %license files are put in belong
+	// to the package as well.
+	for dir, e := range docdirs {
+		if _, ok := files[dir]; !ok {
+			e.Dir = true
+			f, _ := buildFile(buildrootFile{name: dir}, e)
+			files[dir] = f
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if !excluded[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	list := make([]BuildFile, len(names))
+	for i, name := range names {
+		list[i] = files[name]
+	}
+	return list, nil
+}
+
+// buildFile returns the BuildFile for a matched file, applying the
+// directives of its %files entry.
+func buildFile(m buildrootFile, e spec.FileEntry) (BuildFile, error) {
+	f := BuildFile{Name: m.name, Mode: 0644, Lang: e.Lang, Caps: e.Caps}
+	if e.Dir {
+		f.Mode = fs.ModeDir | 0755
+	}
+	if m.info != nil {
+		f.Mode, f.ModTime = m.info.Mode(), m.info.ModTime()
+		switch {
+		case m.info.Mode().IsRegular():
+			f.Path = m.path
+		case m.info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(m.path)
+			if err != nil {
+				return f, err
+			}
+			f.LinkTo = target
+		}
+	}
+
+	mode := e.Attr.Mode
+	switch {
+	case mode != "":
+	case f.Mode.IsDir():
+		mode = e.DefAttr.DirMode
+	default:
+		mode = e.DefAttr.Mode
+	}
+	if mode != "" && f.Mode&fs.ModeSymlink == 0 {
+		perm, _ := strconv.ParseUint(mode, 8, 32)
+		f.Mode = f.Mode.Type() | unixFileMode(uint32(perm)&07777)
+	}
+
+	f.Owner, f.Group = e.Attr.Owner, e.Attr.Group
+	if f.Owner == "" {
+		f.Owner = e.DefAttr.Owner
+	}
+	if f.Group == "" {
+		f.Group = e.DefAttr.Group
+	}
+
+	for _, flag := range []struct {
+		set  bool
+		flag FileFlags
+	}{
+		{e.Config, FileConfig}, {e.NoReplace, FileNoReplace}, {e.MissingOK, FileMissingOK},
+		{e.Doc, FileDoc}, {e.License, FileLicense}, {e.Readme, FileReadme},
+		{e.Ghost, FileGhost}, {e.Artifact, FileArtifact},
+	} {
+		if flag.set {
+			f.Flags |= flag.flag
+		}
+	}
+	if !e.License {
+		for _, dir := range docDirs {
+			if strings.HasPrefix(f.Name, dir) {
+				f.Flags |= FileDoc
+			}
+		}
+	}
+	for _, check := range e.NoVerify {
+		f.NoVerify |= verifyBits[check]
+	}
+	return f, nil
+}
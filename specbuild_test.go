@@ -0,0 +1,187 @@
+package rpm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nesv/rpm/spec"
+)
+
+var buildSpec = `Name: demo
+Version: 1.0
+Release: 1
+Summary: Demo
+License: MIT
+BuildArch: noarch
+
+%description
+Demo.
+
+%package data
+Summary: Data
+
+%description data
+Data.
+
+%post
+echo hello
+
+%files
+%defattr(-,root,root,0700)
+%doc README
+/usr/bin/*
+%attr(0600,demo,-) %config(noreplace) /etc/demo.conf
+%ghost /var/log/demo.log
+%exclude /usr/bin/*.debug
+
+%files data
+%dir /usr/share/demo
+/usr/share/demo/data.txt
+%verify(not mtime) /usr/share/demo/extra
+%LISTED%
+
+%changelog
+* Wed May 01 2024 Jane Doe <jane@example.com> - 1.0-1
+- Initial package
+`
+
+// writeTree creates the files in dir, with their content; names ending in
+// "/" are directories, and content starting with "->" makes a symlink.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		switch {
+		case strings.HasSuffix(name, "/"):
+			err = os.MkdirAll(p, 0755)
+		case strings.HasPrefix(content, "->"):
+			err = os.Symlink(content[2:], p)
+		default:
+			err = os.WriteFile(p, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func evaluateBuildSpec(t *testing.T, listed string) *spec.EvaluatedSpec {
+	s, err := spec.ParseString(strings.Replace(buildSpec, "%LISTED%", listed, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	es, err := s.Evaluate(spec.Target{Arch: "x86_64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return es
+}
+
+func TestSpecBuildersReport(t *testing.T) {
+	buildroot, builddir := t.TempDir(), t.TempDir()
+	writeTree(t, buildroot, map[string]string{
+		"usr/bin/demo":               "#!/bin/sh\n",
+		"usr/bin/demo.debug":         "debug",
+		"etc/demo.conf":              "x=1\n",
+		"usr/share/demo/data.txt":    "data\n",
+		"usr/share/demo/unpackaged":  "oops\n",
+		"usr/share/demo/extra/a.txt": "a\n",
+		"usr/lib/stray.so":           "stray",
+	})
+	writeTree(t, builddir, map[string]string{"README": "read me\n"})
+
+	es := evaluateBuildSpec(t, "/usr/share/demo/missing")
+	_, report, err := SpecBuilders(es, buildroot, SpecBuildOptions{BuildDir: builddir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "File not found: " + filepath.Join(buildroot, "/usr/share/demo/missing") + "\n" +
+		"Installed (but unpackaged) file(s) found:\n   /usr/lib/stray.so\n   /usr/share/demo/unpackaged\n"
+	t.Logf("expecting %q", expected)
+	if got := report.String(); got != expected || report.OK() {
+		t.Errorf("wrong report; got %q wanted %q", got, expected)
+	}
+
+	if _, _, err := BuildSpec(es, buildroot, t.TempDir(), SpecBuildOptions{BuildDir: builddir}); err != ErrFilesCheck {
+		t.Errorf("expected ErrFilesCheck; got %v", err)
+	}
+}
+
+func TestBuildSpec(t *testing.T) {
+	buildroot, builddir, outdir := t.TempDir(), t.TempDir(), t.TempDir()
+	writeTree(t, buildroot, map[string]string{
+		"usr/bin/demo":               "#!/bin/sh\n",
+		"usr/bin/demo-link":          "->demo",
+		"usr/bin/demo.debug":         "debug",
+		"etc/demo.conf":              "x=1\n",
+		"usr/share/demo/data.txt":    "data\n",
+		"usr/share/demo/extra/a.txt": "a\n",
+	})
+	writeTree(t, builddir, map[string]string{"README": "read me\n"})
+
+	es := evaluateBuildSpec(t, "")
+	written, report, err := BuildSpec(es, buildroot, outdir, SpecBuildOptions{BuildDir: builddir, Compressor: "xz"})
+	if err != nil {
+		t.Fatalf("%v\n%s", err, report)
+	}
+	for i, name := range []string{"demo-1.0-1.noarch.rpm", "demo-data-1.0-1.noarch.rpm"} {
+		if want := filepath.Join(outdir, "noarch", name); i >= len(written) || written[i] != want {
+			t.Fatalf("wrong packages written; got %q wanted %q", written, want)
+		}
+	}
+
+	expected := map[string]string{
+		written[0]: `[/etc/demo.conf -rw------- demo:root 11 /usr/bin/demo -rw-r--r-- root:root 0 /usr/bin/demo-link Lrwxrwxrwx root:root 0 ` +
+			`/usr/share/doc/demo drwx------ root:root 2 /usr/share/doc/demo/README -rw-r--r-- root:root 2 /var/log/demo.log -rw-r--r-- root:root 40]`,
+		written[1]: `[/usr/share/demo drwxr-xr-x root:root 0 /usr/share/demo/data.txt -rw-r--r-- root:root 0 ` +
+			`/usr/share/demo/extra drwxr-xr-x root:root 0 /usr/share/demo/extra/a.txt -rw-r--r-- root:root 0]`,
+	}
+	for _, name := range written {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		p, err := ReadPackage(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files, err := p.Header.Files()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, file := range files {
+			got = append(got, fmt.Sprintf("%s %v %s:%s %x", file.Name, file.FileMode(), file.Owner, file.Group, file.Flags))
+		}
+		t.Logf("expecting %q", expected[name])
+		if fmt.Sprint(got) != expected[name] {
+			t.Errorf("%s: wrong files; got %q wanted %q", filepath.Base(name), fmt.Sprint(got), expected[name])
+		}
+
+		if r, err := p.VerifyDigests(); err != nil || !r.OK() {
+			t.Errorf("%s: digests do not verify; got %v %v", filepath.Base(name), r, err)
+		}
+		if got := p.Header.SourceRPM(); got != "demo-1.0-1.src.rpm" {
+			t.Errorf("wrong source package; got %q", got)
+		}
+		if changelog, _ := p.Header.Changelog(); len(changelog) != 1 {
+			t.Errorf("changelog is missing; got %v", changelog)
+		}
+	}
+
+	f, _ := os.Open(written[1])
+	defer f.Close()
+	data, _ := ReadPackage(f)
+	files, _ := data.Header.Files()
+	if files[3].VerifyFlags != ^uint32(1<<5) {
+		t.Errorf("wrong verify flags; got %#x", files[3].VerifyFlags)
+	}
+}
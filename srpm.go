@@ -0,0 +1,164 @@
+package rpm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nesv/rpm/spec"
+)
+
+/*
+Builds the source package of a spec file evaluated for t, holding the spec
+file itself along with its sources and patches, which are read from sourcedir.
+It returns the path of the package, which is written to
+outdir/NAME-VERSION-RELEASE.src.rpm as rpmbuild does. Only the Compressor of
+opts is used.
+
+Sources and patches listed in the NoSource: and NoPatch: tags are left out of
+the payload, but still named in the header; the package is then called
+NAME-VERSION-RELEASE.nosrc.rpm instead.
+*/
+func BuildSourcePackage(s *spec.SpecFile, t spec.Target, sourcedir, outdir string, opts SpecBuildOptions) (string, error) {
+	es, err := s.Evaluate(t)
+	if err != nil {
+		return "", err
+	}
+	b, nosrc, err := sourceBuilder(s, es, sourcedir)
+	if err != nil {
+		return "", err
+	}
+	b.Compressor = opts.Compressor
+
+	suffix := "src"
+	if nosrc {
+		suffix = "nosrc"
+	}
+	p := b.Package
+	name := filepath.Join(outdir, fmt.Sprintf("%s-%s-%s.%s.rpm", p.Name, p.Version, p.Release, suffix))
+	if err := os.MkdirAll(outdir, 0755); err != nil {
+		return "", err
+	}
+	if err := writeFile(name, b); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+/*
+Returns the Builder of the source package of an evaluated spec file, and
+whether any sources or patches were left out of it.
+*/
+func sourceBuilder(s *spec.SpecFile, es *spec.EvaluatedSpec, sourcedir string) (*Builder, bool, error) {
+	// A source package requires what is needed to build it, and
+	// provides nothing.
+	pkg := *es.Packages[0]
+	pkg.Requires, pkg.Conflicts = es.BuildRequires, es.BuildConflicts
+	pkg.Provides, pkg.Obsoletes = nil, nil
+	pkg.Recommends, pkg.Suggests, pkg.Supplements, pkg.Enhances = nil, nil, nil, nil
+
+	b := NewBuilder(&pkg)
+	b.source = true
+	b.Changelog = es.Changelog
+
+	specName := filepath.Base(s.Filename())
+	if s.Filename() == "" {
+		specName = pkg.Name + ".spec"
+	}
+	b.Files = append(b.Files, BuildFile{Name: specName, Mode: 0644, Flags: FileSpecFile, Data: s.Raw()})
+
+	nosrc := false
+	add := func(tag, noTag Tag, values map[string]string, skip []string) error {
+		var names []string
+		var left []uint32
+		for _, num := range spec.SourceNumbers(values) {
+			name := spec.SourceFileName(values[num])
+			names = append(names, name)
+			if slices.Contains(skip, num) {
+				n, _ := strconv.ParseUint(num, 10, 32)
+				left = append(left, uint32(n))
+				continue
+			}
+
+			p := filepath.Join(sourcedir, name)
+			info, err := os.Stat(p)
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return fmt.Errorf("%s is not a regular file", p)
+			}
+			b.Files = append(b.Files, BuildFile{Name: name, Mode: info.Mode().Perm(), ModTime: info.ModTime(), Path: p})
+		}
+		if len(names) > 0 {
+			b.extra = append(b.extra, Entry{Tag: tag, Type: TypeStringArray, Value: names})
+		}
+		if len(left) > 0 {
+			b.extra = append(b.extra, Entry{Tag: noTag, Type: TypeInt32, Value: left})
+			nosrc = true
+		}
+		return nil
+	}
+	if err := add(TagSource, TagNoSource, es.Sources, es.NoSource); err != nil {
+		return nil, false, err
+	}
+	if err := add(TagPatch, TagNoPatch, es.Patches, es.NoPatch); err != nil {
+		return nil, false, err
+	}
+
+	for _, l := range []struct {
+		tag    Tag
+		values []string
+	}{
+		{TagExclusiveArch, es.ExclusiveArch},
+		{TagExcludeArch, es.ExcludeArch},
+		{TagExclusiveOS, es.ExclusiveOS},
+		{TagExcludeOS, es.ExcludeOS},
+	} {
+		if len(l.values) > 0 {
+			b.extra = append(b.extra, Entry{Tag: l.tag, Type: TypeStringArray, Value: l.values})
+		}
+	}
+	return b, nosrc, nil
+}
+
+/*
+Unpacks a source package into the directory dir, which must exist, and
+returns its spec file, parsed with dir as its source file system. The sources
+and patches end up next to the spec file, as they would in rpmbuild's SOURCES
+directory.
+*/
+func (p *Package) ExtractSource(dir string) (*spec.SpecFile, error) {
+	if !p.Header.IsSource() {
+		return nil, fmt.Errorf("%s is not a source package", p.Header.NEVRA())
+	}
+	files, err := p.Header.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	// The spec file is flagged as such, but older packages may not say.
+	name := ""
+	for _, f := range files {
+		if f.Flags&FileSpecFile != 0 {
+			name = f.Name
+			break
+		}
+	}
+	for _, f := range files {
+		if name == "" && strings.HasSuffix(f.Name, ".spec") {
+			name = f.Name
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no spec file in source package %s", p.Header.NEVRA())
+	}
+
+	if _, err := p.Extract(dir, ExtractOptions{}); err != nil {
+		return nil, err
+	}
+	return spec.ParseFS(os.DirFS(dir), strings.TrimPrefix(name, "/"))
+}
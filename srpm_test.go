@@ -0,0 +1,135 @@
+package rpm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nesv/rpm/spec"
+)
+
+var sourceSpec = `Name: demo
+Version: 1.0
+Release: 1
+Summary: Demo
+License: MIT
+Source0: https://example.com/demo-1.0.tar.gz
+Source1: demo.conf
+Source2: secret.bin
+Patch0: demo-fix.patch
+NoSource: 2
+ExclusiveArch: x86_64 aarch64
+BuildRequires: gcc >= 10
+BuildConflicts: clang
+Requires: bash
+
+%description
+Demo.
+
+%files
+/usr/bin/demo
+`
+
+func TestBuildSourcePackage(t *testing.T) {
+	sourcedir, outdir := t.TempDir(), t.TempDir()
+	writeTree(t, sourcedir, map[string]string{
+		"demo.spec":       sourceSpec,
+		"demo-1.0.tar.gz": "tarball",
+		"demo.conf":       "conf",
+		"demo-fix.patch":  "patch",
+	})
+	s, err := spec.ParseFS(os.DirFS(sourcedir), "demo.spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := BuildSourcePackage(s, spec.Target{Arch: "x86_64"}, sourcedir, outdir, SpecBuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(outdir, "demo-1.0-1.nosrc.rpm"); name != want {
+		t.Errorf("wrong package name; got %q wanted %q", name, want)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := ReadPackage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := p.Header
+	if !h.IsSource() || !p.Lead.IsSource() {
+		t.Errorf("not a source package")
+	}
+
+	files, err := h.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, fmt.Sprintf("%s %x", f.Name, f.Flags))
+	}
+	expected := "[demo-1.0.tar.gz 0 demo-fix.patch 0 demo.conf 0 demo.spec 20]"
+	t.Logf("expecting %q", expected)
+	if fmt.Sprint(got) != expected {
+		t.Errorf("wrong files; got %q wanted %q", fmt.Sprint(got), expected)
+	}
+
+	requires, _ := h.Requires()
+	expected = "[gcc >= 10 rpmlib(CompressedFileNames) <= 3.0.4-1 rpmlib(FileDigests) <= 4.6.0-1]"
+	t.Logf("expecting %q", expected)
+	if got := fmt.Sprint(requires); got != expected {
+		t.Errorf("wrong requires; got %q wanted %q", got, expected)
+	}
+	if provides, _ := h.Provides(); len(provides) != 0 {
+		t.Errorf("unexpected provides; got %v", provides)
+	}
+
+	tests := map[Tag]string{
+		TagSource:        "[demo-1.0.tar.gz demo.conf secret.bin]",
+		TagPatch:         "[demo-fix.patch]",
+		TagExclusiveArch: "[x86_64 aarch64]",
+		TagDirNames:      "[]",
+	}
+	for tag, want := range tests {
+		if got := fmt.Sprint(h.GetStrings(tag)); got != want {
+			t.Errorf("tag %v; got %s wanted %s", tag, got, want)
+		}
+	}
+	if got := fmt.Sprint(h.GetInts(TagNoSource)); got != "[2]" {
+		t.Errorf("wrong nosource; got %s", got)
+	}
+
+	dir := t.TempDir()
+	extracted, err := p.ExtractSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extracted.Filename() != "demo.spec" || string(extracted.Raw()) != sourceSpec {
+		t.Errorf("wrong spec file %q", extracted.Filename())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "demo-fix.patch"))
+	if err != nil || string(data) != "patch" {
+		t.Errorf("patch was not extracted; got %q (%v)", data, err)
+	}
+}
+
+func TestBuildSourcePackageErrors(t *testing.T) {
+	s, err := spec.ParseString(sourceSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildSourcePackage(s, spec.Target{Arch: "x86_64"}, t.TempDir(), t.TempDir(), SpecBuildOptions{}); err == nil {
+		t.Errorf("expected an error for missing sources")
+	}
+
+	p := buildTestPackage(t, testBuilder())
+	if _, err := p.ExtractSource(t.TempDir()); err == nil {
+		t.Errorf("expected an error for a binary package")
+	}
+}
@@ -0,0 +1,66 @@
+package rpm
+
+import (
+	"fmt"
+	"strings"
+)
+
+//go:generate go run gentags.go
+
+/*
+A Tag identifies an entry of a header. The signature header has its own set of
+tags (the SigTag* constants), which partly overlap with the main header's.
+*/
+type Tag int32
+
+// The name and data type of a known tag.
+type tagInfo struct {
+	name string
+	typ  TagType
+}
+
+/*
+Returns the name of the tag as rpm knows it, in example "NAME" for TagName.
+Unknown tags are formatted as "Tag(<number>)". Since the signature header tags
+overlap with the main header's, the name is that of the main header tag.
+*/
+func (t Tag) String() string {
+	if info, ok := tagTable[t]; ok {
+		return info.name
+	}
+	return fmt.Sprintf("Tag(%d)", int32(t))
+}
+
+/*
+Returns the name of the tag as a signature header tag, in example "SIZE" for
+SigTagSize.
+*/
+func (t Tag) SignatureString() string {
+	if info, ok := sigTagTable[t]; ok {
+		return info.name
+	}
+	return t.String()
+}
+
+/*
+Returns the main header tag with the given name (ignoring case, and with or
+without the "RPMTAG_" prefix), and whether there is such a tag.
+*/
+func TagByName(name string) (Tag, bool) {
+	name = strings.TrimPrefix(strings.ToUpper(name), "RPMTAG_")
+	for t, info := range tagTable {
+		if info.name == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+/*
+Returns the data type rpm uses for the given main header tag, and whether the
+tag is known at all.
+*/
+func (t Tag) Type() (TagType, bool) {
+	info, ok := tagTable[t]
+	return info.typ, ok
+}
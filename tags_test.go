@@ -0,0 +1,32 @@
+package rpm
+
+import "testing"
+
+func TestTagNames(t *testing.T) {
+	tests := map[Tag]string{
+		TagName:          "NAME",
+		TagRequireName:   "REQUIRENAME",
+		TagPayloadDigest: "PAYLOADDIGEST",
+		Tag(99999):       "Tag(99999)",
+	}
+	for tag, expected := range tests {
+		t.Logf("expecting %q", expected)
+		if got := tag.String(); got != expected {
+			t.Errorf("Tag(%d).String(); got %q wanted %q", int32(tag), got, expected)
+		}
+	}
+
+	if got := SigTagPayloadSize.SignatureString(); got != "PAYLOADSIZE" {
+		t.Errorf("SignatureString(); got %q wanted %q", got, "PAYLOADSIZE")
+	}
+
+	for _, name := range []string{"basenames", "RPMTAG_BASENAMES"} {
+		if tag, ok := TagByName(name); !ok || tag != TagBaseNames {
+			t.Errorf("TagByName(%q); got %v, %v wanted %v", name, tag, ok, TagBaseNames)
+		}
+	}
+
+	if typ, ok := TagFileModes.Type(); !ok || typ != TypeInt16 {
+		t.Errorf("TagFileModes.Type(); got %v, %v wanted %v", typ, ok, TypeInt16)
+	}
+}
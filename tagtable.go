@@ -0,0 +1,447 @@
+// Code generated by gentags.go from tagtable.txt; DO NOT EDIT.
+
+package rpm
+
+// Main header tags.
+const (
+	TagHeaderImage         Tag = 61
+	TagHeaderSignatures    Tag = 62
+	TagHeaderImmutable     Tag = 63
+	TagHeaderRegions       Tag = 64
+	TagHeaderI18NTable     Tag = 100
+	TagSigSize             Tag = 257
+	TagSigPGP              Tag = 259
+	TagSigMD5              Tag = 261
+	TagSigGPG              Tag = 262
+	TagPubKeys             Tag = 266
+	TagDSAHeader           Tag = 267
+	TagRSAHeader           Tag = 268
+	TagSHA1Header          Tag = 269
+	TagLongSigSize         Tag = 270
+	TagLongArchiveSize     Tag = 271
+	TagSHA256Header        Tag = 273
+	TagSHA3_256Header      Tag = 279
+	TagName                Tag = 1000
+	TagVersion             Tag = 1001
+	TagRelease             Tag = 1002
+	TagEpoch               Tag = 1003
+	TagSummary             Tag = 1004
+	TagDescription         Tag = 1005
+	TagBuildTime           Tag = 1006
+	TagBuildHost           Tag = 1007
+	TagInstallTime         Tag = 1008
+	TagSize                Tag = 1009
+	TagDistribution        Tag = 1010
+	TagVendor              Tag = 1011
+	TagGIF                 Tag = 1012
+	TagXPM                 Tag = 1013
+	TagLicense             Tag = 1014
+	TagPackager            Tag = 1015
+	TagGroup               Tag = 1016
+	TagChangelog           Tag = 1017
+	TagSource              Tag = 1018
+	TagPatch               Tag = 1019
+	TagURL                 Tag = 1020
+	TagOS                  Tag = 1021
+	TagArch                Tag = 1022
+	TagPreIn               Tag = 1023
+	TagPostIn              Tag = 1024
+	TagPreUn               Tag = 1025
+	TagPostUn              Tag = 1026
+	TagOldFilenames        Tag = 1027
+	TagFileSizes           Tag = 1028
+	TagFileStates          Tag = 1029
+	TagFileModes           Tag = 1030
+	TagFileUIDs            Tag = 1031
+	TagFileGIDs            Tag = 1032
+	TagFileRDevs           Tag = 1033
+	TagFileMTimes          Tag = 1034
+	TagFileDigests         Tag = 1035
+	TagFileLinkTos         Tag = 1036
+	TagFileFlags           Tag = 1037
+	TagRoot                Tag = 1038
+	TagFileUserName        Tag = 1039
+	TagFileGroupName       Tag = 1040
+	TagExclude             Tag = 1041
+	TagExclusive           Tag = 1042
+	TagIcon                Tag = 1043
+	TagSourceRPM           Tag = 1044
+	TagFileVerifyFlags     Tag = 1045
+	TagArchiveSize         Tag = 1046
+	TagProvideName         Tag = 1047
+	TagRequireFlags        Tag = 1048
+	TagRequireName         Tag = 1049
+	TagRequireVersion      Tag = 1050
+	TagNoSource            Tag = 1051
+	TagNoPatch             Tag = 1052
+	TagConflictFlags       Tag = 1053
+	TagConflictName        Tag = 1054
+	TagConflictVersion     Tag = 1055
+	TagDefaultPrefix       Tag = 1056
+	TagBuildRoot           Tag = 1057
+	TagInstallPrefix       Tag = 1058
+	TagExcludeArch         Tag = 1059
+	TagExcludeOS           Tag = 1060
+	TagExclusiveArch       Tag = 1061
+	TagExclusiveOS         Tag = 1062
+	TagAutoReqProv         Tag = 1063
+	TagRPMVersion          Tag = 1064
+	TagTriggerScripts      Tag = 1065
+	TagTriggerName         Tag = 1066
+	TagTriggerVersion      Tag = 1067
+	TagTriggerFlags        Tag = 1068
+	TagTriggerIndex        Tag = 1069
+	TagVerifyScript        Tag = 1079
+	TagChangelogTime       Tag = 1080
+	TagChangelogName       Tag = 1081
+	TagChangelogText       Tag = 1082
+	TagBrokenMD5           Tag = 1083
+	TagPreReq              Tag = 1084
+	TagPreInProg           Tag = 1085
+	TagPostInProg          Tag = 1086
+	TagPreUnProg           Tag = 1087
+	TagPostUnProg          Tag = 1088
+	TagBuildArchs          Tag = 1089
+	TagObsoleteName        Tag = 1090
+	TagVerifyScriptProg    Tag = 1091
+	TagTriggerScriptProg   Tag = 1092
+	TagDocDir              Tag = 1093
+	TagCookie              Tag = 1094
+	TagFileDevices         Tag = 1095
+	TagFileInodes          Tag = 1096
+	TagFileLangs           Tag = 1097
+	TagPrefixes            Tag = 1098
+	TagInstPrefixes        Tag = 1099
+	TagSourcePackage       Tag = 1106
+	TagBuildRequires       Tag = 1109
+	TagBuildConflicts      Tag = 1110
+	TagProvideFlags        Tag = 1112
+	TagProvideVersion      Tag = 1113
+	TagObsoleteFlags       Tag = 1114
+	TagObsoleteVersion     Tag = 1115
+	TagDirIndexes          Tag = 1116
+	TagBaseNames           Tag = 1117
+	TagDirNames            Tag = 1118
+	TagOrigDirIndexes      Tag = 1119
+	TagOrigBaseNames       Tag = 1120
+	TagOrigDirNames        Tag = 1121
+	TagOptFlags            Tag = 1122
+	TagDistURL             Tag = 1123
+	TagPayloadFormat       Tag = 1124
+	TagPayloadCompressor   Tag = 1125
+	TagPayloadFlags        Tag = 1126
+	TagInstallColor        Tag = 1127
+	TagInstallTID          Tag = 1128
+	TagRemoveTID           Tag = 1129
+	TagRHNPlatform         Tag = 1131
+	TagPlatform            Tag = 1132
+	TagFileColors          Tag = 1140
+	TagFileClass           Tag = 1141
+	TagClassDict           Tag = 1142
+	TagFileDependsX        Tag = 1143
+	TagFileDependsN        Tag = 1144
+	TagDependsDict         Tag = 1145
+	TagSourcePkgID         Tag = 1146
+	TagPolicies            Tag = 1150
+	TagPreTrans            Tag = 1151
+	TagPostTrans           Tag = 1152
+	TagPreTransProg        Tag = 1153
+	TagPostTransProg       Tag = 1154
+	TagDistTag             Tag = 1155
+	TagDBInstance          Tag = 1195
+	TagNVRA                Tag = 1196
+	TagFilenames           Tag = 5000
+	TagOrigFilenames       Tag = 5007
+	TagLongFileSizes       Tag = 5008
+	TagLongSize            Tag = 5009
+	TagFileCaps            Tag = 5010
+	TagFileDigestAlgo      Tag = 5011
+	TagBugURL              Tag = 5012
+	TagEVR                 Tag = 5013
+	TagNVR                 Tag = 5014
+	TagNEVR                Tag = 5015
+	TagNEVRA               Tag = 5016
+	TagHeaderColor         Tag = 5017
+	TagPreInFlags          Tag = 5020
+	TagPostInFlags         Tag = 5021
+	TagPreUnFlags          Tag = 5022
+	TagPostUnFlags         Tag = 5023
+	TagPreTransFlags       Tag = 5024
+	TagPostTransFlags      Tag = 5025
+	TagVerifyScriptFlags   Tag = 5026
+	TagTriggerScriptFlags  Tag = 5027
+	TagCollections         Tag = 5029
+	TagVCS                 Tag = 5034
+	TagOrderName           Tag = 5035
+	TagOrderVersion        Tag = 5036
+	TagOrderFlags          Tag = 5037
+	TagFileNLinks          Tag = 5045
+	TagRecommendName       Tag = 5046
+	TagRecommendVersion    Tag = 5047
+	TagRecommendFlags      Tag = 5048
+	TagSuggestName         Tag = 5049
+	TagSuggestVersion      Tag = 5050
+	TagSuggestFlags        Tag = 5051
+	TagSupplementName      Tag = 5052
+	TagSupplementVersion   Tag = 5053
+	TagSupplementFlags     Tag = 5054
+	TagEnhanceName         Tag = 5055
+	TagEnhanceVersion      Tag = 5056
+	TagEnhanceFlags        Tag = 5057
+	TagEncoding            Tag = 5062
+	TagFileSignatures      Tag = 5090
+	TagFileSignatureLength Tag = 5091
+	TagPayloadDigest       Tag = 5092
+	TagPayloadDigestAlgo   Tag = 5093
+	TagModularityLabel     Tag = 5096
+	TagPayloadDigestAlt    Tag = 5097
+	TagSpec                Tag = 5099
+)
+
+// Signature header tags.
+const (
+	SigTagSize                Tag = 1000
+	SigTagLEMD5_1             Tag = 1001
+	SigTagPGP                 Tag = 1002
+	SigTagLEMD5_2             Tag = 1003
+	SigTagMD5                 Tag = 1004
+	SigTagGPG                 Tag = 1005
+	SigTagPGP5                Tag = 1006
+	SigTagPayloadSize         Tag = 1007
+	SigTagReservedSpace       Tag = 1008
+	SigTagBadSHA1_1           Tag = 264
+	SigTagBadSHA1_2           Tag = 265
+	SigTagDSA                 Tag = 267
+	SigTagRSA                 Tag = 268
+	SigTagSHA1                Tag = 269
+	SigTagLongSize            Tag = 270
+	SigTagLongArchiveSize     Tag = 271
+	SigTagSHA256              Tag = 273
+	SigTagFileSignatures      Tag = 274
+	SigTagFileSignatureLength Tag = 275
+	SigTagVeritySignatures    Tag = 276
+	SigTagVeritySignatureAlgo Tag = 277
+	SigTagOpenPGP             Tag = 278
+	SigTagSHA3_256            Tag = 279
+)
+
+var tagTable = map[Tag]tagInfo{
+	TagHeaderImage:         {"HEADERIMAGE", TypeBin},
+	TagHeaderSignatures:    {"HEADERSIGNATURES", TypeBin},
+	TagHeaderImmutable:     {"HEADERIMMUTABLE", TypeBin},
+	TagHeaderRegions:       {"HEADERREGIONS", TypeBin},
+	TagHeaderI18NTable:     {"HEADERI18NTABLE", TypeStringArray},
+	TagSigSize:             {"SIGSIZE", TypeInt32},
+	TagSigPGP:              {"SIGPGP", TypeBin},
+	TagSigMD5:              {"SIGMD5", TypeBin},
+	TagSigGPG:              {"SIGGPG", TypeBin},
+	TagPubKeys:             {"PUBKEYS", TypeStringArray},
+	TagDSAHeader:           {"DSAHEADER", TypeBin},
+	TagRSAHeader:           {"RSAHEADER", TypeBin},
+	TagSHA1Header:          {"SHA1HEADER", TypeString},
+	TagLongSigSize:         {"LONGSIGSIZE", TypeInt64},
+	TagLongArchiveSize:     {"LONGARCHIVESIZE", TypeInt64},
+	TagSHA256Header:        {"SHA256HEADER", TypeString},
+	TagSHA3_256Header:      {"SHA3_256HEADER", TypeString},
+	TagName:                {"NAME", TypeString},
+	TagVersion:             {"VERSION", TypeString},
+	TagRelease:             {"RELEASE", TypeString},
+	TagEpoch:               {"EPOCH", TypeInt32},
+	TagSummary:             {"SUMMARY", TypeI18NString},
+	TagDescription:         {"DESCRIPTION", TypeI18NString},
+	TagBuildTime:           {"BUILDTIME", TypeInt32},
+	TagBuildHost:           {"BUILDHOST", TypeString},
+	TagInstallTime:         {"INSTALLTIME", TypeInt32},
+	TagSize:                {"SIZE", TypeInt32},
+	TagDistribution:        {"DISTRIBUTION", TypeString},
+	TagVendor:              {"VENDOR", TypeString},
+	TagGIF:                 {"GIF", TypeBin},
+	TagXPM:                 {"XPM", TypeBin},
+	TagLicense:             {"LICENSE", TypeString},
+	TagPackager:            {"PACKAGER", TypeString},
+	TagGroup:               {"GROUP", TypeI18NString},
+	TagChangelog:           {"CHANGELOG", TypeStringArray},
+	TagSource:              {"SOURCE", TypeStringArray},
+	TagPatch:               {"PATCH", TypeStringArray},
+	TagURL:                 {"URL", TypeString},
+	TagOS:                  {"OS", TypeString},
+	TagArch:                {"ARCH", TypeString},
+	TagPreIn:               {"PREIN", TypeString},
+	TagPostIn:              {"POSTIN", TypeString},
+	TagPreUn:               {"PREUN", TypeString},
+	TagPostUn:              {"POSTUN", TypeString},
+	TagOldFilenames:        {"OLDFILENAMES", TypeStringArray},
+	TagFileSizes:           {"FILESIZES", TypeInt32},
+	TagFileStates:          {"FILESTATES", TypeChar},
+	TagFileModes:           {"FILEMODES", TypeInt16},
+	TagFileUIDs:            {"FILEUIDS", TypeInt32},
+	TagFileGIDs:            {"FILEGIDS", TypeInt32},
+	TagFileRDevs:           {"FILERDEVS", TypeInt16},
+	TagFileMTimes:          {"FILEMTIMES", TypeInt32},
+	TagFileDigests:         {"FILEDIGESTS", TypeStringArray},
+	TagFileLinkTos:         {"FILELINKTOS", TypeStringArray},
+	TagFileFlags:           {"FILEFLAGS", TypeInt32},
+	TagRoot:                {"ROOT", TypeString},
+	TagFileUserName:        {"FILEUSERNAME", TypeStringArray},
+	TagFileGroupName:       {"FILEGROUPNAME", TypeStringArray},
+	TagExclude:             {"EXCLUDE", TypeStringArray},
+	TagExclusive:           {"EXCLUSIVE", TypeStringArray},
+	TagIcon:                {"ICON", TypeBin},
+	TagSourceRPM:           {"SOURCERPM", TypeString},
+	TagFileVerifyFlags:     {"FILEVERIFYFLAGS", TypeInt32},
+	TagArchiveSize:         {"ARCHIVESIZE", TypeInt32},
+	TagProvideName:         {"PROVIDENAME", TypeStringArray},
+	TagRequireFlags:        {"REQUIREFLAGS", TypeInt32},
+	TagRequireName:         {"REQUIRENAME", TypeStringArray},
+	TagRequireVersion:      {"REQUIREVERSION", TypeStringArray},
+	TagNoSource:            {"NOSOURCE", TypeInt32},
+	TagNoPatch:             {"NOPATCH", TypeInt32},
+	TagConflictFlags:       {"CONFLICTFLAGS", TypeInt32},
+	TagConflictName:        {"CONFLICTNAME", TypeStringArray},
+	TagConflictVersion:     {"CONFLICTVERSION", TypeStringArray},
+	TagDefaultPrefix:       {"DEFAULTPREFIX", TypeString},
+	TagBuildRoot:           {"BUILDROOT", TypeString},
+	TagInstallPrefix:       {"INSTALLPREFIX", TypeString},
+	TagExcludeArch:         {"EXCLUDEARCH", TypeStringArray},
+	TagExcludeOS:           {"EXCLUDEOS", TypeStringArray},
+	TagExclusiveArch:       {"EXCLUSIVEARCH", TypeStringArray},
+	TagExclusiveOS:         {"EXCLUSIVEOS", TypeStringArray},
+	TagAutoReqProv:         {"AUTOREQPROV", TypeString},
+	TagRPMVersion:          {"RPMVERSION", TypeString},
+	TagTriggerScripts:      {"TRIGGERSCRIPTS", TypeStringArray},
+	TagTriggerName:         {"TRIGGERNAME", TypeStringArray},
+	TagTriggerVersion:      {"TRIGGERVERSION", TypeStringArray},
+	TagTriggerFlags:        {"TRIGGERFLAGS", TypeInt32},
+	TagTriggerIndex:        {"TRIGGERINDEX", TypeInt32},
+	TagVerifyScript:        {"VERIFYSCRIPT", TypeString},
+	TagChangelogTime:       {"CHANGELOGTIME", TypeInt32},
+	TagChangelogName:       {"CHANGELOGNAME", TypeStringArray},
+	TagChangelogText:       {"CHANGELOGTEXT", TypeStringArray},
+	TagBrokenMD5:           {"BROKENMD5", TypeInt32},
+	TagPreReq:              {"PREREQ", TypeInt32},
+	TagPreInProg:           {"PREINPROG", TypeStringArray},
+	TagPostInProg:          {"POSTINPROG", TypeStringArray},
+	TagPreUnProg:           {"PREUNPROG", TypeStringArray},
+	TagPostUnProg:          {"POSTUNPROG", TypeStringArray},
+	TagBuildArchs:          {"BUILDARCHS", TypeStringArray},
+	TagObsoleteName:        {"OBSOLETENAME", TypeStringArray},
+	TagVerifyScriptProg:    {"VERIFYSCRIPTPROG", TypeStringArray},
+	TagTriggerScriptProg:   {"TRIGGERSCRIPTPROG", TypeStringArray},
+	TagDocDir:              {"DOCDIR", TypeString},
+	TagCookie:              {"COOKIE", TypeString},
+	TagFileDevices:         {"FILEDEVICES", TypeInt32},
+	TagFileInodes:          {"FILEINODES", TypeInt32},
+	TagFileLangs:           {"FILELANGS", TypeStringArray},
+	TagPrefixes:            {"PREFIXES", TypeStringArray},
+	TagInstPrefixes:        {"INSTPREFIXES", TypeStringArray},
+	TagSourcePackage:       {"SOURCEPACKAGE", TypeInt32},
+	TagBuildRequires:       {"BUILDREQUIRES", TypeStringArray},
+	TagBuildConflicts:      {"BUILDCONFLICTS", TypeStringArray},
+	TagProvideFlags:        {"PROVIDEFLAGS", TypeInt32},
+	TagProvideVersion:      {"PROVIDEVERSION", TypeStringArray},
+	TagObsoleteFlags:       {"OBSOLETEFLAGS", TypeInt32},
+	TagObsoleteVersion:     {"OBSOLETEVERSION", TypeStringArray},
+	TagDirIndexes:          {"DIRINDEXES", TypeInt32},
+	TagBaseNames:           {"BASENAMES", TypeStringArray},
+	TagDirNames:            {"DIRNAMES", TypeStringArray},
+	TagOrigDirIndexes:      {"ORIGDIRINDEXES", TypeInt32},
+	TagOrigBaseNames:       {"ORIGBASENAMES", TypeStringArray},
+	TagOrigDirNames:        {"ORIGDIRNAMES", TypeStringArray},
+	TagOptFlags:            {"OPTFLAGS", TypeString},
+	TagDistURL:             {"DISTURL", TypeString},
+	TagPayloadFormat:       {"PAYLOADFORMAT", TypeString},
+	TagPayloadCompressor:   {"PAYLOADCOMPRESSOR", TypeString},
+	TagPayloadFlags:        {"PAYLOADFLAGS", TypeString},
+	TagInstallColor:        {"INSTALLCOLOR", TypeInt32},
+	TagInstallTID:          {"INSTALLTID", TypeInt32},
+	TagRemoveTID:           {"REMOVETID", TypeInt32},
+	TagRHNPlatform:         {"RHNPLATFORM", TypeString},
+	TagPlatform:            {"PLATFORM", TypeString},
+	TagFileColors:          {"FILECOLORS", TypeInt32},
+	TagFileClass:           {"FILECLASS", TypeInt32},
+	TagClassDict:           {"CLASSDICT", TypeStringArray},
+	TagFileDependsX:        {"FILEDEPENDSX", TypeInt32},
+	TagFileDependsN:        {"FILEDEPENDSN", TypeInt32},
+	TagDependsDict:         {"DEPENDSDICT", TypeInt32},
+	TagSourcePkgID:         {"SOURCEPKGID", TypeBin},
+	TagPolicies:            {"POLICIES", TypeStringArray},
+	TagPreTrans:            {"PRETRANS", TypeString},
+	TagPostTrans:           {"POSTTRANS", TypeString},
+	TagPreTransProg:        {"PRETRANSPROG", TypeStringArray},
+	TagPostTransProg:       {"POSTTRANSPROG", TypeStringArray},
+	TagDistTag:             {"DISTTAG", TypeString},
+	TagDBInstance:          {"DBINSTANCE", TypeInt32},
+	TagNVRA:                {"NVRA", TypeString},
+	TagFilenames:           {"FILENAMES", TypeStringArray},
+	TagOrigFilenames:       {"ORIGFILENAMES", TypeStringArray},
+	TagLongFileSizes:       {"LONGFILESIZES", TypeInt64},
+	TagLongSize:            {"LONGSIZE", TypeInt64},
+	TagFileCaps:            {"FILECAPS", TypeStringArray},
+	TagFileDigestAlgo:      {"FILEDIGESTALGO", TypeInt32},
+	TagBugURL:              {"BUGURL", TypeString},
+	TagEVR:                 {"EVR", TypeString},
+	TagNVR:                 {"NVR", TypeString},
+	TagNEVR:                {"NEVR", TypeString},
+	TagNEVRA:               {"NEVRA", TypeString},
+	TagHeaderColor:         {"HEADERCOLOR", TypeInt32},
+	TagPreInFlags:          {"PREINFLAGS", TypeInt32},
+	TagPostInFlags:         {"POSTINFLAGS", TypeInt32},
+	TagPreUnFlags:          {"PREUNFLAGS", TypeInt32},
+	TagPostUnFlags:         {"POSTUNFLAGS", TypeInt32},
+	TagPreTransFlags:       {"PRETRANSFLAGS", TypeInt32},
+	TagPostTransFlags:      {"POSTTRANSFLAGS", TypeInt32},
+	TagVerifyScriptFlags:   {"VERIFYSCRIPTFLAGS", TypeInt32},
+	TagTriggerScriptFlags:  {"TRIGGERSCRIPTFLAGS", TypeInt32},
+	TagCollections:         {"COLLECTIONS", TypeStringArray},
+	TagVCS:                 {"VCS", TypeString},
+	TagOrderName:           {"ORDERNAME", TypeStringArray},
+	TagOrderVersion:        {"ORDERVERSION", TypeStringArray},
+	TagOrderFlags:          {"ORDERFLAGS", TypeInt32},
+	TagFileNLinks:          {"FILENLINKS", TypeInt32},
+	TagRecommendName:       {"RECOMMENDNAME", TypeStringArray},
+	TagRecommendVersion:    {"RECOMMENDVERSION", TypeStringArray},
+	TagRecommendFlags:      {"RECOMMENDFLAGS", TypeInt32},
+	TagSuggestName:         {"SUGGESTNAME", TypeStringArray},
+	TagSuggestVersion:      {"SUGGESTVERSION", TypeStringArray},
+	TagSuggestFlags:        {"SUGGESTFLAGS", TypeInt32},
+	TagSupplementName:      {"SUPPLEMENTNAME", TypeStringArray},
+	TagSupplementVersion:   {"SUPPLEMENTVERSION", TypeStringArray},
+	TagSupplementFlags:     {"SUPPLEMENTFLAGS", TypeInt32},
+	TagEnhanceName:         {"ENHANCENAME", TypeStringArray},
+	TagEnhanceVersion:      {"ENHANCEVERSION", TypeStringArray},
+	TagEnhanceFlags:        {"ENHANCEFLAGS", TypeInt32},
+	TagEncoding:            {"ENCODING", TypeString},
+	TagFileSignatures:      {"FILESIGNATURES", TypeStringArray},
+	TagFileSignatureLength: {"FILESIGNATURELENGTH", TypeInt32},
+	TagPayloadDigest:       {"PAYLOADDIGEST", TypeStringArray},
+	TagPayloadDigestAlgo:   {"PAYLOADDIGESTALGO", TypeInt32},
+	TagModularityLabel:     {"MODULARITYLABEL", TypeString},
+	TagPayloadDigestAlt:    {"PAYLOADDIGESTALT", TypeStringArray},
+	TagSpec:                {"SPEC", TypeString},
+}
+
+var sigTagTable = map[Tag]tagInfo{
+	SigTagSize:                {"SIZE", TypeInt32},
+	SigTagLEMD5_1:             {"LEMD5_1", TypeBin},
+	SigTagPGP:                 {"PGP", TypeBin},
+	SigTagLEMD5_2:             {"LEMD5_2", TypeBin},
+	SigTagMD5:                 {"MD5", TypeBin},
+	SigTagGPG:                 {"GPG", TypeBin},
+	SigTagPGP5:                {"PGP5", TypeBin},
+	SigTagPayloadSize:         {"PAYLOADSIZE", TypeInt32},
+	SigTagReservedSpace:       {"RESERVEDSPACE", TypeBin},
+	SigTagBadSHA1_1:           {"BADSHA1_1", TypeBin},
+	SigTagBadSHA1_2:           {"BADSHA1_2", TypeBin},
+	SigTagDSA:                 {"DSA", TypeBin},
+	SigTagRSA:                 {"RSA", TypeBin},
+	SigTagSHA1:                {"SHA1", TypeString},
+	SigTagLongSize:            {"LONGSIZE", TypeInt64},
+	SigTagLongArchiveSize:     {"LONGARCHIVESIZE", TypeInt64},
+	SigTagSHA256:              {"SHA256", TypeString},
+	SigTagFileSignatures:      {"FILESIGNATURES", TypeStringArray},
+	SigTagFileSignatureLength: {"FILESIGNATURELENGTH", TypeInt32},
+	SigTagVeritySignatures:    {"VERITYSIGNATURES", TypeStringArray},
+	SigTagVeritySignatureAlgo: {"VERITYSIGNATUREALGO", TypeInt32},
+	SigTagOpenPGP:             {"OPENPGP", TypeStringArray},
+	SigTagSHA3_256:            {"SHA3_256", TypeString},
+}
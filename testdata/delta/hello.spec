@@ -0,0 +1,20 @@
+Name: hello
+Version: %{ver}
+Release: 1
+Summary: Says hello
+License: MIT
+BuildArch: noarch
+
+%description
+Says hello, for the delta tests.
+
+%install
+mkdir -p %{buildroot}/usr/bin %{buildroot}/usr/share/hello
+printf '#!/bin/sh\necho hello %{version}\n' > %{buildroot}/usr/bin/hello
+chmod 0755 %{buildroot}/usr/bin/hello
+seq 1 2000 > %{buildroot}/usr/share/hello/numbers
+echo %{version} >> %{buildroot}/usr/share/hello/numbers
+
+%files
+/usr/bin/hello
+/usr/share/hello